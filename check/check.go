@@ -1,20 +1,54 @@
 package check
 
 import (
+	"encoding/json"
+	"fmt"
 	"genspark2api/common"
+	"genspark2api/common/abuse"
+	"genspark2api/common/autoroute"
 	"genspark2api/common/config"
+	"genspark2api/common/egress"
+	"genspark2api/common/env"
+	"genspark2api/common/events"
+	"genspark2api/common/fingerprint"
+	"genspark2api/common/guard"
+	"genspark2api/common/imageintent"
+	"genspark2api/common/imagemeta"
+	"genspark2api/common/linkrewrite"
 	logger "genspark2api/common/loggger"
+	"genspark2api/common/metrics"
+	"genspark2api/common/recaptcha"
+	"genspark2api/common/storage"
+	"genspark2api/common/uploadcache"
+	"genspark2api/model"
 	"github.com/samber/lo"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 func CheckEnvVariable() {
 	logger.SysLog("environment variable checking...")
 
+	errs, warnings := env.ValidateConfigFile()
+	for _, warning := range warnings {
+		logger.SysError("配置文件可能有误: " + warning)
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			logger.SysError("配置文件有误: " + err.Error())
+		}
+		logger.FatalLog(fmt.Sprintf("配置文件 %s 校验失败,共 %d 处错误", env.ConfigFile, len(errs)))
+	}
+
 	if config.GSCookie == "" {
 		logger.FatalLog("环境变量 GS_COOKIE 未设置")
 	}
+	for i, cookie := range strings.Split(config.GSCookie, ",") {
+		if _, _, err := config.ParseTaggedCookie(cookie); err != nil {
+			logger.FatalLog(fmt.Sprintf("环境变量 GS_COOKIE 中第 %d 条 cookie 有误: %v", i+1, err))
+		}
+	}
 	if config.YesCaptchaClientKey == "" {
 		//logger.SysLog("环境变量 YES_CAPTCHA_CLIENT_KEY 未设置，将无法使用 YesCaptcha 过谷歌验证，导致无法调用文生图模型 \n ClientKey获取地址：https://yescaptcha.com/i/021iAE")
 	}
@@ -64,5 +98,230 @@ func CheckEnvVariable() {
 		//logger.SysLog("环境变量 SESSION_IMAGE_CHAT_MAP 未设置，生图可能会异常")
 	}
 
+	if config.ModelPriceMapStr != "" {
+		modelPriceMap := make(map[string]config.ModelPrice)
+		for _, pair := range strings.Split(config.ModelPriceMapStr, ",") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				logger.FatalLog("环境变量 MODEL_PRICE_MAP 设置有误")
+			}
+			prices := strings.Split(kv[1], ":")
+			if len(prices) != 2 {
+				logger.FatalLog("环境变量 MODEL_PRICE_MAP 中 " + kv[0] + " 价格格式有误,应为 输入价格:输出价格")
+			}
+			input, err := strconv.ParseFloat(prices[0], 64)
+			if err != nil {
+				logger.FatalLog("环境变量 MODEL_PRICE_MAP 中 " + kv[0] + " 输入价格有误")
+			}
+			output, err := strconv.ParseFloat(prices[1], 64)
+			if err != nil {
+				logger.FatalLog("环境变量 MODEL_PRICE_MAP 中 " + kv[0] + " 输出价格有误")
+			}
+			modelPriceMap[kv[0]] = config.ModelPrice{Input: input, Output: output}
+		}
+		config.ModelPriceMap = modelPriceMap
+	}
+
+	if config.ModelCookieTagsStr != "" {
+		modelCookieTags, err := config.ParseModelCookieTags(config.ModelCookieTagsStr)
+		if err != nil {
+			logger.FatalLog("环境变量 MODEL_COOKIE_TAGS 设置有误: " + err.Error())
+		}
+		config.ModelCookieTags = modelCookieTags
+	}
+	if config.ReasoningExcludeExtraDataStr != "" {
+		if err := json.Unmarshal([]byte(config.ReasoningExcludeExtraDataStr), &config.ReasoningExcludeExtraData); err != nil {
+			logger.FatalLog("环境变量 REASONING_EXCLUDE_EXTRA_DATA 须为 JSON 对象: " + err.Error())
+		}
+	}
+	if config.ModelTierFallbackStr != "" {
+		modelTierFallback, err := config.ParseModelTierFallback(config.ModelTierFallbackStr)
+		if err != nil {
+			logger.FatalLog("环境变量 MODEL_TIER_FALLBACK 设置有误: " + err.Error())
+		}
+		config.ModelTierFallback = modelTierFallback
+	}
+
+	if err := config.ParseAgentTypeMap(config.AgentTypeMapStr); err != nil {
+		logger.FatalLog("环境变量 AGENT_TYPE_MAP 设置有误: " + err.Error())
+	}
+
+	if err := config.ParseOidcRoleMap(); err != nil {
+		logger.FatalLog("OIDC 环境变量设置有误: " + err.Error())
+	}
+
+	if config.TenantsPath != "" {
+		if err := config.LoadTenants(); err != nil {
+			logger.FatalLog("环境变量 TENANTS_PATH 对应的租户配置文件有误: " + err.Error())
+		}
+		logger.SysLog(fmt.Sprintf("multi-tenant mode enabled, %d tenants loaded.", len(config.GetTenants())))
+	}
+
+	if config.ProxyUrl != "" {
+		proxyUrl, err := config.NormalizeProxyUrl(config.ProxyUrl)
+		if err != nil {
+			logger.FatalLog("环境变量 PROXY_URL 有误: " + err.Error())
+		}
+		config.ProxyUrl = proxyUrl
+	}
+	if err := egress.Init(); err != nil {
+		logger.FatalLog("环境变量 PROXY_NODES 有误: " + err.Error())
+	}
+
+	if config.ContentGuardWordsStr != "" {
+		for _, word := range strings.Split(config.ContentGuardWordsStr, ",") {
+			if word = strings.TrimSpace(word); word != "" {
+				config.ContentGuardWords = append(config.ContentGuardWords, word)
+			}
+		}
+	}
+	if config.ContentGuardAction != guard.ActionBlock && config.ContentGuardAction != guard.ActionMask {
+		logger.FatalLog("环境变量 CONTENT_GUARD_ACTION 仅支持 block 或 mask")
+	}
+	if config.GetCorsConfig().CredentialsWithWildcard() {
+		logger.FatalLog("环境变量 CORS_ALLOW_CREDENTIALS=1 时 CORS_ALLOW_ORIGINS 须为明确的来源列表,不能包含 *")
+	}
+	if config.AbuseChallengeDifficulty < 1 || config.AbuseChallengeDifficulty > 24 {
+		logger.FatalLog("环境变量 ABUSE_CHALLENGE_DIFFICULTY 须在 1 到 24 之间")
+	}
+	if err := abuse.Init(); err != nil {
+		logger.FatalLog("防滥用配置有误: " + err.Error())
+	}
+	if config.ContentGuardStreamWindow < 0 {
+		logger.FatalLog("环境变量 CONTENT_GUARD_STREAM_WINDOW 不能为负数")
+	}
+	if err := guard.Init(); err != nil {
+		logger.FatalLog("环境变量 CONTENT_GUARD_PATTERN 正则有误: " + err.Error())
+	}
+
+	if config.ModelSystemPromptMapStr != "" {
+		var modelSystemPrompts map[string]string
+		if err := json.Unmarshal([]byte(config.ModelSystemPromptMapStr), &modelSystemPrompts); err != nil {
+			logger.FatalLog("环境变量 MODEL_SYSTEM_PROMPT_MAP 须为 JSON 对象: " + err.Error())
+		}
+		runtimeConfig := config.GetRuntimeConfig()
+		runtimeConfig.ModelSystemPrompts = modelSystemPrompts
+		config.SetRuntimeConfig(runtimeConfig)
+	}
+
+	if config.SystemMessageMaxCount < 0 || config.SystemMessageMaxLength < 0 {
+		logger.FatalLog("环境变量 SYSTEM_MESSAGE_MAX_COUNT 与 SYSTEM_MESSAGE_MAX_LENGTH 不能为负数")
+	}
+	if !lo.Contains([]string{model.SystemOverflowTruncate, model.SystemOverflowHeadTail}, config.SystemMessageOverflow) {
+		logger.FatalLog("环境变量 SYSTEM_MESSAGE_OVERFLOW 仅支持 truncate 或 head_tail")
+	}
+
+	if config.ModelOutputLimitMapStr != "" {
+		var modelOutputLimits map[string]config.OutputLimit
+		if err := json.Unmarshal([]byte(config.ModelOutputLimitMapStr), &modelOutputLimits); err != nil {
+			logger.FatalLog("环境变量 MODEL_OUTPUT_LIMIT_MAP 须为 JSON 对象: " + err.Error())
+		}
+		runtimeConfig := config.GetRuntimeConfig()
+		runtimeConfig.ModelOutputLimits = modelOutputLimits
+		config.SetRuntimeConfig(runtimeConfig)
+	}
+
+	if err := config.GetRuntimeConfig().Validate(); err != nil {
+		logger.FatalLog("上游超时与重试配置有误: " + err.Error())
+	}
+
+	if config.ErrorLanguage != "" && !lo.Contains([]string{"zh", "en"}, config.ErrorLanguage) {
+		logger.FatalLog("环境变量 ERROR_LANGUAGE 仅支持 zh 或 en")
+	}
+
+	if !lo.Contains([]string{"none", "api_key", "user"}, config.SessionNamespace) {
+		logger.FatalLog("环境变量 SESSION_NAMESPACE 仅支持 none、api_key 或 user")
+	}
+	if !lo.Contains([]string{"all", "sample", "edge"}, config.DebugChunkLogMode) {
+		logger.FatalLog("环境变量 DEBUG_CHUNK_LOG_MODE 仅支持 all、sample 或 edge")
+	}
+	if config.DebugChunkLogSampleRate <= 0 {
+		logger.FatalLog("环境变量 DEBUG_CHUNK_LOG_SAMPLE_RATE 须大于 0")
+	}
+
+	if !lo.Contains([]string{"hide", "markdown", "json"}, config.MixtureLayerOutput) {
+		logger.FatalLog("环境变量 MIXTURE_LAYER_OUTPUT 仅支持 hide、markdown 或 json")
+	}
+	if !lo.Contains([]string{"text", "mermaid", "json", "hide"}, config.MarkmapOutput) {
+		logger.FatalLog("环境变量 MARKMAP_OUTPUT 仅支持 text、mermaid、json 或 hide")
+	}
+
+	if config.LinkRewriteMode != linkrewrite.ModeOff && config.LinkRewriteMode != linkrewrite.ModeStrip && config.LinkRewriteMode != linkrewrite.ModeReplace {
+		logger.FatalLog("环境变量 LINK_REWRITE_MODE 仅支持 off、strip 或 replace")
+	}
+	if config.LinkRewriteMode == linkrewrite.ModeReplace && config.LinkRewriteBaseUrl == "" {
+		logger.FatalLog("环境变量 LINK_REWRITE_MODE 为 replace 时需配置 LINK_REWRITE_BASE_URL")
+	}
+	if err := linkrewrite.Init(); err != nil {
+		logger.FatalLog("内链重写规则有误: " + err.Error())
+	}
+
+	if err := imagemeta.Init(); err != nil {
+		logger.FatalLog("图片水印配置有误: " + err.Error())
+	}
+
+	if err := storage.Init(); err != nil {
+		logger.FatalLog("S3 存储配置有误: " + err.Error())
+	}
+
+	if err := uploadcache.Init(); err != nil {
+		logger.FatalLog("环境变量 UPLOAD_CACHE_REDIS_URL 有误: " + err.Error())
+	}
+
+	if config.ShadowParserRate < 0 || config.ShadowParserRate > 100 {
+		logger.FatalLog("环境变量 SHADOW_PARSER_RATE 须在 0 到 100 之间")
+	}
+
+	if config.MetricsFlushInterval <= 0 {
+		logger.FatalLog("环境变量 METRICS_FLUSH_INTERVAL 须大于 0")
+	}
+	if err := metrics.Init(); err != nil {
+		logger.FatalLog("环境变量 METRICS_PATH 对应的用量汇总文件有误: " + err.Error())
+	}
+
+	if err := autoroute.Init(); err != nil {
+		logger.FatalLog("环境变量 AUTO_MODEL_RULES 或 AUTO_MODEL_*_PATTERN 设置有误: " + err.Error())
+	}
+
+	if err := imageintent.Init(); err != nil {
+		logger.FatalLog("环境变量 CHAT_IMAGE_INTENT_PATTERN 有误: " + err.Error())
+	}
+
+	if config.OverloadMemoryMB < 0 || config.OverloadGoroutines < 0 {
+		logger.FatalLog("环境变量 OVERLOAD_MEMORY_MB、OVERLOAD_GOROUTINES 不能为负数")
+	}
+	if config.ShutdownTimeout < 0 {
+		logger.FatalLog("环境变量 SHUTDOWN_TIMEOUT 不能小于 0")
+	}
+	if config.OverloadCheckInterval <= 0 {
+		logger.FatalLog("环境变量 OVERLOAD_CHECK_INTERVAL 须大于 0")
+	}
+	if config.OverloadRecoverPercent <= 0 || config.OverloadRecoverPercent > 100 {
+		logger.FatalLog("环境变量 OVERLOAD_RECOVER_PERCENT 须在 1 到 100 之间")
+	}
+
+	if err := recaptcha.Init(); err != nil {
+		logger.FatalLog("环境变量 RECAPTCHA_PROXY_URL 有误: " + err.Error())
+	}
+
+	if err := events.Init(); err != nil {
+		logger.FatalLog("环境变量 EVENT_WEBHOOK_URL/EVENT_WEBHOOK_EVENTS/EVENT_PLUGINS 有误: " + err.Error())
+	}
+
+	if config.FieldMapReloadInterval < 0 {
+		logger.FatalLog("环境变量 FIELD_MAP_RELOAD_INTERVAL 不能为负数")
+	}
+	if config.FieldMapPath != "" {
+		if _, err := config.LoadFieldMap(); err != nil {
+			logger.FatalLog("环境变量 FIELD_MAP_PATH 对应的字段映射文件有误: " + err.Error())
+		}
+	}
+	if config.FingerprintRulesReloadInterval < 0 {
+		logger.FatalLog("环境变量 FINGERPRINT_RULES_RELOAD_INTERVAL 不能为负数")
+	}
+	if err := fingerprint.Init(); err != nil {
+		logger.FatalLog("环境变量 FINGERPRINT_RULES_PATH 对应的指纹规则文件有误: " + err.Error())
+	}
+
 	logger.SysLog("environment variable check passed.")
 }
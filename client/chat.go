@@ -0,0 +1,126 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"genspark2api/model"
+	"net/http"
+	"strings"
+)
+
+// CreateChatCompletion 非流式对话,忽略请求中的 Stream 字段
+func (c *Client) CreateChatCompletion(ctx context.Context, req model.OpenAIChatCompletionRequest) (*model.OpenAIChatCompletionResponse, error) {
+	req.Stream = false
+	var response model.OpenAIChatCompletionResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/chat/completions", req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CreateChatCompletionStream 流式对话,返回的迭代器用完后需调用 Close
+//
+//	stream, err := cli.CreateChatCompletionStream(ctx, req)
+//	if err != nil { ... }
+//	defer stream.Close()
+//	for stream.Next() {
+//		chunk := stream.Current()
+//	}
+//	if err := stream.Err(); err != nil { ... }
+func (c *Client) CreateChatCompletionStream(ctx context.Context, req model.OpenAIChatCompletionRequest) (*ChatCompletionStream, error) {
+	req.Stream = true
+	httpReq, err := c.newRequest(ctx, http.MethodPost, "/v1/chat/completions", req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// 非事件流响应视为错误
+		defer resp.Body.Close()
+		return nil, newAPIError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &ChatCompletionStream{body: resp.Body, scanner: scanner, Header: resp.Header}, nil
+}
+
+// ChatCompletionStream 流式对话迭代器
+type ChatCompletionStream struct {
+	Header  http.Header // 响应头(X-Upstream-Model、X-Upstream-Attempts 等)
+	body    interface{ Close() error }
+	scanner *bufio.Scanner
+	current model.OpenAIChatCompletionResponse
+	done    bool
+	err     error
+}
+
+// Next 读取下一个响应块,结束或出错时返回 false,通过 Err 区分
+func (s *ChatCompletionStream) Next() bool {
+	if s.done || s.err != nil {
+		return false
+	}
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			s.done = true
+			return false
+		}
+		if data == "" {
+			continue
+		}
+
+		var chunk model.OpenAIChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			s.err = fmt.Errorf("decode stream chunk: %w", err)
+			return false
+		}
+		// 流式输出过程中的错误以 {"error":...} 块下发
+		if len(chunk.Choices) == 0 && chunk.ID == "" {
+			var payload struct {
+				Error json.RawMessage `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &payload) == nil && len(payload.Error) > 0 {
+				s.err = &APIError{StatusCode: http.StatusOK, Message: strings.Trim(string(payload.Error), `"`), Body: []byte(data)}
+				return false
+			}
+		}
+		s.current = chunk
+		return true
+	}
+	if err := s.scanner.Err(); err != nil {
+		s.err = err
+	} else {
+		s.err = ErrStreamInterrupted
+	}
+	return false
+}
+
+// Current 当前响应块
+func (s *ChatCompletionStream) Current() model.OpenAIChatCompletionResponse {
+	return s.current
+}
+
+// Err 迭代结束后的错误,正常收到 [DONE] 时为 nil
+func (s *ChatCompletionStream) Err() error {
+	return s.err
+}
+
+// Close 关闭响应体
+func (s *ChatCompletionStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,112 @@
+// Package client 封装 genspark2api 的 OpenAI 兼容接口,便于其它 Go 服务直接调用
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"genspark2api/model"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client genspark2api 客户端,可在多个 goroutine 中并发使用
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	headers    map[string]string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义的 http.Client(如设置代理、超时)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHeader 为每个请求附加请求头(如 X-Request-Id)
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.headers[key] = value
+	}
+}
+
+// New 创建客户端,baseURL 为服务地址(如 http://localhost:7055,配置了 ROUTE_PREFIX 时需包含前缀),apiKey 为 API_SECRET 中的任意一个
+func New(baseURL string, apiKey string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		// 生图/生视频可能耗时较长,默认不设置整体超时,由调用方通过 context 控制
+		httpClient: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: 30 * time.Minute,
+		}},
+		headers: make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListModels 获取模型列表
+func (c *Client) ListModels(ctx context.Context) (*model.OpenaiModelListResponse, error) {
+	var response model.OpenaiModelListResponse
+	if err := c.do(ctx, http.MethodGet, "/v1/models", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// newRequest 创建带鉴权头的请求
+func (c *Client) newRequest(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// do 发送请求并将响应解析到 out,非 2xx 响应返回 *APIError
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
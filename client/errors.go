@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/model"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrStreamInterrupted 流式响应在收到 [DONE] 前断开
+var ErrStreamInterrupted = fmt.Errorf("stream interrupted before [DONE]")
+
+// APIError 服务端返回的错误,兼容 OpenAI 格式({"error":{"message":...}})与简单格式({"error":"..."})
+type APIError struct {
+	StatusCode  int
+	Message     string
+	Type        string
+	Code        string
+	Suggestions []string                // 模型限流时可用的替代模型
+	Attempts    []model.UpstreamAttempt // DEBUG 模式下的上游尝试轨迹
+	RetryAfter  time.Duration           // 全部 cookie 限流时建议的重试等待时间
+	Body        []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("genspark2api: status %d, code %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("genspark2api: status %d: %s", e.StatusCode, e.Message)
+}
+
+// IsRateLimited 是否为限流错误(请求频率限制或 cookie 全部限流)
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsUnauthorized 是否为鉴权失败
+func (e *APIError) IsUnauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	apiError := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode), Body: body}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var payload struct {
+		Error       json.RawMessage `json:"error"`
+		Message     string          `json:"message"`
+		Suggestions []string        `json:"suggestions"`
+		Details     struct {
+			Attempts []model.UpstreamAttempt `json:"attempts"`
+		} `json:"details"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		if len(body) > 0 {
+			apiError.Message = string(body)
+		}
+		return apiError
+	}
+	apiError.Suggestions = payload.Suggestions
+	apiError.Attempts = payload.Details.Attempts
+
+	var openAIError model.OpenAIError
+	var message string
+	switch {
+	case json.Unmarshal(payload.Error, &message) == nil && message != "":
+		apiError.Message = message
+	case json.Unmarshal(payload.Error, &openAIError) == nil && openAIError.Message != "":
+		apiError.Message = openAIError.Message
+		apiError.Type = openAIError.Type
+		apiError.Code = openAIError.Code
+	case payload.Message != "":
+		// 管理接口等返回 {"success":false,"message":"..."}
+		apiError.Message = payload.Message
+	}
+	return apiError
+}
@@ -0,0 +1,25 @@
+package client
+
+import (
+	"context"
+	"genspark2api/model"
+	"net/http"
+)
+
+// CreateImage 文生图/图像编辑,耗时可能较长,建议通过 ctx 设置超时
+func (c *Client) CreateImage(ctx context.Context, req model.OpenAIImagesGenerationRequest) (*model.OpenAIImagesGenerationResponse, error) {
+	var response model.OpenAIImagesGenerationResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/images/generations", req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// CreateVideo 文/图生视频,接口在生成完成后才返回,耗时可能达数分钟
+func (c *Client) CreateVideo(ctx context.Context, req model.VideosGenerationRequest) (*model.VideosGenerationResponse, error) {
+	var response model.VideosGenerationResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/videos/generations", req, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,239 @@
+package abuse
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"genspark2api/common/config"
+	"math/bits"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// challengeTTL 挑战的有效期,过期后需重新获取
+const challengeTTL = 5 * 60
+
+// Challenge 工作量证明挑战:找到 solution 使 sha256(token + ":" + solution) 的前 Difficulty 位为 0,
+// 之后携带 token:solution 重新请求
+type Challenge struct {
+	Token      string `json:"token"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// counter 单个 IP 在当前窗口内的统计
+type counter struct {
+	windowStart int64
+	failures    int
+	passedUntil int64 // 完成挑战后在该时间前不再要求挑战
+}
+
+var (
+	mu               sync.Mutex
+	counters         = make(map[string]*counter)
+	lastSweep        int64
+	secret           = make([]byte, 32)
+	whitelist        []*net.IPNet
+	banStatuses      = make(map[int]bool)
+	userAgentPattern *regexp.Regexp
+)
+
+// Init 解析 ABUSE_WHITELIST、ABUSE_BAN_STATUS、ABUSE_CHALLENGE_USER_AGENT 并生成挑战签名密钥
+func Init() error {
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	whitelist = nil
+	for _, item := range strings.Split(config.AbuseWhitelistStr, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		network, err := config.ParseCidr(item)
+		if err != nil {
+			return fmt.Errorf("ABUSE_WHITELIST: %w", err)
+		}
+		whitelist = append(whitelist, network)
+	}
+
+	banStatuses = make(map[int]bool)
+	for _, item := range strings.Split(config.AbuseBanStatus, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		status, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || status < 100 || status > 599 {
+			return fmt.Errorf("ABUSE_BAN_STATUS: invalid status %s", item)
+		}
+		banStatuses[status] = true
+	}
+
+	userAgentPattern = nil
+	if config.AbuseChallengeUserAgent != "" {
+		compiled, err := regexp.Compile(config.AbuseChallengeUserAgent)
+		if err != nil {
+			return fmt.Errorf("ABUSE_CHALLENGE_USER_AGENT: %w", err)
+		}
+		userAgentPattern = compiled
+	}
+	return nil
+}
+
+// Enabled 是否开启了自动封禁或挑战
+func Enabled() bool {
+	return config.AbuseBanThreshold > 0 || ChallengeEnabled()
+}
+
+// ChallengeEnabled 是否开启了挑战
+func ChallengeEnabled() bool {
+	return config.AbuseChallengeThreshold > 0 || userAgentPattern != nil
+}
+
+// Whitelisted 是否在白名单中,白名单内的 IP 不参与统计、封禁与挑战
+func Whitelisted(clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range whitelist {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tracked 响应状态码是否计入统计
+func Tracked(status int) bool {
+	return banStatuses[status]
+}
+
+// RecordFailure 记录一次计入统计的响应,返回当前窗口内的次数
+func RecordFailure(clientIP string) int {
+	now := time.Now().Unix()
+	mu.Lock()
+	defer mu.Unlock()
+
+	entry := getCounter(clientIP, now)
+	entry.failures++
+	return entry.failures
+}
+
+// Reset 清除 IP 的统计(封禁后调用)
+func Reset(clientIP string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(counters, clientIP)
+}
+
+// Suspicious 是否需要先完成挑战:窗口内次数达到 ABUSE_CHALLENGE_THRESHOLD 或 User-Agent 命中规则,
+// 已完成挑战的 IP 在 ABUSE_CHALLENGE_PASS_DURATION 内不再要求
+func Suspicious(clientIP string, userAgent string) bool {
+	if !ChallengeEnabled() {
+		return false
+	}
+	now := time.Now().Unix()
+	mu.Lock()
+	defer mu.Unlock()
+
+	entry := getCounter(clientIP, now)
+	if entry.passedUntil > now {
+		return false
+	}
+	if config.AbuseChallengeThreshold > 0 && entry.failures >= config.AbuseChallengeThreshold {
+		return true
+	}
+	return userAgentPattern != nil && userAgentPattern.MatchString(userAgent)
+}
+
+// NewChallenge 为 IP 签发挑战,token 与 IP 绑定,无需服务端保存
+func NewChallenge(clientIP string) Challenge {
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	expiresAt := time.Now().Unix() + challengeTTL
+	payload := strconv.FormatInt(expiresAt, 10) + "." + hex.EncodeToString(nonce)
+	return Challenge{
+		Token:      payload + "." + sign(clientIP, payload),
+		Difficulty: config.AbuseChallengeDifficulty,
+		ExpiresAt:  expiresAt,
+	}
+}
+
+// Verify 校验挑战答案(token:solution),通过后该 IP 在 ABUSE_CHALLENGE_PASS_DURATION 内免挑战并清空统计
+func Verify(clientIP string, answer string) bool {
+	separator := strings.LastIndex(answer, ":")
+	if separator < 0 {
+		return false
+	}
+	token, solution := answer[:separator], answer[separator+1:]
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || solution == "" {
+		return false
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(sign(clientIP, payload))) {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	now := time.Now().Unix()
+	if err != nil || expiresAt < now {
+		return false
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(answer))) < config.AbuseChallengeDifficulty {
+		return false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	entry := getCounter(clientIP, now)
+	entry.failures = 0
+	entry.passedUntil = now + int64(config.AbuseChallengePassDuration)
+	return true
+}
+
+// getCounter 获取 IP 当前窗口的统计,窗口过期时重置次数;每个窗口清理一次过期的统计,调用方需持有锁
+func getCounter(clientIP string, now int64) *counter {
+	window := int64(max(config.AbuseWindow, 1))
+	if now-lastSweep >= window {
+		for ip, entry := range counters {
+			if now-entry.windowStart >= window && entry.passedUntil <= now {
+				delete(counters, ip)
+			}
+		}
+		lastSweep = now
+	}
+
+	entry, ok := counters[clientIP]
+	if !ok {
+		entry = &counter{windowStart: now}
+		counters[clientIP] = entry
+	}
+	if now-entry.windowStart >= window {
+		entry.windowStart = now
+		entry.failures = 0
+	}
+	return entry
+}
+
+func sign(clientIP string, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(clientIP + "|" + payload))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
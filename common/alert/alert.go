@@ -0,0 +1,186 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/task"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TypeNoValidCookies   = "no_valid_cookies"
+	TypeUpstreamError    = "upstream_error"
+	TypeImageSuccessRate = "image_success_rate"
+)
+
+// 告警中附带的最近错误样本数
+const maxErrorSamples = 5
+
+var (
+	mutex                  sync.Mutex
+	consecutiveUpstreamErr int
+	imageResults           []bool
+	errorSamples           []string
+	lastAlertTime          = make(map[string]time.Time)
+	httpClient             = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Enabled 是否配置了告警通道
+func Enabled() bool {
+	return config.AlertWebhookUrl != "" || (config.AlertTelegramBotToken != "" && config.AlertTelegramChatId != "")
+}
+
+// NoValidCookies 无可用cookie时告警,scope 为空表示全局cookie池均不可用,否则为受限的范围(如租户、模型标签),
+// 不同范围分别限制告警间隔
+func NoValidCookies(scope string, sample string) {
+	if !Enabled() {
+		return
+	}
+	mutex.Lock()
+	addSample(sample)
+	mutex.Unlock()
+	if scope == "" {
+		fire(TypeNoValidCookies, "", "所有cookie均已失效或被限流")
+		return
+	}
+	fire(TypeNoValidCookies, scope, fmt.Sprintf("%s无可用cookie(cookie池为空、没有满足标签要求的cookie或均已失效)", scope))
+}
+
+// RecordUpstreamError 记录上游服务端错误,连续达到阈值时告警
+func RecordUpstreamError(sample string) {
+	if !Enabled() {
+		return
+	}
+	mutex.Lock()
+	consecutiveUpstreamErr++
+	count := consecutiveUpstreamErr
+	addSample(sample)
+	mutex.Unlock()
+
+	if config.AlertUpstreamErrorThreshold > 0 && count >= config.AlertUpstreamErrorThreshold {
+		fire(TypeUpstreamError, "", fmt.Sprintf("上游连续 %d 次返回服务端错误", count))
+	}
+}
+
+// RecordUpstreamSuccess 上游请求成功,重置连续错误计数
+func RecordUpstreamSuccess() {
+	if !Enabled() {
+		return
+	}
+	mutex.Lock()
+	consecutiveUpstreamErr = 0
+	mutex.Unlock()
+}
+
+// RecordImageResult 记录生图结果,最近窗口内成功率低于阈值时告警
+func RecordImageResult(success bool, sample string) {
+	if !Enabled() || config.AlertImageWindow <= 0 {
+		return
+	}
+	mutex.Lock()
+	imageResults = append(imageResults, success)
+	if len(imageResults) > config.AlertImageWindow {
+		imageResults = imageResults[len(imageResults)-config.AlertImageWindow:]
+	}
+	if !success {
+		addSample(sample)
+	}
+	full := len(imageResults) >= config.AlertImageWindow
+	rate := imageSuccessRate()
+	mutex.Unlock()
+
+	if full && rate < config.AlertImageSuccessRateThreshold {
+		fire(TypeImageSuccessRate, "", fmt.Sprintf("最近 %d 次生图成功率 %.0f%% 低于阈值 %.0f%%",
+			config.AlertImageWindow, rate*100, config.AlertImageSuccessRateThreshold*100))
+	}
+}
+
+// imageSuccessRate 调用方需持有锁
+func imageSuccessRate() float64 {
+	if len(imageResults) == 0 {
+		return 1
+	}
+	success := 0
+	for _, ok := range imageResults {
+		if ok {
+			success++
+		}
+	}
+	return float64(success) / float64(len(imageResults))
+}
+
+// addSample 调用方需持有锁
+func addSample(sample string) {
+	if sample == "" {
+		return
+	}
+	if len(sample) > 200 {
+		sample = sample[:200] + "..."
+	}
+	errorSamples = append(errorSamples, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), sample))
+	if len(errorSamples) > maxErrorSamples {
+		errorSamples = errorSamples[len(errorSamples)-maxErrorSamples:]
+	}
+}
+
+// fire 发送告警,同类告警在 ALERT_INTERVAL 内只发送一次
+func fire(alertType string, scope string, title string) {
+	mutex.Lock()
+	key := alertType + ":" + scope
+	if last, ok := lastAlertTime[key]; ok && time.Since(last) < time.Duration(config.AlertInterval)*time.Second {
+		mutex.Unlock()
+		return
+	}
+	lastAlertTime[key] = time.Now()
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("[genspark2api] %s\n", title))
+	builder.WriteString(fmt.Sprintf("可用cookie: %d/%d\n", len(config.NewCookieManager().Cookies), len(config.GetGSCookies())))
+	builder.WriteString(fmt.Sprintf("上游连续错误: %d\n", consecutiveUpstreamErr))
+	builder.WriteString(fmt.Sprintf("生图成功率: %.0f%% (最近 %d 次)\n", imageSuccessRate()*100, len(imageResults)))
+	if len(errorSamples) > 0 {
+		builder.WriteString("最近错误:\n")
+		builder.WriteString(strings.Join(errorSamples, "\n"))
+	}
+	message := builder.String()
+	mutex.Unlock()
+
+	logger.SysError("alert: " + title)
+	task.Go("alert-send", func() { send(alertType, message) })
+}
+
+func send(alertType string, message string) {
+	if config.AlertWebhookUrl != "" {
+		body, _ := json.Marshal(map[string]interface{}{
+			"type":    alertType,
+			"text":    message,
+			"created": time.Now().Unix(),
+		})
+		post(config.AlertWebhookUrl, body)
+	}
+	if config.AlertTelegramBotToken != "" && config.AlertTelegramChatId != "" {
+		body, _ := json.Marshal(map[string]interface{}{
+			"chat_id": config.AlertTelegramChatId,
+			"text":    message,
+		})
+		post(fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", config.AlertTelegramBotToken), body)
+	}
+}
+
+func post(url string, body []byte) {
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.SysError("failed to send alert: " + err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.SysError(fmt.Sprintf("failed to send alert: status code %d", resp.StatusCode))
+	}
+}
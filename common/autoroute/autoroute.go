@@ -0,0 +1,141 @@
+package autoroute
+
+import (
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/model"
+	"regexp"
+	"strings"
+)
+
+// ModelName 触发智能路由的模型名
+const ModelName = "auto"
+
+// 路由类别,按此顺序匹配
+const (
+	CategoryImage   = "image"
+	CategoryCode    = "code"
+	CategoryMath    = "math"
+	CategoryLong    = "long"
+	CategoryDefault = "default"
+)
+
+var categories = []string{CategoryImage, CategoryCode, CategoryMath, CategoryLong, CategoryDefault}
+
+// 默认代码意图:代码块、常见语言与编程术语
+const defaultCodePattern = "(?i)```|\\b(code|function|class|method|bug|debug|compile|refactor|stack ?trace|exception|regex|sql|python|javascript|typescript|golang|java|rust|c\\+\\+|kotlin|swift|html|css|json|yaml|api)\\b|" +
+	`代码|函数|编程|报错|调试|重构|脚本|算法|接口|正则|编译`
+
+// 默认数学意图:数学术语、公式符号与算式
+const defaultMathPattern = `(?i)\b(math|equation|integral|derivative|theorem|prove|proof|probability|matrix|calculus|algebra|geometry|solve for)\b|` +
+	`数学|方程|证明|积分|求导|导数|概率|矩阵|几何|函数极限|解不等式|[∫∑√≤≥≠π]|\$\$|\\frac|\d+\s*[-+*/×÷^]\s*\d+\s*=`
+
+var (
+	rules       map[string]string
+	codePattern = regexp.MustCompile(defaultCodePattern)
+	mathPattern = regexp.MustCompile(defaultMathPattern)
+)
+
+// Init 解析 AUTO_MODEL_RULES 并编译 AUTO_MODEL_CODE_PATTERN、AUTO_MODEL_MATH_PATTERN
+func Init() error {
+	parsed := make(map[string]string)
+	for _, pair := range strings.Split(config.AutoModelRules, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		category, modelName, ok := strings.Cut(pair, "=")
+		category, modelName = strings.ToLower(strings.TrimSpace(category)), strings.TrimSpace(modelName)
+		if !ok || modelName == "" {
+			return fmt.Errorf("invalid item: %s", pair)
+		}
+		if !isCategory(category) {
+			return fmt.Errorf("unknown category: %s", category)
+		}
+		if modelName == ModelName {
+			return fmt.Errorf("category %s can not route to %s", category, ModelName)
+		}
+		parsed[category] = modelName
+	}
+	if len(parsed) > 0 && parsed[CategoryDefault] == "" {
+		return fmt.Errorf("category %s is required", CategoryDefault)
+	}
+	rules = parsed
+
+	if config.AutoModelCodePattern != "" {
+		compiled, err := regexp.Compile(config.AutoModelCodePattern)
+		if err != nil {
+			return fmt.Errorf("invalid code pattern: %w", err)
+		}
+		codePattern = compiled
+	}
+	if config.AutoModelMathPattern != "" {
+		compiled, err := regexp.Compile(config.AutoModelMathPattern)
+		if err != nil {
+			return fmt.Errorf("invalid math pattern: %w", err)
+		}
+		mathPattern = compiled
+	}
+	return nil
+}
+
+// Enabled 是否配置了路由规则
+func Enabled() bool {
+	return len(rules) > 0
+}
+
+// Route 按请求内容选择模型,返回模型名与命中的类别
+func Route(req *model.OpenAIChatCompletionRequest) (string, string) {
+	for _, category := range categories {
+		modelName, ok := rules[category]
+		if ok && match(category, req) {
+			return modelName, category
+		}
+	}
+	return rules[CategoryDefault], CategoryDefault
+}
+
+func match(category string, req *model.OpenAIChatCompletionRequest) bool {
+	switch category {
+	case CategoryImage:
+		return len(req.GetUserImageUrls()) > 0
+	case CategoryCode:
+		return codePattern.MatchString(req.GetUserText())
+	case CategoryMath:
+		return mathPattern.MatchString(req.GetUserText())
+	case CategoryLong:
+		return config.AutoModelLongTokens > 0 && common.CountToken(messagesText(req.Messages)) >= config.AutoModelLongTokens
+	}
+	return true
+}
+
+// messagesText 拼接所有消息的文本部分,不含图片等附件
+func messagesText(messages []model.OpenAIChatMessage) string {
+	var builder strings.Builder
+	for _, message := range messages {
+		switch content := message.Content.(type) {
+		case string:
+			builder.WriteString(content)
+		case []interface{}:
+			for _, part := range content {
+				if partMap, ok := part.(map[string]interface{}); ok && partMap["type"] == "text" {
+					if text, ok := partMap["text"].(string); ok {
+						builder.WriteString(text)
+					}
+				}
+			}
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+func isCategory(category string) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package bodystat
+
+import "sync"
+
+// Stats 对话请求体积统计,字节数均为 JSON 序列化后的大小
+type Stats struct {
+	Requests      int64 `json:"requests"`       // 统计的对话请求数
+	InboundBytes  int64 `json:"inbound_bytes"`  // 客户端请求体累计大小
+	UpstreamBytes int64 `json:"upstream_bytes"` // 发往上游的请求体累计大小
+	MaxUpstream   int64 `json:"max_upstream"`   // 单次发往上游的最大请求体
+	TrimmedMsgs   int64 `json:"trimmed_msgs"`   // 未绑定会话时裁剪掉的历史消息数(不再处理其中的图片/附件)
+	HistoryImages int64 `json:"history_images"` // 历史消息中替换为文件的图片数
+	ReusedImages  int64 `json:"reused_images"`  // 其中复用已上传文件(未重复上传)的图片数
+	ReplacedBytes int64 `json:"replaced_bytes"` // 替换掉的 base64 图片数据大小
+}
+
+var (
+	mutex sync.Mutex
+	stats Stats
+)
+
+// RecordRequest 记录一次对话请求的客户端请求体与上游请求体大小,客户端请求体大小未知时传 -1
+func RecordRequest(inbound int64, upstream int64, trimmed int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	stats.Requests++
+	if inbound > 0 {
+		stats.InboundBytes += inbound
+	}
+	stats.UpstreamBytes += upstream
+	if upstream > stats.MaxUpstream {
+		stats.MaxUpstream = upstream
+	}
+	stats.TrimmedMsgs += int64(trimmed)
+}
+
+// RecordHistoryImage 记录一张替换为文件的历史图片
+func RecordHistoryImage(reused bool, replacedBytes int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	stats.HistoryImages++
+	if reused {
+		stats.ReusedImages++
+	}
+	stats.ReplacedBytes += int64(replacedBytes)
+}
+
+// Snapshot 获取当前统计
+func Snapshot() Stats {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return stats
+}
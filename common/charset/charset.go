@@ -0,0 +1,55 @@
+package charset
+
+import (
+	"bytes"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"strings"
+	"unicode/utf8"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ToUTF8 将请求体转换为 UTF-8:剥离 BOM,按声明的 charset 转换,未声明时探测 UTF-16 与 GBK(GB18030),
+// 返回转换后的内容与识别出的编码,无需转换时编码为空
+func ToUTF8(body []byte, declared string) ([]byte, string, error) {
+	switch {
+	case bytes.HasPrefix(body, utf8BOM):
+		return body[len(utf8BOM):], "utf-8-bom", nil
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return decode(body, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "utf-16le")
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return decode(body, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "utf-16be")
+	}
+
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	if declared != "" && declared != "utf-8" && declared != "utf8" {
+		if enc, err := htmlindex.Get(declared); err == nil {
+			return decode(body, enc, declared)
+		}
+	}
+
+	if utf8.Valid(body) {
+		return body, "", nil
+	}
+	// JSON 以 ASCII 字符开头,无 BOM 的 UTF-16 首个字符的另一字节为 0
+	if len(body) >= 2 && len(body)%2 == 0 {
+		if body[0] != 0 && body[1] == 0 {
+			return decode(body, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), "utf-16le")
+		}
+		if body[0] == 0 && body[1] != 0 {
+			return decode(body, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), "utf-16be")
+		}
+	}
+	return decode(body, simplifiedchinese.GB18030, "gbk")
+}
+
+func decode(body []byte, enc encoding.Encoding, name string) ([]byte, string, error) {
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, "", err
+	}
+	return bytes.TrimPrefix(decoded, utf8BOM), name, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"genspark2api/common/env"
+	"os"
+	"sync"
+	"time"
+)
+
+// 管理端变更记录持久化文件(JSONL),为空时仅保存在内存
+var AdminHistoryPath = env.String("ADMIN_HISTORY_PATH", "")
+
+// 内存中保留的变更记录条数
+const adminHistoryLimit = 500
+
+// AdminOperation 一次管理端变更操作
+type AdminOperation struct {
+	Time       time.Time `json:"time"`
+	Operator   string    `json:"operator"`    // 操作人,OIDC 登录时为 email/用户名,proxy-secret 鉴权时为 proxy-secret
+	Role       string    `json:"role"`        // 操作人角色
+	AuthMethod string    `json:"auth_method"` // proxy-secret 或 oidc
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Body       string    `json:"body,omitempty"` // 请求体,密钥/cookie 等字段已脱敏,过长时截断
+	Status     int       `json:"status"`
+}
+
+var (
+	adminHistory      []AdminOperation
+	adminHistoryMutex sync.RWMutex
+)
+
+// RecordAdminOperation 记录一次管理端变更,配置了 ADMIN_HISTORY_PATH 时同时追加写入文件
+func RecordAdminOperation(op AdminOperation) error {
+	adminHistoryMutex.Lock()
+	defer adminHistoryMutex.Unlock()
+
+	adminHistory = append(adminHistory, op)
+	if len(adminHistory) > adminHistoryLimit {
+		adminHistory = adminHistory[len(adminHistory)-adminHistoryLimit:]
+	}
+
+	if AdminHistoryPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(AdminHistoryPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// GetAdminHistory 获取最近的变更记录,按时间倒序
+func GetAdminHistory(limit int) []AdminOperation {
+	adminHistoryMutex.RLock()
+	defer adminHistoryMutex.RUnlock()
+
+	if limit <= 0 || limit > len(adminHistory) {
+		limit = len(adminHistory)
+	}
+	history := make([]AdminOperation, 0, limit)
+	for i := len(adminHistory) - 1; i >= 0 && len(history) < limit; i-- {
+		history = append(history, adminHistory[i])
+	}
+	return history
+}
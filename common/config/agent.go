@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"genspark2api/common/env"
+	"sort"
+	"strings"
+)
+
+// agent 模型名前缀,如 agent/super 对应 super agent 工作流
+const AgentModelPrefix = "agent/"
+
+// 自定义 agent 类型映射 格式: 名称=上游类型,多个以,分隔,与内置映射合并
+var AgentTypeMapStr = env.String("AGENT_TYPE_MAP", "")
+
+// AgentTypeMap agent 名称 -> 上游请求的 type
+var AgentTypeMap = map[string]string{
+	"super":  "super_agent",
+	"call":   "phone_call",
+	"slides": "ai_slides",
+	"sheets": "ai_sheets",
+	"docs":   "ai_docs",
+}
+
+// ParseAgentTypeMap 解析 AGENT_TYPE_MAP 并合并到内置映射
+func ParseAgentTypeMap(value string) error {
+	for _, pair := range splitList(value) {
+		name, agentType, ok := strings.Cut(pair, "=")
+		name, agentType = strings.TrimSpace(name), strings.TrimSpace(agentType)
+		if !ok || name == "" || agentType == "" {
+			return fmt.Errorf("invalid agent mapping: %s", pair)
+		}
+		AgentTypeMap[name] = agentType
+	}
+	return nil
+}
+
+// GetAgentType 获取 agent 模型对应的上游类型,非 agent 模型返回 false
+func GetAgentType(modelName string) (string, bool) {
+	name, ok := strings.CutPrefix(modelName, AgentModelPrefix)
+	if !ok {
+		return "", false
+	}
+	agentType, ok := AgentTypeMap[name]
+	return agentType, ok
+}
+
+// AgentModelList 所有 agent 模型名
+func AgentModelList() []string {
+	models := make([]string, 0, len(AgentTypeMap))
+	for name := range AgentTypeMap {
+		models = append(models, AgentModelPrefix+name)
+	}
+	sort.Strings(models)
+	return models
+}
@@ -4,34 +4,117 @@ import (
 	"errors"
 	"genspark2api/common/env"
 	"genspark2api/yescaptcha"
+	"github.com/samber/lo"
 	"math/rand"
-	"os"
 	"strings"
 	"sync"
 	"time"
 )
 
-var ApiSecret = os.Getenv("API_SECRET")
-var ApiSecrets = strings.Split(os.Getenv("API_SECRET"), ",")
+var ApiSecret = env.String("API_SECRET", "")
+var ApiSecrets = strings.Split(env.String("API_SECRET", ""), ",")
 
-var GSCookie = os.Getenv("GS_COOKIE")
+var GSCookie = env.String("GS_COOKIE", "")
 
 //var GSCookies = strings.Split(os.Getenv("GS_COOKIE"), ",")
 
 // var IpBlackList = os.Getenv("IP_BLACK_LIST")
-var IpBlackList = strings.Split(os.Getenv("IP_BLACK_LIST"), ",")
+var IpBlackList = strings.Split(env.String("IP_BLACK_LIST", ""), ",")
 
 var AutoDelChat = env.Int("AUTO_DEL_CHAT", 0)
 var ProxyUrl = env.String("PROXY_URL", "")
+
+// 多出口节点(不同代理/地区),按测速延迟优先选择
+var ProxyNodes = env.String("PROXY_NODES", "")                                // 多个以,分隔,可用 名称=地址 命名,direct 表示直连
+var ProxyProbeInterval = env.Int("PROXY_PROBE_INTERVAL", 300)                 // 测速间隔(秒)
+var ProxyProbeUrl = env.String("PROXY_PROBE_URL", "https://www.genspark.ai/") // 测速请求的地址
+
+// 过盾服务(FlareSolverr 兼容接口)
+var CfSolverUrl = env.String("CF_SOLVER_URL", "")
+var CfSolverTimeout = env.Int("CF_SOLVER_TIMEOUT", 60)
+
+// 自定义DNS服务器与强制IPv4
+var DnsServer = env.String("DNS_SERVER", "")
+var ForceIPv4 = env.Int("FORCE_IPV4", 0)
+
 var AutoModelChatMapType = env.Int("AUTO_MODEL_CHAT_MAP_TYPE", 1)
+
+// 自动绑定会话的命名空间(none:所有调用方共享;api_key:按 API key 隔离;user:按 API key 与请求的 user 字段隔离)
+var SessionNamespace = env.String("SESSION_NAMESPACE", "api_key")
 var YesCaptchaClientKey = env.String("YES_CAPTCHA_CLIENT_KEY", "")
 
 // var CheatUrl = env.String("CHEAT_URL", "https://gs-cheat.aytsao.cn/genspark/create/req/body")
 var RecaptchaProxyUrl = env.String("RECAPTCHA_PROXY_URL", "")
+var RecaptchaHealthCheckInterval = env.Int("RECAPTCHA_HEALTH_CHECK_INTERVAL", 30) // 多个 proxy 时的健康检查间隔(秒)
+var RecaptchaTokenPoolSize = env.Int("RECAPTCHA_TOKEN_POOL_SIZE", 0)              // 每个 cookie 预取的 token 数,0 为不预取
+var RecaptchaTokenTTL = env.Int("RECAPTCHA_TOKEN_TTL", 90)                        // 预取 token 的有效期(秒)
+var RecaptchaQueueTimeout = env.Int("RECAPTCHA_QUEUE_TIMEOUT", 30)                // 达到并发上限时排队等待的最长时间(秒),0 为一直等待
+var RecaptchaMaxConcurrency = env.Int("RECAPTCHA_MAX_CONCURRENCY", 0)             // 同时请求 proxy 的最大数量,0 为不限制
 
 // 隐藏思考过程
 var ReasoningHide = env.Int("REASONING_HIDE", 0)
 
+// 请求携带 reasoning.exclude 时合并到上游请求 extra_data 中的字段(JSON 对象),用于关闭上游的思考输出
+var ReasoningExcludeExtraDataStr = env.String("REASONING_EXCLUDE_EXTRA_DATA", "")
+var ReasoningExcludeExtraData map[string]interface{}
+
+// 按模型注入的 system prompt,JSON 对象 {"模型名或前缀*":"prompt"},启动后可通过 PUT /admin/config 热更新
+var ModelSystemPromptMapStr = env.String("MODEL_SYSTEM_PROMPT_MAP", "")
+
+// 系统消息预算:条数超过 SYSTEM_MESSAGE_MAX_COUNT 时合并,总长度(字符)超过 SYSTEM_MESSAGE_MAX_LENGTH 时按 SYSTEM_MESSAGE_OVERFLOW 截断,0 为不限制
+var (
+	SystemMessageMaxCount  = env.Int("SYSTEM_MESSAGE_MAX_COUNT", 0)
+	SystemMessageMaxLength = env.Int("SYSTEM_MESSAGE_MAX_LENGTH", 0)
+	SystemMessageOverflow  = env.String("SYSTEM_MESSAGE_OVERFLOW", "truncate") // truncate 保留开头,head_tail 保留首尾
+)
+
+// 按模型的流式输出上限,JSON 对象 {"模型名或前缀*":{"max_duration":秒,"max_tokens":数量}},启动后可通过 PUT /admin/config 热更新
+var ModelOutputLimitMapStr = env.String("MODEL_OUTPUT_LIMIT_MAP", "")
+
+// 联网搜索(-search)回答末尾是否附加"来源"一节
+var SearchSourcesSection = env.Int("SEARCH_SOURCES_SECTION", 1)
+
+// 透传上游的后续问题建议:非流式填充 suggestions 字段,流式随最后一个数据块的 suggestions 字段下发
+var SuggestionsPassthrough = env.Int("SUGGESTIONS_PASSTHROUGH", 1)
+
+// 多模型混合各层中间答案的输出方式 hide/markdown/json
+var MixtureLayerOutput = env.String("MIXTURE_LAYER_OUTPUT", "hide")
+
+// 思维导图(markmap)的输出方式 text/mermaid/json/hide
+var MarkmapOutput = env.String("MARKMAP_OUTPUT", "mermaid")
+
+// 强制响应语言(如 zh、en、ja、ko)及语言不符时是否自动重试一次(仅非流式)
+var ForceLanguage = env.String("FORCE_LANGUAGE", "")
+var ForceLanguageRetry = env.Int("FORCE_LANGUAGE_RETRY", 0)
+
+// 错误消息语言(zh、en),请求未携带可识别的 Accept-Language 时使用,为空时 API 错误为英文、管理接口错误为中文
+var ErrorLanguage = env.String("ERROR_LANGUAGE", "")
+
+// 降智检测:命中时换 cookie/会话重试一次(仅非流式)
+var DegradeDetect = env.Int("DEGRADE_DETECT", 0)
+var DegradeMinLength = env.Int("DEGRADE_MIN_LENGTH", 0)               // 回复字符数低于该值视为降智,0 为不检测
+var DegradeRefusalPattern = env.String("DEGRADE_REFUSAL_PATTERN", "") // 拒绝模式正则,为空时使用内置规则
+
+// 通过对话接口调用视频模型时的默认参数、结果格式(markdown/html)与流式进度文本间隔(秒)
+var VideoChatAspectRatio = env.String("VIDEO_CHAT_ASPECT_RATIO", "16:9")
+var VideoChatDuration = env.Int("VIDEO_CHAT_DURATION", 5)
+var VideoChatFormat = env.String("VIDEO_CHAT_FORMAT", "markdown")
+var VideoChatProgressInterval = env.Int("VIDEO_CHAT_PROGRESS_INTERVAL", 10)
+
+// 流式请求在输出任何内容前失败时改用非流式请求上游一次
+var StreamFallbackNonStream = env.Int("STREAM_FALLBACK_NON_STREAM", 1)
+
+// 流式输出平滑:超过 STREAM_SMOOTH_CHUNK_SIZE 个字符的增量切成小块,按每秒 STREAM_SMOOTH_RATE 个字符下发,0 为不平滑
+var StreamSmoothRate = env.Int("STREAM_SMOOTH_RATE", 0)
+var StreamSmoothChunkSize = env.Int("STREAM_SMOOTH_CHUNK_SIZE", 4)
+
+// 生图 prompt 增强使用的文本模型
+var PromptEnhanceModel = env.String("PROMPT_ENHANCE_MODEL", "gpt-5.1-low")
+
+// 生图/生视频 prompt 预检:本地敏感词(不区分大小写)与可选的文本模型分类
+var PromptCheckWords = splitList(env.String("PROMPT_CHECK_WORDS", ""))
+var PromptCheckModel = env.String("PROMPT_CHECK_MODEL", "")
+
 // 前置message
 var PRE_MESSAGES_JSON = env.String("PRE_MESSAGES_JSON", "")
 
@@ -45,15 +128,26 @@ var SessionImageChatMap = make(map[string]string)
 var GlobalSessionManager *SessionManager
 
 var SessionImageChatMapStr = env.String("SESSION_IMAGE_CHAT_MAP", "")
+
+// 模型价格表(美元/百万token) 格式: model=输入价格:输出价格
+var ModelPriceMapStr = env.String("MODEL_PRICE_MAP", "")
+var ModelPriceMap = make(map[string]ModelPrice)
 var YescaptchaClient *yescaptcha.Client
 
-var AllDialogRecordEnable = os.Getenv("ALL_DIALOG_RECORD_ENABLE")
-var RequestOutTime = os.Getenv("REQUEST_OUT_TIME")
-var StreamRequestOutTime = os.Getenv("STREAM_REQUEST_OUT_TIME")
-var SwaggerEnable = os.Getenv("SWAGGER_ENABLE")
-var OnlyOpenaiApi = os.Getenv("ONLY_OPENAI_API")
+var AllDialogRecordEnable = env.String("ALL_DIALOG_RECORD_ENABLE", "")
+var RequestOutTime = env.String("REQUEST_OUT_TIME", "")
+var StreamRequestOutTime = env.String("STREAM_REQUEST_OUT_TIME", "")
+var SwaggerEnable = env.String("SWAGGER_ENABLE", "")
+var OnlyOpenaiApi = env.String("ONLY_OPENAI_API", "")
+
+var DebugEnabled = env.Bool("DEBUG", false)
+
+// 流式 chunk 调试日志的采样方式(all:全部记录;sample:每 DEBUG_CHUNK_LOG_SAMPLE_RATE 个记录一次;edge:仅记录首尾),异常 chunk 始终记录
+var DebugChunkLogMode = env.String("DEBUG_CHUNK_LOG_MODE", "all")
+var DebugChunkLogSampleRate = env.Int("DEBUG_CHUNK_LOG_SAMPLE_RATE", 10)
 
-var DebugEnabled = os.Getenv("DEBUG") == "true"
+var GinMode = env.String("GIN_MODE", "")
+var Port = env.String("PORT", "")
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
 
@@ -64,6 +158,200 @@ var (
 	RequestRateLimitDuration int64 = 1 * 60
 )
 
+// 下游服务端
+var (
+	ServerH2C            = env.Int("SERVER_H2C", 0)
+	ServerReadTimeout    = env.Int("SERVER_READ_TIMEOUT", 0)
+	ServerWriteTimeout   = env.Int("SERVER_WRITE_TIMEOUT", 0)
+	ServerIdleTimeout    = env.Int("SERVER_IDLE_TIMEOUT", 120)
+	ServerMaxConnections = env.Int("SERVER_MAX_CONNECTIONS", 0)
+	ShutdownTimeout      = env.Int("SHUTDOWN_TIMEOUT", 30)   // 收到 SIGTERM 后等待在途请求与后台任务的秒数
+	TrustedProxies       = env.String("TRUSTED_PROXIES", "") // 信任其 X-Forwarded-For 的反向代理 IP/CIDR,多个以,分隔,为空时直接使用连接地址
+)
+
+// 消息附件
+var (
+	MediaMaxSize    = env.Int("MEDIA_MAX_SIZE", 100)  // 视频/音频附件大小上限(MB)
+	FileMaxSize     = env.Int("FILE_MAX_SIZE", 20)    // 图片/文件附件下载的大小上限(MB),0 为不限制
+	ResultMaxSize   = env.Int("RESULT_MAX_SIZE", 500) // 生图/生视频结果下载(转 base64 或归档)的大小上限(MB),0 为不限制
+	UploadChunkSize = env.Int("UPLOAD_CHUNK_SIZE", 8) // 超过该大小(MB)的文件分片上传
+	// 单条 user 消息文本超过该字符数时转为 txt 文件上传,0 为不转换
+	LongTextFileThreshold = env.Int("LONG_TEXT_FILE_THRESHOLD", 100000)
+	// 历史消息中的图片上传为文件,按 cookie 缓存 private_storage_url 供后续请求复用
+	HistoryImageReuse = env.Int("HISTORY_IMAGE_REUSE", 1)
+	UploadCacheTTL    = env.Int("UPLOAD_CACHE_TTL", 3600) // 已上传文件的缓存时长(秒)
+	UploadCacheSize   = env.Int("UPLOAD_CACHE_SIZE", 1000)
+	// 已上传文件缓存使用的 Redis,为空时缓存在内存中
+	UploadCacheRedisUrl = env.String("UPLOAD_CACHE_REDIS_URL", "")
+	// 工具调用参数不符合 JSON Schema 时将校验错误回注给模型修正一次
+	ToolCallRepair = env.Int("TOOL_CALL_REPAIR", 1)
+	// 影子解析:上游事件流同时交给新旧解析器并记录输出差异,不影响返回内容
+	ShadowParser     = env.Int("SHADOW_PARSER", 0)
+	ShadowParserRate = env.Int("SHADOW_PARSER_RATE", 100) // 采样比例(%)
+)
+
+// 用量汇总
+var (
+	MetricsPath          = env.String("METRICS_PATH", "") // 汇总落盘的 JSON 文件,为空时仅在内存中统计
+	MetricsFlushInterval = env.Int("METRICS_FLUSH_INTERVAL", 60)
+)
+
+// 生图排队:上游返回的队列位置或预计等待时间(秒)超过阈值时直接失败,0 为不限制
+var (
+	ImageQueueMaxPosition = env.Int("IMAGE_QUEUE_MAX_POSITION", 0)
+	ImageQueueMaxWait     = env.Int("IMAGE_QUEUE_MAX_WAIT", 0)
+)
+
+// 对话中自动生图:请求携带 image_generation 且检测到画图意图时调用生图模型
+var (
+	ChatImageModel         = env.String("CHAT_IMAGE_MODEL", "nano-banana-pro")
+	ChatImageIntentPattern = env.String("CHAT_IMAGE_INTENT_PATTERN", "") // 画图意图正则,为空时使用内置规则
+)
+
+// 智能模型路由:model 为 auto 时按请求内容选择模型
+// 规则格式: 类别=模型,类别为 image(带图)/code(代码)/math(数学)/long(长文本)/default,按此顺序匹配
+var (
+	AutoModelRules       = env.String("AUTO_MODEL_RULES", "image=gemini-3-pro-preview,code=claude-sonnet-4-6,math=gpt-5.2,long=gemini-2.5-pro,default=gpt-5.2")
+	AutoModelLongTokens  = env.Int("AUTO_MODEL_LONG_TOKENS", 16000)  // 消息 token 数达到该值视为长文本
+	AutoModelCodePattern = env.String("AUTO_MODEL_CODE_PATTERN", "") // 代码类请求正则,为空时使用内置规则
+	AutoModelMathPattern = env.String("AUTO_MODEL_MATH_PATTERN", "") // 数学类请求正则,为空时使用内置规则
+)
+
+// 负载保护:内存或 goroutine 超过水位时拒绝新的生图/生视频请求,优先保障聊天
+var (
+	OverloadMemoryMB       = env.Int("OVERLOAD_MEMORY_MB", 0)  // 堆内存水位(MB),0 为不检查
+	OverloadGoroutines     = env.Int("OVERLOAD_GOROUTINES", 0) // goroutine 数水位,0 为不检查
+	OverloadCheckInterval  = env.Int("OVERLOAD_CHECK_INTERVAL", 5)
+	OverloadRecoverPercent = env.Int("OVERLOAD_RECOVER_PERCENT", 80) // 降到水位的该比例(%)以下才解除降级,避免抖动
+)
+
+// 防滥用:窗口内 401/404 等响应过多的 IP 自动临时封禁,可疑来源需先完成工作量证明挑战
+var (
+	AbuseWindow                = env.Int("ABUSE_WINDOW", 60)                  // 统计窗口(秒)
+	AbuseBanStatus             = env.String("ABUSE_BAN_STATUS", "401,404")    // 计入统计的响应状态码
+	AbuseBanThreshold          = env.Int("ABUSE_BAN_THRESHOLD", 0)            // 窗口内达到该次数时封禁,0 为关闭
+	AbuseBanDuration           = env.Int("ABUSE_BAN_DURATION", 60*60)         // 封禁时长(秒)
+	AbuseChallengeThreshold    = env.Int("ABUSE_CHALLENGE_THRESHOLD", 0)      // 窗口内达到该次数时要求挑战,0 为关闭
+	AbuseChallengeUserAgent    = env.String("ABUSE_CHALLENGE_USER_AGENT", "") // User-Agent 匹配该正则的来源要求挑战
+	AbuseChallengeDifficulty   = env.Int("ABUSE_CHALLENGE_DIFFICULTY", 18)    // 哈希前导零的位数
+	AbuseChallengePassDuration = env.Int("ABUSE_CHALLENGE_PASS_DURATION", 60*60)
+	AbuseWhitelistStr          = env.String("ABUSE_WHITELIST", "") // 不参与统计与挑战的 IP/CIDR,多个以,分隔
+)
+
+// 指定请求染色分组(canary/stable)的请求头,未携带时按 CANARY_PERCENT 随机分组
+var CanaryHeader = env.String("CANARY_HEADER", "X-Canary")
+
+// 日志文件
+var (
+	LogErrorDir = env.String("LOG_ERROR_DIR", "")
+	LogMaxDays  = env.Int("LOG_MAX_DAYS", 0)
+	LogMaxSize  = env.Int("LOG_MAX_SIZE", 0) // 单类日志文件总大小上限(MB)
+)
+
+// 告警
+var (
+	AlertWebhookUrl                = env.String("ALERT_WEBHOOK_URL", "")
+	AlertTelegramBotToken          = env.String("ALERT_TELEGRAM_BOT_TOKEN", "")
+	AlertTelegramChatId            = env.String("ALERT_TELEGRAM_CHAT_ID", "")
+	AlertUpstreamErrorThreshold    = env.Int("ALERT_UPSTREAM_ERROR_THRESHOLD", 5)
+	AlertImageSuccessRateThreshold = env.Float64("ALERT_IMAGE_SUCCESS_RATE_THRESHOLD", 0.5)
+	AlertImageWindow               = env.Int("ALERT_IMAGE_WINDOW", 20)
+	AlertInterval                  = env.Int("ALERT_INTERVAL", 10*60)
+)
+
+// 事件总线
+var (
+	EventWebhookUrl    = env.String("EVENT_WEBHOOK_URL", "")
+	EventWebhookEvents = env.String("EVENT_WEBHOOK_EVENTS", "") // 推送到 webhook 的事件类型,为空时推送全部
+	EventPlugins       = env.String("EVENT_PLUGINS", "")        // Go 插件(.so)路径,多个以,分隔
+	EventWebhookSecret = env.String("EVENT_WEBHOOK_SECRET", "") // webhook 请求体的 HMAC-SHA256 签名密钥,为空时不签名
+	EventQueueSize     = env.Int("EVENT_QUEUE_SIZE", 1000)      // 每个订阅者待处理事件的队列容量
+)
+
+// 内容守卫
+var (
+	ContentGuardWordsStr = env.String("CONTENT_GUARD_WORDS", "")
+	ContentGuardWords    []string
+	ContentGuardPattern  = env.String("CONTENT_GUARD_PATTERN", "")
+	ContentGuardWebhook  = env.String("CONTENT_GUARD_WEBHOOK", "")
+	ContentGuardAction   = env.String("CONTENT_GUARD_ACTION", "block")
+	// 流式输出时正则匹配的滑动窗口(字符数),末尾该长度的文本暂存到下一次增量,以命中跨增量拆分的内容
+	ContentGuardStreamWindow = env.Int("CONTENT_GUARD_STREAM_WINDOW", 64)
+)
+
+// 上游错误页指纹规则文件(JSON: {"rules":[...],"samples":[...]}),变更后热更新
+var (
+	FingerprintRulesPath           = env.String("FINGERPRINT_RULES_PATH", "")
+	FingerprintRulesReloadInterval = env.Int("FINGERPRINT_RULES_RELOAD_INTERVAL", 30)
+)
+
+// 内链重写
+var (
+	LinkRewriteMode      = env.String("LINK_REWRITE_MODE", "off") // off/strip/replace
+	LinkRewritePattern   = env.String("LINK_REWRITE_PATTERN", "") // 内链正则,为空时匹配全部 genspark.ai 链接
+	LinkRewriteBaseUrl   = env.String("LINK_REWRITE_BASE_URL", "")
+	LinkRewriteRulesPath = env.String("LINK_REWRITE_RULES_PATH", "")
+)
+
+// 单次请求的最大 prompt tokens 与按输入估算的最大费用(美元),0 为不限制
+var MaxPromptTokens = env.Int("MAX_PROMPT_TOKENS", 0)
+var MaxRequestCost = env.Float64("MAX_REQUEST_COST", 0)
+
+// 图片结果(b64_json)的元数据注入与水印
+var (
+	ImageMetadataEnable    = env.Int("IMAGE_METADATA_ENABLE", 0)
+	ImageWatermarkPath     = env.String("IMAGE_WATERMARK_PATH", "") // png 水印图片
+	ImageWatermarkPosition = env.String("IMAGE_WATERMARK_POSITION", "bottom-right")
+	ImageWatermarkOpacity  = env.Float64("IMAGE_WATERMARK_OPACITY", 0.5)
+)
+
+// 生成结果(图片/视频)归档到 S3 兼容存储(如 AWS S3、Cloudflare R2、MinIO),未配置 endpoint 时不启用
+var (
+	StorageS3Endpoint   = env.String("STORAGE_S3_ENDPOINT", "")
+	StorageS3Region     = env.String("STORAGE_S3_REGION", "auto")
+	StorageS3Bucket     = env.String("STORAGE_S3_BUCKET", "")
+	StorageS3AccessKey  = env.String("STORAGE_S3_ACCESS_KEY", "")
+	StorageS3SecretKey  = env.String("STORAGE_S3_SECRET_KEY", "")
+	StorageS3PathStyle  = env.Int("STORAGE_S3_PATH_STYLE", 1)
+	StorageS3Prefix     = env.String("STORAGE_S3_PREFIX", "genspark2api/")
+	StorageS3UrlExpire  = env.Int("STORAGE_S3_URL_EXPIRE", 60*60) // 下载 URL 有效期(秒)
+	StorageS3ExpireDays = env.Int("STORAGE_S3_EXPIRE_DAYS", 0)    // 对象保留天数,0 为不设置生命周期规则
+)
+
+// 幂等键(Idempotency-Key)缓存有效期(秒),0 为不启用
+var IdempotencyExpireDuration = env.Int("IDEMPOTENCY_EXPIRE_DURATION", 10*60)
+
+// 批任务
+var (
+	BatchConcurrency          = env.Int("BATCH_CONCURRENCY", 2)
+	BatchMaxRequests          = env.Int("BATCH_MAX_REQUESTS", 100)
+	BatchResultExpireDuration = env.Int("BATCH_RESULT_EXPIRE_DURATION", 24*60*60)
+)
+
+// 非流式响应暂存,供客户端按请求 ID 分页获取
+var (
+	ResponsePageExpireDuration = env.Int("RESPONSE_PAGE_EXPIRE_DURATION", 0) // 暂存时长(秒),0 为不暂存
+	ResponsePageSize           = env.Int("RESPONSE_PAGE_SIZE", 8000)         // 每页最大字符数
+)
+
+// 响应质量反馈
+var (
+	FeedbackPath           = env.String("FEEDBACK_PATH", "")               // 反馈记录持久化文件(JSONL),为空时仅计入用量汇总
+	FeedbackExpireDuration = env.Int("FEEDBACK_EXPIRE_DURATION", 24*60*60) // 响应完成后可反馈的时长(秒),0 为不接受反馈
+)
+
+// agent 产出文件的临时下载链接
+var (
+	FileLinkExpireDuration = env.Int("FILE_LINK_EXPIRE_DURATION", 60*60)                                  // 链接有效期(秒),0 为直接返回上游链接
+	FileLinkBaseUrl        = env.String("FILE_LINK_BASE_URL", "")                                         // 下载链接的外部访问地址,为空时按请求地址生成
+	FileLinkExtensions     = env.String("FILE_LINK_EXTENSIONS", "xlsx,xls,pptx,ppt,docx,doc,pdf,csv,zip") // 视为产出文件的扩展名
+)
+
+type ModelPrice struct {
+	Input  float64 // 输入价格(美元/百万token)
+	Output float64 // 输出价格(美元/百万token)
+}
+
 type RateLimitCookie struct {
 	ExpirationTime time.Time // 过期时间
 }
@@ -72,6 +360,17 @@ var (
 	rateLimitCookies sync.Map // 使用 sync.Map 管理限速 Cookie
 )
 
+// TrustedProxyList 解析 TRUSTED_PROXIES,为空时返回 nil(不信任任何代理)
+func TrustedProxyList() []string {
+	var proxies []string
+	for _, item := range strings.Split(TrustedProxies, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			proxies = append(proxies, item)
+		}
+	}
+	return proxies
+}
+
 func AddRateLimitCookie(cookie string, expirationTime time.Time) {
 	rateLimitCookies.Store(cookie, RateLimitCookie{
 		ExpirationTime: expirationTime,
@@ -79,6 +378,41 @@ func AddRateLimitCookie(cookie string, expirationTime time.Time) {
 	//fmt.Printf("Storing cookie: %s with value: %+v\n", cookie, RateLimitCookie{ExpirationTime: expirationTime})
 }
 
+// GetRateLimitRetryAfter 获取 cookie 池中限流 cookie 最早恢复的剩余时间,没有限流的 cookie 时返回0
+func GetRateLimitRetryAfter(cookies []string) time.Duration {
+	var retryAfter time.Duration
+	now := time.Now()
+	for _, cookie := range cookies {
+		value, ok := rateLimitCookies.Load(strings.TrimSpace(cookie))
+		if !ok {
+			continue
+		}
+		remaining := value.(RateLimitCookie).ExpirationTime.Sub(now)
+		if remaining > 0 && (retryAfter == 0 || remaining < retryAfter) {
+			retryAfter = remaining
+		}
+	}
+	return retryAfter
+}
+
+var (
+	rateLimitModels sync.Map // 上游返回限流的模型及其恢复时间
+)
+
+func AddRateLimitModel(model string, expirationTime time.Time) {
+	rateLimitModels.Store(model, expirationTime)
+}
+
+func IsRateLimitedModel(model string) bool {
+	if value, ok := rateLimitModels.Load(model); ok {
+		if value.(time.Time).After(time.Now()) {
+			return true
+		}
+		rateLimitModels.Delete(model)
+	}
+	return false
+}
+
 type CookieManager struct {
 	Cookies      []string
 	currentIndex int
@@ -97,15 +431,17 @@ func InitGSCookies() {
 
 	GSCookies = []string{}
 
-	// 从环境变量中读取 GS_COOKIE 并拆分为切片
-	cookieStr := os.Getenv("GS_COOKIE")
+	// 从环境变量(或配置文件)中读取 GS_COOKIE 并拆分为切片
+	cookieStr := env.String("GS_COOKIE", "")
 	if cookieStr != "" {
 
 		for _, cookie := range strings.Split(cookieStr, ",") {
-			// 如果 cookie 不包含 "session_id="，则添加前缀
-			if !strings.Contains(cookie, "session_id=") {
-				cookie = "session_id=" + cookie
+			// 解析并最小化 cookie,格式有误的 cookie 直接忽略(启动时已校验)
+			cookie, tags, err := ParseTaggedCookie(cookie)
+			if err != nil {
+				continue
 			}
+			SetCookieTags(cookie, tags)
 			GSCookies = append(GSCookies, cookie)
 		}
 	}
@@ -118,7 +454,7 @@ func RemoveCookie(cookieToRemove string) {
 
 	// 创建一个新的切片，过滤掉需要删除的 cookie
 	var newCookies []string
-	for _, cookie := range GetGSCookies() {
+	for _, cookie := range GSCookies {
 		if cookie != cookieToRemove {
 			newCookies = append(newCookies, cookie)
 		}
@@ -128,10 +464,39 @@ func RemoveCookie(cookieToRemove string) {
 	GSCookies = newCookies
 }
 
+// ReplaceCookie 替换全局与各租户 cookie 池中的 cookie(如过盾后更新 cf_clearance),
+// 替换时生成新的切片,已取得的 cookie 池不受影响
+func ReplaceCookie(oldCookie string, newCookie string) {
+	if tags := GetCookieTags(oldCookie); tags != nil {
+		SetCookieTags(newCookie, tags)
+	}
+
+	cookiesMutex.Lock()
+	GSCookies = replaceInSlice(GSCookies, oldCookie, newCookie)
+	cookiesMutex.Unlock()
+
+	replaceTenantCookie(oldCookie, newCookie)
+}
+
+// replaceInSlice 返回将 oldValue 替换为 newValue 后的新切片,不含 oldValue 时返回原切片
+func replaceInSlice(values []string, oldValue string, newValue string) []string {
+	if !lo.Contains(values, oldValue) {
+		return values
+	}
+	replaced := make([]string, len(values))
+	for i, value := range values {
+		if value == oldValue {
+			value = newValue
+		}
+		replaced[i] = value
+	}
+	return replaced
+}
+
 // GetGSCookies 获取 GSCookies 的副本
 func GetGSCookies() []string {
-	//cookiesMutex.Lock()
-	//defer cookiesMutex.Unlock()
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
 
 	// 返回 GSCookies 的副本，避免外部直接修改
 	cookiesCopy := make([]string, len(GSCookies))
@@ -141,9 +506,14 @@ func GetGSCookies() []string {
 
 // NewCookieManager 创建 CookieManager
 func NewCookieManager() *CookieManager {
+	return NewCookieManagerWithCookies(GetGSCookies())
+}
+
+// NewCookieManagerWithCookies 使用指定的 cookie 池创建 CookieManager
+func NewCookieManagerWithCookies(cookies []string) *CookieManager {
 	var validCookies []string
-	// 遍历 GSCookies
-	for _, cookie := range GetGSCookies() {
+	// 遍历 cookie 池
+	for _, cookie := range cookies {
 		cookie = strings.TrimSpace(cookie)
 		if cookie == "" {
 			continue // 忽略空字符串
@@ -243,10 +613,25 @@ func (cm *CookieManager) GetRandomCookie() (string, error) {
 	return cm.Cookies[randomIndex], nil
 }
 
-// SessionKey 定义复合键结构
+// SelectCookie 将当前 cookie 切换为指定 cookie,cookie 不在池中时返回 false
+func (cm *CookieManager) SelectCookie(cookie string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for i, item := range cm.Cookies {
+		if item == cookie {
+			cm.currentIndex = i
+			return true
+		}
+	}
+	return false
+}
+
+// SessionKey 定义复合键结构,Namespace 区分调用方,为空时所有调用方共享
 type SessionKey struct {
-	Cookie string
-	Model  string
+	Namespace string
+	Cookie    string
+	Model     string
 }
 
 // SessionManager 会话管理器
@@ -263,43 +648,46 @@ func NewSessionManager() *SessionManager {
 }
 
 // AddSession 添加会话记录（写操作，需要写锁）
-func (sm *SessionManager) AddSession(cookie string, model string, chatID string) {
+func (sm *SessionManager) AddSession(namespace string, cookie string, model string, chatID string) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	key := SessionKey{
-		Cookie: cookie,
-		Model:  model,
+		Namespace: namespace,
+		Cookie:    cookie,
+		Model:     model,
 	}
 	sm.sessions[key] = chatID
 }
 
 // GetChatID 获取会话ID（读操作，使用读锁）
-func (sm *SessionManager) GetChatID(cookie string, model string) (string, bool) {
+func (sm *SessionManager) GetChatID(namespace string, cookie string, model string) (string, bool) {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
 	key := SessionKey{
-		Cookie: cookie,
-		Model:  model,
+		Namespace: namespace,
+		Cookie:    cookie,
+		Model:     model,
 	}
 	chatID, exists := sm.sessions[key]
 	return chatID, exists
 }
 
 // DeleteSession 删除会话记录（写操作，需要写锁）
-func (sm *SessionManager) DeleteSession(cookie string, model string) {
+func (sm *SessionManager) DeleteSession(namespace string, cookie string, model string) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	key := SessionKey{
-		Cookie: cookie,
-		Model:  model,
+		Namespace: namespace,
+		Cookie:    cookie,
+		Model:     model,
 	}
 	delete(sm.sessions, key)
 }
 
-// GetChatIDsByCookie 获取指定cookie关联的所有chatID列表(读操作,使用读锁)
+// GetChatIDsByCookie 获取指定cookie关联的所有chatID列表(不区分命名空间,读操作,使用读锁)
 func (sm *SessionManager) GetChatIDsByCookie(cookie string) []string {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"genspark2api/common/env"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 模型对 cookie 标签的要求 格式: model=tier:plus|region:us,model2*=tier:plus
+var ModelCookieTagsStr = env.String("MODEL_COOKIE_TAGS", "")
+var ModelCookieTags = make(map[string]map[string]string)
+
+// 无 cookie 满足模型标签要求(如仅有免费账号)时降配使用的模型 格式: model=fallback,model2*=fallback2
+var ModelTierFallbackStr = env.String("MODEL_TIER_FALLBACK", "")
+var ModelTierFallback = make(map[string]string)
+
+var (
+	cookieTags      = make(map[string]map[string]string) // cookie -> 标签
+	cookieTagsMutex sync.RWMutex
+)
+
+// ParseTaggedCookie 解析带标签的 cookie,格式: cookie|tier=plus|region=us
+func ParseTaggedCookie(raw string) (string, map[string]string, error) {
+	parts := strings.Split(raw, "|")
+	cookie, err := ParseCookie(parts[0])
+	if err != nil {
+		return "", nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return "", nil, fmt.Errorf("invalid cookie tag: %s", part)
+		}
+		tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return cookie, tags, nil
+}
+
+// ParseModelCookieTags 解析 MODEL_COOKIE_TAGS,模型名以*结尾时按前缀匹配
+func ParseModelCookieTags(str string) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid item: %s", pair)
+		}
+		tags := make(map[string]string)
+		for _, tag := range strings.Split(kv[1], "|") {
+			tagKv := strings.SplitN(strings.TrimSpace(tag), ":", 2)
+			if len(tagKv) != 2 || strings.TrimSpace(tagKv[0]) == "" || strings.TrimSpace(tagKv[1]) == "" {
+				return nil, fmt.Errorf("invalid tag: %s", tag)
+			}
+			tags[strings.TrimSpace(tagKv[0])] = strings.TrimSpace(tagKv[1])
+		}
+		result[strings.TrimSpace(kv[0])] = tags
+	}
+	return result, nil
+}
+
+// ParseModelTierFallback 解析 MODEL_TIER_FALLBACK,模型名以*结尾时按前缀匹配
+func ParseModelTierFallback(str string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(str, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid item: %s", pair)
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result, nil
+}
+
+// SetCookieTags 设置 cookie 的标签
+func SetCookieTags(cookie string, tags map[string]string) {
+	cookieTagsMutex.Lock()
+	defer cookieTagsMutex.Unlock()
+	if len(tags) == 0 {
+		delete(cookieTags, cookie)
+		return
+	}
+	cookieTags[cookie] = tags
+}
+
+// GetCookieTags 获取 cookie 的标签
+func GetCookieTags(cookie string) map[string]string {
+	cookieTagsMutex.RLock()
+	defer cookieTagsMutex.RUnlock()
+	return cookieTags[cookie]
+}
+
+// GetModelCookieTags 获取模型要求的 cookie 标签,精确匹配优先,其次为最长的前缀匹配
+func GetModelCookieTags(model string) map[string]string {
+	if tags, ok := ModelCookieTags[model]; ok {
+		return tags
+	}
+	var result map[string]string
+	longest := -1
+	for pattern, tags := range ModelCookieTags {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			result, longest = tags, len(prefix)
+		}
+	}
+	return result
+}
+
+// GetModelTierFallback 获取模型的降配模型,精确匹配优先,其次为最长的前缀匹配
+func GetModelTierFallback(model string) string {
+	if fallback, ok := ModelTierFallback[model]; ok {
+		return fallback
+	}
+	result := ""
+	longest := -1
+	for pattern, fallback := range ModelTierFallback {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			result, longest = fallback, len(prefix)
+		}
+	}
+	return result
+}
+
+// FilterCookiesByModel 过滤出满足模型标签要求的 cookie
+func FilterCookiesByModel(cookies []string, model string) []string {
+	required := GetModelCookieTags(model)
+	if len(required) == 0 {
+		return cookies
+	}
+	var result []string
+	for _, cookie := range cookies {
+		tags := GetCookieTags(cookie)
+		matched := true
+		for key, value := range required {
+			if tags[key] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, cookie)
+		}
+	}
+	return result
+}
+
+// FormatCookieTags 将标签格式化为 key=value,key=value(按 key 排序)
+func FormatCookieTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	items := make([]string, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, key+"="+tags[key])
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"genspark2api/common/env"
+	"strings"
+)
+
+// 解析cookie时保留的字段,其余字段会被丢弃
+var CookieKeepFields = strings.Split(env.String("COOKIE_KEEP_FIELDS", "session_id,cf_clearance"), ",")
+
+// ParseCookie 解析用户粘贴的cookie字符串:去除空白与非法字符,仅保留必要字段
+func ParseCookie(raw string) (string, error) {
+	// 去除换行、制表符等空白字符
+	raw = strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == '\t' {
+			return -1
+		}
+		return r
+	}, raw)
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("cookie is empty")
+	}
+
+	// 仅提供了 session_id 的值
+	if !strings.Contains(raw, "=") {
+		raw = "session_id=" + raw
+	}
+
+	fields := make(map[string]string)
+	for _, pair := range strings.Split(raw, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		name := strings.TrimSpace(kv[0])
+		fields[name] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+
+	if fields["session_id"] == "" {
+		return "", errors.New("cookie field session_id is missing")
+	}
+
+	// 只校验保留的字段,其余字段(如统计类 cookie)即使含非法字符也直接丢弃
+	var kept []string
+	for _, name := range CookieKeepFields {
+		name = strings.TrimSpace(name)
+		value, ok := fields[name]
+		if !ok || value == "" {
+			continue
+		}
+		if !isValidCookieValue(value) {
+			return "", fmt.Errorf("cookie field %s contains illegal characters", name)
+		}
+		kept = append(kept, name+"="+value)
+	}
+	return strings.Join(kept, "; "), nil
+}
+
+// isValidCookieValue 校验cookie值是否只包含合法字符(RFC 6265 cookie-octet)
+func isValidCookieValue(value string) bool {
+	for _, r := range value {
+		if r <= 0x20 || r >= 0x7f || r == '"' || r == ',' || r == ';' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetCookieField 设置 cookie 字符串中的字段,字段不存在时追加
+func SetCookieField(cookie string, name string, value string) string {
+	var parts []string
+	found := false
+	for _, part := range strings.Split(cookie, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, name+"=") {
+			part = name + "=" + value
+			found = true
+		}
+		parts = append(parts, part)
+	}
+	if !found {
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, "; ")
+}
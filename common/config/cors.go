@@ -0,0 +1,91 @@
+package config
+
+import (
+	"genspark2api/common/env"
+	"strings"
+	"sync"
+)
+
+// CorsConfig 跨域配置,可通过环境变量初始化并经管理接口在运行时修改
+type CorsConfig struct {
+	AllowOrigins     []string `json:"allow_origins"` // 支持 * 与 https://*.example.com 形式的通配
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"` // * 表示回显预检请求的 Access-Control-Request-Headers
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           int      `json:"max_age"` // 预检结果缓存时间(秒)
+}
+
+var (
+	corsConfig = CorsConfig{
+		AllowOrigins:     splitList(env.String("CORS_ALLOW_ORIGINS", "*")),
+		AllowMethods:     splitList(env.String("CORS_ALLOW_METHODS", "GET,POST,PUT,DELETE,OPTIONS")),
+		AllowHeaders:     splitList(env.String("CORS_ALLOW_HEADERS", "*")),
+		ExposeHeaders:    splitList(env.String("CORS_EXPOSE_HEADERS", "X-Request-Id,X-Response-Id,X-Upstream-Model,X-Actual-Model,X-Usage-Cost-Estimate,Retry-After")),
+		AllowCredentials: env.Int("CORS_ALLOW_CREDENTIALS", 0) == 1,
+		MaxAge:           env.Int("CORS_MAX_AGE", 12*60*60),
+	}
+	corsMutex sync.RWMutex
+)
+
+// GetCorsConfig 获取当前跨域配置
+func GetCorsConfig() CorsConfig {
+	corsMutex.RLock()
+	defer corsMutex.RUnlock()
+	return corsConfig
+}
+
+// SetCorsConfig 更新跨域配置(仅运行时生效,重启后恢复为环境变量配置)
+func SetCorsConfig(cfg CorsConfig) {
+	corsMutex.Lock()
+	defer corsMutex.Unlock()
+	corsConfig = cfg
+}
+
+// CredentialsWithWildcard 允许携带凭证时来源列表包含 *,会使任意来源都能携带凭证访问
+func (cfg CorsConfig) CredentialsWithWildcard() bool {
+	if !cfg.AllowCredentials {
+		return false
+	}
+	for _, allowed := range cfg.AllowOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowOrigin 判断来源是否允许跨域访问
+func (cfg CorsConfig) AllowOrigin(origin string) bool {
+	for _, allowed := range cfg.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowHeadersFor 预检响应的 Access-Control-Allow-Headers,配置为 * 时回显请求声明的请求头
+func (cfg CorsConfig) AllowHeadersFor(requestHeaders string) string {
+	for _, allowed := range cfg.AllowHeaders {
+		if allowed == "*" {
+			return requestHeaders
+		}
+	}
+	return strings.Join(cfg.AllowHeaders, ", ")
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"genspark2api/common/env"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ExperimentalModelText  = "text"
+	ExperimentalModelImage = "image"
+	ExperimentalModelVideo = "video"
+
+	ExperimentalModelStatusUnknown     = "unknown"
+	ExperimentalModelStatusAvailable   = "available"
+	ExperimentalModelStatusUnavailable = "unavailable"
+)
+
+// 实验模型持久化文件
+var ExperimentalModelsPath = env.String("EXPERIMENTAL_MODELS_PATH", "experimental-models.json")
+
+// 启动时加入白名单的实验模型 格式: 模型ID[:类型],类型为 text/image/video,默认 text,多个以,分隔
+var ExperimentalModelsStr = env.String("EXPERIMENTAL_MODELS", "")
+
+var GlobalExperimentalModelManager *ExperimentalModelManager
+
+// ExperimentalModel 上游灰度中的模型,加入白名单后出现在模型列表并可直接调用
+type ExperimentalModel struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Status      string `json:"status"` // 最近一次探测结果,unavailable 的模型不出现在模型列表中
+	Error       string `json:"error,omitempty"`
+	ProbedAt    int64  `json:"probed_at,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	persistable bool
+}
+
+// ExperimentalModelManager 实验模型白名单管理器
+type ExperimentalModelManager struct {
+	models map[string]*ExperimentalModel
+	mutex  sync.RWMutex
+}
+
+// NewExperimentalModelManager 创建实验模型管理器,加载持久化的模型并合并 EXPERIMENTAL_MODELS
+func NewExperimentalModelManager() (*ExperimentalModelManager, error) {
+	manager := &ExperimentalModelManager{
+		models: make(map[string]*ExperimentalModel),
+	}
+
+	for _, item := range splitList(ExperimentalModelsStr) {
+		id, modelType, _ := strings.Cut(item, ":")
+		model := &ExperimentalModel{ID: id, Type: modelType, CreatedAt: time.Now().Unix()}
+		if err := validateExperimentalModel(model); err != nil {
+			return manager, err
+		}
+		manager.models[model.ID] = model
+	}
+
+	data, err := os.ReadFile(ExperimentalModelsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manager, nil
+		}
+		return manager, err
+	}
+
+	var models []*ExperimentalModel
+	if err := json.Unmarshal(data, &models); err != nil {
+		return manager, err
+	}
+	for _, model := range models {
+		if err := validateExperimentalModel(model); err != nil {
+			return manager, err
+		}
+		model.persistable = true
+		manager.models[model.ID] = model
+	}
+	return manager, nil
+}
+
+// List 获取所有实验模型
+func (m *ExperimentalModelManager) List() []ExperimentalModel {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	models := make([]ExperimentalModel, 0, len(m.models))
+	for _, model := range m.models {
+		models = append(models, *model)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+	return models
+}
+
+// Listed 获取指定类型且最近探测未失败的模型ID,用于模型列表
+func (m *ExperimentalModelManager) Listed(modelType string) []string {
+	var ids []string
+	for _, model := range m.List() {
+		if model.Type == modelType && model.Status != ExperimentalModelStatusUnavailable {
+			ids = append(ids, model.ID)
+		}
+	}
+	return ids
+}
+
+// Get 按ID获取实验模型
+func (m *ExperimentalModelManager) Get(id string) (ExperimentalModel, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	model, ok := m.models[id]
+	if !ok {
+		return ExperimentalModel{}, false
+	}
+	return *model, true
+}
+
+// Is 是否为指定类型的实验模型
+func (m *ExperimentalModelManager) Is(id string, modelType string) bool {
+	if m == nil {
+		return false
+	}
+	model, ok := m.Get(id)
+	return ok && model.Type == modelType
+}
+
+// Set 新增或覆盖实验模型,类型变化时重置探测结果
+func (m *ExperimentalModelManager) Set(id string, modelType string) (ExperimentalModel, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	model := &ExperimentalModel{ID: id, Type: modelType, CreatedAt: time.Now().Unix()}
+	if err := validateExperimentalModel(model); err != nil {
+		return ExperimentalModel{}, err
+	}
+	if old, ok := m.models[model.ID]; ok {
+		model.CreatedAt = old.CreatedAt
+		if old.Type == model.Type {
+			model.Status, model.Error, model.ProbedAt = old.Status, old.Error, old.ProbedAt
+		}
+	}
+	model.persistable = true
+	m.models[model.ID] = model
+	return *model, m.save()
+}
+
+// SetProbeResult 记录探测结果,errMessage 为空表示可用
+func (m *ExperimentalModelManager) SetProbeResult(id string, errMessage string) (ExperimentalModel, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	model, ok := m.models[id]
+	if !ok {
+		return ExperimentalModel{}, errors.New("experimental model not found: " + id)
+	}
+	model.Status = ExperimentalModelStatusAvailable
+	if errMessage != "" {
+		model.Status = ExperimentalModelStatusUnavailable
+	}
+	model.Error = errMessage
+	model.ProbedAt = time.Now().Unix()
+	return *model, m.save()
+}
+
+// Remove 删除实验模型,EXPERIMENTAL_MODELS 中的模型重启后会重新加入
+func (m *ExperimentalModelManager) Remove(id string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.models[id]; !ok {
+		return false, nil
+	}
+	delete(m.models, id)
+	return true, m.save()
+}
+
+// validateExperimentalModel 校验并补全模型类型与状态
+func validateExperimentalModel(model *ExperimentalModel) error {
+	model.ID = strings.TrimSpace(model.ID)
+	model.Type = strings.ToLower(strings.TrimSpace(model.Type))
+	if model.ID == "" {
+		return errors.New("experimental model id is empty")
+	}
+	if model.Type == "" {
+		model.Type = ExperimentalModelText
+	}
+	switch model.Type {
+	case ExperimentalModelText, ExperimentalModelImage, ExperimentalModelVideo:
+	default:
+		return errors.New("invalid experimental model type: " + model.Type)
+	}
+	if model.Status == "" {
+		model.Status = ExperimentalModelStatusUnknown
+	}
+	return nil
+}
+
+// save 持久化通过管理接口添加的模型,调用方需持有写锁
+func (m *ExperimentalModelManager) save() error {
+	models := make([]*ExperimentalModel, 0, len(m.models))
+	for _, model := range m.models {
+		if model.persistable {
+			models = append(models, model)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+
+	data, err := json.MarshalIndent(models, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ExperimentalModelsPath, data, 0644)
+}
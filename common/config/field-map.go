@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"genspark2api/common/env"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上游事件字段的内部语义
+const (
+	FieldAnswer       = "answer"
+	FieldDetailAnswer = "detail_answer"
+	FieldMarkmap      = "markmap"
+	FieldThinkStart   = "think_start"
+	FieldThink        = "think"
+	FieldThinkEnd     = "think_end"
+	FieldLayer        = "layer"       // 多模型混合(MixtureModelList)各层各模型的中间答案
+	FieldSources      = "sources"     // 联网搜索(-search)的来源列表
+	FieldSuggestions  = "suggestions" // 后续问题建议
+)
+
+// 字段映射文件路径(JSON: {"上游字段名": "内部语义"}),以*结尾的字段名按前缀匹配
+var FieldMapPath = env.String("FIELD_MAP_PATH", "")
+var FieldMapReloadInterval = env.Int("FIELD_MAP_RELOAD_INTERVAL", 30)
+
+var defaultFieldMap = map[string]string{
+	"session_state.answer":                   FieldAnswer,
+	"session_state.streaming_detail_answer*": FieldDetailAnswer,
+	"session_state.streaming_markmap":        FieldMarkmap,
+	"session_state.answerthink_is_started":   FieldThinkStart,
+	"session_state.answerthink":              FieldThink,
+	"session_state.answerthink_is_finished":  FieldThinkEnd,
+	"session_state.layer_*":                  FieldLayer,
+	"session_state.search_results*":          FieldSources,
+	"session_state.sources*":                 FieldSources,
+	"session_state.suggestions*":             FieldSuggestions,
+}
+
+var (
+	fieldMap        = defaultFieldMap
+	fieldMapModTime time.Time
+	fieldMapMutex   sync.RWMutex
+)
+
+// LoadFieldMap 加载字段映射文件(与内置映射合并),文件未变化时返回 false
+func LoadFieldMap() (bool, error) {
+	if FieldMapPath == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(FieldMapPath)
+	if err != nil {
+		return false, err
+	}
+
+	fieldMapMutex.RLock()
+	unchanged := info.ModTime().Equal(fieldMapModTime)
+	fieldMapMutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(FieldMapPath)
+	if err != nil {
+		return false, err
+	}
+
+	var loaded map[string]string
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return false, err
+	}
+
+	newFieldMap := make(map[string]string, len(defaultFieldMap)+len(loaded))
+	for k, v := range defaultFieldMap {
+		newFieldMap[k] = v
+	}
+	for k, v := range loaded {
+		newFieldMap[k] = v
+	}
+
+	fieldMapMutex.Lock()
+	fieldMap = newFieldMap
+	fieldMapModTime = info.ModTime()
+	fieldMapMutex.Unlock()
+	return true, nil
+}
+
+// ResolveField 获取上游字段名对应的内部语义,未映射时返回空字符串;多个前缀匹配时取最长的前缀
+func ResolveField(fieldName string) string {
+	fieldMapMutex.RLock()
+	defer fieldMapMutex.RUnlock()
+
+	if semantic, ok := fieldMap[fieldName]; ok {
+		return semantic
+	}
+	matched, result := -1, ""
+	for k, semantic := range fieldMap {
+		prefix, ok := strings.CutSuffix(k, "*")
+		if ok && len(prefix) > matched && strings.HasPrefix(fieldName, prefix) {
+			matched, result = len(prefix), semantic
+		}
+	}
+	return result
+}
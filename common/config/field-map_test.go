@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+// TestResolveFieldOverlappingPrefixes 多个通配前缀重叠时稳定地取最长的前缀
+func TestResolveFieldOverlappingPrefixes(t *testing.T) {
+	original := fieldMap
+	fieldMap = map[string]string{
+		"message_*":          FieldAnswer,
+		"message_field*":     FieldThink,
+		"message_field_end*": FieldThinkEnd,
+		"message_exact":      FieldMarkmap,
+	}
+	defer func() { fieldMap = original }()
+
+	tests := map[string]string{
+		"message_other":       FieldAnswer,
+		"message_field_delta": FieldThink,
+		"message_field_end_1": FieldThinkEnd,
+		"message_exact":       FieldMarkmap,
+		"other":               "",
+	}
+	// map 遍历顺序随机,重复多次以覆盖不同顺序
+	for i := 0; i < 100; i++ {
+		for fieldName, want := range tests {
+			if got := ResolveField(fieldName); got != want {
+				t.Fatalf("ResolveField(%q) = %q, want %q", fieldName, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"genspark2api/common/env"
+	"genspark2api/common/random"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IpRuleTypeBlack = "black"
+	IpRuleTypeWhite = "white"
+)
+
+// IP规则持久化文件
+var IpRulesPath = env.String("IP_RULES_PATH", "ip-rules.json")
+
+// 连续鉴权失败自动封禁阈值(0:关闭)与封禁时长
+var IpAutoBanThreshold = env.Int("IP_AUTO_BAN_THRESHOLD", 0)
+var IpAutoBanDuration = env.Int("IP_AUTO_BAN_DURATION", 60*60)
+
+// 鉴权失败计数在最后一次失败后保留的时长,过期的计数定期清理
+const authFailureTTL = time.Hour
+
+var GlobalIpRuleManager *IpRuleManager
+
+type IpRule struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Cidr      string `json:"cidr"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"` // 0 表示永久
+	network   *net.IPNet
+}
+
+// authFailure 连续鉴权失败计数
+type authFailure struct {
+	count int
+	last  time.Time
+}
+
+// IpRuleManager IP黑白名单管理器
+type IpRuleManager struct {
+	rules        []*IpRule
+	staticRules  []*net.IPNet // 环境变量 IP_BLACK_LIST 中的静态规则
+	authFailures map[string]*authFailure
+	lastSweep    time.Time
+	mutex        sync.RWMutex
+}
+
+// NewIpRuleManager 创建IP规则管理器并加载持久化的规则
+func NewIpRuleManager() (*IpRuleManager, error) {
+	manager := &IpRuleManager{
+		authFailures: make(map[string]*authFailure),
+	}
+	for _, blockedIP := range IpBlackList {
+		if strings.TrimSpace(blockedIP) == "" {
+			continue
+		}
+		if network, err := ParseCidr(blockedIP); err == nil {
+			manager.staticRules = append(manager.staticRules, network)
+		}
+	}
+
+	data, err := os.ReadFile(IpRulesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manager, nil
+		}
+		return manager, err
+	}
+
+	var rules []*IpRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return manager, err
+	}
+	for _, rule := range rules {
+		network, err := ParseCidr(rule.Cidr)
+		if err != nil {
+			return manager, err
+		}
+		rule.network = network
+		manager.rules = append(manager.rules, rule)
+	}
+	return manager, nil
+}
+
+// ParseCidr 解析CIDR段,单个IP按 /32 或 /128 处理
+func ParseCidr(cidr string) (*net.IPNet, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, errors.New("invalid ip: " + cidr)
+		}
+		if ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+func (r *IpRule) expired(now int64) bool {
+	return r.ExpiresAt != 0 && r.ExpiresAt <= now
+}
+
+// List 获取所有未过期的规则
+func (m *IpRuleManager) List() []IpRule {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now().Unix()
+	rules := make([]IpRule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		if !rule.expired(now) {
+			rules = append(rules, *rule)
+		}
+	}
+	return rules
+}
+
+// Add 添加规则,duration 为0表示永久
+func (m *IpRuleManager) Add(ruleType string, cidr string, reason string, duration time.Duration) (IpRule, error) {
+	if ruleType != IpRuleTypeBlack && ruleType != IpRuleTypeWhite {
+		return IpRule{}, errors.New("invalid rule type: " + ruleType)
+	}
+	network, err := ParseCidr(cidr)
+	if err != nil {
+		return IpRule{}, err
+	}
+
+	now := time.Now()
+	rule := &IpRule{
+		ID:        random.GetUUID(),
+		Type:      ruleType,
+		Cidr:      network.String(),
+		Reason:    reason,
+		CreatedAt: now.Unix(),
+		network:   network,
+	}
+	if duration > 0 {
+		rule.ExpiresAt = now.Add(duration).Unix()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rules = append(m.rules, rule)
+	return *rule, m.save()
+}
+
+// Remove 删除规则
+func (m *IpRuleManager) Remove(id string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, rule := range m.rules {
+		if rule.ID == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return true, m.save()
+		}
+	}
+	return false, nil
+}
+
+// IsAllowed 判断IP是否允许访问,白名单优先,存在白名单时仅放行白名单内的IP
+func (m *IpRuleManager) IsAllowed(clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now().Unix()
+	hasWhiteRule := false
+	blocked := false
+	for _, rule := range m.rules {
+		if rule.expired(now) {
+			continue
+		}
+		switch rule.Type {
+		case IpRuleTypeWhite:
+			hasWhiteRule = true
+			if rule.network.Contains(ip) {
+				return true
+			}
+		case IpRuleTypeBlack:
+			if rule.network.Contains(ip) {
+				blocked = true
+			}
+		}
+	}
+	if hasWhiteRule || blocked {
+		return false
+	}
+
+	// 环境变量 IP_BLACK_LIST 中的静态规则
+	for _, network := range m.staticRules {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordAuthFailure 记录鉴权失败,连续失败达到阈值时自动临时封禁,返回是否触发封禁
+func (m *IpRuleManager) RecordAuthFailure(clientIP string) bool {
+	if IpAutoBanThreshold <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	m.mutex.Lock()
+	m.sweepAuthFailures(now)
+	failure, ok := m.authFailures[clientIP]
+	if !ok || now.Sub(failure.last) > authFailureTTL {
+		failure = &authFailure{}
+		m.authFailures[clientIP] = failure
+	}
+	failure.count++
+	failure.last = now
+	reached := failure.count >= IpAutoBanThreshold
+	if reached {
+		delete(m.authFailures, clientIP)
+	}
+	m.mutex.Unlock()
+
+	if !reached {
+		return false
+	}
+	_, err := m.Add(IpRuleTypeBlack, clientIP, "auto ban: too many auth failures", time.Duration(IpAutoBanDuration)*time.Second)
+	return err == nil
+}
+
+// ResetAuthFailure 鉴权成功后重置失败计数
+func (m *IpRuleManager) ResetAuthFailure(clientIP string) {
+	if IpAutoBanThreshold <= 0 {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.authFailures, clientIP)
+}
+
+// sweepAuthFailures 每分钟最多一次清理超过 authFailureTTL 的失败计数,调用方需持有写锁
+func (m *IpRuleManager) sweepAuthFailures(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for ip, failure := range m.authFailures {
+		if now.Sub(failure.last) > authFailureTTL {
+			delete(m.authFailures, ip)
+		}
+	}
+}
+
+// save 持久化规则(过期规则不落盘),调用方需持有写锁
+func (m *IpRuleManager) save() error {
+	now := time.Now().Unix()
+	rules := make([]*IpRule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		if !rule.expired(now) {
+			rules = append(rules, rule)
+		}
+	}
+	m.rules = rules
+
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(IpRulesPath, data, 0644)
+}
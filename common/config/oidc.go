@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"genspark2api/common/env"
+	"strings"
+)
+
+// 管理端角色
+const (
+	AdminRoleAdmin  = "admin"  // 可执行全部管理操作
+	AdminRoleViewer = "viewer" // 仅可调用只读(GET)管理接口
+)
+
+// OIDC 单点登录,配置 OIDC_ISSUER 后管理接口除 proxy-secret 外也接受 IdP 签发的 JWT(Authorization: Bearer)
+var (
+	OidcIssuer       = env.String("OIDC_ISSUER", "")
+	OidcClientId     = env.String("OIDC_CLIENT_ID", "")
+	OidcClientSecret = env.String("OIDC_CLIENT_SECRET", "")
+	OidcRedirectUrl  = env.String("OIDC_REDIRECT_URL", "") // 回调地址,如 https://host/admin/oidc/callback
+	OidcScopes       = env.String("OIDC_SCOPES", "openid profile email")
+	OidcRoleClaim    = env.String("OIDC_ROLE_CLAIM", "groups") // 角色所在的 claim,支持以.分隔的嵌套路径(如 realm_access.roles)
+	OidcRoleMapStr   = env.String("OIDC_ROLE_MAP", "")         // IdP 角色/组到管理端角色的映射,如 ops-admins=admin,ops=viewer
+	OidcDefaultRole  = env.String("OIDC_DEFAULT_ROLE", "")     // 未匹配任何映射时的角色,为空时拒绝访问
+)
+
+var OidcRoleMap = map[string]string{}
+
+// OidcEnabled 是否启用 OIDC 登录
+func OidcEnabled() bool {
+	return OidcIssuer != ""
+}
+
+// ParseOidcRoleMap 解析并校验 OIDC 配置
+func ParseOidcRoleMap() error {
+	if !OidcEnabled() {
+		return nil
+	}
+	if OidcClientId == "" {
+		return fmt.Errorf("OIDC_CLIENT_ID is required")
+	}
+	if OidcDefaultRole != "" && !isAdminRole(OidcDefaultRole) {
+		return fmt.Errorf("invalid OIDC_DEFAULT_ROLE %s", OidcDefaultRole)
+	}
+	for _, item := range strings.Split(OidcRoleMapStr, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		group, role, found := strings.Cut(item, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !found || group == "" || !isAdminRole(role) {
+			return fmt.Errorf("invalid OIDC_ROLE_MAP item %s", item)
+		}
+		OidcRoleMap[group] = role
+	}
+	return nil
+}
+
+// MapOidcRole 将 IdP 角色/组映射为管理端角色,多个匹配时取权限最高的角色
+func MapOidcRole(groups []string) string {
+	role := ""
+	for _, group := range groups {
+		switch OidcRoleMap[group] {
+		case AdminRoleAdmin:
+			return AdminRoleAdmin
+		case AdminRoleViewer:
+			role = AdminRoleViewer
+		}
+	}
+	if role == "" {
+		role = OidcDefaultRole
+	}
+	return role
+}
+
+func isAdminRole(role string) bool {
+	return role == AdminRoleAdmin || role == AdminRoleViewer
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"genspark2api/common/env"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// prompt 预设持久化文件
+var PresetsPath = env.String("PRESETS_PATH", "presets.json")
+
+var GlobalPresetManager *PresetManager
+
+// Preset 命名的 prompt 预设,通过请求字段 preset 或模型别名选择
+type Preset struct {
+	Name     string          `json:"name"`
+	Model    string          `json:"model"`    // 通过别名选择时实际使用的模型,为空时保持请求模型
+	Aliases  []string        `json:"aliases"`  // 绑定该预设的模型别名
+	Messages json.RawMessage `json:"messages"` // 前置消息,格式同 PRE_MESSAGES_JSON
+}
+
+// PresetManager prompt 预设管理器
+type PresetManager struct {
+	presets map[string]*Preset
+	mutex   sync.RWMutex
+}
+
+// NewPresetManager 创建预设管理器并加载持久化的预设
+func NewPresetManager() (*PresetManager, error) {
+	manager := &PresetManager{
+		presets: make(map[string]*Preset),
+	}
+
+	data, err := os.ReadFile(PresetsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manager, nil
+		}
+		return manager, err
+	}
+
+	var presets []*Preset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return manager, err
+	}
+	for _, preset := range presets {
+		if err := manager.validate(preset); err != nil {
+			return manager, err
+		}
+		manager.presets[preset.Name] = preset
+	}
+	return manager, nil
+}
+
+// List 获取所有预设
+func (m *PresetManager) List() []Preset {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	presets := make([]Preset, 0, len(m.presets))
+	for _, preset := range m.presets {
+		presets = append(presets, *preset)
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+	return presets
+}
+
+// Get 按名称获取预设
+func (m *PresetManager) Get(name string) (Preset, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	preset, ok := m.presets[name]
+	if !ok {
+		return Preset{}, false
+	}
+	return *preset, true
+}
+
+// GetByAlias 按模型别名获取预设
+func (m *PresetManager) GetByAlias(alias string) (Preset, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, preset := range m.presets {
+		for _, presetAlias := range preset.Aliases {
+			if presetAlias == alias {
+				return *preset, true
+			}
+		}
+	}
+	return Preset{}, false
+}
+
+// Set 新增或覆盖预设
+func (m *PresetManager) Set(preset Preset) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.validate(&preset); err != nil {
+		return err
+	}
+	m.presets[preset.Name] = &preset
+	return m.save()
+}
+
+// Remove 删除预设
+func (m *PresetManager) Remove(name string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.presets[name]; !ok {
+		return false, nil
+	}
+	delete(m.presets, name)
+	return true, m.save()
+}
+
+// validate 校验预设,别名不能与其他预设重复,调用方需持有锁或处于初始化阶段
+func (m *PresetManager) validate(preset *Preset) error {
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" {
+		return errors.New("preset name is empty")
+	}
+	if len(preset.Messages) == 0 {
+		preset.Messages = json.RawMessage("[]")
+	}
+	var messages []map[string]interface{}
+	if err := json.Unmarshal(preset.Messages, &messages); err != nil {
+		return errors.New("invalid preset messages: " + err.Error())
+	}
+	for _, other := range m.presets {
+		if other.Name == preset.Name {
+			continue
+		}
+		for _, alias := range preset.Aliases {
+			for _, otherAlias := range other.Aliases {
+				if alias == otherAlias {
+					return errors.New("alias " + alias + " is already used by preset " + other.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// save 持久化预设,调用方需持有写锁
+func (m *PresetManager) save() error {
+	presets := make([]*Preset, 0, len(m.presets))
+	for _, preset := range m.presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool {
+		return presets[i].Name < presets[j].Name
+	})
+
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(PresetsPath, data, 0644)
+}
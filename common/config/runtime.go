@@ -0,0 +1,321 @@
+package config
+
+import (
+	"fmt"
+	"genspark2api/common/env"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RuntimeConfig 上游请求的超时与重试配置及特性开关,可通过环境变量初始化并经管理接口在运行时修改
+type RuntimeConfig struct {
+	Timeouts                EndpointTimeouts `json:"timeouts"`
+	Retries                 EndpointRetries  `json:"retries"`
+	StreamFirstEventTimeout int              `json:"stream_first_event_timeout"` // 流式请求等待上游首个事件的超时时间(秒),超时后换 cookie 重试,0 为不限制
+	Flags                   map[string]bool  `json:"flags"`                      // 特性开关覆盖值,未设置的开关使用默认值
+	Canary                  CanaryConfig     `json:"canary"`
+	// 按模型注入的 system prompt,键为模型名,以 * 结尾时按前缀匹配
+	ModelSystemPrompts map[string]string `json:"model_system_prompts"`
+	// 按模型限制流式输出,键为模型名,以 * 结尾时按前缀匹配
+	ModelOutputLimits map[string]OutputLimit `json:"model_output_limits"`
+}
+
+// OutputLimit 流式输出上限,超过后以 finish_reason=length 结束,0 为不限制
+type OutputLimit struct {
+	MaxDuration int `json:"max_duration"` // 最大输出时长(秒),同时作为上游请求超时的上限,到时断开上游连接
+	MaxTokens   int `json:"max_tokens"`   // 最大输出 token 数
+}
+
+// CanaryConfig 金丝雀发布:进入金丝雀分组的请求优先使用 Flags 中的特性开关值
+type CanaryConfig struct {
+	Percent int             `json:"percent"` // 未通过请求头指定分组的请求按该比例(%)随机进入金丝雀分组
+	Flags   map[string]bool `json:"flags"`
+}
+
+// 请求的染色分组
+const (
+	CohortStable = "stable"
+	CohortCanary = "canary"
+)
+
+// 特性开关
+const (
+	FlagToolUse   = "tool_use"  // 工具调用(tools/tool_calls、Anthropic tool_use),关闭时忽略请求中的工具定义
+	FlagReasoning = "reasoning" // 输出思考过程
+	FlagCache     = "cache"     // 按 Idempotency-Key 回放已缓存的响应
+	// 规范化输出的 markdown(闭合代码块、修复表格分隔行、规范标题层级)
+	FlagMarkdownNormalize = "markdown_normalize"
+)
+
+// defaultFlags 特性开关默认值
+var defaultFlags = map[string]bool{
+	FlagToolUse:           true,
+	FlagReasoning:         ReasoningHide != 1,
+	FlagCache:             true,
+	FlagMarkdownNormalize: false,
+}
+
+// EndpointTimeouts 各接口上游请求超时(秒),流式请求包含读取响应的全部时间
+type EndpointTimeouts struct {
+	Chat   int `json:"chat"`   // 对话
+	Image  int `json:"image"`  // 生图请求与任务状态轮询
+	Video  int `json:"video"`  // 生视频请求与任务状态轮询
+	Upload int `json:"upload"` // 附件上传
+	Delete int `json:"delete"` // 删除会话
+}
+
+// EndpointRetries 各接口单次请求最多尝试的 cookie 数,0 为尝试全部 cookie
+type EndpointRetries struct {
+	Chat  int `json:"chat"`
+	Image int `json:"image"`
+	Video int `json:"video"`
+}
+
+var (
+	runtimeConfig = RuntimeConfig{
+		Timeouts: EndpointTimeouts{
+			Chat:   env.Int("UPSTREAM_TIMEOUT_CHAT", 300),
+			Image:  env.Int("UPSTREAM_TIMEOUT_IMAGE", 600),
+			Video:  env.Int("UPSTREAM_TIMEOUT_VIDEO", 1800),
+			Upload: env.Int("UPSTREAM_TIMEOUT_UPLOAD", 120),
+			Delete: env.Int("UPSTREAM_TIMEOUT_DELETE", 30),
+		},
+		Retries: EndpointRetries{
+			Chat:  env.Int("UPSTREAM_RETRY_CHAT", 0),
+			Image: env.Int("UPSTREAM_RETRY_IMAGE", 0),
+			Video: env.Int("UPSTREAM_RETRY_VIDEO", 0),
+		},
+		StreamFirstEventTimeout: env.Int("STREAM_FIRST_EVENT_TIMEOUT", 60),
+		Flags:                   parseFlags(env.String("FEATURE_FLAGS", "")),
+		Canary: CanaryConfig{
+			Percent: env.Int("CANARY_PERCENT", 0),
+			Flags:   parseFlags(env.String("CANARY_FLAGS", "")),
+		},
+	}
+	runtimeMutex sync.RWMutex
+)
+
+// GetRuntimeConfig 获取当前超时与重试配置,返回的 Flags、ModelSystemPrompts、ModelOutputLimits 为副本,可安全修改
+func GetRuntimeConfig() RuntimeConfig {
+	runtimeMutex.RLock()
+	defer runtimeMutex.RUnlock()
+	cfg := runtimeConfig
+	cfg.Flags = make(map[string]bool, len(runtimeConfig.Flags))
+	for key, enabled := range runtimeConfig.Flags {
+		cfg.Flags[key] = enabled
+	}
+	cfg.Canary.Flags = make(map[string]bool, len(runtimeConfig.Canary.Flags))
+	for key, enabled := range runtimeConfig.Canary.Flags {
+		cfg.Canary.Flags[key] = enabled
+	}
+	cfg.ModelSystemPrompts = make(map[string]string, len(runtimeConfig.ModelSystemPrompts))
+	for pattern, prompt := range runtimeConfig.ModelSystemPrompts {
+		cfg.ModelSystemPrompts[pattern] = prompt
+	}
+	cfg.ModelOutputLimits = make(map[string]OutputLimit, len(runtimeConfig.ModelOutputLimits))
+	for pattern, limit := range runtimeConfig.ModelOutputLimits {
+		cfg.ModelOutputLimits[pattern] = limit
+	}
+	return cfg
+}
+
+// SetRuntimeConfig 更新超时与重试配置(仅运行时生效,重启后恢复为环境变量配置)
+func SetRuntimeConfig(cfg RuntimeConfig) {
+	runtimeMutex.Lock()
+	defer runtimeMutex.Unlock()
+	runtimeConfig = cfg
+}
+
+// Validate 校验配置,超时须大于 0,重试次数与首事件超时不能为负数
+func (cfg RuntimeConfig) Validate() error {
+	timeouts := map[string]int{
+		"chat":   cfg.Timeouts.Chat,
+		"image":  cfg.Timeouts.Image,
+		"video":  cfg.Timeouts.Video,
+		"upload": cfg.Timeouts.Upload,
+		"delete": cfg.Timeouts.Delete,
+	}
+	for name, timeout := range timeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("timeouts.%s must be greater than 0", name)
+		}
+	}
+	if cfg.Retries.Chat < 0 || cfg.Retries.Image < 0 || cfg.Retries.Video < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if cfg.StreamFirstEventTimeout < 0 {
+		return fmt.Errorf("stream_first_event_timeout must not be negative")
+	}
+	for key := range cfg.Flags {
+		if _, ok := defaultFlags[key]; !ok {
+			return fmt.Errorf("unknown flag %s, available: %s", key, strings.Join(FlagKeys(), ","))
+		}
+	}
+	if cfg.Canary.Percent < 0 || cfg.Canary.Percent > 100 {
+		return fmt.Errorf("canary.percent must be between 0 and 100")
+	}
+	for key := range cfg.Canary.Flags {
+		if _, ok := defaultFlags[key]; !ok {
+			return fmt.Errorf("unknown canary flag %s, available: %s", key, strings.Join(FlagKeys(), ","))
+		}
+	}
+	for pattern := range cfg.ModelSystemPrompts {
+		if strings.TrimSpace(strings.TrimSuffix(pattern, "*")) == "" {
+			return fmt.Errorf("model_system_prompts has empty model name")
+		}
+	}
+	for pattern, limit := range cfg.ModelOutputLimits {
+		if strings.TrimSpace(strings.TrimSuffix(pattern, "*")) == "" {
+			return fmt.Errorf("model_output_limits has empty model name")
+		}
+		if limit.MaxDuration < 0 || limit.MaxTokens < 0 {
+			return fmt.Errorf("model_output_limits.%s must not be negative", pattern)
+		}
+	}
+	return nil
+}
+
+// FlagEnabled 查询特性开关,优先使用运行时覆盖值,未覆盖时使用默认值,未知开关返回 false
+func FlagEnabled(key string) bool {
+	runtimeMutex.RLock()
+	enabled, ok := runtimeConfig.Flags[key]
+	runtimeMutex.RUnlock()
+	if ok {
+		return enabled
+	}
+	return defaultFlags[key]
+}
+
+// FlagEnabledFor 按请求的染色分组查询特性开关,金丝雀分组优先使用 Canary.Flags
+func FlagEnabledFor(cohort string, key string) bool {
+	if cohort == CohortCanary {
+		runtimeMutex.RLock()
+		enabled, ok := runtimeConfig.Canary.Flags[key]
+		runtimeMutex.RUnlock()
+		if ok {
+			return enabled
+		}
+	}
+	return FlagEnabled(key)
+}
+
+// PickCohort 按染色请求头(canary/stable,1/0,true/false)确定分组,未指定时按 Canary.Percent 随机分组;
+// 未配置金丝雀特性开关时返回空字符串,不做染色
+func PickCohort(header string) string {
+	runtimeMutex.RLock()
+	canary := runtimeConfig.Canary
+	runtimeMutex.RUnlock()
+	if len(canary.Flags) == 0 {
+		return ""
+	}
+	switch strings.ToLower(strings.TrimSpace(header)) {
+	case CohortCanary, "1", "true":
+		return CohortCanary
+	case CohortStable, "0", "false":
+		return CohortStable
+	}
+	if rand.Intn(100) < canary.Percent {
+		return CohortCanary
+	}
+	return CohortStable
+}
+
+// GetModelSystemPrompt 获取模型需要注入的 system prompt,精确匹配优先,其次按最长前缀匹配
+func GetModelSystemPrompt(model string) string {
+	runtimeMutex.RLock()
+	prompts := runtimeConfig.ModelSystemPrompts
+	runtimeMutex.RUnlock()
+	return matchModel(prompts, model)
+}
+
+// GetModelOutputLimit 获取模型的流式输出上限,匹配规则同 GetModelSystemPrompt
+func GetModelOutputLimit(model string) OutputLimit {
+	runtimeMutex.RLock()
+	limits := runtimeConfig.ModelOutputLimits
+	runtimeMutex.RUnlock()
+	return matchModel(limits, model)
+}
+
+// matchModel 按模型名取值,精确匹配优先,其次按以 * 结尾的最长前缀匹配,未匹配时返回零值
+func matchModel[T any](values map[string]T, model string) T {
+	if value, ok := values[model]; ok {
+		return value
+	}
+	var result T
+	longest := -1
+	for pattern, value := range values {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			result, longest = value, len(prefix)
+		}
+	}
+	return result
+}
+
+// FlagKeys 所有特性开关名(按字母排序)
+func FlagKeys() []string {
+	keys := make([]string, 0, len(defaultFlags))
+	for key := range defaultFlags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FlagDefault 特性开关默认值
+func FlagDefault(key string) (bool, bool) {
+	enabled, ok := defaultFlags[key]
+	return enabled, ok
+}
+
+// SetFlag 覆盖特性开关(仅运行时生效),立即对之后的请求生效
+func SetFlag(key string, enabled bool) {
+	updateFlags(func(flags map[string]bool) {
+		flags[key] = enabled
+	})
+}
+
+// ResetFlag 清除特性开关的覆盖值,恢复默认值
+func ResetFlag(key string) {
+	updateFlags(func(flags map[string]bool) {
+		delete(flags, key)
+	})
+}
+
+// updateFlags 复制后修改覆盖值,读取方持有的旧 map 不受影响
+func updateFlags(update func(flags map[string]bool)) {
+	runtimeMutex.Lock()
+	defer runtimeMutex.Unlock()
+	flags := make(map[string]bool, len(runtimeConfig.Flags)+1)
+	for key, enabled := range runtimeConfig.Flags {
+		flags[key] = enabled
+	}
+	update(flags)
+	runtimeConfig.Flags = flags
+}
+
+// parseFlags 解析 FEATURE_FLAGS(如 tool_use=false,cache=true)
+func parseFlags(flagsStr string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, item := range strings.Split(flagsStr, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			continue
+		}
+		if enabled, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			flags[strings.TrimSpace(key)] = enabled
+		}
+	}
+	return flags
+}
+
+// LimitRetries 按重试配置限制尝试次数,limit 为 0 或不小于 cookie 数时尝试全部 cookie
+func LimitRetries(cookies int, limit int) int {
+	if limit > 0 && limit < cookies {
+		return limit
+	}
+	return cookies
+}
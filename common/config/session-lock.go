@@ -0,0 +1,48 @@
+package config
+
+import "sync"
+
+type chatSessionKey struct {
+	Cookie string
+	ChatId string
+}
+
+type chatSessionLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var (
+	chatSessionLocks      = make(map[chatSessionKey]*chatSessionLock)
+	chatSessionLocksMutex sync.Mutex
+)
+
+// LockChatSession 获取 (cookie, chatId) 会话锁,保证复用同一会话的请求串行进入上游,返回释放函数
+func LockChatSession(cookie string, chatId string) func() {
+	key := chatSessionKey{Cookie: cookie, ChatId: chatId}
+
+	chatSessionLocksMutex.Lock()
+	lock, ok := chatSessionLocks[key]
+	if !ok {
+		lock = &chatSessionLock{}
+		chatSessionLocks[key] = lock
+	}
+	lock.refs++
+	chatSessionLocksMutex.Unlock()
+
+	lock.mu.Lock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lock.mu.Unlock()
+
+			chatSessionLocksMutex.Lock()
+			lock.refs--
+			if lock.refs == 0 {
+				delete(chatSessionLocks, key)
+			}
+			chatSessionLocksMutex.Unlock()
+		})
+	}
+}
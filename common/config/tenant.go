@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/env"
+	"os"
+	"strings"
+	"sync"
+)
+
+// gin.Context 中保存当前租户的键
+const TenantKey = "tenant"
+
+// 租户配置文件(JSON数组),为空时不启用多租户模式
+var TenantsPath = env.String("TENANTS_PATH", "")
+var TenantAuditDir = env.String("TENANT_AUDIT_DIR", "audit")
+
+type Tenant struct {
+	ID           string            `json:"id"`
+	ApiKeys      []string          `json:"api_keys"`
+	KeyPrefix    string            `json:"key_prefix"`
+	Cookies      []string          `json:"cookies"`
+	ModelChatMap map[string]string `json:"model_chat_map"`
+	RateLimit    int               `json:"rate_limit"` // 每分钟请求数,0 表示不限制
+	// 单次请求的最大 prompt tokens 与最大预计费用(美元),0 表示使用全局配置
+	MaxPromptTokens int     `json:"max_prompt_tokens"`
+	MaxRequestCost  float64 `json:"max_request_cost"`
+}
+
+var (
+	tenants      []*Tenant
+	tenantsMutex sync.RWMutex
+)
+
+// LoadTenants 加载租户配置,租户的 cookie 会按 GS_COOKIE 同样的规则解析
+func LoadTenants() error {
+	if TenantsPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(TenantsPath)
+	if err != nil {
+		return err
+	}
+
+	var loaded []*Tenant
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	ids := make(map[string]bool)
+	for _, tenant := range loaded {
+		if tenant.ID == "" {
+			return fmt.Errorf("tenant id is empty")
+		}
+		if ids[tenant.ID] {
+			return fmt.Errorf("tenant %s is duplicated", tenant.ID)
+		}
+		ids[tenant.ID] = true
+
+		for i, cookie := range tenant.Cookies {
+			parsed, tags, err := ParseTaggedCookie(cookie)
+			if err != nil {
+				return fmt.Errorf("tenant %s cookie %d: %v", tenant.ID, i+1, err)
+			}
+			SetCookieTags(parsed, tags)
+			tenant.Cookies[i] = parsed
+		}
+	}
+
+	tenantsMutex.Lock()
+	tenants = loaded
+	tenantsMutex.Unlock()
+	return nil
+}
+
+// GetTenants 获取所有租户
+func GetTenants() []*Tenant {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+	return tenants
+}
+
+// GetTenantById 按租户ID获取租户
+func GetTenantById(id string) (*Tenant, bool) {
+	for _, tenant := range GetTenants() {
+		if tenant.ID == id {
+			return tenant, true
+		}
+	}
+	return nil, false
+}
+
+// GetTenantByApiKey 按 API key 或 key 前缀获取租户
+func GetTenantByApiKey(apiKey string) (*Tenant, bool) {
+	if apiKey == "" {
+		return nil, false
+	}
+	for _, tenant := range GetTenants() {
+		for _, key := range tenant.ApiKeys {
+			if key == apiKey {
+				return tenant, true
+			}
+		}
+		if tenant.KeyPrefix != "" && strings.HasPrefix(apiKey, tenant.KeyPrefix) {
+			return tenant, true
+		}
+	}
+	return nil, false
+}
+
+// GetCookies 获取租户的 cookie 池,cookie 替换时整体更换切片,返回的切片不会被修改
+func (t *Tenant) GetCookies() []string {
+	tenantsMutex.RLock()
+	defer tenantsMutex.RUnlock()
+	return t.Cookies
+}
+
+// replaceTenantCookie 替换各租户 cookie 池中的 cookie
+func replaceTenantCookie(oldCookie string, newCookie string) {
+	tenantsMutex.Lock()
+	defer tenantsMutex.Unlock()
+	for _, tenant := range tenants {
+		tenant.Cookies = replaceInSlice(tenant.Cookies, oldCookie, newCookie)
+	}
+}
+
+// HasApiKey 判断 API key 是否属于该租户
+func (t *Tenant) HasApiKey(apiKey string) bool {
+	for _, key := range t.ApiKeys {
+		if key == apiKey {
+			return true
+		}
+	}
+	return false
+}
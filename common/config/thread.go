@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"genspark2api/common/env"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 会话(threads)持久化文件,为空时仅保存在内存中
+var ThreadsPath = env.String("THREADS_PATH", "")
+
+// 单个会话最多保存的消息数,超出时丢弃最早的消息,0 为不限制
+var ThreadMaxMessages = env.Int("THREAD_MAX_MESSAGES", 200)
+
+// 会话自最后一次写入起的保留时长(秒),过期后删除,0 为永不过期
+var ThreadTTL = env.Int("THREAD_TTL", 7*24*3600)
+
+var GlobalThreadManager *ThreadManager
+
+// Thread 服务端保存的会话
+type Thread struct {
+	ID        string            `json:"id"`
+	Object    string            `json:"object"`
+	CreatedAt int64             `json:"created_at"`
+	Metadata  map[string]string `json:"metadata"`
+	Owner     string            `json:"-"` // 调用方标识,会话仅对创建者可见
+	Messages  []ThreadMessage   `json:"-"`
+	UpdatedAt int64             `json:"-"` // 最后一次写入时间,用于过期清理
+}
+
+// ThreadMessage 会话中的消息,content 格式同对话请求中的消息
+type ThreadMessage struct {
+	ID        string      `json:"id"`
+	Object    string      `json:"object"`
+	CreatedAt int64       `json:"created_at"`
+	ThreadId  string      `json:"thread_id"`
+	Role      string      `json:"role"`
+	Content   interface{} `json:"content"`
+}
+
+// storedThread 持久化格式
+type storedThread struct {
+	Thread
+	Owner     string          `json:"owner"`
+	Messages  []ThreadMessage `json:"messages"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+// ThreadManager 会话管理器
+type ThreadManager struct {
+	threads map[string]*Thread
+	mutex   sync.RWMutex
+}
+
+// NewThreadManager 创建会话管理器并加载持久化的会话
+func NewThreadManager() (*ThreadManager, error) {
+	manager := &ThreadManager{
+		threads: make(map[string]*Thread),
+	}
+	if ThreadsPath == "" {
+		return manager, nil
+	}
+
+	data, err := os.ReadFile(ThreadsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manager, nil
+		}
+		return manager, err
+	}
+
+	var stored []storedThread
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return manager, err
+	}
+	for _, item := range stored {
+		thread := item.Thread
+		thread.Owner = item.Owner
+		thread.Messages = item.Messages
+		thread.UpdatedAt = item.UpdatedAt
+		if thread.UpdatedAt == 0 {
+			thread.UpdatedAt = thread.CreatedAt
+		}
+		manager.threads[thread.ID] = &thread
+	}
+	manager.removeExpired()
+	return manager, nil
+}
+
+// Create 新建会话
+func (m *ThreadManager) Create(thread Thread) (Thread, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	thread.Messages = trimThreadMessages(thread.Messages)
+	thread.UpdatedAt = time.Now().Unix()
+	m.threads[thread.ID] = &thread
+	return thread, m.save()
+}
+
+// Get 获取调用方的会话
+func (m *ThreadManager) Get(id string, owner string) (Thread, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	thread, ok := m.threads[id]
+	if !ok || thread.Owner != owner || threadExpired(thread) {
+		return Thread{}, false
+	}
+	result := *thread
+	result.Messages = append([]ThreadMessage(nil), thread.Messages...)
+	return result, true
+}
+
+// Remove 删除调用方的会话
+func (m *ThreadManager) Remove(id string, owner string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	thread, ok := m.threads[id]
+	if !ok || thread.Owner != owner {
+		return false, nil
+	}
+	delete(m.threads, id)
+	return true, m.save()
+}
+
+// AddMessage 向调用方的会话追加消息
+func (m *ThreadManager) AddMessage(id string, owner string, message ThreadMessage) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	thread, ok := m.threads[id]
+	if !ok || thread.Owner != owner || threadExpired(thread) {
+		return false, nil
+	}
+	thread.Messages = trimThreadMessages(append(thread.Messages, message))
+	thread.UpdatedAt = time.Now().Unix()
+	return true, m.save()
+}
+
+// trimThreadMessages 丢弃超出 THREAD_MAX_MESSAGES 的最早消息
+func trimThreadMessages(messages []ThreadMessage) []ThreadMessage {
+	if ThreadMaxMessages > 0 && len(messages) > ThreadMaxMessages {
+		return append([]ThreadMessage(nil), messages[len(messages)-ThreadMaxMessages:]...)
+	}
+	return messages
+}
+
+// threadExpired 会话是否已超过 THREAD_TTL 未写入
+func threadExpired(thread *Thread) bool {
+	return ThreadTTL > 0 && time.Now().Unix()-thread.UpdatedAt > int64(ThreadTTL)
+}
+
+// removeExpired 删除过期会话,调用方需持有写锁
+func (m *ThreadManager) removeExpired() {
+	for id, thread := range m.threads {
+		if threadExpired(thread) {
+			delete(m.threads, id)
+		}
+	}
+}
+
+// save 清理过期会话并持久化,调用方需持有写锁
+func (m *ThreadManager) save() error {
+	m.removeExpired()
+	if ThreadsPath == "" {
+		return nil
+	}
+
+	stored := make([]storedThread, 0, len(m.threads))
+	for _, thread := range m.threads {
+		stored = append(stored, storedThread{Thread: *thread, Owner: thread.Owner, Messages: thread.Messages, UpdatedAt: thread.UpdatedAt})
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].CreatedAt < stored[j].CreatedAt
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ThreadsPath, data, 0600)
+}
@@ -0,0 +1,52 @@
+package connstat
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	openConnections  int64
+	idleConnections  int64
+	totalConnections int64
+	connStates       sync.Map // net.Conn -> http.ConnState
+)
+
+type Stats struct {
+	Open  int64 `json:"open"`  // 当前连接数
+	Idle  int64 `json:"idle"`  // 其中空闲(keep-alive)连接数
+	Total int64 `json:"total"` // 启动以来累计连接数
+}
+
+// ConnState 用于 http.Server.ConnState,统计下游连接数
+func ConnState(conn net.Conn, state http.ConnState) {
+	if prev, ok := connStates.Load(conn); ok && prev.(http.ConnState) == http.StateIdle {
+		atomic.AddInt64(&idleConnections, -1)
+	}
+
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&totalConnections, 1)
+		atomic.AddInt64(&openConnections, 1)
+		connStates.Store(conn, state)
+	case http.StateIdle:
+		atomic.AddInt64(&idleConnections, 1)
+		connStates.Store(conn, state)
+	case http.StateActive:
+		connStates.Store(conn, state)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&openConnections, -1)
+		connStates.Delete(conn)
+	}
+}
+
+// Snapshot 获取当前连接数
+func Snapshot() Stats {
+	return Stats{
+		Open:  atomic.LoadInt64(&openConnections),
+		Idle:  atomic.LoadInt64(&idleConnections),
+		Total: atomic.LoadInt64(&totalConnections),
+	}
+}
@@ -99,6 +99,13 @@ var ImageModelList = []string{
 	"fal-ai/image-editing/text-removal",
 }
 
+// 图像编辑类模型,需要传入原图,prompt 可选
+var ImageEditModelList = []string{
+	"fal-ai/recraft-clarity-upscale",
+	"fal-bria-rmbg",
+	"fal-ai/image-editing/text-removal",
+}
+
 var VideoModelList = []string{
 	"gemini/veo3.1",
 	"gemini/veo3.1/reference-to-video",
@@ -122,4 +129,11 @@ var VideoModelList = []string{
 	"fal-ai/bytedance-upscaler/upscale/video",
 }
 
+// 可传入多张图片(参考图、首尾帧)的视频模型及最多可传入的图片数,其余视频模型仅支持一张图片
+var VideoMultiImageModels = map[string]int{
+	"gemini/veo3.1/reference-to-video":        3,
+	"gemini/veo3.1/first-last-frame-to-video": 2,
+	"kling/o3/reference-to-video":             7,
+}
+
 //
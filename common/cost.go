@@ -0,0 +1,12 @@
+package common
+
+import "genspark2api/common/config"
+
+// EstimateCost 按 MODEL_PRICE_MAP 价格表估算单次请求费用(美元),未配置价格的模型返回 false
+func EstimateCost(model string, promptTokens int, completionTokens int) (float64, bool) {
+	price, ok := config.ModelPriceMap[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1000000, true
+}
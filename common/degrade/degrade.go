@@ -0,0 +1,150 @@
+package degrade
+
+import (
+	"genspark2api/common/config"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	ReasonSelfReport = "self_report"
+	ReasonTooShort   = "too_short"
+	ReasonRefusal    = "refusal"
+)
+
+// 默认拒绝模式:回复开头即道歉/拒绝
+const defaultRefusalPattern = `(?i)^\s*(I'm sorry|I am sorry|I cannot|I can't|I'm unable|I am unable|抱歉|对不起|很抱歉|我无法|我不能)`
+
+// 回复中的自我介绍片段,如 "I am Claude"、"我是 GPT-4o"
+var selfReportRegex = regexp.MustCompile(`(?i)(I am|I'm|我是|作为)[^.。!！?？\n]{0,40}`)
+
+// 模型系列及其自报关键词
+var modelFamilies = map[string][]string{
+	"gpt":      {"gpt", "chatgpt", "openai"},
+	"claude":   {"claude", "anthropic"},
+	"gemini":   {"gemini", "google"},
+	"deepseek": {"deepseek"},
+	"grok":     {"grok", "xai"},
+}
+
+var (
+	refusalRegex *regexp.Regexp
+	initOnce     sync.Once
+
+	mu    sync.Mutex
+	stats = make(map[string]*ModelStats)
+)
+
+type ModelStats struct {
+	Detected int64            `json:"detected"` // 命中次数
+	Retried  int64            `json:"retried"`  // 触发重试次数
+	Reasons  map[string]int64 `json:"reasons"`  // 各原因命中次数
+}
+
+func initRefusalRegex() {
+	pattern := config.DegradeRefusalPattern
+	if pattern == "" {
+		pattern = defaultRefusalPattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		compiled = regexp.MustCompile(defaultRefusalPattern)
+	}
+	refusalRegex = compiled
+}
+
+// Enabled 是否开启降智检测
+func Enabled() bool {
+	return config.DegradeDetect == 1
+}
+
+// Detect 检测回复是否疑似降智,返回命中原因,未命中时返回空
+func Detect(modelName string, content string) string {
+	initOnce.Do(initRefusalRegex)
+
+	content = strings.TrimSpace(content)
+	if mismatchSelfReport(modelName, content) {
+		return ReasonSelfReport
+	}
+	if config.DegradeMinLength > 0 && len([]rune(content)) < config.DegradeMinLength {
+		return ReasonTooShort
+	}
+	if refusalRegex.MatchString(content) {
+		return ReasonRefusal
+	}
+	return ""
+}
+
+// mismatchSelfReport 回复中自报的模型系列与请求模型不符
+func mismatchSelfReport(modelName string, content string) bool {
+	expected := getModelFamily(modelName)
+	if expected == "" {
+		return false
+	}
+	for _, sentence := range selfReportRegex.FindAllString(content, -1) {
+		sentence = strings.ToLower(sentence)
+		if containsAny(sentence, modelFamilies[expected]) {
+			continue
+		}
+		for family, keywords := range modelFamilies {
+			if family != expected && containsAny(sentence, keywords) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getModelFamily(modelName string) string {
+	modelName = strings.ToLower(modelName)
+	if strings.HasPrefix(modelName, "o1") || strings.HasPrefix(modelName, "o3") || strings.HasPrefix(modelName, "o4") {
+		return "gpt"
+	}
+	for family := range modelFamilies {
+		if strings.Contains(modelName, family) {
+			return family
+		}
+	}
+	return ""
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record 记录一次降智事件
+func Record(modelName string, reason string, retried bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	modelStats, ok := stats[modelName]
+	if !ok {
+		modelStats = &ModelStats{Reasons: make(map[string]int64)}
+		stats[modelName] = modelStats
+	}
+	modelStats.Detected++
+	modelStats.Reasons[reason]++
+	if retried {
+		modelStats.Retried++
+	}
+}
+
+// Snapshot 获取各模型的降智事件统计
+func Snapshot() map[string]ModelStats {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make(map[string]ModelStats, len(stats))
+	for modelName, modelStats := range stats {
+		reasons := make(map[string]int64, len(modelStats.Reasons))
+		for reason, count := range modelStats.Reasons {
+			reasons[reason] = count
+		}
+		result[modelName] = ModelStats{Detected: modelStats.Detected, Retried: modelStats.Retried, Reasons: reasons}
+	}
+	return result
+}
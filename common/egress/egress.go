@@ -0,0 +1,214 @@
+package egress
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	directNode   = "direct"
+	probeTimeout = 10 * time.Second
+)
+
+// Node 出口节点
+type Node struct {
+	Name      string    `json:"name"`
+	Proxy     string    `json:"-"`          // 代理地址,直连时为空
+	Scheme    string    `json:"scheme"`     // 代理协议,直连时为 direct
+	Healthy   bool      `json:"healthy"`    // 最近一次测速是否成功
+	LatencyMs int64     `json:"latency_ms"` // 最近一次测速的耗时
+	LastError string    `json:"last_error,omitempty"`
+	ProbedAt  time.Time `json:"probed_at"`
+	Selected  bool      `json:"selected"` // 当前是否为选中的出口
+}
+
+var (
+	nodes    []*Node
+	selected *Node
+	mu       sync.RWMutex
+)
+
+// Init 解析 PROXY_NODES,PROXY_URL 同时配置时作为名为 default 的节点参与测速
+func Init() error {
+	if config.ProxyNodes == "" {
+		return nil
+	}
+	if config.ProxyUrl != "" {
+		nodes = append(nodes, &Node{Name: "default", Proxy: config.ProxyUrl, Scheme: proxyScheme(config.ProxyUrl)})
+	}
+	for i, item := range strings.Split(config.ProxyNodes, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, rawUrl := fmt.Sprintf("node-%d", i+1), item
+		// 名称=地址,代理地址本身不含 = 之前的 ://
+		if index := strings.Index(item, "="); index > 0 && !strings.Contains(item[:index], "://") {
+			name, rawUrl = strings.TrimSpace(item[:index]), strings.TrimSpace(item[index+1:])
+		}
+		if rawUrl == directNode {
+			nodes = append(nodes, &Node{Name: name, Scheme: directNode})
+			continue
+		}
+		proxyUrl, err := config.NormalizeProxyUrl(rawUrl)
+		if err != nil {
+			return fmt.Errorf("node %s: %v", name, err)
+		}
+		nodes = append(nodes, &Node{Name: name, Proxy: proxyUrl, Scheme: proxyScheme(proxyUrl)})
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no valid node")
+	}
+	if config.ProxyProbeInterval <= 0 {
+		return fmt.Errorf("PROXY_PROBE_INTERVAL must be greater than 0")
+	}
+	// 测速完成前使用第一个节点
+	nodes[0].Selected = true
+	selected = nodes[0]
+	return nil
+}
+
+// Enabled 是否配置了多出口节点
+func Enabled() bool {
+	return len(nodes) > 0
+}
+
+// Proxy 当前选中出口的代理地址,直连时返回空字符串;未配置多出口时返回 PROXY_URL
+func Proxy() string {
+	if !Enabled() {
+		return config.ProxyUrl
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return selected.Proxy
+}
+
+// ProbeTask 启动时及每隔 PROXY_PROBE_INTERVAL 秒对所有节点测速并切换到延迟最低的可用节点
+func ProbeTask() {
+	if !Enabled() {
+		return
+	}
+	for {
+		Probe()
+		time.Sleep(time.Duration(config.ProxyProbeInterval) * time.Second)
+	}
+}
+
+// Probe 并发测速所有节点并重新选择出口
+func Probe() {
+	var wg sync.WaitGroup
+	type result struct {
+		latency time.Duration
+		err     error
+	}
+	results := make([]result, len(nodes))
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			latency, err := probe(node)
+			results[i] = result{latency: latency, err: err}
+		}(i, node)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now()
+	for i, node := range nodes {
+		node.ProbedAt = now
+		node.LatencyMs = results[i].latency.Milliseconds()
+		if results[i].err != nil {
+			if node.Healthy || node.LastError == "" {
+				logger.SysError(fmt.Sprintf("egress node %s probe failed: %v", node.Name, results[i].err))
+			}
+			node.Healthy = false
+			node.LastError = results[i].err.Error()
+		} else {
+			node.Healthy = true
+			node.LastError = ""
+		}
+	}
+
+	candidates := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Healthy {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		// 全部不可用时保持当前出口
+		return
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LatencyMs < candidates[j].LatencyMs
+	})
+	if candidates[0] != selected {
+		logger.SysLog(fmt.Sprintf("egress switched from %s to %s (%dms)", selected.Name, candidates[0].Name, candidates[0].LatencyMs))
+		selected.Selected = false
+		candidates[0].Selected = true
+		selected = candidates[0]
+	}
+}
+
+// probe 测量经该节点请求测速地址的首字节耗时,net/http 不支持的 socks4 代理仅测量与代理的 TCP 握手耗时
+func probe(node *Node) (time.Duration, error) {
+	start := time.Now()
+	if node.Scheme == "socks4" {
+		proxyUrl, _ := url.Parse(node.Proxy)
+		conn, err := net.DialTimeout("tcp", proxyUrl.Host, probeTimeout)
+		if err != nil {
+			return time.Since(start), err
+		}
+		conn.Close()
+		return time.Since(start), nil
+	}
+
+	transport := &http.Transport{}
+	if node.Proxy != "" {
+		proxyUrl, err := url.Parse(node.Proxy)
+		if err != nil {
+			return 0, err
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: probeTimeout}
+
+	resp, err := client.Get(config.ProxyProbeUrl)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return latency, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// Snapshot 获取各节点的测速结果
+func Snapshot() []Node {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, *node)
+	}
+	return result
+}
+
+func proxyScheme(proxyUrl string) string {
+	if index := strings.Index(proxyUrl, "://"); index > 0 {
+		return proxyUrl[:index]
+	}
+	return "http"
+}
@@ -0,0 +1,180 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	kindString = "string"
+	kindInt    = "int"
+	kindFloat  = "float"
+	kindBool   = "bool"
+)
+
+// ConfigFile 配置文件路径(YAML/JSON),配置项与环境变量同名,环境变量优先
+var ConfigFile = os.Getenv("CONFIG_FILE")
+
+type fileValue struct {
+	value string
+	line  int
+}
+
+var (
+	fileValues  = make(map[string]fileValue)
+	fileError   error
+	registry    = make(map[string]string) // 已读取的配置项 -> 类型
+	registryMux sync.Mutex
+)
+
+func init() {
+	fileError = loadConfigFile(ConfigFile)
+}
+
+// loadConfigFile 解析配置文件,JSON 作为 YAML 的子集一并解析
+// 列表以,拼接;映射以 key=value 形式按,拼接;名称以 _JSON 结尾的配置项整体序列化为 JSON
+func loadConfigFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	document := root.Content[0]
+	if document.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: top level must be a mapping of configuration keys", path, document.Line)
+	}
+
+	for i := 0; i+1 < len(document.Content); i += 2 {
+		keyNode, valueNode := document.Content[i], document.Content[i+1]
+		name := strings.ToUpper(keyNode.Value)
+		if previous, ok := fileValues[name]; ok {
+			return fmt.Errorf("%s:%d: %s is duplicated (first defined at line %d)", path, keyNode.Line, keyNode.Value, previous.line)
+		}
+		value, err := nodeToString(name, valueNode)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", path, valueNode.Line, keyNode.Value, err)
+		}
+		fileValues[name] = fileValue{value: value, line: keyNode.Line}
+	}
+	return nil
+}
+
+func nodeToString(name string, node *yaml.Node) (string, error) {
+	if strings.HasSuffix(name, "_JSON") && node.Kind != yaml.ScalarNode {
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return scalarToString(node), nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("line %d: list items must be scalars", item.Line)
+			}
+			items = append(items, scalarToString(item))
+		}
+		return strings.Join(items, ","), nil
+	case yaml.MappingNode:
+		items := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("line %d: mapping values must be scalars", node.Content[i+1].Line)
+			}
+			items = append(items, node.Content[i].Value+"="+scalarToString(node.Content[i+1]))
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", errors.New("unsupported value")
+	}
+}
+
+// scalarToString 布尔值统一转为 true/false,与开关类环境变量的取值一致
+func scalarToString(node *yaml.Node) string {
+	switch node.Tag {
+	case "!!null":
+		return ""
+	case "!!bool":
+		var value bool
+		if err := node.Decode(&value); err == nil {
+			return strconv.FormatBool(value)
+		}
+	}
+	return node.Value
+}
+
+// lookup 读取配置项并登记类型,环境变量优先于配置文件
+func lookup(name string, kind string) string {
+	registryMux.Lock()
+	registry[name] = kind
+	registryMux.Unlock()
+
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fileValues[name].value
+}
+
+// ValidateConfigFile 校验配置文件,返回解析错误与类型错误,以及未知配置项的警告,信息带行号
+// 未知配置项可能是直接读取环境变量的配置或拼写错误,只作警告,需在所有配置项读取完成后调用
+func ValidateConfigFile() (errs []error, warnings []string) {
+	if ConfigFile == "" {
+		return nil, nil
+	}
+	if fileError != nil {
+		return []error{fileError}, nil
+	}
+
+	registryMux.Lock()
+	defer registryMux.Unlock()
+
+	names := make([]string, 0, len(fileValues))
+	for name := range fileValues {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return fileValues[names[i]].line < fileValues[names[j]].line
+	})
+
+	for _, name := range names {
+		value := fileValues[name]
+		kind, ok := registry[name]
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("%s:%d: unknown configuration key %s", ConfigFile, value.line, name))
+		case value.value == "":
+		case kind == kindInt:
+			if _, err := strconv.Atoi(value.value); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %s must be an integer, got %q", ConfigFile, value.line, name, value.value))
+			}
+		case kind == kindFloat:
+			if _, err := strconv.ParseFloat(value.value, 64); err != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %s must be a number, got %q", ConfigFile, value.line, name, value.value))
+			}
+		}
+	}
+	return errs, warnings
+}
@@ -1,22 +1,23 @@
 package env
 
 import (
-	"os"
 	"strconv"
 )
 
 func Bool(env string, defaultValue bool) bool {
-	if env == "" || os.Getenv(env) == "" {
+	value := lookup(env, kindBool)
+	if env == "" || value == "" {
 		return defaultValue
 	}
-	return os.Getenv(env) == "true"
+	return value == "true"
 }
 
 func Int(env string, defaultValue int) int {
-	if env == "" || os.Getenv(env) == "" {
+	value := lookup(env, kindInt)
+	if env == "" || value == "" {
 		return defaultValue
 	}
-	num, err := strconv.Atoi(os.Getenv(env))
+	num, err := strconv.Atoi(value)
 	if err != nil {
 		return defaultValue
 	}
@@ -24,10 +25,11 @@ func Int(env string, defaultValue int) int {
 }
 
 func Float64(env string, defaultValue float64) float64 {
-	if env == "" || os.Getenv(env) == "" {
+	value := lookup(env, kindFloat)
+	if env == "" || value == "" {
 		return defaultValue
 	}
-	num, err := strconv.ParseFloat(os.Getenv(env), 64)
+	num, err := strconv.ParseFloat(value, 64)
 	if err != nil {
 		return defaultValue
 	}
@@ -35,8 +37,9 @@ func Float64(env string, defaultValue float64) float64 {
 }
 
 func String(env string, defaultValue string) string {
-	if env == "" || os.Getenv(env) == "" {
+	value := lookup(env, kindString)
+	if env == "" || value == "" {
 		return defaultValue
 	}
-	return os.Getenv(env)
+	return value
 }
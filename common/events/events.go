@@ -0,0 +1,218 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/task"
+	"github.com/samber/lo"
+	"net/http"
+	"plugin"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 事件类型
+const (
+	TypeRequestStart     = "request.start"
+	TypeUpstreamResponse = "upstream.response"
+	TypeRequestError     = "request.error"
+	TypeRequestComplete  = "request.complete"
+)
+
+var eventTypes = []string{TypeRequestStart, TypeUpstreamResponse, TypeRequestError, TypeRequestComplete}
+
+// Event 总线上的事件,插件与 webhook 收到其 JSON 序列化结果
+type Event struct {
+	Type             string `json:"type"`
+	Time             int64  `json:"time"`
+	RequestId        string `json:"request_id,omitempty"`
+	TenantId         string `json:"tenant_id,omitempty"`
+	Method           string `json:"method,omitempty"`
+	Path             string `json:"path,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Status           int    `json:"status,omitempty"`
+	DurationMs       int64  `json:"duration_ms,omitempty"`
+	Cookie           int    `json:"cookie,omitempty"`   // 上游尝试使用的 cookie 序号,从 1 开始
+	Category         string `json:"category,omitempty"` // 上游尝试的结果类别
+	PromptTokens     int    `json:"prompt_tokens,omitempty"`
+	CompletionTokens int    `json:"completion_tokens,omitempty"`
+}
+
+// Handler 事件处理函数,每个订阅者在独立的协程中按发布顺序逐个处理
+type Handler func(event Event)
+
+type subscriber struct {
+	name    string
+	types   []string
+	handler Handler
+	queue   chan Event // 待处理的事件,已满时丢弃新事件
+}
+
+var (
+	mutex       sync.RWMutex
+	subscribers []*subscriber
+	httpClient  = &http.Client{Timeout: 10 * time.Second}
+)
+
+// Init 按 EVENT_WEBHOOK_URL 注册内置 webhook,按 EVENT_PLUGINS 加载 Go 插件
+func Init() error {
+	if config.EventQueueSize <= 0 {
+		return errors.New("EVENT_QUEUE_SIZE must be positive")
+	}
+	if config.EventWebhookUrl != "" {
+		if !strings.HasPrefix(config.EventWebhookUrl, "http://") && !strings.HasPrefix(config.EventWebhookUrl, "https://") {
+			return fmt.Errorf("invalid url: %s", config.EventWebhookUrl)
+		}
+		types, err := parseTypes(config.EventWebhookEvents)
+		if err != nil {
+			return err
+		}
+		url, secret := config.EventWebhookUrl, config.EventWebhookSecret
+		Subscribe("webhook", types, func(event Event) { webhook(url, secret, event) })
+	}
+	for _, path := range strings.Split(config.EventPlugins, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if err := loadPlugin(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func parseTypes(str string) ([]string, error) {
+	var types []string
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !lo.Contains(eventTypes, item) {
+			return nil, fmt.Errorf("unknown event type: %s", item)
+		}
+		types = append(types, item)
+	}
+	return types, nil
+}
+
+// loadPlugin 加载导出 OnEvent func([]byte) 的 Go 插件,可选导出 Events []string 指定订阅的事件类型
+func loadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	symbol, err := p.Lookup("OnEvent")
+	if err != nil {
+		return err
+	}
+	onEvent, ok := symbol.(func([]byte))
+	if !ok {
+		return errors.New("OnEvent must be func([]byte)")
+	}
+	var types []string
+	if symbol, err := p.Lookup("Events"); err == nil {
+		value, ok := symbol.(*[]string)
+		if !ok {
+			return errors.New("Events must be []string")
+		}
+		for _, item := range *value {
+			if !lo.Contains(eventTypes, item) {
+				return fmt.Errorf("unknown event type: %s", item)
+			}
+		}
+		types = *value
+	}
+	Subscribe("plugin", types, func(event Event) {
+		data, _ := json.Marshal(event)
+		onEvent(data)
+	})
+	logger.SysLog("event plugin loaded: " + path)
+	return nil
+}
+
+// Subscribe 订阅指定类型的事件,types 为空时订阅全部事件,name 用于区分后台任务。
+// 每个订阅者有容量为 EVENT_QUEUE_SIZE 的队列,由一个守护协程按发布顺序处理
+func Subscribe(name string, types []string, handler Handler) {
+	s := &subscriber{name: name, types: types, handler: handler, queue: make(chan Event, max(config.EventQueueSize, 1))}
+	mutex.Lock()
+	subscribers = append(subscribers, s)
+	mutex.Unlock()
+	task.Daemon("event-"+name, s.run)
+}
+
+func (s *subscriber) run() {
+	for event := range s.queue {
+		s.handle(event)
+	}
+}
+
+// handle 处理单个事件,订阅者的 panic 不影响后续事件
+func (s *subscriber) handle(event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.SysError(fmt.Sprintf("event subscriber %s panic: %v", s.name, r))
+		}
+	}()
+	s.handler(event)
+}
+
+// Enabled 是否有订阅者,未订阅时调用方可跳过事件的组装
+func Enabled() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(subscribers) > 0
+}
+
+// Publish 异步分发事件,订阅者的错误与 panic 不影响请求处理;订阅者的队列已满时丢弃该事件
+func Publish(event Event) {
+	if event.Time == 0 {
+		event.Time = time.Now().UnixMilli()
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, s := range subscribers {
+		if len(s.types) > 0 && !lo.Contains(s.types, event.Type) {
+			continue
+		}
+		select {
+		case s.queue <- event:
+		default:
+			logger.SysError(fmt.Sprintf("event subscriber %s queue is full, dropped %s event of request %s", s.name, event.Type, event.RequestId))
+		}
+	}
+}
+
+// webhook 以 POST JSON 推送事件,配置了 EVENT_WEBHOOK_SECRET 时在 X-Event-Signature 请求头中携带请求体的 HMAC-SHA256 签名
+func webhook(url string, secret string, event Event) {
+	body, _ := json.Marshal(event)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		logger.SysError("failed to send event: " + err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Event-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		logger.SysError("failed to send event: " + err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logger.SysError(fmt.Sprintf("failed to send event: status code %d", resp.StatusCode))
+	}
+}
@@ -0,0 +1,314 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上游错误类别
+const (
+	CategoryCloudflareChallenge = "cloudflare_challenge"
+	CategoryCloudflareBlock     = "cloudflare_block"
+	CategoryServiceUnavailable  = "service_unavailable"
+	CategoryRateLimit           = "rate_limit"
+	CategoryFreeLimit           = "free_limit"
+	CategoryNotLogin            = "not_login"
+	CategoryServerError         = "server_error"
+	CategoryServerOverloaded    = "server_overloaded"
+)
+
+// categories 所有错误类别,Classify 按此顺序匹配
+var categories = []string{
+	CategoryCloudflareChallenge,
+	CategoryCloudflareBlock,
+	CategoryServiceUnavailable,
+	CategoryRateLimit,
+	CategoryFreeLimit,
+	CategoryNotLogin,
+	CategoryServerError,
+	CategoryServerOverloaded,
+}
+
+// Rule 指纹规则:满足 Require 后,Equals/Keywords/Patterns 中命中的条数达到 MinMatches 时判定为 Category
+type Rule struct {
+	Category   string   `json:"category"`
+	Require    string   `json:"require,omitempty"`     // 须先匹配的正则,作用于去除首尾空白后的文本
+	Equals     []string `json:"equals,omitempty"`      // 去除首尾空白后与其完全相等
+	Keywords   []string `json:"keywords,omitempty"`    // 包含该关键字
+	Patterns   []string `json:"patterns,omitempty"`    // 匹配该正则
+	MinMatches int      `json:"min_matches,omitempty"` // 至少命中的条数,默认 1
+	Builtin    bool     `json:"builtin"`
+}
+
+// Sample 指纹样本,Category 为空表示不应命中任何类别
+type Sample struct {
+	Name     string `json:"name,omitempty"`
+	Category string `json:"category"`
+	Text     string `json:"text"`
+}
+
+// SampleResult 样本的校验结果
+type SampleResult struct {
+	Sample
+	Actual string `json:"actual"`
+	Passed bool   `json:"passed"`
+}
+
+// Ruleset 指纹规则文件(JSON),规则优先于内置规则匹配,样本与内置样本一起在加载时校验
+type Ruleset struct {
+	Rules   []Rule   `json:"rules"`
+	Samples []Sample `json:"samples"`
+}
+
+type compiledRule struct {
+	Rule
+	require  *regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+var (
+	rules         []*compiledRule
+	samples       []Sample
+	modTime       time.Time
+	failedModTime time.Time // 最近一次加载失败的文件修改时间,文件未再变更时不重复加载
+	mutex         sync.RWMutex
+)
+
+// Init 编译内置规则,配置了 FINGERPRINT_RULES_PATH 时加载规则文件
+func Init() error {
+	compiled, err := compile(defaultRules)
+	if err != nil {
+		return err
+	}
+	if failed := failedSamples(compiled, defaultSamples); len(failed) > 0 {
+		return fmt.Errorf("builtin sample %s failed", sampleName(failed[0].Sample))
+	}
+	mutex.Lock()
+	rules, samples = compiled, defaultSamples
+	mutex.Unlock()
+
+	_, err = Load()
+	return err
+}
+
+// Load 加载指纹规则文件,文件未变化时返回 false;规则无效或样本校验失败时保留原规则并返回错误,
+// 同一次变更只报告一次错误
+func Load() (bool, error) {
+	if config.FingerprintRulesPath == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(config.FingerprintRulesPath)
+	if err != nil {
+		return false, err
+	}
+
+	mutex.RLock()
+	unchanged := info.ModTime().Equal(modTime) || info.ModTime().Equal(failedModTime)
+	mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	compiled, newSamples, err := loadRuleset(config.FingerprintRulesPath)
+	if err != nil {
+		mutex.Lock()
+		failedModTime = info.ModTime()
+		mutex.Unlock()
+		return false, err
+	}
+
+	mutex.Lock()
+	rules, samples = compiled, newSamples
+	modTime = info.ModTime()
+	mutex.Unlock()
+	return true, nil
+}
+
+// loadRuleset 读取并编译规则文件,规则文件中的规则与样本在内置规则与样本之前,样本须全部通过
+func loadRuleset(path string) ([]*compiledRule, []Sample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ruleset Ruleset
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, nil, err
+	}
+	for i := range ruleset.Rules {
+		ruleset.Rules[i].Builtin = false
+	}
+
+	compiled, err := compile(append(ruleset.Rules, defaultRules...))
+	if err != nil {
+		return nil, nil, err
+	}
+	newSamples := append(append([]Sample{}, ruleset.Samples...), defaultSamples...)
+	if failed := failedSamples(compiled, newSamples); len(failed) > 0 {
+		return nil, nil, fmt.Errorf("sample %s expected %q but got %q", sampleName(failed[0].Sample), failed[0].Category, failed[0].Actual)
+	}
+	return compiled, newSamples, nil
+}
+
+// Match 文本是否命中指定类别的指纹
+func Match(data string, category string) bool {
+	mutex.RLock()
+	current := rules
+	mutex.RUnlock()
+	return match(current, data, category)
+}
+
+// Classify 按类别顺序返回文本命中的第一个类别,未命中时返回空字符串
+func Classify(data string) string {
+	mutex.RLock()
+	current := rules
+	mutex.RUnlock()
+	return classify(current, data)
+}
+
+// Rules 获取当前生效的规则,规则文件中的规则在前
+func Rules() []Rule {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	result := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, rule.Rule)
+	}
+	return result
+}
+
+// VerifySamples 用当前规则校验全部样本
+func VerifySamples() []SampleResult {
+	mutex.RLock()
+	current, currentSamples := rules, samples
+	mutex.RUnlock()
+	return verify(current, currentSamples)
+}
+
+func compile(ruleList []Rule) ([]*compiledRule, error) {
+	compiled := make([]*compiledRule, 0, len(ruleList))
+	for i, rule := range ruleList {
+		if !isCategory(rule.Category) {
+			return nil, fmt.Errorf("rule %d: unknown category %q, available: %s", i, rule.Category, strings.Join(categories, ","))
+		}
+		if len(rule.Equals)+len(rule.Keywords)+len(rule.Patterns) == 0 {
+			return nil, fmt.Errorf("rule %d: equals, keywords or patterns is required", i)
+		}
+		if rule.MinMatches <= 0 {
+			rule.MinMatches = 1
+		}
+		c := &compiledRule{Rule: rule}
+		if rule.Require != "" {
+			require, err := regexp.Compile(rule.Require)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid require: %w", i, err)
+			}
+			c.require = require
+		}
+		for _, pattern := range rule.Patterns {
+			compiledPattern, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern: %w", i, err)
+			}
+			c.patterns = append(c.patterns, compiledPattern)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func match(ruleList []*compiledRule, data string, category string) bool {
+	for _, rule := range ruleList {
+		if rule.Category == category && rule.matches(data) {
+			return true
+		}
+	}
+	return false
+}
+
+func classify(ruleList []*compiledRule, data string) string {
+	for _, category := range categories {
+		if match(ruleList, data, category) {
+			return category
+		}
+	}
+	return ""
+}
+
+func (r *compiledRule) matches(data string) bool {
+	trimmed := strings.TrimSpace(data)
+	if r.require != nil && !r.require.MatchString(trimmed) {
+		return false
+	}
+	count := 0
+	for _, equal := range r.Equals {
+		if trimmed == equal {
+			count++
+		}
+	}
+	for _, keyword := range r.Keywords {
+		if strings.Contains(data, keyword) {
+			count++
+		}
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(data) {
+			count++
+		}
+	}
+	return count >= r.MinMatches
+}
+
+// verify 样本须命中其类别;类别为空的样本不应命中任何类别
+func verify(ruleList []*compiledRule, sampleList []Sample) []SampleResult {
+	results := make([]SampleResult, 0, len(sampleList))
+	for _, sample := range sampleList {
+		result := SampleResult{Sample: sample, Actual: classify(ruleList, sample.Text)}
+		if sample.Category == "" {
+			result.Passed = result.Actual == ""
+		} else {
+			result.Passed = match(ruleList, sample.Text, sample.Category)
+			if result.Passed {
+				result.Actual = sample.Category
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func failedSamples(ruleList []*compiledRule, sampleList []Sample) []SampleResult {
+	var failed []SampleResult
+	for _, result := range verify(ruleList, sampleList) {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+func sampleName(sample Sample) string {
+	if sample.Name != "" {
+		return sample.Name
+	}
+	if len(sample.Text) > 40 {
+		return fmt.Sprintf("%q", sample.Text[:40]+"...")
+	}
+	return fmt.Sprintf("%q", sample.Text)
+}
+
+func isCategory(category string) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package fingerprint
+
+import (
+	"genspark2api/common/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBuiltinSamples 内置样本库须全部通过内置规则的校验
+func TestBuiltinSamples(t *testing.T) {
+	compiled, err := compile(defaultRules)
+	if err != nil {
+		t.Fatalf("compile builtin rules: %v", err)
+	}
+	for _, result := range verify(compiled, defaultSamples) {
+		t.Run(sampleName(result.Sample), func(t *testing.T) {
+			if !result.Passed {
+				t.Errorf("expected %q but got %q", result.Category, result.Actual)
+			}
+		})
+	}
+}
+
+// TestClassify 内置规则对常见上游响应的识别
+func TestClassify(t *testing.T) {
+	compiled, err := compile(defaultRules)
+	if err != nil {
+		t.Fatalf("compile builtin rules: %v", err)
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"rate limit with surrounding spaces", "  Rate limit exceeded cf1\n", CategoryRateLimit},
+		{"rate limit inside other text", "error: Rate limit exceeded cf1", ""},
+		{"internal server error", "Internal Server Error", CategoryServerError},
+		{"not login inside response", `prefix {"status":-5,"message":"not login","data":{}} suffix`, CategoryNotLogin},
+		{"challenge markers without html page", `window._cf_chl_opt = {}`, ""},
+		{"normal answer", `data: {"type": "message_field_delta", "field_name": "session_state.answer", "delta": "hello"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(compiled, tt.text); got != tt.want {
+				t.Errorf("classify(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoad 规则文件无效或样本校验失败时保留原规则,同一次变更只报告一次错误
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  bool
+		text     string // 加载后用于识别的文本
+		category string // text 的期望类别
+	}{
+		{
+			name:     "custom rule with sample",
+			content:  `{"rules":[{"category":"rate_limit","keywords":["Too many requests"]}],"samples":[{"category":"rate_limit","text":"Too many requests, slow down"}]}`,
+			text:     "Too many requests, slow down",
+			category: CategoryRateLimit,
+		},
+		{
+			name:    "invalid json",
+			content: `{"rules":[`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown category",
+			content: `{"rules":[{"category":"teapot","keywords":["418"]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			content: `{"rules":[{"category":"rate_limit","patterns":["("]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "rule breaking builtin sample",
+			content: `{"rules":[{"category":"rate_limit","keywords":["session_state.answer"]}]}`,
+			wantErr: true,
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "fingerprints.json")
+	previous := config.FingerprintRulesPath
+	config.FingerprintRulesPath = ""
+	t.Cleanup(func() { config.FingerprintRulesPath = previous })
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.FingerprintRulesPath = ""
+			if err := Init(); err != nil {
+				t.Fatalf("init: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("write rules: %v", err)
+			}
+			// 每个用例使用不同的修改时间,避免被视为未变更
+			modified := time.Now().Add(time.Duration(i+1) * time.Minute)
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatalf("chtimes: %v", err)
+			}
+			config.FingerprintRulesPath = path
+
+			reloaded, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got reloaded=%v", reloaded)
+				}
+				if Classify("Rate limit exceeded cf1") != CategoryRateLimit {
+					t.Errorf("builtin rules should be kept after a failed load")
+				}
+				// 文件未再变更时不重复报告
+				if reloaded, err := Load(); reloaded || err != nil {
+					t.Errorf("second load = (%v, %v), want (false, nil)", reloaded, err)
+				}
+				return
+			}
+			if err != nil || !reloaded {
+				t.Fatalf("load = (%v, %v), want (true, nil)", reloaded, err)
+			}
+			if got := Classify(tt.text); got != tt.category {
+				t.Errorf("Classify(%q) = %q, want %q", tt.text, got, tt.category)
+			}
+			if reloaded, err := Load(); reloaded || err != nil {
+				t.Errorf("unchanged load = (%v, %v), want (false, nil)", reloaded, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package fingerprint
+
+// defaultRules 内置指纹规则,规则文件中的规则优先匹配
+var defaultRules = []Rule{
+	{
+		Category: CategoryCloudflareChallenge,
+		Require:  `^<!DOCTYPE html><html.*?><head>.*?</head><body.*?>.*?</body></html>$`,
+		Patterns: []string{
+			`<title>Just a moment\.\.\.</title>`,          // 标题特征
+			`window\._cf_chl_opt`,                         // CF 配置对象
+			`challenge-platform/h/b/orchestrate/chl_page`, // CF challenge 路径
+			`cdn-cgi/challenge-platform`,                  // CDN 路径特征
+			`<meta http-equiv="refresh" content="\d+">`,   // 刷新 meta 标签
+		},
+		Builtin: true,
+	},
+	{
+		Category: CategoryCloudflareBlock,
+		Keywords: []string{`<h1 data-translate="block_headline">Sorry, you have been blocked</h1>`},
+		Builtin:  true,
+	},
+	{
+		Category: CategoryServiceUnavailable,
+		Require:  `^<!doctype html><html.*?><head>.*?</head><body.*?>.*?</body></html>`,
+		Patterns: []string{
+			`<title>Genspark</title>`,                           // 标题特征
+			`Service\s+Unavailable`,                             // 错误信息
+			`class="bb".*?class="s1".*?class="s2".*?class="s3"`, // 特征性类名结构
+			`genspark_logo\.png`,                                // Logo 图片
+			`gensparkpublicblob-cdn.*?\.azurefd\.net`,           // CDN 域名
+			`<div class="tt">Service Unavailable</div>`,         // 错误信息容器
+		},
+		MinMatches: 3,
+		Builtin:    true,
+	},
+	{
+		Category: CategoryRateLimit,
+		Equals:   []string{"Rate limit exceeded cf1", "Rate limit exceeded cf2"},
+		Builtin:  true,
+	},
+	{
+		Category: CategoryFreeLimit,
+		Keywords: []string{`data: {"id": "", "role": "assistant", "content": "You've reached your free usage limit today", "action": {"type": "ACTION_QUOTA_EXCEEDED", "query_string": null, "update_flow_data": null, "label": null, "user_s_input": null, "action_params": null}, "recommend_actions": null, "is_prompt": true, "render_template": null, "session_state": {"consume_usage_quota_exceeded": true}, "message_type": null, "type": "message_result"}`},
+		Builtin:  true,
+	},
+	{
+		Category: CategoryNotLogin,
+		Keywords: []string{`{"status":-5,"message":"not login","data":{}}`},
+		Builtin:  true,
+	},
+	{
+		Category: CategoryServerError,
+		Equals:   []string{"Internal Server Error"},
+		Builtin:  true,
+	},
+	{
+		Category: CategoryServerOverloaded,
+		Keywords: []string{`data: {"id": "", "role": "assistant", "content": "Server overloaded, please try again later.", "action": null, "recommend_actions": null, "is_prompt": false, "render_template": null, "session_state": null, "message_type": null, "type": "message_result"}`},
+		Builtin:  true,
+	},
+}
@@ -0,0 +1,43 @@
+package fingerprint
+
+// defaultSamples 内置样本库,加载规则时逐条校验,避免新增规则误判或漏判已知的上游文案
+var defaultSamples = []Sample{
+	{
+		Name:     "cloudflare challenge page",
+		Category: CategoryCloudflareChallenge,
+		Text:     `<!DOCTYPE html><html lang="en-US"><head><title>Just a moment...</title><meta http-equiv="refresh" content="390"></head><body class="no-js"><script>(function(){window._cf_chl_opt={cvId: '3',cZone: "www.genspark.ai"};})();</script></body></html>`,
+	},
+	{
+		Name:     "cloudflare block page",
+		Category: CategoryCloudflareBlock,
+		Text:     `<!DOCTYPE html><html><head><title>Attention Required! | Cloudflare</title></head><body><div class="cf-wrapper"><h1 data-translate="block_headline">Sorry, you have been blocked</h1><h2 class="cf-subheadline">You are unable to access genspark.ai</h2></div></body></html>`,
+	},
+	{
+		Name:     "genspark service unavailable page",
+		Category: CategoryServiceUnavailable,
+		Text:     `<!doctype html><html><head><meta http-equiv="Content-Type" content="text/html; charset=UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1,maximum-scale=1,user-scalable=no"><title>Genspark</title><link rel="icon" href="https://gensparkpublicblob-cdn-e6g4btgjavb5a7gh.z03.azurefd.net/user-upload-image/manual/favicon.ico"><style>body,html{margin:0;padding:0;font-family:Arial}.bb{width:100vw;height:100vh;position:absolute;overflow:hidden}.logo img{margin:20px 0 0 24px;height:24px}.iw{display:flex;flex-direction:column;height:100vh;width:100%}.s1{position:absolute;top:0;left:0;margin-top:-5%;margin-left:15%;width:289px;height:289px;border-radius:289px;opacity:.6;background:radial-gradient(55.64% 49.84%,#2c10d6 0,rgba(44,16,214,.36) 100%);filter:blur(120px)}.s2{position:absolute;top:0;left:0;margin-top:10%;margin-left:50%;width:204.845px;height:204.845px;transform:rotate(-131.346deg);flex-shrink:0;background:radial-gradient(55.64% 49.84%,#7fd1ff 0,rgba(44,16,214,.36) 100%);filter:blur(120px)}.s3{position:absolute;bottom:0;right:0;margin-bottom:10%;margin-right:10%;width:251px;height:251px;border-radius:289.093px;background:radial-gradient(88.27% 88.27% at 90.98% 61.04%,#ce7fff 0,#ffe4af 100%);filter:blur(120px)}.cc{display:flex;justify-content:center;align-items:center;height:100%;width:100%}.hh{align-items:center;display:flex;width:100vw}.dd{margin-top:-200px}.tt{color:#000;text-align:center;font-size:40px;font-style:normal;font-weight:700}@media (max-width:800px){.tt{font-size:30px}}</style></head><body><div class="bb"><div class="s1"></div><div class="s2"></div><div class="s3"></div></div><div class="iw"><div class="hh"><div class="logo"><img src="https://gensparkpublicblob-cdn-e6g4btgjavb5a7gh.z03.azurefd.net/user-upload-image/manual/genspark_logo.png" alt="logo"></div></div><div class="cc"><div class="dd"><div class="tt">Service Unavailable</div></div></div></div></body></html>`,
+	},
+	{Name: "rate limit cf1", Category: CategoryRateLimit, Text: "Rate limit exceeded cf1"},
+	{Name: "rate limit cf2", Category: CategoryRateLimit, Text: "Rate limit exceeded cf2"},
+	{
+		Name:     "free usage limit",
+		Category: CategoryFreeLimit,
+		Text:     `data: {"id": "", "role": "assistant", "content": "You've reached your free usage limit today", "action": {"type": "ACTION_QUOTA_EXCEEDED", "query_string": null, "update_flow_data": null, "label": null, "user_s_input": null, "action_params": null}, "recommend_actions": null, "is_prompt": true, "render_template": null, "session_state": {"consume_usage_quota_exceeded": true}, "message_type": null, "type": "message_result"}`,
+	},
+	{Name: "not login", Category: CategoryNotLogin, Text: `{"status":-5,"message":"not login","data":{}}`},
+	{Name: "internal server error", Category: CategoryServerError, Text: "Internal Server Error"},
+	{
+		Name:     "server overloaded",
+		Category: CategoryServerOverloaded,
+		Text:     `data: {"id": "", "role": "assistant", "content": "Server overloaded, please try again later.", "action": null, "recommend_actions": null, "is_prompt": false, "render_template": null, "session_state": null, "message_type": null, "type": "message_result"}`,
+	},
+	{
+		Name: "answer delta",
+		Text: `data: {"type": "message_field_delta", "message_id": "1", "field_name": "session_state.answer", "delta": "Rate limit exceeded cf1 is an upstream error text"}`,
+	},
+	{
+		Name: "answer mentioning service unavailable",
+		Text: `data: {"type": "message_field_delta", "message_id": "1", "field_name": "session_state.answer", "delta": "<title>Genspark</title> Service Unavailable"}`,
+	},
+	{Name: "empty line", Text: ""},
+}
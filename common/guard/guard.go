@@ -0,0 +1,161 @@
+package guard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DirectionInput  = "input"
+	DirectionOutput = "output"
+
+	ActionBlock = "block"
+	ActionMask  = "mask"
+
+	maskText = "***"
+)
+
+var (
+	pattern    *regexp.Regexp
+	words      []*regexp.Regexp // 敏感词的不区分大小写正则,与 config.ContentGuardWords 一一对应
+	window     int              // 流式输出暂存的末尾字符数
+	httpClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+type Result struct {
+	Hit     bool   // 是否命中
+	Blocked bool   // 是否需要阻断
+	Reason  string // 命中原因
+	Text    string // 未阻断时的文本(脱敏策略下已替换命中内容)
+}
+
+type webhookResponse struct {
+	Flagged bool   `json:"flagged"`
+	Reason  string `json:"reason"`
+}
+
+// Init 编译内容守卫正则与敏感词,并计算流式输出的滑动窗口:敏感词按最长词长,正则按 CONTENT_GUARD_STREAM_WINDOW
+func Init() error {
+	words = nil
+	window = 0
+	for _, word := range config.ContentGuardWords {
+		words = append(words, regexp.MustCompile("(?i)"+regexp.QuoteMeta(word)))
+		window = max(window, len([]rune(word))-1)
+	}
+	if config.ContentGuardPattern == "" {
+		return nil
+	}
+	compiled, err := regexp.Compile(config.ContentGuardPattern)
+	if err != nil {
+		return err
+	}
+	pattern = compiled
+	window = max(window, config.ContentGuardStreamWindow)
+	return nil
+}
+
+// Enabled 是否配置了内容守卫
+func Enabled() bool {
+	return len(config.ContentGuardWords) > 0 || pattern != nil || config.ContentGuardWebhook != ""
+}
+
+// Check 检查文本,useWebhook 控制是否调用外部 webhook(流式增量检查时不调用)
+func Check(direction string, text string, useWebhook bool) Result {
+	result := Result{Text: text}
+	if text == "" {
+		return result
+	}
+
+	var reasons []string
+	for i, word := range words {
+		if word.MatchString(result.Text) {
+			reasons = append(reasons, "word: "+config.ContentGuardWords[i])
+			if config.ContentGuardAction == ActionMask {
+				result.Text = word.ReplaceAllString(result.Text, maskText)
+			}
+		}
+	}
+	if pattern != nil && pattern.MatchString(result.Text) {
+		reasons = append(reasons, "pattern: "+pattern.String())
+		if config.ContentGuardAction == ActionMask {
+			result.Text = pattern.ReplaceAllString(result.Text, maskText)
+		}
+	}
+	if len(reasons) > 0 {
+		result.Hit = true
+		result.Blocked = config.ContentGuardAction != ActionMask
+		result.Reason = strings.Join(reasons, "; ")
+	}
+
+	// webhook 命中时无法定位命中内容,一律阻断
+	if useWebhook && !result.Blocked && config.ContentGuardWebhook != "" {
+		if flagged, reason := checkWebhook(direction, text); flagged {
+			result.Hit = true
+			result.Blocked = true
+			result.Reason = "webhook: " + reason
+		}
+	}
+
+	if result.Blocked {
+		result.Text = ""
+	}
+	return result
+}
+
+// checkWebhook 调用外部审核 webhook,请求失败时放行
+func checkWebhook(direction string, text string) (bool, string) {
+	body, _ := json.Marshal(map[string]string{
+		"direction": direction,
+		"text":      text,
+	})
+	resp, err := httpClient.Post(config.ContentGuardWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.SysError("content guard webhook failed: " + err.Error())
+		return false, ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logger.SysError(fmt.Sprintf("content guard webhook failed: status code %d", resp.StatusCode))
+		return false, ""
+	}
+
+	var webhookResp webhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&webhookResp); err != nil {
+		logger.SysError("content guard webhook failed: " + err.Error())
+		return false, ""
+	}
+	return webhookResp.Flagged, webhookResp.Reason
+}
+
+// Stream 流式输出的内容守卫:在暂存的末尾文本与新增量拼接成的滑动缓冲上匹配,跨增量拆分的敏感词与正则同样能命中。
+// 末尾可能与后续增量组成命中的文本暂存到下一次 Write 或 Flush
+type Stream struct {
+	pending string
+}
+
+// Write 检查增量,返回可输出的文本与检查结果(不调用 webhook)
+func (s *Stream) Write(delta string) (string, Result) {
+	result := Check(DirectionOutput, s.pending+delta, false)
+	if result.Blocked {
+		s.pending = ""
+		return "", result
+	}
+	runes := []rune(result.Text)
+	keep := min(len(runes), window)
+	s.pending = string(runes[len(runes)-keep:])
+	return string(runes[:len(runes)-keep]), result
+}
+
+// Flush 输出暂存的文本
+func (s *Stream) Flush() string {
+	text := s.pending
+	s.pending = ""
+	return text
+}
@@ -1,5 +1,37 @@
 package helper
 
 const (
-	RequestIdKey = "X-Request-Id"
+	RequestIdKey          = "X-Request-Id"
+	StoreKey              = "store"
+	MetadataKey           = "metadata"
+	ContentGuardKey       = "content_guard"
+	LanguageKey           = "language"
+	LinkRewriterKey       = "link_rewriter"
+	MixtureLayerKey       = "mixture_layer"
+	MarkmapKey            = "markmap"
+	AgentKey              = "agent"
+	AttemptsKey           = "upstream_attempts"
+	SearchKey             = "search"
+	SuggestionsKey        = "suggestions"
+	OperatorKey           = "admin_operator"
+	ShadowParserKey       = "shadow_parser"
+	ModelKey              = "model"
+	UsageKey              = "usage"
+	CohortKey             = "cohort"
+	ChatImageKey          = "chat_image"
+	ReasoningExcludeKey   = "reasoning_exclude"
+	RawPromptKey          = "raw_prompt"
+	MarkdownNormalizeKey  = "markdown_normalize"
+	MarkdownNormalizerKey = "markdown_normalizer"
+	SessionUserKey        = "session_user"
+	SessionCallerKey      = "session_caller"
+	ImageQueueKey         = "image_queue"
+	ImageQueueReporterKey = "image_queue_reporter"
+	ImageSessionKey       = "image_session"
+	OutputLimitKey        = "output_limit"
+	GenerationTaskKey     = "generation_task"
+	ThreadRunKey          = "thread_run"
+	ToolHistoryKey        = "tool_history"
+	GuardStreamKey        = "guard_stream"
+	ResponsePageIdKey     = "response_page_id"
 )
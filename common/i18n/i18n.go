@@ -0,0 +1,104 @@
+package i18n
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	"github.com/gin-gonic/gin"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 支持的错误消息语言
+const (
+	LangZh = "zh"
+	LangEn = "en"
+)
+
+// text 一条错误消息的各语言文本,可包含 fmt 占位符
+type text struct {
+	En string
+	Zh string
+}
+
+// byEnglish 英文文本到消息 key 的索引,用于翻译以英文常量传递的消息
+var byEnglish = func() map[string]string {
+	index := make(map[string]string, len(messages))
+	for key, t := range messages {
+		index[t.En] = key
+	}
+	return index
+}()
+
+// Lang 按 Accept-Language(含 q 权重)选择错误消息语言,无可识别的语言时返回空字符串
+func Lang(c *gin.Context) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (primary == LangZh || primary == LangEn) && q > 0 {
+			candidates = append(candidates, candidate{lang: primary, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].lang
+}
+
+// Message 获取 API 错误消息,未指定语言时默认为英文
+func Message(c *gin.Context, key string, args ...interface{}) string {
+	return format(resolve(c, LangEn), key, args...)
+}
+
+// AdminMessage 获取管理接口错误消息,未指定语言时默认为中文
+func AdminMessage(c *gin.Context, key string, args ...interface{}) string {
+	return format(resolve(c, LangZh), key, args...)
+}
+
+// Translate 翻译以英文文本传递的消息,不在消息表中的消息(如上游错误)原样返回
+func Translate(c *gin.Context, message string) string {
+	key, ok := byEnglish[message]
+	if !ok {
+		return message
+	}
+	return Message(c, key)
+}
+
+func resolve(c *gin.Context, fallback string) string {
+	if lang := Lang(c); lang != "" {
+		return lang
+	}
+	if config.ErrorLanguage != "" {
+		return config.ErrorLanguage
+	}
+	return fallback
+}
+
+func format(lang string, key string, args ...interface{}) string {
+	t, ok := messages[key]
+	if !ok {
+		return key
+	}
+	message := t.En
+	if lang == LangZh {
+		message = t.Zh
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
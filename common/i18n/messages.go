@@ -0,0 +1,139 @@
+package i18n
+
+// API 错误消息 key,与响应中的错误码(code)相互独立,可随时调整文案
+const (
+	InvalidAuthorization = "invalid_authorization"
+	TenantMismatch       = "tenant_mismatch"
+	Forbidden            = "forbidden"
+	InvalidRequest       = "invalid_request"
+	ReadBodyFailed       = "read_body_failed"
+	MarshalFailed        = "marshal_failed"
+	MarshalDataFailed    = "marshal_data_failed"
+	IdempotencyConflict  = "idempotency_conflict"
+	InvalidModel         = "invalid_model"
+	InvalidAgentModel    = "invalid_agent_model"
+	PresetNotFound       = "preset_not_found"
+	PromptRequired       = "prompt_required"
+	VideoImagesExceeded  = "video_images_exceeded"
+	ContentPolicy        = "content_policy_violation"
+	ContentFilter        = "content_filter"
+	PromptTokensExceeded = "prompt_tokens_exceeded"
+	RequestCostExceeded  = "request_cost_exceeded"
+	BatchSizeInvalid     = "batch_size_invalid"
+	BatchUrlUnsupported  = "batch_url_unsupported"
+	BatchNotCompleted    = "batch_not_completed"
+	BatchNotFound        = "batch_not_found"
+	ThreadNotFound       = "thread_not_found"
+	ResponseNotFound     = "response_not_found"
+	FileNotFound         = "file_not_found"
+	ModelNotFound        = "model_not_found"
+	TaskNotFound         = "task_not_found"
+	TaskCancelled        = "task_cancelled"
+	FeedbackNotFound     = "feedback_not_found"
+	FeedbackInvalid      = "feedback_invalid"
+	CommentTooLong       = "comment_too_long"
+	ThreadNoMessages     = "thread_no_messages"
+	ThreadSaveFailed     = "thread_save_failed"
+	NoValidCookies       = "no_valid_cookies"
+	NoMoreValidCookies   = "no_more_valid_cookies"
+	ServiceOverloaded    = "service_overloaded"
+	ChallengeRequired    = "challenge_required"
+	ImageQueueTooLong    = "image_queue_too_long"
+	CloudflareChallenge  = "cloudflare_challenge"
+	CloudflareBlock      = "cloudflare_block"
+	UpstreamError        = "upstream_error"
+	ServiceUnavailable   = "service_unavailable"
+	StreamInterrupted    = "stream_interrupted"
+	NoValidResponse      = "no_valid_response"
+)
+
+// 管理接口错误消息 key
+const (
+	AdminInvalidParams    = "admin_invalid_params"
+	AdminInvalidSecret    = "admin_invalid_secret"
+	AdminInvalidToken     = "admin_invalid_token"
+	AdminRoleForbidden    = "admin_role_forbidden"
+	AdminTooManyRequests  = "admin_too_many_requests"
+	AdminRuleNotFound     = "admin_rule_not_found"
+	AdminPresetNotFound   = "admin_preset_not_found"
+	AdminModelNotFound    = "admin_model_not_found"
+	AdminModelBuiltin     = "admin_model_builtin"
+	AdminFlagNotFound     = "admin_flag_not_found"
+	AdminLogTypeInvalid   = "admin_log_type_invalid"
+	AdminCorsEmpty        = "admin_cors_empty"
+	AdminCorsCredentials  = "admin_cors_credentials"
+	AdminOidcDisabled     = "admin_oidc_disabled"
+	AdminOidcDiscovery    = "admin_oidc_discovery_failed"
+	AdminOidcLoginFailed  = "admin_oidc_login_failed"
+	AdminOidcInvalidState = "admin_oidc_invalid_state"
+	AdminOidcExchange     = "admin_oidc_exchange_failed"
+	AdminOidcVerifyFailed = "admin_oidc_verify_failed"
+	AdminOidcNoRole       = "admin_oidc_no_role"
+)
+
+var messages = map[string]text{
+	InvalidAuthorization: {En: "authorization(api-secret) verification failed", Zh: "authorization(api-secret)校验失败"},
+	TenantMismatch:       {En: "X-Tenant-Id does not match the tenant of the API key", Zh: "X-Tenant-Id与API key所属租户不一致"},
+	Forbidden:            {En: "Forbidden", Zh: "禁止访问"},
+	InvalidRequest:       {En: "Invalid request parameters", Zh: "请求参数有误"},
+	ReadBodyFailed:       {En: "Failed to read request body", Zh: "读取请求体失败"},
+	MarshalFailed:        {En: "Failed to marshal request body", Zh: "请求体序列化失败"},
+	MarshalDataFailed:    {En: "Failed to marshal request data", Zh: "请求数据序列化失败"},
+	IdempotencyConflict:  {En: "Idempotency-Key has already been used with a different request body", Zh: "该 Idempotency-Key 已用于不同的请求体"},
+	InvalidModel:         {En: "Invalid model", Zh: "模型无效"},
+	InvalidAgentModel:    {En: "Invalid agent model %s, available: %s", Zh: "agent 模型 %s 无效,可用模型: %s"},
+	PresetNotFound:       {En: "Preset %s does not exist", Zh: "预设 %s 不存在"},
+	PromptRequired:       {En: "prompt is required", Zh: "prompt 不能为空"},
+	VideoImagesExceeded:  {En: "Model %s accepts at most %d images", Zh: "模型 %s 最多支持传入 %d 张图片"},
+	ContentPolicy:        {En: "Your request was rejected as a result of our safety system", Zh: "请求因触发安全策略被拒绝"},
+	ContentFilter:        {En: "Your request was rejected by the content filter", Zh: "请求因包含敏感内容被拦截"},
+	PromptTokensExceeded: {En: "This request has %d prompt tokens, which exceeds the limit of %d tokens per request", Zh: "本次请求的 prompt 为 %d tokens,超过单次请求上限 %d tokens"},
+	RequestCostExceeded:  {En: "The estimated cost of this request is $%.6f, which exceeds the limit of $%.6f per request", Zh: "本次请求预估费用为 $%.6f,超过单次请求上限 $%.6f"},
+	BatchSizeInvalid:     {En: "requests count must be between 1 and %d", Zh: "请求数须在 1 到 %d 之间"},
+	BatchUrlUnsupported:  {En: "unsupported url %s of custom_id %s", Zh: "不支持的请求地址 %s(custom_id: %s)"},
+	BatchNotCompleted:    {En: "batch is not completed yet", Zh: "批任务尚未完成"},
+	BatchNotFound:        {En: "batch not found", Zh: "批任务不存在"},
+	ThreadNotFound:       {En: "thread not found", Zh: "会话不存在"},
+	ResponseNotFound:     {En: "response not found or expired", Zh: "响应不存在或已过期"},
+	FileNotFound:         {En: "file not found or expired", Zh: "文件不存在或已过期"},
+	ModelNotFound:        {En: "The model '%s' does not exist", Zh: "模型 '%s' 不存在"},
+	TaskNotFound:         {En: "task not found or already finished", Zh: "任务不存在或已结束"},
+	TaskCancelled:        {En: "generation task cancelled", Zh: "生成任务已取消"},
+	FeedbackNotFound:     {En: "response not found, expired or already rated", Zh: "响应不存在、已过期或已反馈"},
+	FeedbackInvalid:      {En: "score must be between 1 and 5, or degraded must be true", Zh: "score 须为 1-5,或将 degraded 设为 true"},
+	CommentTooLong:       {En: "comment must be at most 1000 characters", Zh: "comment 不能超过 1000 个字符"},
+	ThreadNoMessages:     {En: "thread has no messages", Zh: "会话中没有消息"},
+	ThreadSaveFailed:     {En: "Failed to save thread", Zh: "保存会话失败"},
+	NoValidCookies:       {En: "No valid cookies available", Zh: "没有可用的 cookie"},
+	NoMoreValidCookies:   {En: "No more valid cookies available", Zh: "已无其他可用的 cookie"},
+	ServiceOverloaded:    {En: "The server is overloaded, image and video generation is temporarily unavailable, please retry later", Zh: "服务负载过高,生图/生视频暂不可用,请稍后重试"},
+	ImageQueueTooLong:    {En: "Image generation queue is too long (position %d, estimated wait %ds), please retry later", Zh: "生图排队过长(队列位置 %d,预计等待 %d 秒),请稍后重试"},
+	ChallengeRequired:    {En: "Please solve the proof-of-work challenge and retry with the X-Challenge-Solution header", Zh: "请完成工作量证明挑战后携带 X-Challenge-Solution 请求头重试"},
+	CloudflareChallenge:  {En: "Detected Cloudflare Challenge Page", Zh: "触发了 Cloudflare 人机验证"},
+	CloudflareBlock:      {En: "CloudFlare: Sorry, you have been blocked", Zh: "请求已被 Cloudflare 拦截"},
+	UpstreamError:        {En: "An error occurred with the current request, please try again.", Zh: "当前请求出错,请重试"},
+	ServiceUnavailable:   {En: "Genspark Service Unavailable", Zh: "Genspark 服务不可用"},
+	StreamInterrupted:    {En: "Upstream stream interrupted", Zh: "上游流式响应中断"},
+	NoValidResponse:      {En: "No valid response content", Zh: "上游未返回有效内容"},
+
+	AdminInvalidParams:    {En: "Invalid parameters", Zh: "无效的参数"},
+	AdminInvalidSecret:    {En: "Unauthorized: missing or incorrect api-secret", Zh: "无权进行此操作,未提供正确的 api-secret"},
+	AdminInvalidToken:     {En: "Unauthorized: login token is invalid or expired", Zh: "无权进行此操作,登录凭证无效或已过期"},
+	AdminRoleForbidden:    {En: "Forbidden: insufficient role for this operation", Zh: "无权进行此操作,当前账号角色权限不足"},
+	AdminTooManyRequests:  {En: "Too many requests, please try again later", Zh: "请求过于频繁,请稍后再试"},
+	AdminRuleNotFound:     {En: "Rule not found", Zh: "规则不存在"},
+	AdminPresetNotFound:   {En: "Preset not found", Zh: "预设不存在"},
+	AdminModelNotFound:    {En: "Experimental model not found", Zh: "实验模型不存在"},
+	AdminModelBuiltin:     {En: "Model %s is already built in", Zh: "模型 %s 已内置"},
+	AdminFlagNotFound:     {En: "Feature flag not found", Zh: "特性开关不存在"},
+	AdminLogTypeInvalid:   {En: "type must be access or error", Zh: "type 仅支持 access 或 error"},
+	AdminCorsEmpty:        {En: "allow_origins and allow_methods must not be empty", Zh: "allow_origins 与 allow_methods 不能为空"},
+	AdminCorsCredentials:  {En: "allow_credentials requires an explicit allow_origins list without *", Zh: "开启 allow_credentials 时 allow_origins 须为明确的来源列表,不能包含 *"},
+	AdminOidcDisabled:     {En: "OIDC login is not enabled", Zh: "未启用 OIDC 登录"},
+	AdminOidcDiscovery:    {En: "Failed to fetch IdP configuration", Zh: "获取 IdP 配置失败"},
+	AdminOidcLoginFailed:  {En: "IdP login failed: %s %s", Zh: "IdP 登录失败: %s %s"},
+	AdminOidcInvalidState: {En: "Invalid or expired state, please log in again", Zh: "无效或已过期的 state,请重新登录"},
+	AdminOidcExchange:     {En: "Failed to exchange authorization code for token", Zh: "授权码换取 token 失败"},
+	AdminOidcVerifyFailed: {En: "Login token verification failed", Zh: "登录凭证校验失败"},
+	AdminOidcNoRole:       {En: "This account has not been granted an admin role", Zh: "当前账号未被授予管理端角色"},
+}
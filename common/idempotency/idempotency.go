@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// Result 首次请求的响应,用于重复请求时回放
+type Result struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+type entry struct {
+	bodyHash  string
+	done      chan struct{} // 首次请求结束时关闭
+	result    *Result       // 为空表示首次请求未成功,不缓存
+	expiresAt time.Time
+}
+
+var (
+	store     = make(map[string]*entry)
+	mutex     sync.Mutex
+	cleanOnce sync.Once
+)
+
+// Begin 开始一次带幂等键的请求
+// 首次请求返回 first=true,调用方处理完成后需调用 Finish;
+// 重复请求返回首次请求的结束通道,通道关闭后通过 Get 获取结果
+func Begin(key string, bodyHash string, ttl time.Duration) (first bool, done <-chan struct{}, mismatch bool) {
+	cleanOnce.Do(func() { go clearExpiredItems(ttl) })
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if e, ok := store[key]; ok && time.Now().Before(e.expiresAt) {
+		if e.bodyHash != bodyHash {
+			return false, nil, true
+		}
+		return false, e.done, false
+	}
+	store[key] = &entry{
+		bodyHash:  bodyHash,
+		done:      make(chan struct{}),
+		expiresAt: time.Now().Add(ttl),
+	}
+	return true, nil, false
+}
+
+// Finish 结束首次请求,result 为空时删除幂等键以允许客户端重试
+func Finish(key string, result *Result) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	e, ok := store[key]
+	if !ok {
+		return
+	}
+	e.result = result
+	if result == nil {
+		delete(store, key)
+	}
+	close(e.done)
+}
+
+// Get 获取首次请求的结果
+func Get(key string) (*Result, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	e, ok := store[key]
+	if !ok || e.result == nil {
+		return nil, false
+	}
+	return e.result, true
+}
+
+func clearExpiredItems(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		mutex.Lock()
+		now := time.Now()
+		for key, e := range store {
+			if now.After(e.expiresAt) {
+				select {
+				case <-e.done:
+					delete(store, key)
+				default:
+					// 首次请求仍在处理中
+				}
+			}
+		}
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,32 @@
+package imageintent
+
+import (
+	"genspark2api/common/config"
+	"regexp"
+	"strings"
+)
+
+// 默认画图意图:以"画"/draw 开头,中文的"生成/来一张...图",英文的 generate ... image
+const defaultPattern = `(?i)^\s*(请|帮我|给我)?\s*画|(画|绘制|生成|创作|来)\s*(一|两|几|个|张|幅|副|些)+[^，。,.!?！？\n]{0,20}?(图|插画|画像|海报|壁纸|头像)|` +
+	`^\s*(please\s+)?(draw|paint|sketch)\b|\b(draw|paint|sketch|generate|create|make)\s+(me\s+)?(an?|some|the)?\s*[\w\s-]{0,30}?\b(image|picture|illustration|drawing|painting|poster|wallpaper|avatar)s?\b`
+
+var pattern = regexp.MustCompile(defaultPattern)
+
+// Init 编译 CHAT_IMAGE_INTENT_PATTERN
+func Init() error {
+	if config.ChatImageIntentPattern == "" {
+		return nil
+	}
+	compiled, err := regexp.Compile(config.ChatImageIntentPattern)
+	if err != nil {
+		return err
+	}
+	pattern = compiled
+	return nil
+}
+
+// Detect 文本是否包含画图意图
+func Detect(text string) bool {
+	text = strings.TrimSpace(text)
+	return text != "" && pattern.MatchString(text)
+}
@@ -0,0 +1,293 @@
+package imagemeta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"genspark2api/common/config"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	PositionTopLeft     = "top-left"
+	PositionTopRight    = "top-right"
+	PositionBottomLeft  = "bottom-left"
+	PositionBottomRight = "bottom-right"
+	PositionCenter      = "center"
+
+	// 水印与图片边缘的距离(像素)
+	watermarkMargin = 16
+)
+
+// IPTC 规定的 AI 生成内容来源类型
+const digitalSourceType = "http://cv.iptc.org/newscodes/digitalsourcetype/trainedAlgorithmicMedia"
+
+var watermark image.Image
+
+type Metadata struct {
+	Model   string
+	Created time.Time
+	Prompt  string
+}
+
+// Init 加载水印图片并校验水印配置
+func Init() error {
+	switch config.ImageWatermarkPosition {
+	case PositionTopLeft, PositionTopRight, PositionBottomLeft, PositionBottomRight, PositionCenter:
+	default:
+		return fmt.Errorf("IMAGE_WATERMARK_POSITION: invalid position %s", config.ImageWatermarkPosition)
+	}
+	if config.ImageWatermarkOpacity <= 0 || config.ImageWatermarkOpacity > 1 {
+		return fmt.Errorf("IMAGE_WATERMARK_OPACITY: must be in (0, 1]")
+	}
+	if config.ImageWatermarkPath == "" {
+		return nil
+	}
+
+	file, err := os.Open(config.ImageWatermarkPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		return fmt.Errorf("IMAGE_WATERMARK_PATH: %v", err)
+	}
+	watermark = img
+	return nil
+}
+
+// Enabled 是否需要处理图片
+func Enabled() bool {
+	return config.ImageMetadataEnable == 1 || watermark != nil
+}
+
+// Process 为图片叠加水印并注入元数据,返回处理后的图片与其 Content-Type
+// 水印与元数据分别处理,某一步失败时跳过该步并返回错误;水印仅支持 png/jpeg(webp 等格式不叠加水印),元数据支持 png/jpeg/webp
+func Process(data []byte, meta Metadata) ([]byte, string, error) {
+	contentType := http.DetectContentType(data)
+	if !Enabled() {
+		return data, contentType, nil
+	}
+
+	var errs []error
+	result := data
+	if watermark != nil {
+		if marked, err := applyWatermark(result, contentType); err != nil {
+			errs = append(errs, fmt.Errorf("watermark: %v", err))
+		} else {
+			result = marked
+		}
+	}
+
+	if config.ImageMetadataEnable == 1 {
+		packet := buildXmp(meta)
+		var (
+			injected []byte
+			err      error
+		)
+		switch contentType {
+		case "image/png":
+			injected, err = injectPng(result, packet)
+		case "image/jpeg":
+			injected, err = injectJpeg(result, packet)
+		case "image/webp":
+			injected, err = injectWebp(result, packet)
+		default:
+			err = fmt.Errorf("unsupported format %s", contentType)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("metadata: %v", err))
+		} else {
+			result = injected
+		}
+	}
+	return result, contentType, errors.Join(errs...)
+}
+
+// applyWatermark 按配置的位置与透明度叠加水印,并以原格式重新编码
+func applyWatermark(data []byte, contentType string) ([]byte, error) {
+	var (
+		src image.Image
+		err error
+	)
+	switch contentType {
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported format %s", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+
+	size := watermark.Bounds().Size()
+	var point image.Point
+	switch config.ImageWatermarkPosition {
+	case PositionTopLeft:
+		point = image.Pt(bounds.Min.X+watermarkMargin, bounds.Min.Y+watermarkMargin)
+	case PositionTopRight:
+		point = image.Pt(bounds.Max.X-size.X-watermarkMargin, bounds.Min.Y+watermarkMargin)
+	case PositionBottomLeft:
+		point = image.Pt(bounds.Min.X+watermarkMargin, bounds.Max.Y-size.Y-watermarkMargin)
+	case PositionCenter:
+		point = image.Pt(bounds.Min.X+(bounds.Dx()-size.X)/2, bounds.Min.Y+(bounds.Dy()-size.Y)/2)
+	default:
+		point = image.Pt(bounds.Max.X-size.X-watermarkMargin, bounds.Max.Y-size.Y-watermarkMargin)
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(config.ImageWatermarkOpacity * 255)})
+	draw.DrawMask(dst, image.Rectangle{Min: point, Max: point.Add(size)}, watermark, watermark.Bounds().Min, mask, image.Point{}, draw.Over)
+
+	var buffer bytes.Buffer
+	if contentType == "image/png" {
+		err = png.Encode(&buffer, dst)
+	} else {
+		err = jpeg.Encode(&buffer, dst, &jpeg.Options{Quality: 95})
+	}
+	return buffer.Bytes(), err
+}
+
+// buildXmp 生成 XMP 元数据包:AI 生成标注、生成模型、时间与 prompt 的 sha256
+func buildXmp(meta Metadata) []byte {
+	hash := sha256.Sum256([]byte(meta.Prompt))
+	escape := func(value string) string {
+		var builder strings.Builder
+		xml.EscapeText(&builder, []byte(value))
+		return builder.String()
+	}
+	return []byte(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about=""` +
+		` xmlns:Iptc4xmpExt="http://iptc.org/std/Iptc4xmpExt/2008-02-29/"` +
+		` xmlns:xmp="http://ns.adobe.com/xap/1.0/"` +
+		` xmlns:genspark2api="https://github.com/deanxv/genspark2api/ns/1.0/"` +
+		` Iptc4xmpExt:DigitalSourceType="` + digitalSourceType + `"` +
+		` xmp:CreatorTool="` + escape(meta.Model) + `"` +
+		` xmp:CreateDate="` + meta.Created.Format(time.RFC3339) + `"` +
+		` genspark2api:Model="` + escape(meta.Model) + `"` +
+		` genspark2api:PromptHash="sha256:` + hex.EncodeToString(hash[:]) + `"/>` +
+		`</rdf:RDF></x:xmpmeta><?xpacket end="r"?>`)
+}
+
+// injectPng 在 IHDR 之后插入 iTXt(XML:com.adobe.xmp) 块
+func injectPng(data []byte, packet []byte) ([]byte, error) {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	if len(data) < ihdrEnd || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("invalid png")
+	}
+
+	var chunkData bytes.Buffer
+	chunkData.WriteString("XML:com.adobe.xmp")
+	chunkData.Write([]byte{0, 0, 0, 0, 0}) // 关键字结束、不压缩、压缩方式、语言标签、翻译关键字
+	chunkData.Write(packet)
+
+	chunk := make([]byte, 0, chunkData.Len()+12)
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(chunkData.Len()))
+	chunk = append(chunk, "iTXt"...)
+	chunk = append(chunk, chunkData.Bytes()...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	result := make([]byte, 0, len(data)+len(chunk))
+	result = append(result, data[:ihdrEnd]...)
+	result = append(result, chunk...)
+	return append(result, data[ihdrEnd:]...), nil
+}
+
+// injectJpeg 在 SOI(及 JFIF APP0)之后插入 XMP APP1 段
+func injectJpeg(data []byte, packet []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("invalid jpeg")
+	}
+	payload := append([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet...)
+	if len(payload)+2 > 0xffff {
+		return nil, errors.New("metadata too large")
+	}
+
+	pos := 2
+	if data[2] == 0xff && data[3] == 0xe0 && len(data) >= 6 {
+		pos += 2 + int(binary.BigEndian.Uint16(data[4:6]))
+		if pos > len(data) {
+			return nil, errors.New("invalid jpeg")
+		}
+	}
+
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	result := make([]byte, 0, len(data)+len(segment))
+	result = append(result, data[:pos]...)
+	result = append(result, segment...)
+	return append(result, data[pos:]...), nil
+}
+
+// injectWebp 追加 XMP 块,简单格式(VP8/VP8L)的 webp 会先转为扩展格式(VP8X)
+func injectWebp(data []byte, packet []byte) ([]byte, error) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid webp")
+	}
+
+	result := make([]byte, 0, len(data)+len(packet)+32)
+	result = append(result, data[:12]...)
+	switch string(data[12:16]) {
+	case "VP8X":
+		result = append(result, data[12:]...)
+		result[20] |= 0x04 // XMP 标志位
+	case "VP8 ", "VP8L":
+		var width, height int
+		var flags byte = 0x04
+		if string(data[12:16]) == "VP8 " {
+			width = int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff)
+			height = int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff)
+		} else {
+			if data[20] != 0x2f {
+				return nil, errors.New("invalid webp lossless signature")
+			}
+			bits := binary.LittleEndian.Uint32(data[21:25])
+			width = int(bits&0x3fff) + 1
+			height = int((bits>>14)&0x3fff) + 1
+			if (bits>>28)&1 == 1 {
+				flags |= 0x10 // alpha 标志位
+			}
+		}
+		vp8x := []byte{'V', 'P', '8', 'X', 10, 0, 0, 0, flags, 0, 0, 0}
+		vp8x = appendUint24(vp8x, width-1)
+		vp8x = appendUint24(vp8x, height-1)
+		result = append(result, vp8x...)
+		result = append(result, data[12:]...)
+	default:
+		return nil, errors.New("unsupported webp chunk " + string(data[12:16]))
+	}
+
+	result = append(result, "XMP "...)
+	result = binary.LittleEndian.AppendUint32(result, uint32(len(packet)))
+	result = append(result, packet...)
+	if len(packet)%2 == 1 {
+		result = append(result, 0)
+	}
+	binary.LittleEndian.PutUint32(result[4:8], uint32(len(result)-8))
+	return result, nil
+}
+
+func appendUint24(b []byte, v int) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
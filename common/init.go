@@ -3,9 +3,11 @@ package common
 import (
 	"flag"
 	"fmt"
+	"genspark2api/common/env"
 	"log"
 	"os"
 	"path/filepath"
+	"testing"
 )
 
 var (
@@ -26,7 +28,10 @@ func printHelp() {
 }
 
 func init() {
-	flag.Parse()
+	// go test 的 -test.* 参数由测试框架在包初始化之后注册,测试时跳过命令行解析
+	if !testing.Testing() {
+		flag.Parse()
+	}
 
 	if *PrintVersion {
 		fmt.Println(Version)
@@ -38,9 +43,7 @@ func init() {
 		os.Exit(0)
 	}
 
-	if os.Getenv("UPLOAD_PATH") != "" {
-		UploadPath = os.Getenv("UPLOAD_PATH")
-	}
+	UploadPath = env.String("UPLOAD_PATH", UploadPath)
 	if *LogDir != "" {
 		var err error
 		*LogDir, err = filepath.Abs(*LogDir)
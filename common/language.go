@@ -0,0 +1,69 @@
+package common
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 语言代码对应的名称,用于注入语言约束
+var languageNames = map[string]string{
+	"zh": "Simplified Chinese (简体中文)",
+	"en": "English",
+	"ja": "Japanese (日本語)",
+	"ko": "Korean (한국어)",
+}
+
+var (
+	thinkBlockRegex = regexp.MustCompile(`(?s)<think>.*?</think>`)
+	codeBlockRegex  = regexp.MustCompile("(?s)```.*?```")
+)
+
+// GetLanguageName 获取语言名称,未知语言原样返回
+func GetLanguageName(language string) string {
+	if name, ok := languageNames[strings.ToLower(language)]; ok {
+		return name
+	}
+	return language
+}
+
+// GetLanguageConstraint 获取注入系统消息的语言约束
+func GetLanguageConstraint(language string) string {
+	return "You must always respond in " + GetLanguageName(language) + ", regardless of the language used in the question or in any previous context."
+}
+
+// MatchLanguage 粗略校验文本是否为指定语言(按文字系统统计),无法校验的语言视为匹配
+func MatchLanguage(text string, language string) bool {
+	text = thinkBlockRegex.ReplaceAllString(text, "")
+	text = codeBlockRegex.ReplaceAllString(text, "")
+
+	var han, kana, hangul, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	total := han + kana + hangul + latin
+	if total == 0 {
+		return true
+	}
+
+	switch strings.ToLower(language) {
+	case "zh":
+		return han > 0 && kana == 0 && hangul == 0 && han*3 >= latin
+	case "ja":
+		return kana > 0
+	case "ko":
+		return hangul*2 >= total
+	case "en":
+		return latin*2 >= total
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package linkrewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	ModeOff     = "off"
+	ModeStrip   = "strip"
+	ModeReplace = "replace"
+
+	// 流式输出时最多暂存的未完成链接长度
+	maxPending = 2048
+)
+
+// 默认内链规则:genspark.ai 站内链接(项目页、文件页等)
+const defaultPattern = `https?://(?:www\.)?genspark\.ai(?:/[^\s)\]"'<>]*)?`
+
+type Rule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	regex       *regexp.Regexp
+}
+
+var (
+	internalRegex *regexp.Regexp
+	hostRegex     = regexp.MustCompile(`^https?://(?:www\.)?genspark\.ai`)
+	markdownRegex = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^\s)]+)\)`)
+	rules         []Rule
+)
+
+// Init 编译内链规则并加载自定义重写规则
+func Init() error {
+	pattern := config.LinkRewritePattern
+	if pattern == "" {
+		pattern = defaultPattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("LINK_REWRITE_PATTERN: %v", err)
+	}
+	internalRegex = compiled
+
+	if config.LinkRewriteRulesPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(config.LinkRewriteRulesPath)
+	if err != nil {
+		return err
+	}
+	var loaded []Rule
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	for i := range loaded {
+		if loaded[i].regex, err = regexp.Compile(loaded[i].Pattern); err != nil {
+			return fmt.Errorf("rule %q: %v", loaded[i].Pattern, err)
+		}
+	}
+	rules = loaded
+	return nil
+}
+
+// Enabled 是否开启内链重写
+func Enabled() bool {
+	return internalRegex != nil && (config.LinkRewriteMode == ModeStrip || config.LinkRewriteMode == ModeReplace || len(rules) > 0)
+}
+
+// Rewrite 重写文本中的内链,markdown 图片不做处理
+func Rewrite(text string) string {
+	if !Enabled() || text == "" {
+		return text
+	}
+	for _, rule := range rules {
+		text = rule.regex.ReplaceAllString(text, rule.Replacement)
+	}
+
+	switch config.LinkRewriteMode {
+	case ModeStrip:
+		// markdown 链接保留链接文本,裸链接直接移除
+		text = markdownRegex.ReplaceAllStringFunc(text, func(match string) string {
+			groups := markdownRegex.FindStringSubmatch(match)
+			if groups[1] == "!" || !internalRegex.MatchString(groups[3]) {
+				return match
+			}
+			return groups[2]
+		})
+		text = replaceBareLinks(text, func(string) string { return "" })
+	case ModeReplace:
+		text = replaceBareLinks(text, func(link string) string {
+			return hostRegex.ReplaceAllLiteralString(link, strings.TrimSuffix(config.LinkRewriteBaseUrl, "/"))
+		})
+	}
+	return text
+}
+
+// replaceBareLinks 替换 markdown 图片以外的内链
+func replaceBareLinks(text string, replace func(string) string) string {
+	var builder strings.Builder
+	last := 0
+	for _, loc := range internalRegex.FindAllStringIndex(text, -1) {
+		if isImageLink(text, loc[0]) {
+			continue
+		}
+		builder.WriteString(text[last:loc[0]])
+		builder.WriteString(replace(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	builder.WriteString(text[last:])
+	return builder.String()
+}
+
+// isImageLink 链接是否位于 markdown 图片 ![...](...) 中
+func isImageLink(text string, start int) bool {
+	if start < 2 || text[start-2:start] != "](" {
+		return false
+	}
+	open := strings.LastIndex(text[:start-2], "[")
+	return open > 0 && text[open-1] == '!'
+}
+
+// StreamRewriter 流式输出的内链重写,暂存可能被拆分在多个增量中的未完成链接
+type StreamRewriter struct {
+	pending string
+}
+
+// Write 写入增量文本,返回可以安全输出的已重写文本
+func (r *StreamRewriter) Write(delta string) string {
+	text := r.pending + delta
+	cut := holdIndex(text)
+	r.pending = text[cut:]
+	return Rewrite(text[:cut])
+}
+
+// Flush 输出暂存的全部文本
+func (r *StreamRewriter) Flush() string {
+	text := r.pending
+	r.pending = ""
+	return Rewrite(text)
+}
+
+// holdIndex 返回文本末尾可能属于未完成链接部分的起始位置
+func holdIndex(text string) int {
+	start := len(text) - maxPending
+	if start < 0 {
+		start = 0
+	}
+	index := len(text)
+
+	// 末尾未闭合的 markdown 链接
+	if open := strings.LastIndex(text, "["); open >= start {
+		rest := text[open:]
+		closeIndex := strings.Index(rest, "]")
+		if closeIndex < 0 || closeIndex == len(rest)-1 ||
+			(strings.HasPrefix(rest[closeIndex:], "](") && !strings.Contains(rest[closeIndex:], ")")) {
+			index = open
+			if open > 0 && text[open-1] == '!' {
+				index = open - 1
+			}
+		}
+	}
+	if index == len(text) && strings.HasSuffix(text, "!") {
+		// 可能是 markdown 图片的开头
+		index = len(text) - 1
+	}
+
+	// 末尾未结束的裸链接(含 "htt" 这类不完整前缀)
+	wordStart := strings.LastIndexAny(text, " \t\r\n") + 1
+	if wordStart >= start && wordStart < index {
+		word := text[wordStart:]
+		if strings.Contains(word, "http") || hasPrefixSuffix(word, "http") {
+			index = wordStart
+		}
+	}
+	return index
+}
+
+// hasPrefixSuffix text 的某个后缀是否为 prefix 的前缀
+func hasPrefixSuffix(text string, prefix string) bool {
+	for i := 1; i < len(prefix) && i <= len(text); i++ {
+		if strings.HasSuffix(text, prefix[:i]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"genspark2api/common/config"
+	"genspark2api/common/fingerprint"
+	"strings"
+)
+
+// ChunkSampler 按 DEBUG_CHUNK_LOG_MODE 采样记录流式 chunk 的调试日志,降低 DEBUG 下的日志量;
+// 首个 chunk 与异常 chunk(非 JSON 或命中错误页指纹)始终记录,最后一个 chunk 在 Close 时补记
+type ChunkSampler struct {
+	ctx        context.Context
+	count      int
+	logged     int
+	last       string
+	lastLogged bool
+}
+
+// NewChunkSampler 创建采样器,每个流(每次尝试)使用一个
+func NewChunkSampler(ctx context.Context) *ChunkSampler {
+	return &ChunkSampler{ctx: ctx}
+}
+
+// Log 记录一个 chunk
+func (s *ChunkSampler) Log(chunk string) {
+	if !config.DebugEnabled {
+		return
+	}
+	chunk = strings.TrimSpace(chunk)
+	if config.DebugChunkLogMode != "sample" && config.DebugChunkLogMode != "edge" {
+		Debug(s.ctx, chunk)
+		return
+	}
+
+	s.count++
+	s.last = chunk
+	s.lastLogged = s.count == 1 ||
+		(config.DebugChunkLogMode == "sample" && s.count%config.DebugChunkLogSampleRate == 1%config.DebugChunkLogSampleRate) ||
+		anomalous(chunk)
+	if s.lastLogged {
+		s.logged++
+		Debugf(s.ctx, "chunk #%d: %s", s.count, chunk)
+	}
+}
+
+// Close 补记最后一个 chunk 并输出采样统计,nil 时不做任何事
+func (s *ChunkSampler) Close() {
+	if s == nil || !config.DebugEnabled || s.count == 0 {
+		return
+	}
+	if !s.lastLogged {
+		s.logged++
+		Debugf(s.ctx, "chunk #%d: %s", s.count, s.last)
+	}
+	Debugf(s.ctx, "stream chunks: %d, logged: %d", s.count, s.logged)
+}
+
+// anomalous 非 JSON 的 chunk(如 HTML 错误页)或命中错误页指纹
+func anomalous(chunk string) bool {
+	data := strings.TrimPrefix(chunk, "data: ")
+	return !json.Valid([]byte(data)) || fingerprint.Classify(chunk) != ""
+}
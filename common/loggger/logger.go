@@ -8,7 +8,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
@@ -27,13 +26,24 @@ var setupLogOnce sync.Once
 func SetupLogger() {
 	setupLogOnce.Do(func() {
 		if LogDir != "" {
-			logPath := filepath.Join(LogDir, fmt.Sprintf("genspark2api-%s.log", time.Now().Format("20060102")))
-			fd, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			var err error
+			accessWriter, err = newDailyFileWriter(LogDir, "genspark2api")
 			if err != nil {
 				log.Fatal("failed to open log file")
 			}
-			gin.DefaultWriter = io.MultiWriter(os.Stdout, fd)
-			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, fd)
+			errorWriter = accessWriter
+			gin.DefaultWriter = io.MultiWriter(os.Stdout, accessWriter)
+		}
+		// 错误日志可单独配置目录,未配置时与访问日志写入同一文件
+		if config.LogErrorDir != "" {
+			var err error
+			errorWriter, err = newDailyFileWriter(config.LogErrorDir, "genspark2api-error")
+			if err != nil {
+				log.Fatal("failed to open error log file")
+			}
+		}
+		if errorWriter != nil {
+			gin.DefaultErrorWriter = io.MultiWriter(os.Stderr, errorWriter)
 		}
 	})
 }
@@ -91,6 +101,9 @@ func logHelper(ctx context.Context, level string, msg string) {
 	if id == nil {
 		id = helper.GenRequestID()
 	}
+	if cohort, ok := ctx.Value(helper.CohortKey).(string); ok {
+		id = fmt.Sprintf("%v(%s)", id, cohort)
+	}
 	now := time.Now()
 	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
 	SetupLogger()
@@ -0,0 +1,165 @@
+package logger
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LogTypeAccess = "access"
+	LogTypeError  = "error"
+)
+
+// dailyFileWriter 按天滚动的日志文件,滚动时按保留天数/总大小清理旧文件
+type dailyFileWriter struct {
+	dir    string
+	prefix string
+	date   string
+	fd     *os.File
+	mutex  sync.Mutex
+}
+
+func newDailyFileWriter(dir string, prefix string) (*dailyFileWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &dailyFileWriter{dir: dir, prefix: prefix}
+	if err := w.rotate(time.Now().Format("20060102")); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *dailyFileWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if date := time.Now().Format("20060102"); date != w.date {
+		if err := w.rotate(date); err != nil {
+			return 0, err
+		}
+	}
+	return w.fd.Write(p)
+}
+
+// rotate 切换到指定日期的日志文件,调用方需持有锁
+func (w *dailyFileWriter) rotate(date string) error {
+	fd, err := os.OpenFile(w.path(date), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if w.fd != nil {
+		_ = w.fd.Close()
+	}
+	w.fd = fd
+	w.date = date
+	go w.cleanup()
+	return nil
+}
+
+func (w *dailyFileWriter) path(date string) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%s-%s.log", w.prefix, date))
+}
+
+// currentPath 当前写入的日志文件
+func (w *dailyFileWriter) currentPath() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.path(w.date)
+}
+
+// cleanup 删除超过保留天数的日志,总大小超限时从最旧的开始删除(不删除当天日志)
+func (w *dailyFileWriter) cleanup() {
+	if config.LogMaxDays <= 0 && config.LogMaxSize <= 0 {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(w.dir, w.prefix+"-*.log"))
+	if err != nil {
+		return
+	}
+	// 文件名中的日期固定为 8 位,按文件名排序即按日期排序
+	sort.Strings(files)
+
+	current := w.path(time.Now().Format("20060102"))
+	expireDate := time.Now().AddDate(0, 0, -config.LogMaxDays).Format("20060102")
+	var kept []string
+	var totalSize int64
+	for _, file := range files {
+		date := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), w.prefix+"-"), ".log")
+		if len(date) != 8 {
+			continue
+		}
+		if file != current && config.LogMaxDays > 0 && date < expireDate {
+			_ = os.Remove(file)
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			totalSize += info.Size()
+		}
+		kept = append(kept, file)
+	}
+
+	maxSize := int64(config.LogMaxSize) * 1024 * 1024
+	for _, file := range kept {
+		if maxSize <= 0 || totalSize <= maxSize || file == current {
+			break
+		}
+		if info, err := os.Stat(file); err == nil {
+			totalSize -= info.Size()
+		}
+		_ = os.Remove(file)
+	}
+}
+
+var (
+	accessWriter *dailyFileWriter
+	errorWriter  *dailyFileWriter
+)
+
+// TailLog 获取当前日志文件的最后若干行
+func TailLog(logType string, lines int) ([]string, error) {
+	writer := accessWriter
+	if logType == LogTypeError {
+		writer = errorWriter
+	}
+	if writer == nil {
+		return nil, fmt.Errorf("log file is not enabled")
+	}
+
+	const maxTailBytes = 2 * 1024 * 1024
+	fd, err := os.Open(writer.currentPath())
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size() - maxTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	if _, err := fd.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+
+	result := strings.Split(strings.TrimRight(string(buf), "\n"), "\n")
+	if offset > 0 && len(result) > 0 {
+		// 丢弃可能不完整的第一行
+		result = result[1:]
+	}
+	if len(result) > lines {
+		result = result[len(result)-lines:]
+	}
+	return result, nil
+}
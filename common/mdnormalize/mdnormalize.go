@@ -0,0 +1,218 @@
+package mdnormalize
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	fenceRegex     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	headingRegex   = regexp.MustCompile(`^ {0,3}(#+)([ \t]*)(.*)$`)
+	separatorRegex = regexp.MustCompile(`^\s*:?-+:?\s*$`)
+)
+
+// Normalize 规范化完整的 markdown 文本:闭合代码块、修复表格分隔行、规范标题层级
+func Normalize(text string) string {
+	if text == "" {
+		return text
+	}
+	n := &Normalizer{}
+	return n.Write(text) + n.Flush()
+}
+
+// Normalizer 按行规范化流式输出的 markdown,未完成的行与待确认的表头暂存到下一次增量
+type Normalizer struct {
+	pending   string // 未完成的行
+	header    string // 待确认的表头行
+	fence     string // 未闭合代码块的围栏,为空时不在代码块中
+	columns   int    // 当前表格的列数,为 0 时不在表格中
+	lastLevel int    // 上一个标题的层级
+}
+
+// Write 写入增量文本,返回已完成规范化的行
+func (n *Normalizer) Write(delta string) string {
+	text := n.pending + delta
+	end := strings.LastIndex(text, "\n")
+	if end < 0 {
+		n.pending = text
+		return ""
+	}
+	n.pending = text[end+1:]
+
+	var builder strings.Builder
+	for _, line := range strings.Split(text[:end], "\n") {
+		builder.WriteString(n.line(line))
+	}
+	return builder.String()
+}
+
+// Flush 输出暂存的文本并闭合未闭合的代码块,之后状态重置
+func (n *Normalizer) Flush() string {
+	var builder strings.Builder
+	partial := n.pending != ""
+	if partial {
+		builder.WriteString(strings.TrimSuffix(n.line(n.pending), "\n"))
+	}
+	if n.header != "" {
+		// 表头之后没有更多的行,原样输出
+		builder.WriteString(n.header)
+		if !partial {
+			builder.WriteString("\n")
+		}
+	}
+	if n.fence != "" {
+		if partial {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(n.fence)
+	}
+	*n = Normalizer{}
+	return builder.String()
+}
+
+// line 规范化一行,返回带换行符的结果,表头行暂存时返回空
+func (n *Normalizer) line(line string) string {
+	trimmed := strings.TrimSpace(line)
+
+	// 代码块内原样输出
+	if n.fence != "" {
+		if strings.HasPrefix(trimmed, n.fence) && strings.Trim(trimmed, n.fence[:1]) == "" {
+			n.fence = ""
+		}
+		return line + "\n"
+	}
+
+	if n.header != "" {
+		header := n.header
+		n.header = ""
+		columns := countCells(header)
+		if strings.Contains(trimmed, "|") && isSeparator(trimmed) {
+			n.columns = columns
+			return header + "\n" + separatorRow(trimmed, columns) + "\n"
+		}
+		if isTableRow(trimmed) {
+			// 缺少分隔行
+			n.columns = columns
+			return header + "\n" + separatorRow("", columns) + "\n" + padRow(line, columns) + "\n"
+		}
+		return header + "\n" + n.line(line)
+	}
+
+	if n.columns > 0 {
+		if isTableRow(trimmed) {
+			return padRow(line, n.columns) + "\n"
+		}
+		n.columns = 0
+	}
+
+	if groups := fenceRegex.FindStringSubmatch(line); groups != nil {
+		n.fence = groups[1]
+		return line + "\n"
+	}
+
+	if isTableRow(trimmed) && countCells(trimmed) >= 2 {
+		n.header = line
+		return ""
+	}
+
+	return n.heading(line) + "\n"
+}
+
+// heading 补全标题 # 后的空格,层级超过 6 时按 6 处理,且不跳级(如 h2 之后的 h4 改为 h3)
+func (n *Normalizer) heading(line string) string {
+	groups := headingRegex.FindStringSubmatch(line)
+	if groups == nil || strings.TrimSpace(groups[3]) == "" {
+		return line
+	}
+	hashes, space, text := groups[1], groups[2], groups[3]
+	if space == "" && len(hashes) < 2 {
+		// #tag 这类文本不视为标题
+		return line
+	}
+	level := min(len(hashes), 6)
+	if n.lastLevel > 0 && level > n.lastLevel+1 {
+		level = n.lastLevel + 1
+	}
+	n.lastLevel = level
+	return strings.Repeat("#", level) + " " + text
+}
+
+func isTableRow(trimmed string) bool {
+	return len(trimmed) > 1 && strings.HasPrefix(trimmed, "|")
+}
+
+func isSeparator(trimmed string) bool {
+	for _, cell := range splitCells(trimmed) {
+		if !separatorRegex.MatchString(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitCells 拆分表格行的单元格,忽略转义的 \|
+func splitCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = strings.TrimSuffix(row, "|")
+	}
+	var cells []string
+	var builder strings.Builder
+	for i := 0; i < len(row); i++ {
+		if row[i] == '\\' && i+1 < len(row) && row[i+1] == '|' {
+			builder.WriteString(`\|`)
+			i++
+			continue
+		}
+		if row[i] == '|' {
+			cells = append(cells, builder.String())
+			builder.Reset()
+			continue
+		}
+		builder.WriteByte(row[i])
+	}
+	return append(cells, builder.String())
+}
+
+func countCells(row string) int {
+	return len(splitCells(row))
+}
+
+// separatorRow 按列数生成分隔行,保留已有分隔行中的对齐方式
+func separatorRow(existing string, columns int) string {
+	var aligns []string
+	if existing != "" {
+		aligns = splitCells(existing)
+	}
+	cells := make([]string, columns)
+	for i := range cells {
+		cells[i] = "---"
+		if i < len(aligns) {
+			align := strings.TrimSpace(aligns[i])
+			left, right := strings.HasPrefix(align, ":"), strings.HasSuffix(align, ":")
+			switch {
+			case left && right:
+				cells[i] = ":---:"
+			case left:
+				cells[i] = ":---"
+			case right:
+				cells[i] = "---:"
+			}
+		}
+	}
+	return "| " + strings.Join(cells, " | ") + " |"
+}
+
+// padRow 单元格少于表头时补齐空单元格
+func padRow(line string, columns int) string {
+	missing := columns - countCells(line)
+	if missing <= 0 {
+		return line
+	}
+	line = strings.TrimRight(line, " \t")
+	if !strings.HasSuffix(line, "|") || strings.HasSuffix(line, `\|`) {
+		line += " |"
+	}
+	return line + strings.Repeat("  |", missing)
+}
@@ -0,0 +1,363 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	hourLayout   = "2006-01-02 15"
+	dayLayout    = "2006-01-02"
+	keepHours    = 48 // 保留的小时汇总数
+	keepDays     = 30 // 保留的天汇总数
+	unknownModel = "unknown"
+)
+
+// ModelUsage 单个模型的用量
+type ModelUsage struct {
+	Requests         int64 `json:"requests"`
+	Success          int64 `json:"success"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	FeedbackUsage
+}
+
+// FeedbackUsage 用户反馈统计,差评(评分不高于 2)或标记降智计为负反馈
+type FeedbackUsage struct {
+	Feedback             int64   `json:"feedback,omitempty"`
+	NegativeFeedback     int64   `json:"negative_feedback,omitempty"`
+	NegativeFeedbackRate float64 `json:"negative_feedback_rate,omitempty"`
+}
+
+// CohortUsage 单个染色分组的请求结果,用于对比金丝雀与稳定分组的错误率
+type CohortUsage struct {
+	Requests    int64   `json:"requests"`
+	Success     int64   `json:"success"`
+	Failed      int64   `json:"failed"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// Summary 一段时间内的请求汇总
+type Summary struct {
+	Requests    int64                     `json:"requests"`
+	Success     int64                     `json:"success"`
+	Failed      int64                     `json:"failed"`
+	SuccessRate float64                   `json:"success_rate"`
+	Models      map[string]*ModelUsage    `json:"models"`
+	Cohorts     map[string]*CohortUsage   `json:"cohorts,omitempty"` // 开启金丝雀发布后按分组统计
+	Cookies     map[string]*FeedbackUsage `json:"cookies,omitempty"` // 按 cookie 标识统计的用户反馈
+}
+
+// Snapshot /admin/metrics 返回的数据
+type Snapshot struct {
+	StartedAt  time.Time           `json:"started_at"`
+	SavedAt    time.Time           `json:"saved_at,omitempty"`
+	SinceStart Summary             `json:"since_start"` // 本次启动以来
+	Persistent Summary             `json:"persistent"`  // 含落盘恢复的累计值
+	Hourly     map[string]*Summary `json:"hourly"`
+	Daily      map[string]*Summary `json:"daily"`
+}
+
+// state 落盘的内容
+type state struct {
+	SavedAt    time.Time           `json:"saved_at"`
+	Persistent *Summary            `json:"persistent"`
+	Hourly     map[string]*Summary `json:"hourly"`
+	Daily      map[string]*Summary `json:"daily"`
+}
+
+var (
+	mu         sync.Mutex
+	startedAt  = time.Now()
+	savedAt    time.Time
+	sinceStart = newSummary()
+	persistent = newSummary()
+	hourly     = make(map[string]*Summary)
+	daily      = make(map[string]*Summary)
+	dirty      bool
+)
+
+func newSummary() *Summary {
+	return &Summary{Models: make(map[string]*ModelUsage), Cohorts: make(map[string]*CohortUsage), Cookies: make(map[string]*FeedbackUsage)}
+}
+
+// Init 配置了 METRICS_PATH 时从文件恢复累计值与按小时/天的汇总
+func Init() error {
+	if config.MetricsPath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(config.MetricsPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved state
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	savedAt = saved.SavedAt
+	if saved.Persistent != nil {
+		persistent = normalize(saved.Persistent)
+	}
+	for key, summary := range saved.Hourly {
+		hourly[key] = normalize(summary)
+	}
+	for key, summary := range saved.Daily {
+		daily[key] = normalize(summary)
+	}
+	prune()
+	logger.SysLog(fmt.Sprintf("metrics restored, total requests: %d", persistent.Requests))
+	return nil
+}
+
+func normalize(summary *Summary) *Summary {
+	if summary.Models == nil {
+		summary.Models = make(map[string]*ModelUsage)
+	}
+	if summary.Cohorts == nil {
+		summary.Cohorts = make(map[string]*CohortUsage)
+	}
+	if summary.Cookies == nil {
+		summary.Cookies = make(map[string]*FeedbackUsage)
+	}
+	return summary
+}
+
+// Record 记录一次请求的结果与用量,用量未知时 promptTokens/completionTokens 为 0,未染色的请求 cohort 为空
+func Record(modelName string, cohort string, success bool, promptTokens int, completionTokens int) {
+	if modelName == "" {
+		modelName = unknownModel
+	}
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	summaries := []*Summary{sinceStart, persistent, bucket(hourly, now.Format(hourLayout)), bucket(daily, now.Format(dayLayout))}
+	for _, summary := range summaries {
+		summary.Requests++
+		if success {
+			summary.Success++
+		} else {
+			summary.Failed++
+		}
+		usage, ok := summary.Models[modelName]
+		if !ok {
+			usage = &ModelUsage{}
+			summary.Models[modelName] = usage
+		}
+		usage.Requests++
+		if success {
+			usage.Success++
+		}
+		usage.PromptTokens += int64(promptTokens)
+		usage.CompletionTokens += int64(completionTokens)
+
+		if cohort == "" {
+			continue
+		}
+		cohortUsage, ok := summary.Cohorts[cohort]
+		if !ok {
+			cohortUsage = &CohortUsage{}
+			summary.Cohorts[cohort] = cohortUsage
+		}
+		cohortUsage.Requests++
+		if success {
+			cohortUsage.Success++
+		} else {
+			cohortUsage.Failed++
+		}
+	}
+	dirty = true
+}
+
+// RecordFeedback 记录一次用户反馈,计入响应所用的模型与 cookie
+func RecordFeedback(modelName string, cookieId string, negative bool) {
+	if modelName == "" {
+		modelName = unknownModel
+	}
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	summaries := []*Summary{sinceStart, persistent, bucket(hourly, now.Format(hourLayout)), bucket(daily, now.Format(dayLayout))}
+	for _, summary := range summaries {
+		usage, ok := summary.Models[modelName]
+		if !ok {
+			usage = &ModelUsage{}
+			summary.Models[modelName] = usage
+		}
+		usage.FeedbackUsage.add(negative)
+
+		if cookieId == "" {
+			continue
+		}
+		cookieUsage, ok := summary.Cookies[cookieId]
+		if !ok {
+			cookieUsage = &FeedbackUsage{}
+			summary.Cookies[cookieId] = cookieUsage
+		}
+		cookieUsage.add(negative)
+	}
+	dirty = true
+}
+
+func (u *FeedbackUsage) add(negative bool) {
+	u.Feedback++
+	if negative {
+		u.NegativeFeedback++
+	}
+}
+
+// withRate 计算负反馈率
+func (u FeedbackUsage) withRate() FeedbackUsage {
+	if u.Feedback > 0 {
+		u.NegativeFeedbackRate = float64(u.NegativeFeedback) / float64(u.Feedback)
+	}
+	return u
+}
+
+func bucket(buckets map[string]*Summary, key string) *Summary {
+	summary, ok := buckets[key]
+	if !ok {
+		summary = newSummary()
+		buckets[key] = summary
+	}
+	return summary
+}
+
+// prune 清理超出保留数量的小时/天汇总
+func prune() {
+	for _, item := range []struct {
+		buckets map[string]*Summary
+		keep    int
+	}{{hourly, keepHours}, {daily, keepDays}} {
+		if len(item.buckets) <= item.keep {
+			continue
+		}
+		keys := make([]string, 0, len(item.buckets))
+		for key := range item.buckets {
+			keys = append(keys, key)
+		}
+		// 时间格式的 key 按字典序即时间顺序
+		sort.Strings(keys)
+		for _, key := range keys[:len(keys)-item.keep] {
+			delete(item.buckets, key)
+		}
+	}
+}
+
+// FlushTask 每隔 METRICS_FLUSH_INTERVAL 秒将汇总写入 METRICS_PATH
+func FlushTask() {
+	if config.MetricsPath == "" {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.MetricsFlushInterval) * time.Second)
+		if err := Save(); err != nil {
+			logger.SysError("failed to save metrics: " + err.Error())
+		}
+	}
+}
+
+// Save 写入临时文件后重命名,避免写入中途退出导致文件损坏
+func Save() error {
+	mu.Lock()
+	if !dirty {
+		mu.Unlock()
+		return nil
+	}
+	prune()
+	now := time.Now()
+	data, err := json.Marshal(state{SavedAt: now, Persistent: persistent, Hourly: hourly, Daily: daily})
+	dirty = false
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.MetricsPath), 0755); err != nil {
+		return err
+	}
+	tmpPath := config.MetricsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, config.MetricsPath); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	savedAt = now
+	mu.Unlock()
+	return nil
+}
+
+// GetSnapshot 获取本次启动以来与累计的汇总,以及按小时/天的汇总
+func GetSnapshot() Snapshot {
+	mu.Lock()
+	defer mu.Unlock()
+	snapshot := Snapshot{
+		StartedAt:  startedAt,
+		SavedAt:    savedAt,
+		SinceStart: copySummary(sinceStart),
+		Persistent: copySummary(persistent),
+		Hourly:     make(map[string]*Summary, len(hourly)),
+		Daily:      make(map[string]*Summary, len(daily)),
+	}
+	for key, summary := range hourly {
+		copied := copySummary(summary)
+		snapshot.Hourly[key] = &copied
+	}
+	for key, summary := range daily {
+		copied := copySummary(summary)
+		snapshot.Daily[key] = &copied
+	}
+	return snapshot
+}
+
+func copySummary(summary *Summary) Summary {
+	copied := Summary{
+		Requests: summary.Requests,
+		Success:  summary.Success,
+		Failed:   summary.Failed,
+		Models:   make(map[string]*ModelUsage, len(summary.Models)),
+	}
+	if len(summary.Cohorts) > 0 {
+		copied.Cohorts = make(map[string]*CohortUsage, len(summary.Cohorts))
+		for cohort, usage := range summary.Cohorts {
+			u := *usage
+			if u.Requests > 0 {
+				u.SuccessRate = float64(u.Success) / float64(u.Requests)
+			}
+			copied.Cohorts[cohort] = &u
+		}
+	}
+	if summary.Requests > 0 {
+		copied.SuccessRate = float64(summary.Success) / float64(summary.Requests)
+	}
+	for modelName, usage := range summary.Models {
+		u := *usage
+		u.FeedbackUsage = u.FeedbackUsage.withRate()
+		copied.Models[modelName] = &u
+	}
+	if len(summary.Cookies) > 0 {
+		copied.Cookies = make(map[string]*FeedbackUsage, len(summary.Cookies))
+		for cookieId, usage := range summary.Cookies {
+			u := usage.withRate()
+			copied.Cookies[cookieId] = &u
+		}
+	}
+	return copied
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"github.com/samber/lo"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	aspectRatioSuffixRegex = regexp.MustCompile(`^(\d+)[xX](\d+)$`)
+	durationSuffixRegex    = regexp.MustCompile(`^(\d+)s$`)
+)
+
+// ModelOptions 通过模型名后缀指定的生图/生视频参数
+type ModelOptions struct {
+	AspectRatio string // 如 16x9 -> 16:9
+	HD          bool   // hd
+	Style       string // 其他后缀视为风格,如 anime
+	Duration    int    // 如 8s(仅视频模型)
+}
+
+// ParseModelSuffix 解析 "nano-banana-pro:16x9:hd" 形式的模型名,仅对生图/生视频模型生效
+// 返回去掉后缀的模型名与后缀参数,非生图/生视频模型原样返回
+func ParseModelSuffix(modelName string) (string, ModelOptions) {
+	var options ModelOptions
+	parts := strings.Split(modelName, ":")
+	if len(parts) < 2 {
+		return modelName, options
+	}
+	baseModel := parts[0]
+	if !lo.Contains(ImageModelList, baseModel) && !lo.Contains(VideoModelList, baseModel) {
+		return modelName, options
+	}
+
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+		case strings.EqualFold(part, "hd"):
+			options.HD = true
+		case strings.EqualFold(part, "auto"):
+			options.AspectRatio = "auto"
+		case aspectRatioSuffixRegex.MatchString(part):
+			matches := aspectRatioSuffixRegex.FindStringSubmatch(part)
+			options.AspectRatio = matches[1] + ":" + matches[2]
+		case durationSuffixRegex.MatchString(part):
+			options.Duration, _ = strconv.Atoi(durationSuffixRegex.FindStringSubmatch(part)[1])
+		default:
+			options.Style = part
+		}
+	}
+	return baseModel, options
+}
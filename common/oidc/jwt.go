@@ -0,0 +1,280 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"genspark2api/common/config"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway 校验 exp/nbf 时允许的时钟偏差
+const leeway = 60 * time.Second
+
+// jwksRefreshInterval kid 未命中时两次拉取 JWKS 的最小间隔,避免伪造 kid 打满 IdP
+const jwksRefreshInterval = time.Minute
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var (
+	keys        = map[string]crypto.PublicKey{}
+	keysFetched time.Time
+	keysMu      sync.Mutex
+)
+
+// Claims 已校验的 id_token 载荷
+type Claims map[string]interface{}
+
+// Identity 操作人标识,依次取 email、preferred_username、sub
+func (c Claims) Identity() string {
+	for _, key := range []string{"email", "preferred_username", "sub"} {
+		if v, ok := c[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Roles 按 OIDC_ROLE_CLAIM 读取角色/组,支持字符串或字符串数组
+func (c Claims) Roles() []string {
+	var value interface{} = map[string]interface{}(c)
+	for _, key := range strings.Split(config.OidcRoleClaim, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []interface{}:
+		roles := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// ExpiresAt token 过期时间,未携带 exp 时返回零值
+func (c Claims) ExpiresAt() time.Time {
+	if exp, ok := c["exp"].(float64); ok {
+		return time.Unix(int64(exp), 0)
+	}
+	return time.Time{}
+}
+
+// Verify 校验 id_token 的签名、签发方、受众与有效期
+func Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	key, err := getKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if err := validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func validateClaims(claims Claims) error {
+	issuer, _ := claims["iss"].(string)
+	if strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(config.OidcIssuer, "/") {
+		return fmt.Errorf("unexpected issuer %s", issuer)
+	}
+
+	audienceMatched := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audienceMatched = aud == config.OidcClientId
+	case []interface{}:
+		for _, item := range aud {
+			if item == config.OidcClientId {
+				audienceMatched = true
+				break
+			}
+		}
+	}
+	if !audienceMatched {
+		return errors.New("unexpected audience")
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("missing exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not yet valid")
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %s", alg)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("alg %s does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("alg %s does not match EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported key type")
+	}
+	return nil
+}
+
+// getKey 按 kid 获取公钥,未命中时重新拉取 JWKS(IdP 轮换密钥)
+func getKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown kid %s", kid)
+	}
+
+	p, err := getProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, p.JwksUri, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keysFetched = time.Now()
+
+	fetched := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		// 无法解析的密钥(如 OKP)直接跳过
+		if key, err := k.publicKey(); err == nil {
+			fetched[k.Kid] = key
+		}
+	}
+	keys = fetched
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown kid %s", kid)
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported kty %s", k.Kty)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,131 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// discovery .well-known/openid-configuration 中用到的字段
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+var (
+	provider   *discovery
+	providerMu sync.Mutex
+)
+
+// getProvider 懒加载 IdP 元数据,获取失败时下次调用重试
+func getProvider(ctx context.Context) (*discovery, error) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+
+	var d discovery
+	endpoint := strings.TrimSuffix(config.OidcIssuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, endpoint, &d); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksUri == "" {
+		return nil, fmt.Errorf("discovery: incomplete provider metadata")
+	}
+	provider = &d
+	return provider, nil
+}
+
+// AuthCodeURL 生成跳转到 IdP 登录页的地址
+func AuthCodeURL(ctx context.Context, state string) (string, error) {
+	p, err := getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {config.OidcClientId},
+		"redirect_uri":  {config.OidcRedirectUrl},
+		"scope":         {config.OidcScopes},
+		"state":         {state},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange 使用授权码换取 id_token
+func Exchange(ctx context.Context, code string) (string, error) {
+	p, err := getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.OidcRedirectUrl},
+		"client_id":     {config.OidcClientId},
+		"client_secret": {config.OidcClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+
+	var token struct {
+		IdToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", err
+	}
+	if token.IdToken == "" {
+		return "", fmt.Errorf("token endpoint returned no id_token")
+	}
+	return token.IdToken, nil
+}
+
+func getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
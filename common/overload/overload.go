@@ -0,0 +1,104 @@
+package overload
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Status 负载保护状态,/health 返回
+type Status struct {
+	Degraded   bool       `json:"degraded"`
+	Reason     string     `json:"reason,omitempty"`
+	Since      *time.Time `json:"since,omitempty"` // 进入降级的时间
+	MemoryMB   uint64     `json:"memory_mb"`
+	Goroutines int        `json:"goroutines"`
+	CheckedAt  time.Time  `json:"checked_at"`
+}
+
+var (
+	mu     sync.RWMutex
+	status Status
+)
+
+// Enabled 是否配置了任一水位
+func Enabled() bool {
+	return config.OverloadMemoryMB > 0 || config.OverloadGoroutines > 0
+}
+
+// Degraded 当前是否处于降级模式
+func Degraded() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return status.Degraded
+}
+
+// GetStatus 获取负载保护状态
+func GetStatus() Status {
+	mu.RLock()
+	defer mu.RUnlock()
+	return status
+}
+
+// WatchTask 每隔 OVERLOAD_CHECK_INTERVAL 秒采样内存与 goroutine 数,超过水位进入降级,
+// 降到水位的 OVERLOAD_RECOVER_PERCENT 以下后解除
+func WatchTask() {
+	if !Enabled() {
+		return
+	}
+	for {
+		Check()
+		time.Sleep(time.Duration(config.OverloadCheckInterval) * time.Second)
+	}
+}
+
+// Check 采样一次并更新降级状态
+func Check() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	memoryMB := mem.HeapAlloc / 1024 / 1024
+	goroutines := runtime.NumGoroutine()
+
+	mu.Lock()
+	defer mu.Unlock()
+	status.MemoryMB = memoryMB
+	status.Goroutines = goroutines
+	status.CheckedAt = time.Now()
+
+	if !status.Degraded {
+		reason := exceeded(memoryMB, goroutines, 100)
+		if reason == "" {
+			return
+		}
+		status.Degraded = true
+		status.Reason = reason
+		since := status.CheckedAt
+		status.Since = &since
+		logger.SysError(fmt.Sprintf("overload protection enabled: %s, memory: %dMB, goroutines: %d", reason, memoryMB, goroutines))
+		return
+	}
+
+	if reason := exceeded(memoryMB, goroutines, config.OverloadRecoverPercent); reason != "" {
+		status.Reason = reason
+		return
+	}
+	logger.SysLog(fmt.Sprintf("overload protection disabled after %s, memory: %dMB, goroutines: %d",
+		status.CheckedAt.Sub(*status.Since).Round(time.Second), memoryMB, goroutines))
+	status.Degraded = false
+	status.Reason = ""
+	status.Since = nil
+}
+
+// exceeded 返回超过水位 percent% 的指标,均未超过时返回空
+func exceeded(memoryMB uint64, goroutines int, percent int) string {
+	if config.OverloadMemoryMB > 0 && memoryMB*100 >= uint64(config.OverloadMemoryMB*percent) {
+		return "memory"
+	}
+	if config.OverloadGoroutines > 0 && goroutines*100 >= config.OverloadGoroutines*percent {
+		return "goroutines"
+	}
+	return ""
+}
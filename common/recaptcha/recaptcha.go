@@ -0,0 +1,332 @@
+package recaptcha
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+	Timeout: 60 * time.Second,
+}
+
+type Proxy struct {
+	Url       string `json:"url"`
+	Weight    int    `json:"weight"`
+	Healthy   bool   `json:"healthy"`
+	Success   int64  `json:"success"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error"`
+}
+
+type pooledToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+var (
+	proxies []*Proxy
+	mu      sync.Mutex
+
+	pool     = make(map[string][]pooledToken)      // cookie -> 预取的 token
+	fetching = make(map[string]int)                // cookie -> 进行中的获取数
+	waiters  = make(map[string][]chan fetchResult) // cookie -> 等待 token 的请求,按到达顺序
+	poolMu   sync.Mutex
+
+	semaphore chan struct{} // 限制同时请求 proxy 的数量
+)
+
+// fetchResult 一次获取的结果,交给最早等待的请求
+type fetchResult struct {
+	token string
+	err   error
+}
+
+// Init 解析 RECAPTCHA_PROXY_URL,多个地址以,分隔,地址后可用 |权重 指定权重(默认1)
+func Init() error {
+	for _, item := range strings.Split(config.RecaptchaProxyUrl, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		proxyUrl, weight := item, 1
+		if index := strings.LastIndex(item, "|"); index > 0 {
+			parsed, err := strconv.Atoi(strings.TrimSpace(item[index+1:]))
+			if err != nil || parsed <= 0 {
+				return fmt.Errorf("invalid weight: %s", item)
+			}
+			proxyUrl, weight = strings.TrimSpace(item[:index]), parsed
+		}
+		// 单个地址有误时跳过,不影响其他验证服务
+		if !strings.HasPrefix(proxyUrl, "http://") && !strings.HasPrefix(proxyUrl, "https://") {
+			logger.SysError(fmt.Sprintf("RECAPTCHA_PROXY_URL: skip invalid url %s, only http:// and https:// are supported", proxyUrl))
+			continue
+		}
+		if !strings.HasSuffix(proxyUrl, "/") {
+			proxyUrl += "/"
+		}
+		proxies = append(proxies, &Proxy{Url: proxyUrl, Weight: weight, Healthy: true})
+	}
+	if config.RecaptchaMaxConcurrency < 0 || config.RecaptchaQueueTimeout < 0 {
+		return errors.New("RECAPTCHA_MAX_CONCURRENCY and RECAPTCHA_QUEUE_TIMEOUT must not be negative")
+	}
+	if config.RecaptchaMaxConcurrency > 0 {
+		semaphore = make(chan struct{}, config.RecaptchaMaxConcurrency)
+	}
+	return nil
+}
+
+// Enabled 是否配置了 recaptcha proxy
+func Enabled() bool {
+	return len(proxies) > 0
+}
+
+// HealthCheckTask 定时检查各 proxy 的连通性,不可用的 proxy 恢复后重新参与调度
+func HealthCheckTask() {
+	if len(proxies) < 2 || config.RecaptchaHealthCheckInterval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.RecaptchaHealthCheckInterval) * time.Second)
+		for _, proxy := range proxies {
+			resp, err := httpClient.Get(proxy.Url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			mu.Lock()
+			if err != nil {
+				if proxy.Healthy {
+					logger.SysError(fmt.Sprintf("recaptcha proxy %s is unhealthy: %v", proxy.Url, err))
+				}
+				proxy.Healthy = false
+				proxy.LastError = err.Error()
+			} else if !proxy.Healthy {
+				logger.SysLog(fmt.Sprintf("recaptcha proxy %s recovered", proxy.Url))
+				proxy.Healthy = true
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+// GetToken 获取 g_recaptcha_token。token 只能使用一次,每个请求各取一个:优先使用预取池中未过期的 token,
+// 否则登记等待,同一 cookie 的并发请求由 refillPool 统一发起获取,结果按到达顺序逐个交给等待的请求
+func GetToken(cookie string) (string, error) {
+	poolMu.Lock()
+	if token, ok := takePooledToken(cookie); ok {
+		poolMu.Unlock()
+		refillPool(cookie)
+		return token, nil
+	}
+	wait := make(chan fetchResult, 1)
+	waiters[cookie] = append(waiters[cookie], wait)
+	poolMu.Unlock()
+
+	refillPool(cookie)
+	result := <-wait
+	return result.token, result.err
+}
+
+// fetchWithFailover 依次尝试各 proxy 直到成功,健康的 proxy 按权重优先;
+// 配置了 RECAPTCHA_MAX_CONCURRENCY 时先排队,超过 RECAPTCHA_QUEUE_TIMEOUT 仍未轮到时放弃
+func fetchWithFailover(cookie string) (string, error) {
+	if semaphore != nil {
+		if err := acquire(); err != nil {
+			return "", err
+		}
+		defer func() { <-semaphore }()
+	}
+
+	var lastErr error
+	tried := make(map[*Proxy]bool)
+	for proxy := pickProxy(tried); proxy != nil; proxy = pickProxy(tried) {
+		tried[proxy] = true
+		token, err := fetchToken(proxy.Url, cookie)
+		mu.Lock()
+		if err != nil {
+			proxy.Failures++
+			proxy.Healthy = false
+			proxy.LastError = err.Error()
+		} else {
+			proxy.Success++
+			proxy.Healthy = true
+		}
+		mu.Unlock()
+		if err == nil {
+			return token, nil
+		}
+		logger.SysError(fmt.Sprintf("recaptcha proxy %s failed: %v", proxy.Url, err))
+		lastErr = err
+	}
+	return "", fmt.Errorf("all recaptcha proxies failed, 查看 playwright-proxy log: %v", lastErr)
+}
+
+// pickProxy 在未尝试的 proxy 中按权重随机选择,健康的 proxy 全部尝试过后再尝试不健康的
+func pickProxy(tried map[*Proxy]bool) *Proxy {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, healthy := range []bool{true, false} {
+		var candidates []*Proxy
+		total := 0
+		for _, proxy := range proxies {
+			if !tried[proxy] && proxy.Healthy == healthy {
+				candidates = append(candidates, proxy)
+				total += proxy.Weight
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		n := rand.Intn(total)
+		for _, proxy := range candidates {
+			if n < proxy.Weight {
+				return proxy
+			}
+			n -= proxy.Weight
+		}
+	}
+	return nil
+}
+
+// acquire 占用一个请求 proxy 的名额,RECAPTCHA_QUEUE_TIMEOUT 为 0 时一直等待
+func acquire() error {
+	if config.RecaptchaQueueTimeout <= 0 {
+		semaphore <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(config.RecaptchaQueueTimeout) * time.Second)
+	defer timer.Stop()
+	select {
+	case semaphore <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("waited more than %ds for a recaptcha proxy slot, RECAPTCHA_MAX_CONCURRENCY: %d", config.RecaptchaQueueTimeout, config.RecaptchaMaxConcurrency)
+	}
+}
+
+// fetchToken 请求 proxy 的 /genspark 接口获取 token
+func fetchToken(proxyUrl string, cookie string) (string, error) {
+	req, err := http.NewRequest("GET", proxyUrl+"genspark", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", cookie)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	var response struct {
+		Code    int    `json:"code"`
+		Token   string `json:"token"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	if response.Code != 200 || response.Token == "" {
+		return "", errors.New("invalid token response: " + response.Message)
+	}
+	return response.Token, nil
+}
+
+// takePooledToken 取出一个未过期的预取 token,调用方需持有 poolMu
+func takePooledToken(cookie string) (string, bool) {
+	now := time.Now()
+	tokens := pool[cookie]
+	for len(tokens) > 0 {
+		token := tokens[0]
+		tokens = tokens[1:]
+		if token.expiresAt.After(now) {
+			pool[cookie] = tokens
+			return token.token, true
+		}
+	}
+	delete(pool, cookie)
+	return "", false
+}
+
+// refillPool 并发获取 token,使进行中的获取数覆盖等待的请求数与 RECAPTCHA_TOKEN_POOL_SIZE
+func refillPool(cookie string) {
+	poolMu.Lock()
+	missing := len(waiters[cookie]) + max(config.RecaptchaTokenPoolSize, 0) - len(pool[cookie]) - fetching[cookie]
+	if missing <= 0 {
+		poolMu.Unlock()
+		return
+	}
+	fetching[cookie] += missing
+	poolMu.Unlock()
+
+	for i := 0; i < missing; i++ {
+		go func() {
+			token, err := fetchWithFailover(cookie)
+			deliver(cookie, token, err)
+		}()
+	}
+}
+
+// deliver 将一次获取的结果交给最早等待的请求,无人等待时成功获取的 token 放入预取池
+func deliver(cookie string, token string, err error) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if fetching[cookie]--; fetching[cookie] <= 0 {
+		delete(fetching, cookie)
+	}
+	if queue := waiters[cookie]; len(queue) > 0 {
+		queue[0] <- fetchResult{token: token, err: err}
+		if len(queue) == 1 {
+			delete(waiters, cookie)
+		} else {
+			waiters[cookie] = queue[1:]
+		}
+		return
+	}
+	if err == nil {
+		pool[cookie] = append(pool[cookie], pooledToken{
+			token:     token,
+			expiresAt: time.Now().Add(time.Duration(config.RecaptchaTokenTTL) * time.Second),
+		})
+	}
+}
+
+// Snapshot 获取各 proxy 状态与预取池中的 token 数
+func Snapshot() ([]Proxy, int) {
+	mu.Lock()
+	result := make([]Proxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		result = append(result, *proxy)
+	}
+	mu.Unlock()
+
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	pooled := 0
+	for _, tokens := range pool {
+		pooled += len(tokens)
+	}
+	return result, pooled
+}
@@ -0,0 +1,113 @@
+package resolver
+
+import (
+	"context"
+	"genspark2api/common/config"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"strings"
+	"time"
+)
+
+// Init 根据 DNS_SERVER / FORCE_IPV4 替换全局 DNS 解析器,cycletls 与标准库请求均会生效
+func Init() {
+	if config.DnsServer == "" && config.ForceIPv4 != 1 {
+		return
+	}
+
+	server := normalizeServer(config.DnsServer)
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if server != "" {
+				address = server
+			}
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			if config.ForceIPv4 == 1 {
+				if packetConn, ok := conn.(net.PacketConn); ok {
+					return &ipv4OnlyConn{Conn: conn, PacketConn: packetConn}, nil
+				}
+			}
+			return conn, nil
+		},
+	}
+}
+
+func normalizeServer(server string) string {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return net.JoinHostPort(server, "53")
+	}
+	return server
+}
+
+// ipv4OnlyConn 拦截 AAAA 查询并直接返回空结果,使解析只得到 IPv4 地址
+type ipv4OnlyConn struct {
+	net.Conn
+	net.PacketConn
+	pending []byte
+}
+
+func (c *ipv4OnlyConn) Write(b []byte) (int, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(b)
+	if err != nil {
+		return c.Conn.Write(b)
+	}
+	question, err := parser.Question()
+	if err != nil || question.Type != dnsmessage.TypeAAAA {
+		return c.Conn.Write(b)
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 header.ID,
+			Response:           true,
+			RecursionDesired:   header.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              dnsmessage.RCodeSuccess,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+	c.pending, err = msg.Pack()
+	if err != nil {
+		return c.Conn.Write(b)
+	}
+	return len(b), nil
+}
+
+func (c *ipv4OnlyConn) Read(b []byte) (int, error) {
+	if c.pending != nil {
+		n := copy(b, c.pending)
+		c.pending = nil
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *ipv4OnlyConn) Close() error {
+	return c.Conn.Close()
+}
+
+func (c *ipv4OnlyConn) LocalAddr() net.Addr {
+	return c.Conn.LocalAddr()
+}
+
+func (c *ipv4OnlyConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *ipv4OnlyConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *ipv4OnlyConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,135 @@
+package shadow
+
+import (
+	"encoding/json"
+	"genspark2api/common/config"
+	"strings"
+)
+
+// Result 解析器对一次上游事件流的解析结果
+type Result struct {
+	ProjectId string `json:"project_id"`
+	Content   string `json:"content"`   // 最终答案
+	Reasoning string `json:"reasoning"` // 思考过程
+	Finished  bool   `json:"finished"`  // 是否收到 message_result
+}
+
+// Parser 上游事件流解析器,按顺序输入每个事件(可带 data: 前缀)
+type Parser interface {
+	Feed(data string)
+	Result() Result
+}
+
+// event 上游事件
+type event struct {
+	Id         string          `json:"id"`
+	MessageId  string          `json:"message_id"`
+	Type       string          `json:"type"`
+	FieldName  string          `json:"field_name"`
+	Delta      string          `json:"delta"`
+	FieldValue json.RawMessage `json:"field_value"`
+	Content    string          `json:"content"`
+}
+
+// eventParser 新解析器:按结构体解析事件,字段的完整值(message_field)覆盖此前的增量,
+// 收到 message_result 时以其中的完整答案为准
+type eventParser struct {
+	fields    map[string]*strings.Builder
+	order     []string
+	reasoning strings.Builder
+	result    Result
+}
+
+func newEventParser(string) Parser {
+	return &eventParser{fields: make(map[string]*strings.Builder)}
+}
+
+func (p *eventParser) Feed(data string) {
+	data = strings.TrimPrefix(strings.TrimSpace(data), "data: ")
+	if !strings.HasPrefix(data, "{") {
+		return
+	}
+	var e event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return
+	}
+	switch e.Type {
+	case "project_start":
+		p.result.ProjectId = e.Id
+	case "message_field_delta":
+		switch field := config.ResolveField(e.FieldName); field {
+		case config.FieldAnswer, config.FieldDetailAnswer, config.FieldMarkmap:
+			p.field(e.FieldName).WriteString(e.Delta)
+		case config.FieldThink:
+			p.reasoning.WriteString(e.Delta)
+		}
+	case "message_field":
+		var value string
+		if json.Unmarshal(e.FieldValue, &value) != nil {
+			return
+		}
+		switch field := config.ResolveField(e.FieldName); field {
+		case config.FieldAnswer, config.FieldDetailAnswer, config.FieldMarkmap:
+			builder := p.field(e.FieldName)
+			builder.Reset()
+			builder.WriteString(value)
+		}
+	case "message_result":
+		p.result.Finished = true
+		if e.Content != "" {
+			p.result.Content = e.Content
+		}
+	}
+}
+
+func (p *eventParser) field(fieldName string) *strings.Builder {
+	builder, ok := p.fields[fieldName]
+	if !ok {
+		builder = &strings.Builder{}
+		p.fields[fieldName] = builder
+		p.order = append(p.order, fieldName)
+	}
+	return builder
+}
+
+func (p *eventParser) Result() Result {
+	result := p.result
+	if result.Content == "" {
+		var content strings.Builder
+		for _, fieldName := range p.order {
+			content.WriteString(p.fields[fieldName].String())
+		}
+		result.Content = content.String()
+	}
+	result.Content = strings.TrimSpace(result.Content)
+	result.Reasoning = strings.TrimSpace(p.reasoning.String())
+	return result
+}
+
+// recorder 线上解析结果,由请求协程在事件流结束(Finish)前写入,run 在事件 channel 关闭后读取
+type recorder struct {
+	content   strings.Builder
+	reasoning strings.Builder
+	final     string
+	result    Result
+}
+
+func (r *recorder) field(field string, delta string) {
+	switch field {
+	case config.FieldAnswer, config.FieldDetailAnswer, config.FieldMarkmap:
+		r.content.WriteString(delta)
+	case config.FieldThinkStart, config.FieldThink, config.FieldThinkEnd:
+		r.reasoning.WriteString(delta)
+	}
+}
+
+func (r *recorder) Result() Result {
+	result := r.result
+	result.Content = r.final
+	if result.Content == "" {
+		result.Content = r.content.String()
+	}
+	result.Content = strings.TrimSpace(result.Content)
+	result.Reasoning = strings.TrimSpace(r.reasoning.String())
+	return result
+}
@@ -0,0 +1,218 @@
+package shadow
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	maxReports   = 100  // 保留的差异报告数
+	maxSnippet   = 200  // 差异报告中每个字段保留的字符数
+	eventBufSize = 4096 // 待解析事件的缓冲数,超出时丢弃并标记为不完整
+)
+
+// Diff 线上解析与新解析器在某个字段上的差异,Offset 为第一个不同字符的位置
+type Diff struct {
+	Field     string `json:"field"`
+	Offset    int    `json:"offset"`
+	Legacy    string `json:"legacy"`
+	Candidate string `json:"candidate"`
+}
+
+// Report 一次请求的对比报告
+type Report struct {
+	Time      time.Time `json:"time"`
+	RequestId string    `json:"request_id"`
+	Model     string    `json:"model"`
+	Events    int       `json:"events"`
+	Diffs     []Diff    `json:"diffs"`
+}
+
+// Stats 对比统计
+type Stats struct {
+	Compared   int64    `json:"compared"`   // 已对比的请求数
+	Mismatched int64    `json:"mismatched"` // 输出不一致的请求数
+	Dropped    int64    `json:"dropped"`    // 事件缓冲溢出未对比的请求数
+	Panics     int64    `json:"panics"`     // 解析器 panic 次数
+	Reports    []Report `json:"reports"`    // 最近的差异报告,新的在前
+}
+
+var (
+	mu    sync.Mutex
+	stats Stats
+)
+
+// Session 一次上游请求的影子解析,事件在独立的 goroutine 中交给新解析器,不阻塞线上返回;
+// 旧的一侧由线上流程通过 Record* 记录其实际解析出的结果
+type Session struct {
+	requestId  string
+	modelName  string
+	events     chan string
+	done       chan struct{}
+	dropped    bool
+	count      int
+	closeOnce  sync.Once
+	production recorder
+}
+
+// Start 开启影子解析,未开启或未被采样时返回 nil
+func Start(requestId string, modelName string) *Session {
+	if config.ShadowParser != 1 || rand.Intn(100) >= config.ShadowParserRate {
+		return nil
+	}
+	s := &Session{
+		requestId: requestId,
+		modelName: modelName,
+		events:    make(chan string, eventBufSize),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Feed 输入一个上游事件,缓冲已满时丢弃本次对比
+func (s *Session) Feed(data string) {
+	if s == nil || s.dropped {
+		return
+	}
+	select {
+	case s.events <- data:
+		s.count++
+	default:
+		s.dropped = true
+	}
+}
+
+// RecordProjectId 记录线上解析出的 project id
+func (s *Session) RecordProjectId(projectId string) {
+	if s == nil {
+		return
+	}
+	s.production.result.ProjectId = projectId
+}
+
+// RecordField 记录线上解析出的字段增量,field 为 config.ResolveField 的结果
+func (s *Session) RecordField(field string, delta string) {
+	if s == nil {
+		return
+	}
+	s.production.field(field, delta)
+}
+
+// RecordResult 记录线上收到 message_result,content 非空时以其作为最终答案
+func (s *Session) RecordResult(content string) {
+	if s == nil {
+		return
+	}
+	s.production.result.Finished = true
+	s.production.final = content
+}
+
+// Finish 事件流结束,异步对比线上与新解析器的输出并记录
+func (s *Session) Finish() {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(func() { close(s.events) })
+}
+
+// Discard 放弃本次对比,如换 cookie 重试前
+func (s *Session) Discard() {
+	if s == nil {
+		return
+	}
+	s.dropped = true
+	s.Finish()
+}
+
+func (s *Session) run() {
+	candidate := newEventParser(s.modelName)
+	failed := false
+	for data := range s.events {
+		if failed {
+			continue
+		}
+		failed = !safeFeed(candidate, data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case failed:
+		stats.Panics++
+		return
+	case s.dropped:
+		stats.Dropped++
+		return
+	}
+	stats.Compared++
+	diffs := compare(s.production.Result(), candidate.Result())
+	if len(diffs) == 0 {
+		return
+	}
+	stats.Mismatched++
+	logger.SysError(fmt.Sprintf("shadow parser mismatch, request: %s, model: %s, fields: %d", s.requestId, s.modelName, len(diffs)))
+	report := Report{Time: time.Now(), RequestId: s.requestId, Model: s.modelName, Events: s.count, Diffs: diffs}
+	stats.Reports = append([]Report{report}, stats.Reports...)
+	if len(stats.Reports) > maxReports {
+		stats.Reports = stats.Reports[:maxReports]
+	}
+}
+
+// safeFeed 解析器 panic 时不影响服务,返回 false
+func safeFeed(candidate Parser, data string) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.SysError(fmt.Sprintf("shadow parser panic: %v", r))
+			ok = false
+		}
+	}()
+	candidate.Feed(data)
+	return true
+}
+
+func compare(legacy Result, candidate Result) []Diff {
+	var diffs []Diff
+	add := func(field string, a string, b string) {
+		if a == b {
+			return
+		}
+		offset := 0
+		ra, rb := []rune(a), []rune(b)
+		for offset < len(ra) && offset < len(rb) && ra[offset] == rb[offset] {
+			offset++
+		}
+		diffs = append(diffs, Diff{Field: field, Offset: offset, Legacy: snippet(ra, offset), Candidate: snippet(rb, offset)})
+	}
+	add("project_id", legacy.ProjectId, candidate.ProjectId)
+	add("content", legacy.Content, candidate.Content)
+	add("reasoning", legacy.Reasoning, candidate.Reasoning)
+	add("finished", fmt.Sprint(legacy.Finished), fmt.Sprint(candidate.Finished))
+	return diffs
+}
+
+// snippet 截取差异位置附近的文本
+func snippet(text []rune, offset int) string {
+	start := offset - maxSnippet/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + maxSnippet
+	if end > len(text) {
+		end = len(text)
+	}
+	return string(text[start:end])
+}
+
+// Snapshot 获取对比统计与最近的差异报告
+func Snapshot() Stats {
+	mu.Lock()
+	defer mu.Unlock()
+	result := stats
+	result.Reports = append([]Report(nil), stats.Reports...)
+	return result
+}
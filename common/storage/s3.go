@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "AWS4-HMAC-SHA256"
+	service   = "s3"
+
+	// 预签名 URL 的最长有效期(7天)
+	maxUrlExpire = 7 * 24 * 60 * 60
+
+	lifecycleRuleId = "genspark2api-expire"
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxResponseSize = 1 << 20
+)
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+var endpoint *url.URL
+
+// Init 校验 S3 兼容存储配置,未配置 STORAGE_S3_ENDPOINT 时不启用
+func Init() error {
+	if config.StorageS3Endpoint == "" {
+		return nil
+	}
+	parsed, err := url.Parse(config.StorageS3Endpoint)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("STORAGE_S3_ENDPOINT: invalid url %s", config.StorageS3Endpoint)
+	}
+	if config.StorageS3Bucket == "" || config.StorageS3AccessKey == "" || config.StorageS3SecretKey == "" {
+		return fmt.Errorf("STORAGE_S3_BUCKET, STORAGE_S3_ACCESS_KEY and STORAGE_S3_SECRET_KEY are required")
+	}
+	if config.StorageS3UrlExpire <= 0 || config.StorageS3UrlExpire > maxUrlExpire {
+		return fmt.Errorf("STORAGE_S3_URL_EXPIRE: must be in (0, %d]", maxUrlExpire)
+	}
+	if config.StorageS3ExpireDays < 0 {
+		return fmt.Errorf("STORAGE_S3_EXPIRE_DAYS: must not be negative")
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	endpoint = parsed
+	return nil
+}
+
+// Enabled 是否将生成结果归档到 S3 兼容存储
+func Enabled() bool {
+	return endpoint != nil
+}
+
+// Upload 上传生成结果,返回带签名的下载 URL。body 以流式发送,size 未知(小于 0)时先写入临时文件以获得长度
+func Upload(body io.Reader, size int64, contentType string) (string, error) {
+	if size < 0 {
+		file, err := os.CreateTemp("", "genspark2api-upload-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+		if size, err = io.Copy(file, body); err != nil {
+			return "", err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		body = file
+	}
+
+	key := objectKey(contentType)
+	req, err := http.NewRequest(http.MethodPut, objectUrl(key).String(), body)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	// 流式上传时无法预先计算载荷摘要
+	if _, err := do(req, unsignedPayload); err != nil {
+		return "", fmt.Errorf("failed to upload object: %w", err)
+	}
+	return presign(key, time.Now()), nil
+}
+
+type lifecycleRule struct {
+	ID         string `xml:"ID"`
+	Prefix     string `xml:"Filter>Prefix"`
+	Status     string `xml:"Status"`
+	Expiration int    `xml:"Expiration>Days"`
+}
+
+// ApplyLifecycle 为归档前缀设置过期规则,STORAGE_S3_EXPIRE_DAYS 为 0 时跳过。
+// 存储桶已有相同的规则时不做修改,否则保留其他规则并替换本服务的规则
+func ApplyLifecycle() error {
+	if !Enabled() || config.StorageS3ExpireDays == 0 {
+		return nil
+	}
+	desired := lifecycleRule{ID: lifecycleRuleId, Prefix: config.StorageS3Prefix, Status: "Enabled", Expiration: config.StorageS3ExpireDays}
+
+	target := objectUrl("")
+	target.RawQuery = "lifecycle="
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	data, err := do(req, sha256Hex(nil))
+	var statusErr *statusError
+	if err != nil && !(errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound) {
+		return fmt.Errorf("failed to get lifecycle: %w", err)
+	}
+
+	// 原样保留其他规则,避免丢失解析不了的字段
+	type rawRule struct {
+		Inner string `xml:",innerxml"`
+	}
+	var existing struct {
+		Rules []struct {
+			lifecycleRule
+			rawRule
+		} `xml:"Rule"`
+	}
+	if len(data) > 0 {
+		if err := xml.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("failed to parse lifecycle: %w", err)
+		}
+	}
+	var rules []rawRule
+	for _, rule := range existing.Rules {
+		if rule.ID != lifecycleRuleId {
+			rules = append(rules, rule.rawRule)
+		} else if rule.lifecycleRule == desired {
+			return nil
+		}
+	}
+	rule, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Rule"`
+		lifecycleRule
+	}{lifecycleRule: desired})
+	if err != nil {
+		return err
+	}
+	rules = append(rules, rawRule{Inner: strings.TrimSuffix(strings.TrimPrefix(string(rule), "<Rule>"), "</Rule>")})
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name  `xml:"LifecycleConfiguration"`
+		Rules   []rawRule `xml:"Rule"`
+	}{Rules: rules})
+	if err != nil {
+		return err
+	}
+
+	req, err = http.NewRequest(http.MethodPut, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	req.Header.Set("Content-Type", "application/xml")
+	if _, err := do(req, sha256Hex(body)); err != nil {
+		return fmt.Errorf("failed to apply lifecycle: %w", err)
+	}
+	return nil
+}
+
+// objectKey 按日期分目录生成对象名,如 genspark2api/2024/01/02/<uuid>.png
+func objectKey(contentType string) string {
+	ext := ""
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	return fmt.Sprintf("%s%s/%s%s", config.StorageS3Prefix, time.Now().UTC().Format("2006/01/02"), common.GetUUID(), ext)
+}
+
+// objectUrl 对象地址,STORAGE_S3_PATH_STYLE 为 1 时使用 endpoint/bucket/key,否则使用 bucket.endpoint/key
+func objectUrl(key string) *url.URL {
+	target := *endpoint
+	if config.StorageS3PathStyle == 1 {
+		target.Path = fmt.Sprintf("%s/%s/%s", endpoint.Path, config.StorageS3Bucket, key)
+	} else {
+		target.Host = config.StorageS3Bucket + "." + endpoint.Host
+		target.Path = fmt.Sprintf("%s/%s", endpoint.Path, key)
+	}
+	target.RawPath = encodePath(target.Path)
+	return &target
+}
+
+// statusError 存储服务返回的非 200 响应
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.status, e.message)
+}
+
+// do 对请求进行 SigV4 签名后发送,返回响应体
+func do(req *http.Request, payloadHash string) ([]byte, error) {
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := credentialScope(now)
+	signature := sign(now, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, config.StorageS3AccessKey, scope, signedHeaders, signature))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &statusError{status: resp.StatusCode, message: strings.TrimSpace(string(message))}
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
+
+// presign 生成有效期为 STORAGE_S3_URL_EXPIRE 秒的下载 URL
+func presign(key string, now time.Time) string {
+	now = now.UTC()
+	target := objectUrl(key)
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", config.StorageS3AccessKey+"/"+credentialScope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", fmt.Sprint(config.StorageS3UrlExpire))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", sign(now, canonicalRequest))
+	target.RawQuery = canonicalQuery(query)
+	return target.String()
+}
+
+func credentialScope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", now.Format("20060102"), config.StorageS3Region, service)
+}
+
+func sign(now time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		algorithm,
+		now.Format("20060102T150405Z"),
+		credentialScope(now),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+config.StorageS3SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, config.StorageS3Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, encode(key, true)+"="+encode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func encodePath(path string) string {
+	return encode(path, false)
+}
+
+// encode 按 SigV4 规则编码,仅保留 A-Za-z0-9-_.~,路径中的 / 不编码
+func encode(value string, encodeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case b >= 'A' && b <= 'Z', b >= 'a' && b <= 'z', b >= '0' && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			builder.WriteByte(b)
+		default:
+			builder.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return builder.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
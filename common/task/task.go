@@ -0,0 +1,121 @@
+package task
+
+import (
+	"fmt"
+	logger "genspark2api/common/loggger"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stat 按任务名称统计的运行数
+type Stat struct {
+	Name    string `json:"name"`
+	Running int    `json:"running"`
+}
+
+var (
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	running = make(map[string]int)
+	daemons = make(map[string]int)
+)
+
+// Go 启动一个需在退出前完成的后台任务(删除会话、批任务、视频轮询等),
+// 进程收到 SIGTERM 后仍会执行,由 Shutdown 等待其结束
+func Go(name string, fn func()) {
+	mu.Lock()
+	running[name]++
+	wg.Add(1)
+	mu.Unlock()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.SysError(fmt.Sprintf("task %s panic: %v\n%s", name, r, debug.Stack()))
+			}
+			mu.Lock()
+			if running[name]--; running[name] <= 0 {
+				delete(running, name)
+			}
+			mu.Unlock()
+			wg.Done()
+		}()
+		fn()
+	}()
+}
+
+// Daemon 启动常驻的定时任务(健康检查、重载配置等),只登记不等待,退出时随进程结束
+func Daemon(name string, fn func()) {
+	mu.Lock()
+	daemons[name]++
+	mu.Unlock()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.SysError(fmt.Sprintf("daemon %s panic: %v\n%s", name, r, debug.Stack()))
+			}
+			mu.Lock()
+			if daemons[name]--; daemons[name] <= 0 {
+				delete(daemons, name)
+			}
+			mu.Unlock()
+		}()
+		fn()
+	}()
+}
+
+// Running 在途任务统计,按名称排序
+func Running() []Stat {
+	mu.Lock()
+	defer mu.Unlock()
+	return toStats(running)
+}
+
+// Daemons 常驻任务统计,按名称排序
+func Daemons() []Stat {
+	mu.Lock()
+	defer mu.Unlock()
+	return toStats(daemons)
+}
+
+// Shutdown 等待在途任务结束,超时后返回仍未完成的任务统计,timeout<=0 时不等待
+func Shutdown(timeout time.Duration) []Stat {
+	if timeout > 0 {
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(timeout):
+		}
+	}
+
+	pending := Running()
+	if len(pending) == 0 {
+		logger.SysLog("all background tasks finished")
+		return nil
+	}
+	parts := make([]string, 0, len(pending))
+	total := 0
+	for _, s := range pending {
+		parts = append(parts, fmt.Sprintf("%s=%d", s.Name, s.Running))
+		total += s.Running
+	}
+	logger.SysError(fmt.Sprintf("%d background tasks unfinished after %s: %s", total, timeout, strings.Join(parts, ", ")))
+	return pending
+}
+
+func toStats(m map[string]int) []Stat {
+	stats := make([]Stat, 0, len(m))
+	for name, n := range m {
+		stats = append(stats, Stat{Name: name, Running: n})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
@@ -0,0 +1,112 @@
+package tlsclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+	"h12.io/socks"
+)
+
+// proxyDialer 按代理地址创建拨号器,支持 http/https(CONNECT)、socks5/socks5h 与 socks4,为空时直连
+func proxyDialer(proxyUrl string) (proxy.ContextDialer, error) {
+	if proxyUrl == "" {
+		return proxy.Direct, nil
+	}
+	parsed, err := url.Parse(proxyUrl)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url: %s", proxyUrl)
+	}
+
+	switch parsed.Scheme {
+	case "http", "https":
+		return &connectDialer{proxyUrl: parsed}, nil
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if parsed.User != nil && parsed.User.Username() != "" {
+			password, _ := parsed.User.Password()
+			auth = &proxy.Auth{User: parsed.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", parsed.Host, auth, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("socks5 proxy: %v", err)
+		}
+		return dialer.(proxy.ContextDialer), nil
+	case "socks4":
+		return socks4Dialer(socks.Dial(proxyUrl)), nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme: %s", parsed.Scheme)
+}
+
+// socks4Dialer socks4 拨号不支持 context,与 cycletls 的处理一致
+type socks4Dialer func(network, address string) (net.Conn, error)
+
+func (d socks4Dialer) DialContext(_ context.Context, network, address string) (net.Conn, error) {
+	return d(network, address)
+}
+
+// connectDialer 经 http/https 代理以 HTTP/1.1 CONNECT 建立隧道
+type connectDialer struct {
+	proxyUrl *url.URL
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host := d.proxyUrl.Host
+	if d.proxyUrl.Port() == "" {
+		if d.proxyUrl.Scheme == "https" {
+			host = net.JoinHostPort(host, "443")
+		} else {
+			host = net.JoinHostPort(host, "80")
+		}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	if d.proxyUrl.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.proxyUrl.Hostname(), NextProtos: []string{"http/1.1"}})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if d.proxyUrl.User != nil && d.proxyUrl.User.Username() != "" {
+		password, _ := d.proxyUrl.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(d.proxyUrl.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxyconnect: proxy responded with %s", resp.Status)
+	}
+	return conn, nil
+}
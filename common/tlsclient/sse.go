@@ -0,0 +1,154 @@
+package tlsclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	http "github.com/Danny-Dasilva/fhttp"
+	"github.com/deanxv/CycleTLS/cycletls"
+)
+
+// 与 cycletls.DoSSE 相同的默认指纹
+const (
+	defaultJa3       = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,29-23-24,0"
+	defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
+)
+
+// 请求头顺序,与 cycletls 保持一致
+var headerOrder = []string{
+	"host", "connection", "cache-control", "device-memory", "viewport-width", "rtt", "downlink", "ect",
+	"sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-full-version", "sec-ch-ua-arch", "sec-ch-ua-platform",
+	"sec-ch-ua-platform-version", "sec-ch-ua-model", "upgrade-insecure-requests", "user-agent", "accept",
+	"sec-fetch-site", "sec-fetch-mode", "sec-fetch-user", "sec-fetch-dest", "referer", "accept-encoding",
+	"accept-language", "cookie",
+}
+
+// DoSSE 以 cycletls 的 TLS 指纹发起 SSE 请求,事件格式同 cycletls.DoSSE。
+// 与 cycletls.DoSSE 不同,ctx 结束或调用返回的 cancel 时会关闭上游连接并结束 channel,
+// 调用方提前停止读取时必须调用 cancel,否则上游连接与读取协程不会释放
+func DoSSE(ctx context.Context, url string, options cycletls.Options, method string) (<-chan cycletls.SSEResponse, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	client, req, err := newRequest(ctx, url, options, method)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	sseChan := make(chan cycletls.SSEResponse)
+	go func() {
+		defer close(sseChan)
+		defer client.CloseIdleConnections()
+		dispatchSSE(ctx, client, req, sseChan)
+	}()
+	return sseChan, cancel, nil
+}
+
+// DoStream 以 cycletls 的 TLS 指纹发起请求并返回未读取的响应,用于下载文件等需要流式转发响应体的场景,
+// 调用方读取完毕后需关闭 Body;ctx 结束时连接随之关闭
+func DoStream(ctx context.Context, url string, options cycletls.Options, method string) (*http.Response, error) {
+	client, req, err := newRequest(ctx, url, options, method)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// newRequest 按 options 构造使用 cycletls 指纹与代理的客户端及请求,请求头顺序与 cycletls 一致
+func newRequest(ctx context.Context, url string, options cycletls.Options, method string) (*http.Client, *http.Request, error) {
+	ja3 := options.Ja3
+	if ja3 == "" {
+		ja3 = defaultJa3
+	}
+	userAgent := options.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = 15
+	}
+
+	dialer, err := proxyDialer(options.Proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	client := &http.Client{
+		Transport: cycletls.NewTransportWithProxy(ja3, userAgent, dialer),
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), url, strings.NewReader(options.Body))
+	if err != nil {
+		return nil, nil, err
+	}
+	var order []string
+	for _, key := range headerOrder {
+		for name := range options.Headers {
+			if strings.ToLower(name) == key {
+				order = append(order, key)
+			}
+		}
+	}
+	req.Header = http.Header{
+		http.HeaderOrderKey:  order,
+		http.PHeaderOrderKey: {":method", ":authority", ":scheme", ":path"},
+	}
+	for name, value := range options.Headers {
+		if name != "Content-Length" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return client, req, nil
+}
+
+// dispatchSSE 逐行读取上游事件,ctx 结束时放弃发送并关闭响应体
+func dispatchSSE(ctx context.Context, client *http.Client, req *http.Request, sseChan chan<- cycletls.SSEResponse) {
+	finalUrl := req.URL.String()
+	send := func(response cycletls.SSEResponse) bool {
+		response.FinalUrl = finalUrl
+		select {
+		case sseChan <- response:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			send(cycletls.SSEResponse{Data: err.Error(), Done: true})
+		}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.Request != nil && resp.Request.URL != nil {
+		finalUrl = resp.Request.URL.String()
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			if ctx.Err() == nil {
+				send(cycletls.SSEResponse{Status: resp.StatusCode, Data: "Error reading stream: " + err.Error(), Done: true})
+			}
+			return
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if data = strings.TrimSpace(data); data != "" {
+				if !send(cycletls.SSEResponse{Status: resp.StatusCode, Data: data}) {
+					return
+				}
+			}
+		}
+		if err == io.EOF || strings.Contains(line, "[DONE]") {
+			break
+		}
+	}
+	send(cycletls.SSEResponse{Status: resp.StatusCode, Done: true})
+}
@@ -0,0 +1,87 @@
+package tlsclient
+
+import (
+	"fmt"
+	logger "genspark2api/common/loggger"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	openClients       int64
+	totalClients      int64
+	doubleClosePanics int64
+)
+
+type Stats struct {
+	Open              int64 `json:"open"`                // 未释放的客户端数
+	Total             int64 `json:"total"`               // 启动以来累计创建的客户端数
+	DoubleClosePanics int64 `json:"double_close_panics"` // 关闭时捕获的 channel 重复关闭 panic 数
+}
+
+// Client cycletls 客户端包装,按引用计数释放,channel 只会关闭一次
+type Client struct {
+	cycletls.CycleTLS
+	refs int32
+	once sync.Once
+}
+
+// New 创建客户端,初始引用计数为 1,使用完毕后需调用 Release
+func New(workers ...bool) *Client {
+	atomic.AddInt64(&openClients, 1)
+	atomic.AddInt64(&totalClients, 1)
+	return &Client{CycleTLS: cycletls.Init(workers...), refs: 1}
+}
+
+// Retain 增加引用计数,用于将客户端交给其他 goroutine 继续使用,对应的使用方需调用 Release
+func (c *Client) Retain() *Client {
+	atomic.AddInt32(&c.refs, 1)
+	return c
+}
+
+// Release 释放引用,计数归零时关闭客户端
+func (c *Client) Release() {
+	if atomic.AddInt32(&c.refs, -1) > 0 {
+		return
+	}
+	c.once.Do(func() {
+		atomic.AddInt64(&openClients, -1)
+		closeChannels(c.CycleTLS)
+	})
+}
+
+// closeChannels 关闭 cycletls 的请求/响应 channel
+// 客户端以值传递,若其他副本已被关闭(如直接调用 cycletls.Close),捕获重复关闭的 panic 并计数,其他 panic 继续抛出
+func closeChannels(client cycletls.CycleTLS) {
+	closeChannel := func(fn func()) {
+		defer func() {
+			if r := recover(); r != nil {
+				if err, ok := r.(error); ok && strings.Contains(err.Error(), "close of closed channel") {
+					atomic.AddInt64(&doubleClosePanics, 1)
+					logger.SysError(fmt.Sprintf("cycletls client closed twice: %v", err))
+					return
+				}
+				panic(r)
+			}
+		}()
+		fn()
+	}
+
+	if client.ReqChan != nil {
+		closeChannel(func() { close(client.ReqChan) })
+	}
+	if client.RespChan != nil {
+		closeChannel(func() { close(client.RespChan) })
+	}
+}
+
+// Snapshot 获取客户端数与重复关闭 panic 数
+func Snapshot() Stats {
+	return Stats{
+		Open:              atomic.LoadInt64(&openClients),
+		Total:             atomic.LoadInt64(&totalClients),
+		DoubleClosePanics: atomic.LoadInt64(&doubleClosePanics),
+	}
+}
@@ -0,0 +1,103 @@
+package tooluse
+
+import (
+	"encoding/json"
+	"genspark2api/model"
+	"strings"
+)
+
+// FromAnthropicTools Anthropic 工具定义(input_schema)转为内部格式
+func FromAnthropicTools(tools []model.AnthropicTool) []Tool {
+	var result []Tool
+	for _, tool := range tools {
+		result = append(result, Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
+		})
+	}
+	return result
+}
+
+// ToAnthropicTools 内部工具定义转为 Anthropic 格式
+func ToAnthropicTools(tools []Tool) []model.AnthropicTool {
+	var result []model.AnthropicTool
+	for _, tool := range tools {
+		inputSchema := tool.Parameters
+		if len(inputSchema) == 0 {
+			inputSchema = json.RawMessage(`{"type":"object"}`)
+		}
+		result = append(result, model.AnthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	return result
+}
+
+// FromAnthropicChoice Anthropic tool_choice(auto/any/tool/none)转为内部格式
+func FromAnthropicChoice(toolChoice *model.AnthropicToolChoice) Choice {
+	if toolChoice == nil {
+		return Choice{Mode: ChoiceAuto}
+	}
+	switch toolChoice.Type {
+	case "any":
+		return Choice{Mode: ChoiceRequired}
+	case "tool":
+		return Choice{Mode: ChoiceRequired, Name: toolChoice.Name}
+	case "none":
+		return Choice{Mode: ChoiceNone}
+	}
+	return Choice{Mode: ChoiceAuto}
+}
+
+// ToAnthropicChoice 内部工具选择转为 Anthropic tool_choice
+func ToAnthropicChoice(choice Choice) *model.AnthropicToolChoice {
+	switch {
+	case choice.Mode == ChoiceRequired && choice.Name != "":
+		return &model.AnthropicToolChoice{Type: "tool", Name: choice.Name}
+	case choice.Mode == ChoiceRequired:
+		return &model.AnthropicToolChoice{Type: "any"}
+	case choice.Mode == ChoiceNone:
+		return &model.AnthropicToolChoice{Type: "none"}
+	}
+	return &model.AnthropicToolChoice{Type: "auto"}
+}
+
+// FromAnthropicToolUse tool_use content block 转为内部工具调用
+func FromAnthropicToolUse(block model.AnthropicContentBlock) Call {
+	arguments := block.Input
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage("{}")
+	}
+	return Call{ID: block.ID, Name: block.Name, Arguments: arguments}
+}
+
+// ToAnthropicToolUse 内部工具调用转为 tool_use content block
+func ToAnthropicToolUse(call Call) model.AnthropicContentBlock {
+	id := call.ID
+	if strings.HasPrefix(id, "call_") {
+		id = "toolu_" + strings.TrimPrefix(id, "call_")
+	}
+	return model.AnthropicContentBlock{Type: "tool_use", ID: id, Name: call.Name, Input: call.Arguments}
+}
+
+// FromAnthropicToolResult tool_result content block 转为内部工具结果,结果中的非文本 block 被忽略
+func FromAnthropicToolResult(block model.AnthropicContentBlock, name string) Result {
+	var texts []string
+	if blocks, err := model.ParseAnthropicContent(block.Content); err == nil {
+		for _, contentBlock := range blocks {
+			if contentBlock.Type == "text" {
+				texts = append(texts, contentBlock.Text)
+			}
+		}
+	}
+	return Result{CallId: block.ToolUseId, Name: name, Content: strings.Join(texts, "\n"), IsError: block.IsError}
+}
+
+// ToAnthropicToolResult 内部工具结果转为 tool_result content block
+func ToAnthropicToolResult(result Result) model.AnthropicContentBlock {
+	content, _ := json.Marshal(result.Content)
+	return model.AnthropicContentBlock{Type: "tool_result", ToolUseId: result.CallId, Content: content, IsError: result.IsError}
+}
@@ -0,0 +1,168 @@
+package tooluse
+
+import (
+	"encoding/json"
+	"genspark2api/model"
+)
+
+// FromOpenAITools OpenAI 工具定义转为内部格式,忽略非 function 类型
+func FromOpenAITools(tools []model.OpenAITool) []Tool {
+	var result []Tool
+	for _, tool := range tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		result = append(result, Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	return result
+}
+
+// ToOpenAITools 内部工具定义转为 OpenAI 格式
+func ToOpenAITools(tools []Tool) []model.OpenAITool {
+	var result []model.OpenAITool
+	for _, tool := range tools {
+		result = append(result, model.OpenAITool{
+			Type: "function",
+			Function: model.OpenAIToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return result
+}
+
+// FromOpenAIChoice 解析 tool_choice:字符串 auto/none/required 或 {"type":"function","function":{"name":"..."}}
+func FromOpenAIChoice(toolChoice interface{}) Choice {
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == ChoiceNone || choice == ChoiceRequired {
+			return Choice{Mode: choice}
+		}
+	case map[string]interface{}:
+		if function, ok := choice["function"].(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				return Choice{Mode: ChoiceRequired, Name: name}
+			}
+		}
+	}
+	return Choice{Mode: ChoiceAuto}
+}
+
+// ToOpenAIChoice 内部工具选择转为 OpenAI tool_choice
+func ToOpenAIChoice(choice Choice) interface{} {
+	if choice.Mode == ChoiceRequired && choice.Name != "" {
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": choice.Name},
+		}
+	}
+	if choice.Mode == "" {
+		return ChoiceAuto
+	}
+	return choice.Mode
+}
+
+// FromOpenAIToolCalls OpenAI 工具调用转为内部格式
+func FromOpenAIToolCalls(toolCalls []model.OpenAIToolCall) []Call {
+	var calls []Call
+	for _, toolCall := range toolCalls {
+		calls = append(calls, Call{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: json.RawMessage(toolCall.Function.Arguments),
+		})
+	}
+	return calls
+}
+
+// ToOpenAIToolCalls 内部工具调用转为 OpenAI 格式,stream 为 true 时填充增量所需的 index
+func ToOpenAIToolCalls(calls []Call, stream bool) []model.OpenAIToolCall {
+	var toolCalls []model.OpenAIToolCall
+	for i, call := range calls {
+		toolCall := model.OpenAIToolCall{
+			ID:   call.ID,
+			Type: "function",
+			Function: model.OpenAIToolCallFunction{
+				Name:      call.Name,
+				Arguments: string(call.Arguments),
+			},
+		}
+		if stream {
+			index := i
+			toolCall.Index = &index
+		}
+		toolCalls = append(toolCalls, toolCall)
+	}
+	return toolCalls
+}
+
+// ConvertOpenAIMessages 将历史中的工具调用与工具结果转为上游可理解的纯文本消息:
+// 助手的 tool_calls 还原为约定的调用块,连续的 tool 消息合并为一条 user 消息
+func ConvertOpenAIMessages(messages []model.OpenAIChatMessage) []model.OpenAIChatMessage {
+	callNames := make(map[string]string)
+	var result []model.OpenAIChatMessage
+	var results []Result
+
+	flushResults := func() {
+		if len(results) == 0 {
+			return
+		}
+		result = append(result, model.OpenAIChatMessage{Role: "user", Content: FormatResults(results)})
+		results = nil
+	}
+
+	for _, message := range messages {
+		switch {
+		case message.Role == "tool":
+			name := message.Name
+			if name == "" {
+				name = callNames[message.ToolCallId]
+			}
+			results = append(results, Result{CallId: message.ToolCallId, Name: name, Content: messageText(message.Content)})
+		case message.Role == "assistant" && len(message.ToolCalls) > 0:
+			flushResults()
+			calls := FromOpenAIToolCalls(message.ToolCalls)
+			for _, call := range calls {
+				callNames[call.ID] = call.Name
+			}
+			content := FormatCalls(calls)
+			if text := messageText(message.Content); text != "" {
+				content = text + "\n" + content
+			}
+			result = append(result, model.OpenAIChatMessage{Role: "assistant", Content: content})
+		default:
+			flushResults()
+			result = append(result, message)
+		}
+	}
+	flushResults()
+	return result
+}
+
+// messageText 获取消息中的文本(兼容字符串与数组格式)
+func messageText(content interface{}) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		var text string
+		for _, part := range content {
+			if partMap, ok := part.(map[string]interface{}); ok && partMap["type"] == "text" {
+				if partText, ok := partMap["text"].(string); ok {
+					if text != "" {
+						text += "\n"
+					}
+					text += partText
+				}
+			}
+		}
+		return text
+	}
+	return ""
+}
@@ -0,0 +1,243 @@
+package tooluse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateArguments 按工具的 parameters JSON Schema 校验参数,支持 type/required/enum/const/properties/additionalProperties/items、
+// anyOf/oneOf/allOf 以及数值、字符串、数组的范围约束,$ref 等其余关键字忽略。返回的错误包含所有不合法的字段,可直接回注给模型
+func ValidateArguments(parameters json.RawMessage, arguments json.RawMessage) error {
+	var value interface{}
+	if err := json.Unmarshal(arguments, &value); err != nil {
+		return errors.New("arguments is not valid JSON")
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return errors.New("arguments must be a JSON object")
+	}
+
+	parameters = bytes.TrimSpace(parameters)
+	if len(parameters) == 0 || string(parameters) == "null" {
+		return nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(parameters, &schema); err != nil {
+		// 工具定义本身不合法时不做校验
+		return nil
+	}
+
+	var problems []string
+	validateSchema(schema, value, "arguments", &problems)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validateSchema(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	if len(schema) == 0 {
+		return
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		actual := jsonType(value)
+		matched := false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), actual))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if reflect.DeepEqual(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allowed, _ := json.Marshal(enum)
+			*problems = append(*problems, fmt.Sprintf("%s: must be one of %s", path, allowed))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		expected, _ := json.Marshal(constant)
+		*problems = append(*problems, fmt.Sprintf("%s: must be %s", path, expected))
+	}
+
+	for _, item := range subSchemas(schema["allOf"]) {
+		validateSchema(item, value, path, problems)
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		items := subSchemas(schema[keyword])
+		if len(items) == 0 {
+			continue
+		}
+		// oneOf 按 anyOf 处理,仅要求至少匹配一个
+		var first []string
+		matched := false
+		for i, item := range items {
+			var itemProblems []string
+			validateSchema(item, value, path, &itemProblems)
+			if len(itemProblems) == 0 {
+				matched = true
+				break
+			}
+			if i == 0 {
+				first = itemProblems
+			}
+		}
+		if !matched {
+			*problems = append(*problems, fmt.Sprintf("%s: does not match any schema in %s (%s)", path, keyword, strings.Join(first, "; ")))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		validateObject(schema, v, path, problems)
+	case []interface{}:
+		if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < min {
+			*problems = append(*problems, fmt.Sprintf("%s: must have at least %v items", path, min))
+		}
+		if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > max {
+			*problems = append(*problems, fmt.Sprintf("%s: must have at most %v items", path, max))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema["minLength"]); ok && length < min {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at least %v characters", path, min))
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && length > max {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at most %v characters", path, max))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			// 与 ECMA 正则不兼容的 pattern 忽略
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				*problems = append(*problems, fmt.Sprintf("%s: must match pattern %s", path, pattern))
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema["minimum"]); ok && v < min {
+			*problems = append(*problems, fmt.Sprintf("%s: must be >= %v", path, min))
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && v > max {
+			*problems = append(*problems, fmt.Sprintf("%s: must be <= %v", path, max))
+		}
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && v <= min {
+			*problems = append(*problems, fmt.Sprintf("%s: must be > %v", path, min))
+		}
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && v >= max {
+			*problems = append(*problems, fmt.Sprintf("%s: must be < %v", path, max))
+		}
+	}
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string, problems *[]string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, item := range required {
+			if name, ok := item.(string); ok {
+				if _, exists := value[name]; !exists {
+					*problems = append(*problems, fmt.Sprintf("%s.%s: is required", path, name))
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			validateSchema(property, value[name], path+"."+name, problems)
+			continue
+		}
+		if _, ok := properties[name]; ok {
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: is not an allowed property", path, name))
+			}
+		case map[string]interface{}:
+			validateSchema(additional, value[name], path+"."+name, problems)
+		}
+	}
+}
+
+// schemaTypes 解析 type 关键字,可为字符串或字符串数组
+func schemaTypes(value interface{}) []string {
+	switch t := value.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func subSchemas(value interface{}) []map[string]interface{} {
+	items, _ := value.([]interface{})
+	var schemas []map[string]interface{}
+	for _, item := range items {
+		if schema, ok := item.(map[string]interface{}); ok {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+func schemaNumber(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
@@ -0,0 +1,130 @@
+package tooluse
+
+import (
+	"strings"
+	"unicode"
+)
+
+const callsStart = "<tool_calls>"
+
+const (
+	phasePending = iota // 尚未确定回答是否以思考段开头
+	phaseThink
+	phaseAnswer
+)
+
+// StreamFilter 流式转发回答时分离开头的思考段并拦截工具调用块:调用块之前的文本立即放行,
+// 调用块开始后暂存,回答结束后由 Close 按解析结果输出剩余文本。放行的文本与 SplitReasoning、Parse 一样去掉首尾空白
+type StreamFilter struct {
+	content       strings.Builder
+	phase         int
+	sent          int // 已放行(或丢弃)到的位置
+	blocked       bool
+	reasoningSent bool
+	textSent      bool
+}
+
+// Write 追加回答增量,返回可立即输出的思考与回答文本
+func (f *StreamFilter) Write(delta string) (string, string) {
+	f.content.WriteString(delta)
+	content := f.content.String()
+
+	if f.phase == phasePending {
+		trimmed := strings.TrimLeftFunc(content, unicode.IsSpace)
+		if len(trimmed) < len(thinkStart) && strings.HasPrefix(thinkStart, trimmed) {
+			// 可能是思考段的开头,等待更多内容
+			return "", ""
+		}
+		f.phase = phaseAnswer
+		if strings.HasPrefix(trimmed, thinkStart) {
+			f.phase = phaseThink
+			f.sent = len(content) - len(trimmed) + len(thinkStart)
+		}
+	}
+
+	var reasoning string
+	if f.phase == phaseThink {
+		// 思考中常会复述调用格式,思考段内不拦截调用块
+		if end := strings.Index(content[f.sent:], thinkEnd); end >= 0 {
+			reasoning = f.release(&f.reasoningSent, content[f.sent:f.sent+end])
+			f.sent += end + len(thinkEnd)
+			f.phase = phaseAnswer
+		} else {
+			reasoning = f.take(&f.reasoningSent, content, len(content)-partialSuffix(content[f.sent:], thinkEnd))
+			return reasoning, ""
+		}
+	}
+
+	if f.blocked {
+		return reasoning, ""
+	}
+	if index := strings.Index(content[f.sent:], callsStart); index >= 0 {
+		f.blocked = true
+		return reasoning, f.take(&f.textSent, content, f.sent+index)
+	}
+	return reasoning, f.take(&f.textSent, content, len(content)-partialSuffix(content[f.sent:], callsStart))
+}
+
+// Close 回答结束时输出暂存的剩余文本,stripCalls 为 true 时去掉其中的调用块
+func (f *StreamFilter) Close(stripCalls bool) (string, string) {
+	content := f.content.String()
+	switch f.phase {
+	case phasePending:
+		// 回答只是思考段开头的一部分,按普通文本输出
+		return "", f.release(&f.textSent, content)
+	case phaseThink:
+		return f.release(&f.reasoningSent, content[f.sent:]), ""
+	}
+	rest := content[f.sent:]
+	if stripCalls {
+		if text, calls := Parse(rest); len(calls) > 0 {
+			rest = text
+			if f.textSent && rest != "" {
+				rest = "\n\n" + rest
+			}
+		}
+	}
+	return "", f.release(&f.textSent, rest)
+}
+
+// Content 返回目前收到的完整回答
+func (f *StreamFilter) Content() string {
+	return f.content.String()
+}
+
+// take 放行 content[f.sent:end],末尾空白暂不放行,避免输出调用块或思考段结束前的空白
+func (f *StreamFilter) take(started *bool, content string, end int) string {
+	text := strings.TrimRightFunc(content[f.sent:end], unicode.IsSpace)
+	if !*started {
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		f.sent += len(text) - len(trimmed)
+		text = trimmed
+	}
+	f.sent += len(text)
+	if text != "" {
+		*started = true
+	}
+	return text
+}
+
+// release 放行一段已确定结束的文本,首次放行时去掉开头空白,末尾空白直接丢弃
+func (f *StreamFilter) release(started *bool, text string) string {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	if !*started {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	}
+	if text != "" {
+		*started = true
+	}
+	return text
+}
+
+// partialSuffix 返回 s 末尾与 marker 开头重合的最大长度,该部分可能是标记的开头,需等待更多内容
+func partialSuffix(s string, marker string) int {
+	for n := len(marker) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, marker[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package tooluse
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common"
+	"regexp"
+	"strings"
+)
+
+const (
+	ChoiceAuto     = "auto"
+	ChoiceNone     = "none"
+	ChoiceRequired = "required" // 必须调用工具,Name 不为空时必须调用指定工具
+)
+
+// 模型输出中的工具调用块
+var callsBlockRegex = regexp.MustCompile(`(?s)<tool_calls>\s*(.*?)\s*</tool_calls>`)
+
+const (
+	thinkStart = "<think>"
+	thinkEnd   = "</think>"
+)
+
+// Tool 工具定义,Parameters 为 JSON Schema
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// Call 工具调用,Arguments 为 JSON 对象
+type Call struct {
+	ID        string
+	Name      string
+	Arguments json.RawMessage
+}
+
+// Result 工具执行结果
+type Result struct {
+	CallId  string
+	Name    string
+	Content string
+	IsError bool
+}
+
+// Choice 工具选择策略
+type Choice struct {
+	Mode string
+	Name string
+}
+
+// BuildPrompt 生成描述可用工具与调用格式的指令,上游模型不支持原生工具调用,按约定格式输出后由 Parse 解析
+func BuildPrompt(tools []Tool, choice Choice) string {
+	var builder strings.Builder
+	builder.WriteString("You can call the following tools. Each tool is described by its name, description and JSON Schema parameters:\n\n")
+	for _, tool := range tools {
+		parameters := string(tool.Parameters)
+		if parameters == "" || parameters == "null" {
+			parameters = "{}"
+		}
+		builder.WriteString(fmt.Sprintf("- %s: %s\n  parameters: %s\n", tool.Name, tool.Description, parameters))
+	}
+	builder.WriteString("\nTo call tools, reply with a block in exactly this format and stop, the arguments must be a JSON object matching the parameters:\n" +
+		"<tool_calls>\n[{\"name\": \"tool name\", \"arguments\": {}}]\n</tool_calls>\n" +
+		"You may write a short explanation before the block. Tool results will be sent back to you in a later message.\n")
+	switch {
+	case choice.Mode == ChoiceRequired && choice.Name != "":
+		builder.WriteString(fmt.Sprintf("You must call the tool %s now.", choice.Name))
+	case choice.Mode == ChoiceRequired:
+		builder.WriteString("You must call at least one tool now.")
+	default:
+		builder.WriteString("Only call a tool when it is needed, otherwise answer directly without the block.")
+	}
+	return builder.String()
+}
+
+// SplitReasoning 剥离回答开头的 <think> 思考段,思考中常会复述调用格式,需在解析工具调用前分开。
+// 思考段未闭合时以最后一个调用块作为回答的开始,不含调用块则视为没有思考段
+func SplitReasoning(content string) (string, string) {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, thinkStart) {
+		return "", content
+	}
+	body := trimmed[len(thinkStart):]
+	if end := strings.Index(body, thinkEnd); end >= 0 {
+		return strings.TrimSpace(body[:end]), strings.TrimSpace(body[end+len(thinkEnd):])
+	}
+	matches := callsBlockRegex.FindAllStringIndex(body, -1)
+	if len(matches) == 0 {
+		return "", content
+	}
+	start := matches[len(matches)-1][0]
+	return strings.TrimSpace(body[:start]), strings.TrimSpace(body[start:])
+}
+
+// JoinReasoning 将思考段还原到回答开头,思考段与回答之间换行分隔
+func JoinReasoning(reasoning string, text string) string {
+	if reasoning == "" {
+		return text
+	}
+	return strings.TrimSpace(thinkStart + "\n" + reasoning + "\n" + thinkEnd + "\n" + text)
+}
+
+// Parse 从模型输出中解析工具调用,返回去掉调用块后的文本,未解析出调用时原样返回
+func Parse(content string) (string, []Call) {
+	match := callsBlockRegex.FindStringSubmatchIndex(content)
+	if match == nil {
+		return content, nil
+	}
+	block := strings.TrimSpace(content[match[2]:match[3]])
+	block = strings.TrimPrefix(strings.TrimSuffix(block, "```"), "```json")
+
+	var items []struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &items); err != nil {
+		// 兼容单个调用对象
+		var item struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &item); err != nil || item.Name == "" {
+			return content, nil
+		}
+		items = append(items, item)
+	}
+
+	var calls []Call
+	for _, item := range items {
+		if item.Name == "" {
+			continue
+		}
+		arguments := item.Arguments
+		// 部分模型会把 arguments 输出为 JSON 字符串
+		var text string
+		if json.Unmarshal(arguments, &text) == nil {
+			arguments = json.RawMessage(text)
+		}
+		if len(arguments) == 0 || string(arguments) == "null" {
+			arguments = json.RawMessage("{}")
+		}
+		calls = append(calls, Call{ID: NewCallId(), Name: item.Name, Arguments: arguments})
+	}
+	if len(calls) == 0 {
+		return content, nil
+	}
+	text := strings.TrimSpace(content[:match[0]] + content[match[1]:])
+	return text, calls
+}
+
+// ValidateToolCall 校验工具调用是否为已定义的工具,且参数符合工具的 parameters JSON Schema
+func ValidateToolCall(tools []Tool, call Call) error {
+	for _, tool := range tools {
+		if tool.Name == call.Name {
+			if err := ValidateArguments(tool.Parameters, call.Arguments); err != nil {
+				return fmt.Errorf("tool %s: %v", call.Name, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tool %s", call.Name)
+}
+
+// BuildRepairPrompt 生成要求模型修正工具调用的指令,附带上一次的回答与校验错误
+func BuildRepairPrompt(content string, errs []error) string {
+	var builder strings.Builder
+	builder.WriteString("Your previous reply was:\n" + content + "\n\nThe following tool calls in it are invalid:\n")
+	for _, err := range errs {
+		builder.WriteString("- " + err.Error() + "\n")
+	}
+	builder.WriteString("Reply again with the corrected <tool_calls> block, the arguments must match the tool parameters exactly.")
+	return builder.String()
+}
+
+// FormatCalls 将历史中的工具调用还原为约定格式,作为助手消息发往上游
+func FormatCalls(calls []Call) string {
+	type item struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	items := make([]item, 0, len(calls))
+	for _, call := range calls {
+		arguments := call.Arguments
+		if !json.Valid(arguments) {
+			arguments = json.RawMessage("{}")
+		}
+		items = append(items, item{Name: call.Name, Arguments: arguments})
+	}
+	data, _ := json.Marshal(items)
+	return "<tool_calls>\n" + string(data) + "\n</tool_calls>"
+}
+
+// FormatResults 将工具执行结果转为文本,作为用户消息发往上游
+func FormatResults(results []Result) string {
+	var builder strings.Builder
+	for _, result := range results {
+		name := result.Name
+		if name == "" {
+			name = result.CallId
+		}
+		status := "result"
+		if result.IsError {
+			status = "error"
+		}
+		builder.WriteString(fmt.Sprintf("<tool_%s name=\"%s\">\n%s\n</tool_%s>\n", status, name, result.Content, status))
+	}
+	return strings.TrimSpace(builder.String())
+}
+
+// NewCallId 生成工具调用 ID
+func NewCallId() string {
+	return "call_" + common.GetUUID()[:24]
+}
@@ -0,0 +1,85 @@
+package ttfb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 首事件耗时分布的桶上限(秒),最后一个桶为超出所有上限的请求
+var buckets = []int{1, 3, 5, 10, 30, 60}
+
+var (
+	mu    sync.Mutex
+	stats = make(map[string]*ModelStats)
+)
+
+type ModelStats struct {
+	Count    int64            `json:"count"`    // 收到首事件的请求数
+	Timeouts int64            `json:"timeouts"` // 首事件超时次数
+	AvgMs    int64            `json:"avg_ms"`   // 平均首事件耗时
+	MaxMs    int64            `json:"max_ms"`   // 最大首事件耗时
+	Buckets  map[string]int64 `json:"buckets"`  // 耗时分布,如 "<=1s"、">60s"
+	totalMs  int64
+}
+
+func getModelStats(modelName string) *ModelStats {
+	modelStats, ok := stats[modelName]
+	if !ok {
+		modelStats = &ModelStats{Buckets: make(map[string]int64)}
+		stats[modelName] = modelStats
+	}
+	return modelStats
+}
+
+func bucketName(duration time.Duration) string {
+	for _, bucket := range buckets {
+		if duration <= time.Duration(bucket)*time.Second {
+			return fmt.Sprintf("<=%ds", bucket)
+		}
+	}
+	return fmt.Sprintf(">%ds", buckets[len(buckets)-1])
+}
+
+// Record 记录一次首事件耗时
+func Record(modelName string, duration time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	modelStats := getModelStats(modelName)
+	ms := duration.Milliseconds()
+	modelStats.Count++
+	modelStats.totalMs += ms
+	modelStats.AvgMs = modelStats.totalMs / modelStats.Count
+	if ms > modelStats.MaxMs {
+		modelStats.MaxMs = ms
+	}
+	modelStats.Buckets[bucketName(duration)]++
+}
+
+// RecordTimeout 记录一次首事件超时
+func RecordTimeout(modelName string) {
+	mu.Lock()
+	defer mu.Unlock()
+	getModelStats(modelName).Timeouts++
+}
+
+// Snapshot 获取各模型的首事件耗时统计
+func Snapshot() map[string]ModelStats {
+	mu.Lock()
+	defer mu.Unlock()
+	result := make(map[string]ModelStats, len(stats))
+	for modelName, modelStats := range stats {
+		bucketStats := make(map[string]int64, len(modelStats.Buckets))
+		for bucket, count := range modelStats.Buckets {
+			bucketStats[bucket] = count
+		}
+		result[modelName] = ModelStats{
+			Count:    modelStats.Count,
+			Timeouts: modelStats.Timeouts,
+			AvgMs:    modelStats.AvgMs,
+			MaxMs:    modelStats.MaxMs,
+			Buckets:  bucketStats,
+		}
+	}
+	return result
+}
@@ -0,0 +1,208 @@
+package uploadcache
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout  = 5 * time.Second
+	redisMaxIdle  = 8
+	redisKeyspace = "genspark2api:upload:"
+)
+
+var errRedisNil = errors.New("redis: nil")
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// redisClient 仅实现 GET/SET 的最小 RESP 客户端
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	useTLS   bool
+	idle     chan *redisConn
+}
+
+// newRedisClient 解析 redis://[user:password@]host:port[/db],rediss:// 为 TLS 连接
+func newRedisClient(rawUrl string) (*redisClient, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") {
+		return nil, fmt.Errorf("invalid redis url %s", rawUrl)
+	}
+	client := &redisClient{
+		addr:   parsed.Host,
+		useTLS: parsed.Scheme == "rediss",
+		idle:   make(chan *redisConn, redisMaxIdle),
+	}
+	if parsed.Port() == "" {
+		client.addr = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		client.username = parsed.User.Username()
+		client.password, _ = parsed.User.Password()
+	}
+	if db := strings.TrimPrefix(parsed.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis db %s", db)
+		}
+	}
+	return client, nil
+}
+
+func (r *redisClient) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if r.useTLS {
+		host, _, _ := net.SplitHostPort(r.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{Conn: conn, reader: bufio.NewReader(conn)}
+
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := rc.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// do 执行命令,连接出错时丢弃连接,否则放回空闲池
+func (r *redisClient) do(args ...string) (interface{}, error) {
+	var conn *redisConn
+	select {
+	case conn = <-r.idle:
+	default:
+		var err error
+		if conn, err = r.dial(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.do(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) && err != errRedisNil {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case r.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (r *redisClient) get(key string) ([]byte, error) {
+	reply, err := r.do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return data, nil
+}
+
+func (r *redisClient) set(key string, value []byte, ttl time.Duration) error {
+	_, err := r.do("SET", key, string(value), "EX", strconv.Itoa(int(ttl.Seconds())))
+	return err
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(redisTimeout))
+
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		items := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			item, err := c.readReply()
+			if err != nil && err != errRedisNil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
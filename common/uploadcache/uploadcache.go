@@ -0,0 +1,174 @@
+package uploadcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type entry struct {
+	file      map[string]interface{}
+	expiresAt time.Time
+}
+
+var (
+	store = make(map[string]*entry)
+	mutex sync.Mutex
+
+	redis *redisClient
+
+	hits   atomic.Int64
+	misses atomic.Int64
+)
+
+// Stats 上传缓存统计
+type Stats struct {
+	Backend string `json:"backend"`        // memory 或 redis
+	Size    int    `json:"size,omitempty"` // 内存中缓存的文件数
+	Hits    int64  `json:"hits"`           // 命中次数(未重复上传)
+	Misses  int64  `json:"misses"`
+}
+
+// Init 配置了 UPLOAD_CACHE_REDIS_URL 时使用 Redis 缓存,多实例部署可共享已上传的文件
+func Init() error {
+	if config.UploadCacheRedisUrl == "" {
+		return nil
+	}
+	client, err := newRedisClient(config.UploadCacheRedisUrl)
+	if err != nil {
+		return err
+	}
+	redis = client
+	return nil
+}
+
+// SourceKey 按图片链接或 base64 数据生成缓存键,命中时无需下载/解码
+// 上传的文件仅对上传时使用的 cookie 可见,因此按 cookie 区分
+func SourceKey(cookie string, source string) string {
+	return hashKey("src", cookie, []byte(source))
+}
+
+// ContentKey 按文件内容生成缓存键,不同来源的相同文件只上传一次
+func ContentKey(cookie string, data []byte) string {
+	return hashKey("sha256", cookie, data)
+}
+
+func hashKey(kind string, cookie string, data []byte) string {
+	cookieSum := sha256.Sum256([]byte(cookie))
+	h := sha256.New()
+	h.Write(cookieSum[:])
+	h.Write(data)
+	return kind + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Get 获取已上传文件的 private_file 内容,返回副本
+func Get(key string) (map[string]interface{}, bool) {
+	file, ok := get(key)
+	if ok {
+		hits.Add(1)
+	} else {
+		misses.Add(1)
+	}
+	return file, ok
+}
+
+func get(key string) (map[string]interface{}, bool) {
+	if redis != nil {
+		data, err := redis.get(redisKeyspace + key)
+		if err != nil {
+			if err != errRedisNil {
+				logger.SysError("upload cache redis get failed: " + err.Error())
+			}
+			return nil, false
+		}
+		var file map[string]interface{}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, false
+		}
+		return file, true
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	e, ok := store[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(store, key)
+		return nil, false
+	}
+	return copyFile(e.file), true
+}
+
+// Put 缓存已上传文件的 private_file 内容,内存缓存超过容量时先清理过期项,仍超出时淘汰最早过期的一项
+func Put(key string, file map[string]interface{}) {
+	if config.UploadCacheTTL <= 0 {
+		return
+	}
+	ttl := time.Duration(config.UploadCacheTTL) * time.Second
+
+	if redis != nil {
+		data, err := json.Marshal(file)
+		if err != nil {
+			return
+		}
+		if err := redis.set(redisKeyspace+key, data, ttl); err != nil {
+			logger.SysError("upload cache redis set failed: " + err.Error())
+		}
+		return
+	}
+
+	if config.UploadCacheSize <= 0 {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := store[key]; !ok && len(store) >= config.UploadCacheSize {
+		now := time.Now()
+		oldestKey, oldest := "", time.Time{}
+		for k, e := range store {
+			if now.After(e.expiresAt) {
+				delete(store, k)
+			} else if oldestKey == "" || e.expiresAt.Before(oldest) {
+				oldestKey, oldest = k, e.expiresAt
+			}
+		}
+		if len(store) >= config.UploadCacheSize {
+			delete(store, oldestKey)
+		}
+	}
+	store[key] = &entry{
+		file:      copyFile(file),
+		expiresAt: time.Now().Add(ttl),
+	}
+}
+
+// Snapshot 获取缓存统计
+func Snapshot() Stats {
+	stats := Stats{Backend: "memory", Hits: hits.Load(), Misses: misses.Load()}
+	if redis != nil {
+		stats.Backend = "redis"
+		return stats
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	stats.Size = len(store)
+	return stats
+}
+
+func copyFile(file map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(file))
+	for k, v := range file {
+		if inner, ok := v.(map[string]interface{}); ok {
+			v = copyFile(inner)
+		}
+		copied[k] = v
+	}
+	return copied
+}
@@ -3,11 +3,11 @@ package common
 import (
 	"encoding/base64"
 	"fmt"
+	"genspark2api/common/fingerprint"
 	"github.com/google/uuid"
 	jsoniter "github.com/json-iterator/go"
 	_ "github.com/pkoukk/tiktoken-go"
 	"math/rand"
-	"regexp"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -129,114 +129,38 @@ func IsBase64(s string) bool {
 	return err == nil
 }
 
-//<h1 data-translate="block_headline">Sorry, you have been blocked</h1>
+// IsCloudflareBlock 等判断基于 fingerprint 中的指纹规则,规则可通过 FINGERPRINT_RULES_PATH 外置并热更新
 
 func IsCloudflareBlock(data string) bool {
-	if strings.Contains(data, `<h1 data-translate="block_headline">Sorry, you have been blocked</h1>`) {
-		return true
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryCloudflareBlock)
 }
 
 func IsCloudflareChallenge(data string) bool {
-	// 检查基本的 HTML 结构
-	htmlPattern := `^<!DOCTYPE html><html.*?><head>.*?</head><body.*?>.*?</body></html>$`
-
-	// 检查 Cloudflare 特征
-	cfPatterns := []string{
-		`<title>Just a moment\.\.\.</title>`,          // 标题特征
-		`window\._cf_chl_opt`,                         // CF 配置对象
-		`challenge-platform/h/b/orchestrate/chl_page`, // CF challenge 路径
-		`cdn-cgi/challenge-platform`,                  // CDN 路径特征
-		`<meta http-equiv="refresh" content="\d+">`,   // 刷新 meta 标签
-	}
-
-	// 首先检查整体 HTML 结构
-	matched, _ := regexp.MatchString(htmlPattern, strings.TrimSpace(data))
-	if !matched {
-		return false
-	}
-
-	// 检查是否包含 Cloudflare 特征
-	for _, pattern := range cfPatterns {
-		if matched, _ := regexp.MatchString(pattern, data); matched {
-			return true
-		}
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryCloudflareChallenge)
 }
 
 func IsRateLimit(data string) bool {
-	if data == "Rate limit exceeded cf1" || data == "Rate limit exceeded cf2" {
-		return true
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryRateLimit)
 }
 
 func IsNotLogin(data string) bool {
-	if strings.Contains(data, `{"status":-5,"message":"not login","data":{}}`) {
-		return true
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryNotLogin)
 }
 
 func IsServerError(data string) bool {
-	if data == "Internal Server Error" {
-		return true
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryServerError)
 }
 
 func IsServerOverloaded(data string) bool {
-	if strings.Contains(data, `data: {"id": "", "role": "assistant", "content": "Server overloaded, please try again later.", "action": null, "recommend_actions": null, "is_prompt": false, "render_template": null, "session_state": null, "message_type": null, "type": "message_result"}`) {
-		return true
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryServerOverloaded)
 }
 
 func IsFreeLimit(data string) bool {
-	if strings.Contains(data, `data: {"id": "", "role": "assistant", "content": "You've reached your free usage limit today", "action": {"type": "ACTION_QUOTA_EXCEEDED", "query_string": null, "update_flow_data": null, "label": null, "user_s_input": null, "action_params": null}, "recommend_actions": null, "is_prompt": true, "render_template": null, "session_state": {"consume_usage_quota_exceeded": true}, "message_type": null, "type": "message_result"}`) {
-		return true
-	}
-
-	return false
+	return fingerprint.Match(data, fingerprint.CategoryFreeLimit)
 }
 
 func IsServiceUnavailablePage(data string) bool {
-	// 检查基本的 HTML 结构
-	htmlPattern := `^<!doctype html><html.*?><head>.*?</head><body.*?>.*?</body></html>`
-
-	// 检查 Service Unavailable 页面特征
-	suPatterns := []string{
-		`<title>Genspark</title>`,                           // 标题特征
-		`Service\s+Unavailable`,                             // 错误信息
-		`class="bb".*?class="s1".*?class="s2".*?class="s3"`, // 特征性类名结构
-		`genspark_logo\.png`,                                // Logo 图片
-		`gensparkpublicblob-cdn.*?\.azurefd\.net`,           // CDN 域名
-		`<div class="tt">Service Unavailable</div>`,         // 错误信息容器
-	}
-
-	// 首先检查整体 HTML 结构
-	matched, _ := regexp.MatchString(htmlPattern, strings.TrimSpace(data))
-	if !matched {
-		return false
-	}
-
-	// 检查特征模式，至少匹配其中的 3 个才认为是目标页面
-	matchCount := 0
-	for _, pattern := range suPatterns {
-		if matched, _ := regexp.MatchString(pattern, data); matched {
-			matchCount++
-		}
-	}
-
-	return matchCount >= 3
+	return fingerprint.Match(data, fingerprint.CategoryServiceUnavailable)
 }
 
 //<!doctype html><html><head><meta http-equiv="Content-Type" content="text/html; charset=UTF-8"><meta name="viewport" content="width=device-width,initial-scale=1,maximum-scale=1,user-scalable=no"><title>Genspark</title><link rel="icon" href="https://gensparkpublicblob-cdn-e6g4btgjavb5a7gh.z03.azurefd.net/user-upload-image/manual/favicon.ico"><style>body,html{margin:0;padding:0;font-family:Arial}.bb{width:100vw;height:100vh;position:absolute;overflow:hidden}.logo img{margin:20px 0 0 24px;height:24px}.iw{display:flex;flex-direction:column;height:100vh;width:100%}.s1{position:absolute;top:0;left:0;margin-top:-5%;margin-left:15%;width:289px;height:289px;border-radius:289px;opacity:.6;background:radial-gradient(55.64% 49.84%,#2c10d6 0,rgba(44,16,214,.36) 100%);filter:blur(120px)}.s2{position:absolute;top:0;left:0;margin-top:10%;margin-left:50%;width:204.845px;height:204.845px;transform:rotate(-131.346deg);flex-shrink:0;background:radial-gradient(55.64% 49.84%,#7fd1ff 0,rgba(44,16,214,.36) 100%);filter:blur(120px)}.s3{position:absolute;bottom:0;right:0;margin-bottom:10%;margin-right:10%;width:251px;height:251px;border-radius:289.093px;background:radial-gradient(88.27% 88.27% at 90.98% 61.04%,#ce7fff 0,#ffe4af 100%);filter:blur(120px)}.cc{display:flex;justify-content:center;align-items:center;height:100%;width:100%}.hh{align-items:center;display:flex;width:100vw}.dd{margin-top:-200px}.tt{color:#000;text-align:center;font-size:40px;font-style:normal;font-weight:700}@media (max-width:800px){.tt{font-size:30px}}</style></head><body><div class="bb"><div class="s1"></div><div class="s2"></div><div class="s3"></div></div><div class="iw"><div class="hh"><div class="logo"><img src="https://gensparkpublicblob-cdn-e6g4btgjavb5a7gh.z03.azurefd.net/user-upload-image/manual/genspark_logo.png" alt="logo"></div></div><div class="cc"><div class="dd"><div class="tt">Service Unavailable</div></div></div></div></body></html>
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"regexp"
+	"strings"
+)
+
+// 步骤事件中的产物链接
+var agentArtifactRegex = regexp.MustCompile(`https?://[^\s"'<>)\]\\]+`)
+
+// 对话接口本身的事件类型,其余类型的事件在 agent 模型下视为步骤事件
+var agentMessageEventTypes = []string{"project_start", "message_field", "message_field_delta", "message_result"}
+
+// agentCollector 收集一次 agent 请求中的步骤与产物链接
+type agentCollector struct {
+	steps     []model.AgentStep
+	artifacts []string
+	files     []model.Attachment
+	fileUrls  []string // files 对应的上游链接
+	sent      bool
+}
+
+func getAgentCollector(c *gin.Context) *agentCollector {
+	if collector, ok := c.Get(helper.AgentKey); ok {
+		return collector.(*agentCollector)
+	}
+	collector := &agentCollector{}
+	c.Set(helper.AgentKey, collector)
+	return collector
+}
+
+// resetAgent 换 cookie 重试前清空已收集的步骤与产物
+func resetAgent(c *gin.Context) {
+	c.Set(helper.AgentKey, &agentCollector{})
+}
+
+// isAgentModel 是否为 agent 模型(agent/xxx)
+func isAgentModel(modelName string) bool {
+	_, ok := config.GetAgentType(modelName)
+	return ok
+}
+
+// requestType 请求体中的上游类型,agent 模型为对应的 agent 类型
+func requestType(requestBody map[string]interface{}) string {
+	if requestBodyType, ok := requestBody["type"].(string); ok && requestBodyType != "" {
+		return requestBodyType
+	}
+	return chatType
+}
+
+// collectAgentStep 记录 agent 步骤事件及其中的产物链接与产出文件,非步骤事件返回 false
+func collectAgentStep(c *gin.Context, modelName string, data string, cookie string) (model.AgentStep, bool) {
+	if !isAgentModel(modelName) {
+		return model.AgentStep{}, false
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return model.AgentStep{}, false
+	}
+	eventType, _ := event["type"].(string)
+	if eventType == "" || lo.Contains(agentMessageEventTypes, eventType) {
+		return model.AgentStep{}, false
+	}
+
+	step := model.AgentStep{Type: eventType}
+	for _, key := range []string{"content", "title", "name", "message", "status"} {
+		if value, ok := event[key].(string); ok && strings.TrimSpace(value) != "" {
+			step.Content = strings.TrimSpace(value)
+			break
+		}
+	}
+
+	collector := getAgentCollector(c)
+	collector.steps = append(collector.steps, step)
+	for _, artifact := range agentArtifactRegex.FindAllString(data, -1) {
+		if !lo.Contains(collector.artifacts, artifact) {
+			collector.artifacts = append(collector.artifacts, artifact)
+		}
+	}
+	collectAgentFiles(collector, event, cookie)
+	return step, true
+}
+
+// sendAgentStep 以 agent_steps 字段流式返回步骤事件
+func sendAgentStep(c *gin.Context, step model.AgentStep, responseId, modelName string, jsonData []byte) error {
+	chunk := createStreamResponse(responseId, modelName, jsonData, model.OpenAIDelta{Role: "assistant"}, nil)
+	chunk.AgentSteps = []model.AgentStep{step}
+	return sendSSEvent(c, chunk)
+}
+
+// takeAgentArtifacts 返回最终答案中未出现的产物链接及产出文件下载链接段落,每次请求只返回一次
+func takeAgentArtifacts(c *gin.Context, content string) string {
+	collector := getAgentCollector(c)
+	if collector.sent {
+		return ""
+	}
+	collector.sent = true
+
+	var builder strings.Builder
+	for _, artifact := range collector.artifacts {
+		// 产出文件以下载链接的形式单独追加
+		if strings.Contains(content, artifact) || lo.Contains(collector.fileUrls, artifact) {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("- %s\n", artifact))
+	}
+	builder.WriteString(attachmentList(collector.files))
+	if builder.Len() == 0 {
+		return ""
+	}
+	return "\n\n---\n\n" + builder.String()
+}
+
+// getAgentArtifacts 返回收集到的产物链接,作为响应的 agent_artifacts 字段
+func getAgentArtifacts(c *gin.Context) []string {
+	return getAgentCollector(c).artifacts
+}
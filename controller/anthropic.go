@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/tooluse"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// MessagesForAnthropic Anthropic /v1/messages 接口,转为 OpenAI 格式后复用对话流程
+func MessagesForAnthropic(c *gin.Context) {
+	var anthropicReq model.AnthropicMessagesRequest
+	if err := c.BindJSON(&anthropicReq); err != nil {
+		logger.Errorf(c.Request.Context(), err.Error())
+		anthropicError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request parameters")
+		return
+	}
+
+	openAIReq, err := anthropicToOpenAIRequest(anthropicReq)
+	if err != nil {
+		anthropicError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	upstreamReq, tools := prepareToolRequest(c, openAIReq)
+	if anthropicReq.Stream {
+		streamAnthropicMessages(c, anthropicReq.Model, upstreamReq, tools)
+		return
+	}
+	response, writer := completeChat(c, upstreamReq)
+	if response == nil {
+		anthropicUpstreamError(c, writer)
+		return
+	}
+
+	reasoning, text, calls := resolveToolCalls(c, upstreamReq, tools, response)
+	var content []model.AnthropicContentBlock
+	if reasoning != "" {
+		content = append(content, model.AnthropicContentBlock{Type: "thinking", Thinking: reasoning, Signature: thinkingSignature(reasoning)})
+	}
+	if text != "" || len(calls) == 0 {
+		content = append(content, model.AnthropicContentBlock{Type: "text", Text: text})
+	}
+	for _, call := range calls {
+		content = append(content, tooluse.ToAnthropicToolUse(call))
+	}
+	c.JSON(http.StatusOK, model.AnthropicMessagesResponse{
+		ID:         "msg_" + response.ID,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      anthropicReq.Model,
+		Content:    content,
+		StopReason: anthropicStopReason(response.Choices[0].FinishReason, calls),
+		Usage: model.AnthropicUsage{
+			InputTokens:  response.Usage.PromptTokens,
+			OutputTokens: response.Usage.CompletionTokens,
+		},
+	})
+}
+
+// streamAnthropicMessages 流式请求上游并以 Anthropic SSE 事件实时下发思考与文本增量,回答结束后下发 tool_use 内容块
+func streamAnthropicMessages(c *gin.Context, modelName string, upstreamReq model.OpenAIChatCompletionRequest, tools []tooluse.Tool) {
+	stream := &anthropicStream{c: c, message: model.AnthropicMessagesResponse{
+		Type:    "message",
+		Role:    "assistant",
+		Model:   modelName,
+		Content: []model.AnthropicContentBlock{},
+	}}
+	response, filter, writer := streamChat(c, upstreamReq, func(chunk model.OpenAIChatCompletionResponse, reasoning, text string) {
+		stream.message.ID = "msg_" + chunk.ID
+		stream.delta("thinking", reasoning)
+		stream.delta("text", text)
+	})
+	if response == nil {
+		anthropicUpstreamError(c, writer)
+		return
+	}
+	stream.message.ID = "msg_" + response.ID
+
+	_, _, calls := resolveToolCalls(c, upstreamReq, tools, response)
+	reasoning, text := filter.Close(len(calls) > 0)
+	stream.delta("thinking", reasoning)
+	if text != "" || !stream.started && len(calls) == 0 {
+		stream.start()
+		stream.open("text")
+		stream.delta("text", text)
+	}
+	for _, call := range calls {
+		stream.toolUse(tooluse.ToAnthropicToolUse(call))
+	}
+	stream.finish(anthropicStopReason(response.Choices[0].FinishReason, calls), model.AnthropicUsage{
+		InputTokens:  response.Usage.PromptTokens,
+		OutputTokens: response.Usage.CompletionTokens,
+	})
+}
+
+// anthropicStopReason 将 OpenAI 的结束原因转为 Anthropic 的 stop_reason
+func anthropicStopReason(finishReason *string, calls []tooluse.Call) *string {
+	stopReason := "end_turn"
+	if len(calls) > 0 {
+		stopReason = "tool_use"
+	} else if finishReason != nil && *finishReason == "length" {
+		stopReason = "max_tokens"
+	}
+	return &stopReason
+}
+
+// anthropicUpstreamError 将暂存的 OpenAI 格式错误响应转为 Anthropic 格式返回
+func anthropicUpstreamError(c *gin.Context, writer *bufferedWriter) {
+	var errorResponse model.OpenAIErrorResponse
+	message := writer.body.String()
+	if json.Unmarshal(writer.body.Bytes(), &errorResponse) == nil && errorResponse.OpenAIError.Message != "" {
+		message = errorResponse.OpenAIError.Message
+	}
+	status := writer.status
+	if status == http.StatusOK {
+		status = http.StatusInternalServerError
+	}
+	anthropicError(c, status, "api_error", message)
+}
+
+// anthropicToOpenAIRequest Anthropic 请求转为 OpenAI 格式:tool_use 转为 tool_calls,tool_result 转为 tool 消息
+func anthropicToOpenAIRequest(anthropicReq model.AnthropicMessagesRequest) (model.OpenAIChatCompletionRequest, error) {
+	openAIReq := model.OpenAIChatCompletionRequest{
+		Model:      anthropicReq.Model,
+		Tools:      tooluse.ToOpenAITools(tooluse.FromAnthropicTools(anthropicReq.Tools)),
+		ToolChoice: tooluse.ToOpenAIChoice(tooluse.FromAnthropicChoice(anthropicReq.ToolChoice)),
+	}
+	// 未开启扩展思考时不返回思考过程
+	if !anthropicReq.ThinkingEnabled() {
+		openAIReq.Reasoning = &model.ChatReasoning{Exclude: true}
+	}
+	if system := anthropicReq.GetSystemText(); system != "" {
+		openAIReq.Messages = append(openAIReq.Messages, model.OpenAIChatMessage{Role: "system", Content: system})
+	}
+
+	callNames := make(map[string]string)
+	for i, message := range anthropicReq.Messages {
+		blocks, err := model.ParseAnthropicContent(message.Content)
+		if err != nil {
+			return openAIReq, fmt.Errorf("messages.%d.content: %v", i, err)
+		}
+
+		var parts []interface{}
+		var toolCalls []model.OpenAIToolCall
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				parts = append(parts, map[string]interface{}{"type": "text", "text": block.Text})
+			case "image":
+				if block.Source == nil {
+					continue
+				}
+				url := block.Source.URL
+				if block.Source.Type == "base64" {
+					url = fmt.Sprintf("data:%s;base64,%s", block.Source.MediaType, block.Source.Data)
+				}
+				parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}})
+			case "tool_use":
+				call := tooluse.FromAnthropicToolUse(block)
+				callNames[call.ID] = call.Name
+				toolCalls = append(toolCalls, tooluse.ToOpenAIToolCalls([]tooluse.Call{call}, false)...)
+			case "tool_result":
+				result := tooluse.FromAnthropicToolResult(block, callNames[block.ToolUseId])
+				content := result.Content
+				if result.IsError {
+					content = "Error: " + content
+				}
+				openAIReq.Messages = append(openAIReq.Messages, model.OpenAIChatMessage{Role: "tool", ToolCallId: result.CallId, Name: result.Name, Content: content})
+			}
+		}
+
+		if len(parts) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+		openAIMessage := model.OpenAIChatMessage{Role: message.Role, ToolCalls: toolCalls}
+		if len(parts) == 1 && parts[0].(map[string]interface{})["type"] == "text" {
+			openAIMessage.Content = parts[0].(map[string]interface{})["text"]
+		} else if len(parts) > 0 {
+			openAIMessage.Content = parts
+		} else {
+			openAIMessage.Content = ""
+		}
+		openAIReq.Messages = append(openAIReq.Messages, openAIMessage)
+	}
+	return openAIReq, nil
+}
+
+// anthropicStream 按 Anthropic SSE 事件序列下发回答,message_start 延迟到首个内容块前发出
+type anthropicStream struct {
+	c        *gin.Context
+	message  model.AnthropicMessagesResponse
+	started  bool
+	index    int             // 当前内容块序号
+	block    string          // 当前打开的内容块类型,为空时没有打开的内容块
+	thinking strings.Builder // 当前 thinking 内容块的思考过程,结束时据此下发签名
+}
+
+// start 发出 message_start 事件
+func (s *anthropicStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.c.Header("Content-Type", "text/event-stream")
+	s.send(gin.H{"type": "message_start", "message": s.message})
+}
+
+// open 打开指定类型的内容块,已打开其他类型时先结束该内容块
+func (s *anthropicStream) open(blockType string) {
+	if s.block == blockType {
+		return
+	}
+	s.close()
+	s.block = blockType
+	contentBlock := gin.H{"type": blockType, blockType: ""}
+	if blockType == "thinking" {
+		contentBlock["signature"] = ""
+	}
+	s.send(gin.H{"type": "content_block_start", "index": s.index, "content_block": contentBlock})
+}
+
+// close 结束当前内容块
+func (s *anthropicStream) close() {
+	if s.block == "" {
+		return
+	}
+	if s.block == "thinking" {
+		s.send(gin.H{"type": "content_block_delta", "index": s.index, "delta": gin.H{"type": "signature_delta", "signature": thinkingSignature(s.thinking.String())}})
+		s.thinking.Reset()
+	}
+	s.send(gin.H{"type": "content_block_stop", "index": s.index})
+	s.index++
+	s.block = ""
+}
+
+// delta 向 thinking 或 text 内容块追加增量
+func (s *anthropicStream) delta(blockType string, text string) {
+	if text == "" {
+		return
+	}
+	s.start()
+	s.open(blockType)
+	if blockType == "thinking" {
+		s.thinking.WriteString(text)
+	}
+	s.send(gin.H{"type": "content_block_delta", "index": s.index, "delta": gin.H{"type": blockType + "_delta", blockType: text}})
+}
+
+// toolUse 下发完整的 tool_use 内容块
+func (s *anthropicStream) toolUse(block model.AnthropicContentBlock) {
+	s.start()
+	s.close()
+	s.block = block.Type
+	s.send(gin.H{"type": "content_block_start", "index": s.index, "content_block": gin.H{"type": "tool_use", "id": block.ID, "name": block.Name, "input": gin.H{}}})
+	s.send(gin.H{"type": "content_block_delta", "index": s.index, "delta": gin.H{"type": "input_json_delta", "partial_json": string(block.Input)}})
+	s.close()
+}
+
+// finish 结束当前内容块并发出 message_delta 与 message_stop
+func (s *anthropicStream) finish(stopReason *string, usage model.AnthropicUsage) {
+	s.start()
+	s.close()
+	s.send(gin.H{"type": "message_delta", "delta": gin.H{"stop_reason": stopReason, "stop_sequence": nil}, "usage": usage})
+	s.send(gin.H{"type": "message_stop"})
+}
+
+func (s *anthropicStream) send(event gin.H) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf(s.c.Request.Context(), "Failed to marshal event: %v", err)
+		return
+	}
+	s.c.SSEvent(event["type"].(string), string(data))
+	s.c.Writer.Flush()
+}
+
+// thinkingSignature thinking 内容块的签名。上游不提供签名,以思考过程的摘要作为不透明值,客户端回传的 thinking 内容块会被忽略
+func thinkingSignature(thinking string) string {
+	sum := sha256.Sum256([]byte(thinking))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func anthropicError(c *gin.Context, status int, errorType string, message string) {
+	c.JSON(status, model.AnthropicErrorResponse{
+		Type:  "error",
+		Error: model.AnthropicError{Type: errorType, Message: i18n.Translate(c, message)},
+	})
+}
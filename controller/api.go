@@ -1,14 +1,14 @@
 package controller
 
 import (
-	"github.com/deanxv/CycleTLS/cycletls"
+	"genspark2api/common/tlsclient"
 	"github.com/gin-gonic/gin"
 )
 
 // ChatForOpenAI 处理OpenAI聊天请求
 func InitModelChatMap(c *gin.Context) {
-	client := cycletls.Init()
-	defer safeClose(client)
+	client := tlsclient.New()
+	defer client.Release()
 
 	// TODO
 }
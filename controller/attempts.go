@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"genspark2api/common/config"
+	"genspark2api/common/events"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"time"
+)
+
+// 上游尝试的结果类别
+const (
+	attemptOk                  = "ok"
+	attemptRequestError        = "request_error"
+	attemptFirstEventTimeout   = "first_event_timeout"
+	attemptInterrupted         = "interrupted"
+	attemptRateLimit           = "rate_limit"
+	attemptFreeLimit           = "free_limit"
+	attemptNotLogin            = "not_login"
+	attemptCloudflareChallenge = "cloudflare_challenge"
+	attemptCloudflareBlock     = "cloudflare_block"
+	attemptServiceUnavailable  = "service_unavailable"
+	attemptServerError         = "server_error"
+	attemptServerOverloaded    = "server_overloaded"
+	attemptNoContent           = "no_content"
+	attemptImageQueue          = "image_queue" // 生图排队过长,快速失败
+	attemptRetry               = "retry"       // 内容校验未通过(语言不符、疑似降智)后重试
+)
+
+// attemptTracer 记录一次请求中各次上游尝试,DEBUG 模式下通过 X-Upstream-Attempts 响应头与错误体 details 返回
+type attemptTracer struct {
+	attempts []model.UpstreamAttempt
+	cookie   string
+	start    time.Time
+	pending  bool
+}
+
+func getAttemptTracer(c *gin.Context) *attemptTracer {
+	if tracer, ok := c.Get(helper.AttemptsKey); ok {
+		return tracer.(*attemptTracer)
+	}
+	tracer := &attemptTracer{}
+	c.Set(helper.AttemptsKey, tracer)
+	return tracer
+}
+
+// attemptsTracked DEBUG 模式或订阅了事件总线时记录上游尝试
+func attemptsTracked() bool {
+	return config.DebugEnabled || events.Enabled()
+}
+
+// beginAttempt 开始一次上游尝试,上一次尝试未结束时按中断记录
+func beginAttempt(c *gin.Context, cookie string) {
+	if !attemptsTracked() {
+		return
+	}
+	endAttempt(c, attemptInterrupted)
+	tracer := getAttemptTracer(c)
+	tracer.cookie = cookie
+	tracer.start = time.Now()
+	tracer.pending = true
+}
+
+// endAttempt 结束当前尝试并记录结果类别,响应尚未输出时同步更新响应头
+func endAttempt(c *gin.Context, category string) {
+	if !attemptsTracked() {
+		return
+	}
+	tracer := getAttemptTracer(c)
+	if !tracer.pending {
+		return
+	}
+	tracer.pending = false
+	attempt := model.UpstreamAttempt{
+		Cookie:     lo.IndexOf(getCookiePool(c), tracer.cookie) + 1,
+		Category:   category,
+		DurationMs: time.Since(tracer.start).Milliseconds(),
+	}
+	tracer.attempts = append(tracer.attempts, attempt)
+	events.Publish(events.Event{
+		Type:       events.TypeUpstreamResponse,
+		RequestId:  c.GetString(helper.RequestIdKey),
+		Model:      c.GetString(helper.ModelKey),
+		DurationMs: attempt.DurationMs,
+		Cookie:     attempt.Cookie,
+		Category:   attempt.Category,
+	})
+	if !config.DebugEnabled {
+		return
+	}
+	if !c.Writer.Written() {
+		data, _ := json.Marshal(tracer.attempts)
+		c.Header("X-Upstream-Attempts", string(data))
+	}
+}
+
+// errorBody 组装错误响应体,DEBUG 模式下在 details 中附带上游尝试轨迹
+func errorBody(c *gin.Context, message string) gin.H {
+	body := gin.H{"error": i18n.Translate(c, message)}
+	if !config.DebugEnabled {
+		return body
+	}
+	if attempts := getAttemptTracer(c).attempts; len(attempts) > 0 {
+		body["details"] = gin.H{"attempts": attempts}
+	}
+	return body
+}
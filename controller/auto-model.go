@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"genspark2api/common/autoroute"
+	"genspark2api/common/helper"
+	logger "genspark2api/common/loggger"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+)
+
+// resolveAutoModel model 为 auto 时按 AUTO_MODEL_RULES 选择模型,并以 X-Actual-Model 响应头注明实际使用的模型
+func resolveAutoModel(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) {
+	if openAIReq.Model != autoroute.ModelName || !autoroute.Enabled() {
+		return
+	}
+	modelName, category := autoroute.Route(openAIReq)
+	logger.Infof(c.Request.Context(), "auto model routed to %s by rule %s", modelName, category)
+	c.Header("X-Actual-Model", modelName)
+	c.Set(helper.ModelKey, modelName)
+	openAIReq.Model = modelName
+}
@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/task"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+const (
+	batchStatusInProgress = "in_progress"
+	batchStatusCompleted  = "completed"
+)
+
+// 批任务的可执行端点
+var batchHandlers = map[string]gin.HandlerFunc{
+	"/v1/chat/completions":   ChatForOpenAI,
+	"/v1/images/generations": ImagesForOpenAI,
+}
+
+// 所有批任务共享的并发令牌
+var batchSemaphore = make(chan struct{}, helper.Max(config.BatchConcurrency, 1))
+
+type batchTask struct {
+	owner    string // 提交者标识,批任务仅对提交者可见
+	caller   string // 提交者的会话命名空间标识,各请求按提交者隔离自动绑定的会话
+	response model.BatchResponse
+	results  []model.BatchResultItem
+	mu       sync.Mutex
+}
+
+var batchTasks sync.Map
+
+// BatchForOpenAI 提交批任务,按队列异步执行
+func BatchForOpenAI(c *gin.Context) {
+	var batchReq model.BatchRequest
+	if err := c.BindJSON(&batchReq); err != nil {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.InvalidRequest),
+				Type:    "invalid_request_error",
+				Code:    "400",
+			},
+		})
+		return
+	}
+
+	if len(batchReq.Requests) == 0 || len(batchReq.Requests) > config.BatchMaxRequests {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.BatchSizeInvalid, config.BatchMaxRequests),
+				Type:    "invalid_request_error",
+				Code:    "400",
+			},
+		})
+		return
+	}
+
+	for _, item := range batchReq.Requests {
+		if _, ok := batchHandlers[item.Url]; !ok {
+			c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+				OpenAIError: model.OpenAIError{
+					Message: i18n.Message(c, i18n.BatchUrlUnsupported, item.Url, item.CustomId),
+					Type:    "invalid_request_error",
+					Code:    "400",
+				},
+			})
+			return
+		}
+	}
+
+	batch := &batchTask{
+		owner:  getCallerOwner(c),
+		caller: sessionCaller(c),
+		response: model.BatchResponse{
+			ID:        "batch_" + common.GetUUID(),
+			Object:    "batch",
+			Status:    batchStatusInProgress,
+			CreatedAt: time.Now().Unix(),
+			RequestCounts: model.BatchRequestCounts{
+				Total: len(batchReq.Requests),
+			},
+		},
+		results: make([]model.BatchResultItem, len(batchReq.Requests)),
+	}
+	batchTasks.Store(batch.response.ID, batch)
+
+	tenant, _ := getTenant(c)
+
+	logger.Infof(c.Request.Context(), "batch %s submitted, %d requests", batch.response.ID, len(batchReq.Requests))
+	task.Go("batch", func() { runBatchTask(batch, batchReq.Requests, tenant) })
+
+	c.JSON(http.StatusOK, batch.snapshot())
+}
+
+// GetBatch 查询批任务状态
+func GetBatch(c *gin.Context) {
+	task, ok := getBatchTask(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, task.snapshot())
+}
+
+// GetBatchResults 以 JSONL 格式下载批任务结果
+func GetBatchResults(c *gin.Context) {
+	task, ok := getBatchTask(c)
+	if !ok {
+		return
+	}
+
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	if task.response.Status != batchStatusCompleted {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.BatchNotCompleted),
+				Type:    "invalid_request_error",
+				Code:    "400",
+			},
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, result := range task.results {
+		line, _ := json.Marshal(result)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.jsonl", task.response.ID))
+	c.Data(http.StatusOK, "application/jsonl", buf.Bytes())
+}
+
+// getBatchTask 获取当前调用方提交的批任务,其他调用方的批任务视为不存在
+func getBatchTask(c *gin.Context) (*batchTask, bool) {
+	value, ok := batchTasks.Load(c.Param("id"))
+	if ok && value.(*batchTask).owner != getCallerOwner(c) {
+		ok = false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.BatchNotFound),
+				Type:    "invalid_request_error",
+				Code:    "404",
+			},
+		})
+		return nil, false
+	}
+	return value.(*batchTask), true
+}
+
+func (t *batchTask) snapshot() model.BatchResponse {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.response
+}
+
+func runBatchTask(task *batchTask, items []model.BatchRequestItem, tenant *config.Tenant) {
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		batchSemaphore <- struct{}{}
+		go func(index int, item model.BatchRequestItem) {
+			defer wg.Done()
+			defer func() { <-batchSemaphore }()
+
+			result := executeBatchItem(task.response.ID, index, item, tenant, task.caller)
+
+			task.mu.Lock()
+			task.results[index] = result
+			if result.Error == nil && result.Response.StatusCode == http.StatusOK {
+				task.response.RequestCounts.Completed++
+			} else {
+				task.response.RequestCounts.Failed++
+			}
+			task.mu.Unlock()
+		}(i, item)
+	}
+	wg.Wait()
+
+	task.mu.Lock()
+	completedAt := time.Now().Unix()
+	task.response.Status = batchStatusCompleted
+	task.response.CompletedAt = &completedAt
+	task.mu.Unlock()
+
+	// 结果保留一段时间后清理
+	time.AfterFunc(time.Duration(config.BatchResultExpireDuration)*time.Second, func() {
+		batchTasks.Delete(task.response.ID)
+	})
+}
+
+// executeBatchItem 复用现有接口处理逻辑执行单个请求
+func executeBatchItem(batchId string, index int, item model.BatchRequestItem, tenant *config.Tenant, caller string) (result model.BatchResultItem) {
+	result = model.BatchResultItem{
+		ID:       fmt.Sprintf("%s-%d", batchId, index),
+		CustomId: item.CustomId,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Response = nil
+			result.Error = &model.OpenAIError{
+				Message: fmt.Sprintf("%v", r),
+				Type:    "request_error",
+				Code:    "500",
+			}
+		}
+	}()
+
+	// 批任务不支持流式
+	var body map[string]interface{}
+	if err := json.Unmarshal(item.Body, &body); err != nil {
+		result.Error = &model.OpenAIError{
+			Message: "Invalid request body",
+			Type:    "invalid_request_error",
+			Code:    "400",
+		}
+		return result
+	}
+	body["stream"] = false
+	jsonData, _ := json.Marshal(body)
+
+	c, recorder := newBatchItemContext(fmt.Sprintf("%s-%d", batchId, index), item.Url, jsonData, tenant, caller)
+
+	// 降级时由各接口在分发前拒绝生图/生视频请求,结果中记录 503
+	batchHandlers[item.Url](c)
+
+	respBody := recorder.Body.Bytes()
+	if !json.Valid(respBody) {
+		respBody, _ = json.Marshal(string(respBody))
+	}
+	result.Response = &model.BatchResultResponse{
+		StatusCode: recorder.Code,
+		Body:       respBody,
+	}
+	return result
+}
+
+// newBatchItemContext 构造执行批任务单个请求的上下文,带上提交者的租户与会话命名空间
+func newBatchItemContext(requestId string, url string, body []byte, tenant *config.Tenant, caller string) (*gin.Context, *httptest.ResponseRecorder) {
+	ctx := context.WithValue(context.Background(), helper.RequestIdKey, requestId)
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = req
+	c.Set(helper.RequestIdKey, requestId)
+	c.Set(helper.SessionCallerKey, caller)
+	if tenant != nil {
+		c.Set(config.TenantKey, tenant)
+	}
+	return c, recorder
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBatchItemSessionNamespace 批任务的请求按提交者的 API key 隔离自动绑定的会话
+func TestBatchItemSessionNamespace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := config.SessionNamespace
+	config.SessionNamespace = "api_key"
+	defer func() { config.SessionNamespace = original }()
+
+	namespaceOf := func(key string) string {
+		submit, _ := gin.CreateTestContext(httptest.NewRecorder())
+		submit.Request = httptest.NewRequest(http.MethodPost, "/v1/batches", nil)
+		submit.Request.Header.Set("Authorization", "Bearer "+key)
+		c, _ := newBatchItemContext("batch_1-0", "/v1/chat/completions", []byte("{}"), nil, sessionCaller(submit))
+		return sessionNamespace(c)
+	}
+
+	first, second := namespaceOf("sk-first"), namespaceOf("sk-second")
+	if first == second {
+		t.Fatalf("batch items of different keys share namespace %q", first)
+	}
+	if first != namespaceOf("sk-first") {
+		t.Fatalf("batch items of the same key got different namespaces")
+	}
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// countPromptTokens 统计消息中文本内容的 token 数,图片等附件不计入
+func countPromptTokens(messages []model.OpenAIChatMessage, modelName string) int {
+	tokens := 0
+	for _, message := range messages {
+		switch content := message.Content.(type) {
+		case string:
+			tokens += common.CountTokenText(content, modelName)
+		case []interface{}:
+			for _, item := range content {
+				contentMap, ok := item.(map[string]interface{})
+				if !ok || contentMap["type"] != "text" {
+					continue
+				}
+				if text, ok := contentMap["text"].(string); ok {
+					tokens += common.CountTokenText(text, modelName)
+				}
+			}
+		}
+	}
+	return tokens
+}
+
+// getRequestBudget 获取单次请求的最大 prompt tokens 与最大预计费用,租户配置优先于全局配置
+func getRequestBudget(c *gin.Context) (int, float64) {
+	maxPromptTokens, maxRequestCost := config.MaxPromptTokens, config.MaxRequestCost
+	if tenant, ok := getTenant(c); ok {
+		if tenant.MaxPromptTokens > 0 {
+			maxPromptTokens = tenant.MaxPromptTokens
+		}
+		if tenant.MaxRequestCost > 0 {
+			maxRequestCost = tenant.MaxRequestCost
+		}
+	}
+	return maxPromptTokens, maxRequestCost
+}
+
+// checkRequestBudget 请求的 prompt tokens 或按输入估算的费用超过上限时返回 400
+func checkRequestBudget(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) bool {
+	maxPromptTokens, maxRequestCost := getRequestBudget(c)
+	if maxPromptTokens <= 0 && maxRequestCost <= 0 {
+		return true
+	}
+
+	promptTokens := countPromptTokens(openAIReq.Messages, openAIReq.Model)
+	var message, code string
+	if maxPromptTokens > 0 && promptTokens > maxPromptTokens {
+		message = i18n.Message(c, i18n.PromptTokensExceeded, promptTokens, maxPromptTokens)
+		code = "prompt_tokens_exceeded"
+	} else if cost, ok := common.EstimateCost(openAIReq.Model, promptTokens, 0); ok && maxRequestCost > 0 && cost > maxRequestCost {
+		message = i18n.Message(c, i18n.RequestCostExceeded, cost, maxRequestCost)
+		code = "request_cost_exceeded"
+	} else {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Param:   "messages",
+			Code:    code,
+		},
+	})
+	return false
+}
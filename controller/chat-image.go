@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/alert"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/imageintent"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/overload"
+	"genspark2api/model"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"net/http"
+	"strings"
+)
+
+// chatImage 对话中自动生成的图片,在最终答案开头输出一次
+type chatImage struct {
+	markdown string
+	sent     bool
+}
+
+// generateChatImage 请求携带 image_generation 且最后一条 user 消息有画图意图时先调用生图模型,
+// 图片插回对话交给文本模型继续回答;生图失败时按普通对话处理。prompt 未通过检查时已返回错误,返回 false
+func generateChatImage(c *gin.Context, client cycletls.CycleTLS, openAIReq *model.OpenAIChatCompletionRequest) bool {
+	if openAIReq.ImageGeneration == nil {
+		return true
+	}
+	prompt := strings.TrimSpace(openAIReq.GetUserText())
+	if !imageintent.Detect(prompt) {
+		return true
+	}
+	ctx := c.Request.Context()
+	if overload.Degraded() {
+		logger.Warnf(ctx, "skip chat image generation: service overloaded")
+		return true
+	}
+
+	imageModel := openAIReq.ImageGeneration.Model
+	if imageModel == "" {
+		imageModel = config.ChatImageModel
+	}
+	if !isImageModel(imageModel) || lo.Contains(common.ImageEditModelList, imageModel) {
+		logger.Warnf(ctx, "skip chat image generation: invalid image model %s", imageModel)
+		return true
+	}
+	if !checkMediaPrompt(c, imageModel, prompt) {
+		return false
+	}
+
+	// 生图失败时 ImageProcess 可能已写出错误响应,暂存后丢弃,不影响后续对话
+	writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+	c.Writer = writer
+	resp, err := ImageProcess(c, client, model.OpenAIImagesGenerationRequest{
+		Model:       imageModel,
+		Prompt:      prompt,
+		AspectRatio: openAIReq.ImageGeneration.AspectRatio,
+	})
+	c.Writer = writer.ResponseWriter
+	if err != nil {
+		logger.Warnf(ctx, "chat image generation failed: %v", err)
+		alert.RecordImageResult(false, err.Error())
+		return true
+	}
+	alert.RecordImageResult(true, "")
+
+	var urls []string
+	var markdown strings.Builder
+	for _, item := range resp.Data {
+		if item.URL == "" || item.Error != nil {
+			continue
+		}
+		urls = append(urls, item.URL)
+		markdown.WriteString(fmt.Sprintf("![Image](%s)\n\n", item.URL))
+	}
+	if len(urls) == 0 {
+		return true
+	}
+	logger.Infof(ctx, "chat image generated by %s: %d images", imageModel, len(urls))
+	c.Set(helper.ChatImageKey, &chatImage{markdown: markdown.String()})
+	appendToLastUserMessage(openAIReq.Messages, fmt.Sprintf("The image requested above has already been generated by the image model %s "+
+		"and will be shown to the user right before your reply: %s\n"+
+		"Do not say you cannot draw and do not output the image again. Continue the conversation, "+
+		"for example briefly introduce the image and ask whether any adjustment is needed.", imageModel, strings.Join(urls, ", ")))
+	return true
+}
+
+// takeChatImage 返回自动生成的图片,每次请求只返回一次
+func takeChatImage(c *gin.Context) string {
+	value, ok := c.Get(helper.ChatImageKey)
+	if !ok {
+		return ""
+	}
+	image := value.(*chatImage)
+	if image.sent {
+		return ""
+	}
+	image.sent = true
+	return image.markdown
+}
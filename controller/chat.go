@@ -2,20 +2,36 @@ package controller
 
 import (
 	"bufio"
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"genspark2api/common"
+	"genspark2api/common/alert"
 	"genspark2api/common/config"
+	"genspark2api/common/degrade"
+	"genspark2api/common/egress"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"genspark2api/common/imagemeta"
+	"genspark2api/common/linkrewrite"
 	logger "genspark2api/common/loggger"
+	"genspark2api/common/recaptcha"
+	"genspark2api/common/storage"
+	"genspark2api/common/task"
+	"genspark2api/common/tlsclient"
+	"genspark2api/common/uploadcache"
 	"genspark2api/model"
 	"github.com/deanxv/CycleTLS/cycletls"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
 	"io"
-	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,6 +40,11 @@ const (
 	errNoValidCookies = "No valid cookies available"
 )
 
+var (
+	markdownImageRegex = regexp.MustCompile(`!\[[^\]]*\]\((https?://[^\s)]+)\)`)
+	plainImageUrlRegex = regexp.MustCompile(`https?://[^\s)"'<>]+\.(?i:png|jpe?g|gif|webp|bmp)(\?[^\s)"'<>]*)?`)
+)
+
 const (
 	baseURL          = "https://www.genspark.ai"
 	apiEndpoint      = baseURL + "/api/copilot/ask"
@@ -47,65 +68,199 @@ type OpenAIChatCompletionRequest struct {
 
 // ChatForOpenAI 处理OpenAI聊天请求
 func ChatForOpenAI(c *gin.Context) {
-	client := cycletls.Init()
-	defer safeClose(client)
+	client := tlsclient.New()
+	defer client.Release()
 
 	var openAIReq model.OpenAIChatCompletionRequest
 	if err := c.BindJSON(&openAIReq); err != nil {
 		logger.Errorf(c.Request.Context(), err.Error())
 		c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
-				Message: "Invalid request parameters",
+				Message: i18n.Message(c, i18n.InvalidRequest),
 				Type:    "request_error",
 				Code:    "500",
 			},
 		})
 		return
 	}
+	c.Set(helper.ModelKey, openAIReq.Model)
+	if openAIReq.Reasoning != nil && openAIReq.Reasoning.Exclude {
+		c.Set(helper.ReasoningExcludeKey, true)
+	}
+	if openAIReq.NormalizeMarkdown != nil {
+		c.Set(helper.MarkdownNormalizeKey, *openAIReq.NormalizeMarkdown)
+	}
+	if openAIReq.User != "" {
+		c.Set(helper.SessionUserKey, openAIReq.User)
+	}
+
+	// 原始 prompt 透传:整段文本作为单条 user 消息发送,避免二次包裹
+	if openAIReq.RawPrompt != "" {
+		openAIReq.Messages = []model.OpenAIChatMessage{{Role: "user", Content: openAIReq.RawPrompt}}
+		openAIReq.Tools = nil
+		c.Set(helper.RawPromptKey, true)
+	}
+
+	// 工具调用:转为纯文本请求后重新进入本流程
+	if len(openAIReq.Tools) > 0 || hasToolMessages(openAIReq.Messages) {
+		chatWithTools(c, openAIReq)
+		return
+	}
+
+	// 请求级会话保留与元数据
+	if openAIReq.Store != nil {
+		c.Set(helper.StoreKey, *openAIReq.Store)
+	}
+	if len(openAIReq.Metadata) > 0 {
+		c.Set(helper.MetadataKey, openAIReq.Metadata)
+		logger.Infof(c.Request.Context(), "request metadata: %v", openAIReq.Metadata)
+	}
+
+	// 入站内容守卫
+	if !guardMessages(c, &openAIReq) {
+		return
+	}
+
+	// 响应语言约束
+	if openAIReq.Language == "" {
+		openAIReq.Language = config.ForceLanguage
+	}
+	if openAIReq.Language != "" {
+		c.Set(helper.LanguageKey, openAIReq.Language)
+	}
+
+	// prompt 预设
+	if !resolvePreset(c, &openAIReq) {
+		return
+	}
+
+	// 智能模型路由
+	resolveAutoModel(c, &openAIReq)
 
 	// 模型映射
 	if strings.HasPrefix(openAIReq.Model, "deepseek") {
 		openAIReq.Model = strings.Replace(openAIReq.Model, "deepseek", "deep-seek", 1)
 	}
 
+	// 模型名后缀参数(如 nano-banana-pro:16x9:hd)
+	var modelOptions common.ModelOptions
+	openAIReq.Model, modelOptions = common.ParseModelSuffix(openAIReq.Model)
+
+	if strings.HasPrefix(openAIReq.Model, config.AgentModelPrefix) && !isAgentModel(openAIReq.Model) {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.InvalidAgentModel, openAIReq.Model, strings.Join(config.AgentModelList(), ",")),
+				Type:    "invalid_request_error",
+				Param:   "model",
+				Code:    "400",
+			},
+		})
+		return
+	}
+
+	// 账号等级不足时降配模型
+	openAIReq.Model = resolveTierModel(c, openAIReq.Model)
+
+	// 单次请求的 token 与费用上限
+	if !checkRequestBudget(c, &openAIReq) {
+		return
+	}
+
+	// 对话路由的生图/生视频与 /v1/images、/v1/videos 一致,降级时拒绝
+	if (isImageModel(openAIReq.Model) || isVideoModel(openAIReq.Model)) && rejectOverloaded(c) {
+		return
+	}
+
 	// 初始化cookie
 
-	cookieManager := config.NewCookieManager()
+	cookieManager := newCookieManager(c, openAIReq.Model)
 	cookie, err := cookieManager.GetRandomCookie()
 	if err != nil {
 		logger.Errorf(c.Request.Context(), "Failed to get initial cookie: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
+		alertNoValidCookies(c, openAIReq.Model, err.Error())
+		respondCookiesUnavailable(c, openAIReq.Model, errNoValidCookies)
 		return
 	}
 
-	if lo.Contains(common.ImageModelList, openAIReq.Model) {
-		responseId := fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405"))
+	if isImageModel(openAIReq.Model) {
+		responseId := newResponseId()
+		markImageSession(c, openAIReq)
 
-		if len(openAIReq.GetUserContent()) == 0 {
-			logger.Errorf(c.Request.Context(), "user content is null")
-			c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
-				OpenAIError: model.OpenAIError{
-					Message: "Invalid request parameters",
-					Type:    "request_error",
-					Code:    "500",
-				},
-			})
+		imageReq := model.OpenAIImagesGenerationRequest{
+			Model:       openAIReq.Model,
+			AspectRatio: modelOptions.AspectRatio,
+			HD:          modelOptions.HD,
+			Style:       modelOptions.Style,
+		}
+		if lo.Contains(common.ImageEditModelList, openAIReq.Model) {
+			// 编辑类模型从消息中获取原图,prompt 可选
+			imageReq.Prompt = openAIReq.GetUserText()
+			imageReq.Image = openAIReq.GetUserImageUrl()
+			if err := validateImageEditRequest(imageReq); err != nil {
+				logger.Errorf(c.Request.Context(), err.Error())
+				c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+					OpenAIError: model.OpenAIError{
+						Message: err.Error(),
+						Type:    "invalid_request_error",
+						Param:   "image",
+						Code:    "400",
+					},
+				})
+				return
+			}
+		} else {
+			if len(openAIReq.GetUserContent()) == 0 {
+				logger.Errorf(c.Request.Context(), "user content is null")
+				c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
+					OpenAIError: model.OpenAIError{
+						Message: i18n.Message(c, i18n.InvalidRequest),
+						Type:    "request_error",
+						Code:    "500",
+					},
+				})
+				return
+			}
+			imageReq.Prompt = openAIReq.GetUserContent()[0]
+		}
+
+		if !checkMediaPrompt(c, imageReq.Model, imageReq.Prompt) {
 			return
 		}
 
-		jsonData, err := json.Marshal(openAIReq.GetUserContent()[0])
+		jsonData, err := json.Marshal(imageReq.Prompt)
 		if err != nil {
 			logger.Errorf(c.Request.Context(), err.Error())
-			c.JSON(500, gin.H{"error": "Failed to marshal request body"})
+			c.JSON(500, errorBody(c, "Failed to marshal request body"))
 			return
 		}
-		resp, err := ImageProcess(c, client, model.OpenAIImagesGenerationRequest{
-			Model:  openAIReq.Model,
-			Prompt: openAIReq.GetUserContent()[0],
-		})
+		if openAIReq.Stream {
+			// 排队状态变化时以 image_queue 字段下发进度
+			c.Set(helper.ImageQueueReporterKey, imageQueueReporter(func(queue model.ImageQueue) {
+				c.Header("X-Upstream-Model", openAIReq.Model)
+				chunk := createStreamResponse(responseId, openAIReq.Model, jsonData, model.OpenAIDelta{Role: "assistant"}, nil)
+				chunk.ImageQueue = &queue
+				if err := writeSSEvent(c, chunk); err != nil {
+					logger.Warnf(c.Request.Context(), "send image queue status err: %v", err)
+				}
+			}))
+		}
+		resp, err := ImageProcess(c, client.CycleTLS, imageReq)
 
 		if err != nil {
 			logger.Errorf(c.Request.Context(), err.Error())
+			// 取消的任务不计入生图失败
+			if !errors.Is(err, errGenerationCancelled) {
+				alert.RecordImageResult(false, err.Error())
+			}
+			if openAIReq.Stream && c.Writer.Written() {
+				// 已下发排队进度,以错误文本结束流
+				_ = writeSSEvent(c, createStreamResponse(responseId, openAIReq.Model, jsonData, model.OpenAIDelta{Content: imageErrorMessage(c, err), Role: "assistant"}, nil))
+				c.SSEvent("", " [DONE]")
+				return
+			}
+			if respondGenerationCancelled(c, err) || respondImageQueueError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
 				OpenAIError: model.OpenAIError{
 					Message: err.Error(),
@@ -115,13 +270,18 @@ func ChatForOpenAI(c *gin.Context) {
 			})
 			return
 		} else {
+			alert.RecordImageResult(true, "")
 			data := resp.Data
 			var content []string
 			for _, item := range data {
+				if item.Error != nil {
+					continue
+				}
 				content = append(content, fmt.Sprintf("![Image](%s)", item.URL))
 			}
 
 			if openAIReq.Stream {
+				c.Header("X-Upstream-Model", openAIReq.Model)
 				streamResp := createStreamResponse(responseId, openAIReq.Model, jsonData, model.OpenAIDelta{Content: strings.Join(content, "\n"), Role: "assistant"}, nil)
 				err := sendSSEvent(c, streamResp)
 				if err != nil {
@@ -140,47 +300,34 @@ func ChatForOpenAI(c *gin.Context) {
 			} else {
 
 				jsonBytes, _ := json.Marshal(openAIReq.Messages)
-				promptTokens := common.CountTokenText(string(jsonBytes), openAIReq.Model)
-				completionTokens := common.CountTokenText(strings.Join(content, "\n"), openAIReq.Model)
-
-				finishReason := "stop"
-				// 创建并返回 OpenAIChatCompletionResponse 结构
-				resp := model.OpenAIChatCompletionResponse{
-					ID:      fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
-					Object:  "chat.completion",
-					Created: time.Now().Unix(),
-					Model:   openAIReq.Model,
-					Choices: []model.OpenAIChoice{
-						{
-							Message: model.OpenAIMessage{
-								Role:    "assistant",
-								Content: strings.Join(content, "\n"),
-							},
-							FinishReason: &finishReason,
-						},
-					},
-					Usage: model.OpenAIUsage{
-						PromptTokens:     promptTokens,
-						CompletionTokens: completionTokens,
-						TotalTokens:      promptTokens + completionTokens,
-					},
-				}
-				c.JSON(200, resp)
+				usage := buildTextUsage(openAIReq.Model, string(jsonBytes), strings.Join(content, "\n"))
+				setUsageHeaders(c, openAIReq.Model, openAIReq.Model, usage)
+				c.JSON(200, buildChatCompletion(newResponseId(), openAIReq.Model, strings.Join(content, "\n"), "stop", usage))
 				return
 			}
 
 		}
 	}
 
+	if isVideoModel(openAIReq.Model) {
+		videoChatForOpenAI(c, client, openAIReq, modelOptions)
+		return
+	}
+
+	// 对话中自动生图,图片插回对话后继续回答
+	if !generateChatImage(c, client.CycleTLS, &openAIReq) {
+		return
+	}
+
 	var isSearchModel bool
 	if strings.HasSuffix(openAIReq.Model, "-search") {
 		isSearchModel = true
 	}
 
-	requestBody, err := createRequestBody(c, client, cookie, &openAIReq)
+	requestBody, err := createRequestBody(c, client.CycleTLS, cookie, &openAIReq)
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.JSON(500, errorBody(c, err.Error()))
 		return
 	}
 
@@ -191,9 +338,9 @@ func ChatForOpenAI(c *gin.Context) {
 	//}
 
 	if openAIReq.Stream {
-		handleStreamRequest(c, client, cookie, cookieManager, requestBody, openAIReq.Model, isSearchModel)
+		handleStreamRequest(c, client.CycleTLS, cookie, cookieManager, requestBody, openAIReq.Model, isSearchModel)
 	} else {
-		handleNonStreamRequest(c, client, cookie, cookieManager, requestBody, openAIReq.Model, isSearchModel)
+		handleNonStreamRequest(c, client.CycleTLS, cookie, cookieManager, requestBody, openAIReq.Model, isSearchModel)
 	}
 
 }
@@ -202,13 +349,51 @@ func processMessages(c *gin.Context, client cycletls.CycleTLS, cookie string, me
 	//client := cycletls.Init()
 	//defer client.Close()
 
+	lastUserIndex := -1
+	for i, message := range messages {
+		if message.Role == "user" {
+			lastUserIndex = i
+		}
+	}
+
 	for i, message := range messages {
+		// 用户消息正文中的 markdown 图片/图片链接按 image_url 处理
+		if message.Role == "user" {
+			messages[i].Content = convertTextImages(message.Content)
+			content, err := convertLongText(c, client, cookie, messages[i].Content)
+			if err != nil {
+				logger.Errorf(c.Request.Context(), fmt.Sprintf("convertLongText err  %v\n", err))
+				return fmt.Errorf("convertLongText err: %v", err)
+			}
+			messages[i].Content = content
+			message = messages[i]
+		}
 		if contentArray, ok := message.Content.([]interface{}); ok {
 			for j, content := range contentArray {
 				if contentMap, ok := content.(map[string]interface{}); ok {
-					if contentType, ok := contentMap["type"].(string); ok && contentType == "image_url" {
+					if contentType, ok := contentMap["type"].(string); ok && (contentType == "video_url" || contentType == "audio_url") {
+						// 视频/音频附件
+						if mediaMap, ok := contentMap[contentType].(map[string]interface{}); ok {
+							if url, ok := mediaMap["url"].(string); ok {
+								privateFile, err := processMediaUrl(c, client, cookie, url, strings.TrimSuffix(contentType, "_url"))
+								if err != nil {
+									logger.Errorf(c.Request.Context(), fmt.Sprintf("processMediaUrl err  %v\n", err))
+									return fmt.Errorf("processMediaUrl err: %v", err)
+								}
+								contentArray[j] = privateFile
+							}
+						}
+					} else if contentType, ok := contentMap["type"].(string); ok && contentType == "image_url" {
 						if imageMap, ok := contentMap["image_url"].(map[string]interface{}); ok {
-							if url, ok := imageMap["url"].(string); ok {
+							if url, ok := imageMap["url"].(string); ok && i < lastUserIndex && config.HistoryImageReuse == 1 {
+								// 历史消息中的图片上传为文件,已上传过的直接复用
+								privateFile, err := processHistoryImage(c, client, cookie, url)
+								if err != nil {
+									logger.Errorf(c.Request.Context(), fmt.Sprintf("processHistoryImage err  %v\n", err))
+									return fmt.Errorf("processHistoryImage err: %v", err)
+								}
+								contentArray[j] = privateFile
+							} else if ok {
 								err := processUrl(c, client, cookie, url, imageMap, j, contentArray)
 								if err != nil {
 									logger.Errorf(c.Request.Context(), fmt.Sprintf("processUrl err  %v\n", err))
@@ -224,141 +409,265 @@ func processMessages(c *gin.Context, client cycletls.CycleTLS, cookie string, me
 	}
 	return nil
 }
-func processUrl(c *gin.Context, client cycletls.CycleTLS, cookie string, url string, imageMap map[string]interface{}, index int, contentArray []interface{}) error {
-	// 判断是否为URL
-	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-		// 下载文件
-		bytes, err := fetchImageBytes(url)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("fetchImageBytes err  %v\n", err))
-			return fmt.Errorf("fetchImageBytes err  %v\n", err)
-		}
 
-		err = processBytes(c, client, cookie, bytes, imageMap, index, contentArray)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("processBytes err  %v\n", err))
-			return fmt.Errorf("processBytes err  %v\n", err)
+// convertTextImages 将文本中的图片提取为 image_url 内容,没有图片时原样返回
+func convertTextImages(content interface{}) interface{} {
+	switch v := content.(type) {
+	case string:
+		text, images := extractTextImages(v)
+		if len(images) == 0 {
+			return content
 		}
-	} else {
-		// 尝试解析base64
-		var bytes []byte
-		var err error
-
-		// 处理可能包含 data:image/ 前缀的base64
-		base64Str := url
-		if strings.Contains(url, ";base64,") {
-			base64Str = strings.Split(url, ";base64,")[1]
+		return append([]interface{}{map[string]interface{}{"type": "text", "text": text}}, images...)
+	case []interface{}:
+		var images []interface{}
+		for _, item := range v {
+			if contentMap, ok := item.(map[string]interface{}); ok && contentMap["type"] == "text" {
+				if text, ok := contentMap["text"].(string); ok {
+					var textImages []interface{}
+					contentMap["text"], textImages = extractTextImages(text)
+					images = append(images, textImages...)
+				}
+			}
 		}
+		return append(v, images...)
+	}
+	return content
+}
 
-		bytes, err = base64.StdEncoding.DecodeString(base64Str)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("base64.StdEncoding.DecodeString err  %v\n", err))
-			return fmt.Errorf("base64.StdEncoding.DecodeString err: %v\n", err)
+// extractTextImages 提取 markdown 图片(从正文中移除)与纯图片链接(保留在正文中)
+func extractTextImages(text string) (string, []interface{}) {
+	var images []interface{}
+	seen := make(map[string]bool)
+	addImage := func(url string) {
+		if seen[url] {
+			return
 		}
+		seen[url] = true
+		images = append(images, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": url},
+		})
+	}
+
+	text = markdownImageRegex.ReplaceAllStringFunc(text, func(match string) string {
+		addImage(markdownImageRegex.FindStringSubmatch(match)[1])
+		return ""
+	})
+	for _, url := range plainImageUrlRegex.FindAllString(text, -1) {
+		addImage(url)
+	}
+	return strings.TrimSpace(text), images
+}
 
-		err = processBytes(c, client, cookie, bytes, imageMap, index, contentArray)
+func processUrl(c *gin.Context, client cycletls.CycleTLS, cookie string, url string, imageMap map[string]interface{}, index int, contentArray []interface{}) error {
+	maxSize := int64(config.FileMaxSize) * 1024 * 1024
+
+	var reader io.Reader
+	// 判断是否为URL
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		// 下载文件
+		body, err := openLimitedUrl(url, maxSize)
 		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("processBytes err  %v\n", err))
-			return fmt.Errorf("processBytes err: %v\n", err)
+			logger.Errorf(c.Request.Context(), fmt.Sprintf("openLimitedUrl err  %v\n", err))
+			return fmt.Errorf("openLimitedUrl err  %v\n", err)
 		}
+		defer body.Close()
+		reader = body
+	} else {
+		// 解析base64(可能包含 data:image/ 前缀)
+		reader = openLimitedBase64(url, maxSize)
+	}
+
+	err := processReader(c, client, cookie, reader, imageMap, index, contentArray)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), fmt.Sprintf("processReader err  %v\n", err))
+		return fmt.Errorf("processReader err: %v\n", err)
 	}
 	return nil
 }
 
-func processBytes(c *gin.Context, client cycletls.CycleTLS, cookie string, bytes []byte, imageMap map[string]interface{}, index int, contentArray []interface{}) error {
+func processReader(c *gin.Context, client cycletls.CycleTLS, cookie string, reader io.Reader, imageMap map[string]interface{}, index int, contentArray []interface{}) error {
 	// 检查是否为图片类型
-	contentType := http.DetectContentType(bytes)
+	contentType, reader, err := sniffContentType(reader)
+	if err != nil {
+		return err
+	}
 	if strings.HasPrefix(contentType, "image/") {
 		// 是图片类型，转换为base64
-		base64Data := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(bytes)
+		base64Data, err := encodeBase64(reader, "image/jpeg")
+		if err != nil {
+			return err
+		}
 		imageMap["url"] = base64Data
 	} else {
-		response, err := makeGetUploadUrlRequest(client, cookie)
+		privateFile, err := uploadPrivateFile(c, client, cookie, reader, "file", contentType, strings.Split(contentType, "/")[1])
 		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("makeGetUploadUrlRequest err  %v\n", err))
-			return fmt.Errorf("makeGetUploadUrlRequest err: %v\n", err)
-		}
-
-		var jsonResponse map[string]interface{}
-		if err := json.Unmarshal([]byte(response.Body), &jsonResponse); err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("Unmarshal err  %v\n", err))
-			return fmt.Errorf("Unmarshal err: %v\n", err)
+			return err
 		}
 
-		uploadImageUrl, ok := jsonResponse["data"].(map[string]interface{})["upload_image_url"].(string)
-		privateStorageUrl, ok := jsonResponse["data"].(map[string]interface{})["private_storage_url"].(string)
+		// 替换数组中的元素
+		contentArray[index] = privateFile
+	}
+	return nil
+}
 
-		if !ok {
-			//fmt.Println("Failed to extract upload_image_url")
-			return fmt.Errorf("Failed to extract upload_image_url")
+// uploadPrivateFile 上传文件并返回 private_file 格式的内容,超过分片大小时按块流式读取并分片上传
+// 不超过一个分片的文件按内容 hash 缓存,同一 cookie 下相同的文件直接复用已上传的 private_storage_url
+func uploadPrivateFile(c *gin.Context, client cycletls.CycleTLS, cookie string, reader io.Reader, name string, contentType string, ext string) (map[string]interface{}, error) {
+	// 读满首块时说明文件超过分片大小,按块流式上传;否则整个文件已在内存中
+	var fileBytes []byte
+	var chunked bool
+	chunkSize := config.UploadChunkSize * 1024 * 1024
+	if chunkSize > 0 {
+		chunk := make([]byte, chunkSize)
+		n, readErr := io.ReadFull(reader, chunk)
+		switch {
+		case readErr == nil:
+			fileBytes, chunked = chunk, true
+		case readErr == io.EOF || readErr == io.ErrUnexpectedEOF:
+			fileBytes = chunk[:n]
+		default:
+			return nil, readErr
 		}
+	} else {
+		var err error
+		if fileBytes, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
 
-		// 发送OPTIONS预检请求
-		//_, err = makeOptionsRequest(client, uploadImageUrl)
-		//if err != nil {
-		//	return
-		//}
-		// 上传文件
-		_, err = makeUploadRequest(client, uploadImageUrl, bytes)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("makeUploadRequest err  %v\n", err))
-			return fmt.Errorf("makeUploadRequest err: %v\n", err)
-		}
-		//fmt.Println(resp)
-
-		// 创建新的 private_file 格式的内容
-		privateFile := map[string]interface{}{
-			"type": "private_file",
-			"private_file": map[string]interface{}{
-				"name":                "file", // 你可能需要从原始文件名或其他地方获取
-				"type":                contentType,
-				"size":                len(bytes),
-				"ext":                 strings.Split(contentType, "/")[1], // 简单处理，可能需要更复杂的逻辑
-				"private_storage_url": privateStorageUrl,
-			},
+	var cacheKey string
+	if !chunked {
+		cacheKey = uploadcache.ContentKey(cookie, fileBytes)
+		if privateFile, ok := uploadcache.Get(cacheKey); ok {
+			logger.Debugf(c.Request.Context(), "upload cache hit: %s", name)
+			if file, ok := privateFile["private_file"].(map[string]interface{}); ok {
+				file["name"] = name
+			}
+			return privateFile, nil
 		}
+	}
 
-		// 替换数组中的元素
-		contentArray[index] = privateFile
+	response, err := makeGetUploadUrlRequest(client, cookie)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), fmt.Sprintf("makeGetUploadUrlRequest err  %v\n", err))
+		return nil, fmt.Errorf("makeGetUploadUrlRequest err: %v\n", err)
 	}
-	return nil
+
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal([]byte(response.Body), &jsonResponse); err != nil {
+		logger.Errorf(c.Request.Context(), fmt.Sprintf("Unmarshal err  %v\n", err))
+		return nil, fmt.Errorf("Unmarshal err: %v\n", err)
+	}
+
+	data, _ := jsonResponse["data"].(map[string]interface{})
+	uploadImageUrl, _ := data["upload_image_url"].(string)
+	privateStorageUrl, ok := data["private_storage_url"].(string)
+	if !ok || uploadImageUrl == "" {
+		return nil, fmt.Errorf("Failed to extract upload_image_url")
+	}
+
+	// 上传文件
+	size := int64(len(fileBytes))
+	if chunked {
+		size, err = makeChunkedUploadRequest(client, uploadImageUrl, reader, fileBytes)
+	} else {
+		_, err = makeUploadRequest(client, uploadImageUrl, fileBytes)
+	}
+	if err != nil {
+		logger.Errorf(c.Request.Context(), fmt.Sprintf("makeUploadRequest err  %v\n", err))
+		return nil, fmt.Errorf("makeUploadRequest err: %v\n", err)
+	}
+
+	// 创建新的 private_file 格式的内容
+	privateFile := map[string]interface{}{
+		"type": "private_file",
+		"private_file": map[string]interface{}{
+			"name":                name,
+			"type":                contentType,
+			"size":                size,
+			"ext":                 ext,
+			"private_storage_url": privateStorageUrl,
+		},
+	}
+	if cacheKey != "" {
+		uploadcache.Put(cacheKey, privateFile)
+	}
+	return privateFile, nil
 }
 
-// 获取文件字节数组的函数
-func fetchImageBytes(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+// fetchImageBase64 下载图片并流式编码为 base64 data URI,非图片时返回空字符串
+func fetchImageBase64(url string) (string, error) {
+	body, err := openLimitedUrl(url, int64(config.FileMaxSize)*1024*1024)
 	if err != nil {
-		return nil, fmt.Errorf("http.Get err: %v\n", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	return ioutil.ReadAll(resp.Body)
+	contentType, reader, err := sniffContentType(body)
+	if err != nil || !strings.HasPrefix(contentType, "image/") {
+		return "", err
+	}
+	return encodeBase64(reader, "image/jpeg")
 }
 
 func createRequestBody(c *gin.Context, client cycletls.CycleTLS, cookie string, openAIReq *model.OpenAIChatCompletionRequest) (map[string]interface{}, error) {
-	openAIReq.SystemMessagesProcess(openAIReq.Model)
-	if config.PRE_MESSAGES_JSON != "" {
-		err := openAIReq.PrependMessagesFromJSON(config.PRE_MESSAGES_JSON)
-		if err != nil {
-			return nil, fmt.Errorf("PrependMessagesFromJSON err: %v PrependMessagesFromJSON:", err, config.PRE_MESSAGES_JSON)
+	// 原始 prompt 透传时跳过系统消息处理、前置消息、裁剪、附件上传与语言约束
+	rawPrompt := c.GetBool(helper.RawPromptKey)
+	if !rawPrompt {
+		// 预算仅作用于客户端发送的系统消息,不含按模型注入的 prompt 与预设
+		limitSystemMessages(c, openAIReq)
+		openAIReq.SystemMessagesProcess(openAIReq.Model)
+		if openAIReq.Preset != "" {
+			// 命名预设优先于全局 PRE_MESSAGES_JSON
+			if preset, ok := config.GlobalPresetManager.Get(openAIReq.Preset); ok {
+				if err := openAIReq.PrependMessagesFromJSON(string(preset.Messages)); err != nil {
+					return nil, fmt.Errorf("PrependMessagesFromJSON err: %v preset: %s", err, preset.Name)
+				}
+			}
+		} else if config.PRE_MESSAGES_JSON != "" {
+			err := openAIReq.PrependMessagesFromJSON(config.PRE_MESSAGES_JSON)
+			if err != nil {
+				return nil, fmt.Errorf("PrependMessagesFromJSON err: %v PrependMessagesFromJSON: %s", err, config.PRE_MESSAGES_JSON)
+			}
 		}
 	}
 
-	// 处理消息中的图像 URL
-	err := processMessages(c, client, cookie, openAIReq.Messages)
-	if err != nil {
-		logger.Errorf(c.Request.Context(), "processMessages err: %v", err)
-		return nil, fmt.Errorf("processMessages err: %v", err)
-	}
-
 	currentQueryString := fmt.Sprintf("type=%s", chatType)
 	//查找 key 对应的 value
-	if chatId, ok := config.ModelChatMap[openAIReq.Model]; ok {
+	trimmed := 0
+	if !sessionReusable(c) {
+		// 会话(threads)运行携带已按 THREAD_MAX_MESSAGES 裁剪的完整历史,store:false 的请求结束后会删除对话,
+		// 均不复用已绑定的会话也不再裁剪
+	} else if chatId, ok := getModelChatMap(c)[openAIReq.Model]; ok {
 		currentQueryString = fmt.Sprintf("id=%s&type=%s", chatId, chatType)
-	} else if chatId, ok := config.GlobalSessionManager.GetChatID(cookie, openAIReq.Model); ok {
+	} else if chatId, ok := config.GlobalSessionManager.GetChatID(sessionNamespace(c), cookie, openAIReq.Model); ok {
 		currentQueryString = fmt.Sprintf("id=%s&type=%s", chatId, chatType)
-	} else {
-		openAIReq.FilterUserMessage()
+	} else if !rawPrompt && !c.GetBool(helper.ToolHistoryKey) {
+		// 工具循环的后续轮次携带完整历史,否则模型看不到原始问题与之前的调用。
+		// 先裁剪再处理图片/附件,避免为不会发送的历史消息下载、编码或上传文件
+		trimmed = len(openAIReq.Messages)
+		// 配置了系统消息预算时保留客户端的系统消息,预算才对新会话生效
+		openAIReq.FilterUserMessage(config.SystemMessageMaxCount > 0 || config.SystemMessageMaxLength > 0)
+		trimmed -= len(openAIReq.Messages)
+	}
+
+	// 按模型注入的 system prompt 在裁剪之后加入,避免新会话与未绑定会话中被裁剪掉
+	if prompt := config.GetModelSystemPrompt(openAIReq.Model); prompt != "" && !rawPrompt {
+		openAIReq.AddMessage(model.OpenAIChatMessage{Role: "system", Content: prompt})
+		openAIReq.SystemMessagesProcess(openAIReq.Model)
+	}
+
+	// 处理消息中的图像 URL
+	if !rawPrompt {
+		if err := processMessages(c, client, cookie, openAIReq.Messages); err != nil {
+			logger.Errorf(c.Request.Context(), "processMessages err: %v", err)
+			return nil, fmt.Errorf("processMessages err: %v", err)
+		}
+	}
+	if openAIReq.Language != "" && !rawPrompt {
+		openAIReq.AddLanguageConstraint(common.GetLanguageConstraint(openAIReq.Language))
 	}
 	requestWebKnowledge := false
 	models := []string{openAIReq.Model}
@@ -367,13 +676,21 @@ func createRequestBody(c *gin.Context, client cycletls.CycleTLS, cookie string,
 		requestWebKnowledge = true
 		models = []string{openAIReq.Model}
 	}
-	if !lo.Contains(common.TextModelList, openAIReq.Model) {
+	if !isTextModel(openAIReq.Model) {
 		models = common.MixtureModelList
 	}
 
+	// agent 模型按对应的 agent 类型请求上游
+	requestBodyType := chatType
+	if agentType, ok := config.GetAgentType(openAIReq.Model); ok {
+		requestBodyType = agentType
+		currentQueryString = strings.Replace(currentQueryString, "type="+chatType, "type="+agentType, 1)
+		models = []string{}
+	}
+
 	// 创建请求体
 	requestBody := map[string]interface{}{
-		"type":                 chatType,
+		"type":                 requestBodyType,
 		"current_query_string": currentQueryString,
 		"messages":             openAIReq.Messages,
 		"action_params":        map[string]interface{}{},
@@ -385,26 +702,46 @@ func createRequestBody(c *gin.Context, client cycletls.CycleTLS, cookie string,
 		},
 	}
 
+	// 请求不需要思考过程时尽量让上游也不输出
+	if c.GetBool(helper.ReasoningExcludeKey) {
+		extraData := requestBody["extra_data"].(map[string]interface{})
+		for key, value := range config.ReasoningExcludeExtraData {
+			extraData[key] = value
+		}
+	}
+
 	logger.Debug(c.Request.Context(), fmt.Sprintf("RequestBody: %v", requestBody))
+	recordRequestSize(c, requestBody, trimmed)
 
 	return requestBody, nil
 }
 
+// openAIImageStyles OpenAI 图片接口的 style 取值,不转发给上游
+var openAIImageStyles = []string{"vivid", "natural"}
+
 func createImageRequestBody(c *gin.Context, cookie string, openAIReq *model.OpenAIImagesGenerationRequest, chatId string) (map[string]interface{}, error) {
 
 	if openAIReq.Model == "dall-e-3" {
 		openAIReq.Model = "dalle-3"
 	}
+	aspectRatio, style := "auto", "auto"
+	if openAIReq.AspectRatio != "" {
+		aspectRatio = openAIReq.AspectRatio
+	}
+	// OpenAI 的 style 取值(vivid/natural)只是 DALL·E 3 的色彩倾向,上游没有对应的风格,按 auto 处理
+	if openAIReq.Style != "" && !lo.Contains(openAIImageStyles, strings.ToLower(openAIReq.Style)) {
+		style = openAIReq.Style
+	}
 	// 创建模型配置
 	modelConfigs := []map[string]interface{}{
 		{
 			"model":                   openAIReq.Model,
-			"aspect_ratio":            "auto",
+			"aspect_ratio":            aspectRatio,
 			"use_personalized_models": false,
 			"fashion_profile_id":      nil,
-			"hd":                      false,
+			"hd":                      openAIReq.HD,
 			"reflection_enabled":      false,
-			"style":                   "auto",
+			"style":                   style,
 		},
 	}
 
@@ -415,17 +752,12 @@ func createImageRequestBody(c *gin.Context, cookie string, openAIReq *model.Open
 		var base64Data string
 
 		if strings.HasPrefix(openAIReq.Image, "http://") || strings.HasPrefix(openAIReq.Image, "https://") {
-			// 下载文件
-			bytes, err := fetchImageBytes(openAIReq.Image)
+			// 下载文件,是图片类型时转换为base64
+			var err error
+			base64Data, err = fetchImageBase64(openAIReq.Image)
 			if err != nil {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("fetchImageBytes err  %v\n", err))
-				return nil, fmt.Errorf("fetchImageBytes err  %v\n", err)
-			}
-
-			contentType := http.DetectContentType(bytes)
-			if strings.HasPrefix(contentType, "image/") {
-				// 是图片类型，转换为base64
-				base64Data = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(bytes)
+				logger.Errorf(c.Request.Context(), fmt.Sprintf("fetchImageBase64 err  %v\n", err))
+				return nil, fmt.Errorf("fetchImageBase64 err  %v\n", err)
 			}
 		} else if common.IsImageBase64(openAIReq.Image) {
 			// 如果已经是 base64 格式
@@ -458,6 +790,11 @@ func createImageRequestBody(c *gin.Context, cookie string, openAIReq *model.Open
 		}
 	}
 
+	// 编辑类模型必须成功解析出原图
+	if len(messages) == 0 && lo.Contains(common.ImageEditModelList, openAIReq.Model) {
+		return nil, fmt.Errorf("model %s requires a valid image, the image is neither a reachable image url nor image base64", openAIReq.Model)
+	}
+
 	// 如果没有图片或处理图片失败，使用纯文本消息
 	if len(messages) == 0 {
 		messages = []map[string]interface{}{
@@ -492,134 +829,88 @@ func createImageRequestBody(c *gin.Context, cookie string, openAIReq *model.Open
 
 	logger.Debug(c.Request.Context(), fmt.Sprintf("RequestBody: %v", requestBody))
 
-	if strings.TrimSpace(config.RecaptchaProxyUrl) == "" ||
-		(!strings.HasPrefix(config.RecaptchaProxyUrl, "http://") &&
-			!strings.HasPrefix(config.RecaptchaProxyUrl, "https://")) {
-		return requestBody, nil
-	} else {
-
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client := &http.Client{Transport: tr}
-
-		// 检查并补充 RecaptchaProxyUrl 的末尾斜杠
-		if !strings.HasSuffix(config.RecaptchaProxyUrl, "/") {
-			config.RecaptchaProxyUrl += "/"
-		}
+	return cheat(requestBody, c, cookie)
+}
 
-		// 创建请求
-		req, err := http.NewRequest("GET", fmt.Sprintf("%sgenspark", config.RecaptchaProxyUrl), nil)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("创建/genspark请求失败   %v\n", err))
-			return nil, err
-		}
+// createStreamResponse 创建流式响应
+func createStreamResponse(responseId, modelName string, jsonData []byte, delta model.OpenAIDelta, finishReason *string) model.OpenAIChatCompletionResponse {
+	return buildChatCompletionChunk(responseId, modelName, delta, finishReason, buildTextUsage(modelName, string(jsonData), delta.Content))
+}
 
-		// 设置请求头
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Cookie", cookie)
+// handleMessageFieldDelta 处理消息字段增量
+func handleMessageFieldDelta(c *gin.Context, event map[string]interface{}, responseId, modelName string, jsonData []byte, searchModel bool) error {
+	fieldName, ok := event["field_name"].(string)
+	if !ok {
+		return nil
+	}
 
-		// 发送请求
-		resp, err := client.Do(req)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("发送/genspark请求失败   %v\n", err))
-			return nil, err
-		}
-		defer resp.Body.Close()
+	field := config.ResolveField(fieldName)
 
-		// 读取响应体
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark响应失败   %v\n", err))
-			return nil, err
-		}
+	// 获取 delta 内容
+	var delta string
+	switch {
+	case (modelName == "o1" || modelName == "o3-mini-high") && field == config.FieldAnswer:
+		delta, _ = event["field_value"].(string)
+	default:
+		delta, _ = event["delta"].(string)
+	}
+	// 影子解析以线上实际解析出的增量作为对照
+	getShadowSession(c).RecordField(field, delta)
 
-		type Response struct {
-			Code    int    `json:"code"`
-			Token   string `json:"token"`
-			Message string `json:"message"`
+	// 多模型混合的中间答案单独收集,按 MIXTURE_LAYER_OUTPUT 输出
+	if field == config.FieldLayer {
+		eventType, _ := event["type"].(string)
+		value, _ := event["delta"].(string)
+		if eventType == "message_field" {
+			value, _ = event["field_value"].(string)
 		}
+		collectMixtureLayer(c, eventType, fieldName, value)
+		return nil
+	}
 
-		if resp.StatusCode == 200 {
-			var response Response
-			if err := json.Unmarshal(body, &response); err != nil {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark JSON 失败   %v\n", err))
-				return nil, err
-			}
-
-			if response.Code == 200 {
-				logger.Debugf(c.Request.Context(), fmt.Sprintf("g_recaptcha_token: %v\n", response.Token))
-				requestBody["g_recaptcha_token"] = response.Token
-				logger.Infof(c.Request.Context(), fmt.Sprintf("cheat success!"))
-				return requestBody, nil
-			} else {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark token 失败   %v\n", err))
-				return nil, err
-			}
-		} else {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("请求/genspark失败   %v\n", err))
-			return nil, err
+	// 联网搜索的来源列表在答案末尾统一输出
+	if field == config.FieldSources {
+		if searchModel {
+			collectSearchSources(c, event["field_value"])
 		}
+		return nil
 	}
-}
-
-// createStreamResponse 创建流式响应
-func createStreamResponse(responseId, modelName string, jsonData []byte, delta model.OpenAIDelta, finishReason *string) model.OpenAIChatCompletionResponse {
-	promptTokens := common.CountTokenText(string(jsonData), modelName)
-	completionTokens := common.CountTokenText(delta.Content, modelName)
-	return model.OpenAIChatCompletionResponse{
-		ID:      responseId,
-		Object:  "chat.completion.chunk",
-		Created: time.Now().Unix(),
-		Model:   modelName,
-		Choices: []model.OpenAIChoice{
-			{
-				Index:        0,
-				Delta:        delta,
-				FinishReason: finishReason,
-			},
-		},
-		Usage: model.OpenAIUsage{
-			PromptTokens:     promptTokens,
-			CompletionTokens: completionTokens,
-			TotalTokens:      promptTokens + completionTokens,
-		},
+	// 后续问题建议随最后一个数据块的 suggestions 字段统一输出
+	if field == config.FieldSuggestions {
+		collectSuggestions(c, event["field_value"])
+		return nil
 	}
-}
-
-// handleMessageFieldDelta 处理消息字段增量
-func handleMessageFieldDelta(c *gin.Context, event map[string]interface{}, responseId, modelName string, jsonData []byte) error {
-	fieldName, ok := event["field_name"].(string)
-	if !ok {
+	if searchModel && skipSearchField(c, field) {
+		return nil
+	}
+	// 思维导图按 MARKMAP_OUTPUT 在答案末尾统一输出,text 模式按普通文本下发
+	if field == config.FieldMarkmap && markmapCollected() {
+		eventType, _ := event["type"].(string)
+		value, _ := event["delta"].(string)
+		if eventType == "message_field" {
+			value, _ = event["field_value"].(string)
+		}
+		collectMarkmap(c, eventType, value)
 		return nil
 	}
 
 	// 基础允许列表（所有配置下都需要处理的字段）
-	baseAllowed := fieldName == "session_state.answer" ||
-		strings.Contains(fieldName, "session_state.streaming_detail_answer") ||
-		fieldName == "session_state.streaming_markmap"
+	baseAllowed := field == config.FieldAnswer ||
+		field == config.FieldDetailAnswer ||
+		field == config.FieldMarkmap
 
 	// 需要显示思考过程时需要额外处理的字段
-	if config.ReasoningHide != 1 {
+	if reasoningEnabled(c) {
 		baseAllowed = baseAllowed ||
-			fieldName == "session_state.answerthink_is_started" ||
-			fieldName == "session_state.answerthink" ||
-			fieldName == "session_state.answerthink_is_finished"
+			field == config.FieldThinkStart ||
+			field == config.FieldThink ||
+			field == config.FieldThinkEnd
 	}
 
 	if !baseAllowed {
 		return nil
 	}
 
-	// 获取 delta 内容
-	var delta string
-	switch {
-	case (modelName == "o1" || modelName == "o3-mini-high") && fieldName == "session_state.answer":
-		delta, _ = event["field_value"].(string)
-	default:
-		delta, _ = event["delta"].(string)
-	}
-
 	// 创建基础响应
 	createResponse := func(content string) model.OpenAIChatCompletionResponse {
 		return createStreamResponse(
@@ -631,6 +922,30 @@ func handleMessageFieldDelta(c *gin.Context, event map[string]interface{}, respo
 		)
 	}
 
+	// 最终答案开始前输出 markdown 格式的中间答案
+	if field == config.FieldAnswer || field == config.FieldDetailAnswer {
+		delta = takeChatImage(c) + takeMixtureMarkdown(c) + delta
+	}
+
+	// 内链重写与 markdown 规范化,思考结束时输出暂存的文本
+	delta = rewriteStreamDelta(c, delta)
+	if field == config.FieldThinkEnd {
+		delta += flushStreamRewriter(c)
+	}
+	delta = normalizeStreamDelta(c, delta)
+	if field == config.FieldThinkEnd {
+		delta += flushStreamNormalizer(c)
+	}
+
+	// 出站内容守卫,思考结束时输出暂存的文本
+	delta, blocked := guardStreamDelta(c, delta, field == config.FieldThinkEnd)
+	if blocked {
+		if err := finishContentFiltered(c, responseId, modelName, jsonData); err != nil {
+			return err
+		}
+		return errContentFiltered
+	}
+
 	// 发送基础事件
 	var err error
 	if err = sendSSEvent(c, createResponse(delta)); err != nil {
@@ -638,52 +953,53 @@ func handleMessageFieldDelta(c *gin.Context, event map[string]interface{}, respo
 	}
 
 	// 处理思考过程标记
-	if config.ReasoningHide != 1 {
-		switch fieldName {
-		case "session_state.answerthink_is_started":
+	if reasoningEnabled(c) {
+		switch field {
+		case config.FieldThinkStart:
 			err = sendSSEvent(c, createResponse("<think>\n"))
-		case "session_state.answerthink_is_finished":
+		case config.FieldThinkEnd:
 			err = sendSSEvent(c, createResponse("\n</think>"))
 		}
 	}
 
-	return err
-}
-
-type Content struct {
-	DetailAnswer string `json:"detailAnswer"`
-}
-
-func getDetailAnswer(eventMap map[string]interface{}) (string, error) {
-	// 获取 content 字段的值
-	contentStr, ok := eventMap["content"].(string)
-	if !ok {
-		return "", fmt.Errorf("content is not a string")
-	}
-
-	// 解析内层的 JSON
-	var content Content
-	if err := json.Unmarshal([]byte(contentStr), &content); err != nil {
-		return "", err
+	// 超过模型的输出上限时以 length 结束,不再读取上游
+	if err == nil && outputLimitReached(c, delta) {
+		if err = finishOutputLimited(c, responseId, modelName, jsonData); err != nil {
+			return err
+		}
+		return errOutputLimited
 	}
-
-	return content.DetailAnswer, nil
+	return err
 }
 
 // handleMessageResult 处理消息结果
 func handleMessageResult(c *gin.Context, event map[string]interface{}, responseId, modelName string, jsonData []byte, searchModel bool) bool {
 	finishReason := "stop"
 	var delta string
-	var err error
-	if modelName == "o1" && searchModel {
-		delta, err = getDetailAnswer(event)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), "getDetailAnswer err: %v", err)
-			return false
+	if searchModel {
+		// 答案未以增量形式输出时,从结果中取出完整答案
+		content, _ := event["content"].(string)
+		if answer := parseSearchResult(c, content); !searchAnswerStreamed(c) {
+			delta = answer
 		}
+		delta += takeSearchSources(c, "")
+	}
+	delta = rewriteStreamDelta(c, takeChatImage(c)+takeMixtureMarkdown(c)+delta+takeMarkmapMermaid(c)+takeAgentArtifacts(c, "")) + flushStreamRewriter(c)
+	delta = normalizeStreamDelta(c, delta) + flushStreamNormalizer(c)
+	delta, blocked := guardStreamDelta(c, delta, true)
+	if blocked {
+		if err := finishContentFiltered(c, responseId, modelName, jsonData); err != nil {
+			logger.Warnf(c.Request.Context(), "sendSSEvent err: %v", err)
+		}
+		return false
 	}
 
 	streamResp := createStreamResponse(responseId, modelName, jsonData, model.OpenAIDelta{Content: delta, Role: "assistant"}, &finishReason)
+	streamResp.MixtureLayers = getMixtureLayers(c)
+	streamResp.AgentArtifacts = getAgentArtifacts(c)
+	streamResp.Attachments = getAttachments(c)
+	streamResp.Markmap = getMarkmap(c)
+	streamResp.Suggestions = getSuggestions(c)
 	if err := sendSSEvent(c, streamResp); err != nil {
 		logger.Warnf(c.Request.Context(), "sendSSEvent err: %v", err)
 		return false
@@ -692,8 +1008,16 @@ func handleMessageResult(c *gin.Context, event map[string]interface{}, responseI
 	return false
 }
 
-// sendSSEvent 发送SSE事件
+// sendSSEvent 发送SSE事件,开启输出平滑时大块内容分段下发
 func sendSSEvent(c *gin.Context, response model.OpenAIChatCompletionResponse) error {
+	if config.StreamSmoothRate > 0 {
+		return sendSmoothSSEvent(c, response)
+	}
+	return writeSSEvent(c, response)
+}
+
+// writeSSEvent 立即写出一个SSE事件
+func writeSSEvent(c *gin.Context, response model.OpenAIChatCompletionResponse) error {
 	jsonResp, err := json.Marshal(response)
 	if err != nil {
 		logger.Errorf(c.Request.Context(), "Failed to marshal response: %v", err)
@@ -704,6 +1028,88 @@ func sendSSEvent(c *gin.Context, response model.OpenAIChatCompletionResponse) er
 	return nil
 }
 
+// cleanupChat 对话结束后保存会话映射,或按 shouldDeleteChat 删除临时会话
+func cleanupChat(c *gin.Context, cookie, modelName, projectId string) {
+	if projectId == "" {
+		return
+	}
+	deleteChat := shouldDeleteChat(c)
+	namespace := sessionNamespace(c)
+	bindSession := config.AutoModelChatMapType == 1 && sessionReusable(c)
+	task.Go("chat-cleanup", func() {
+		if bindSession {
+			// 保存映射
+			config.GlobalSessionManager.AddSession(namespace, cookie, modelName, projectId)
+		} else if deleteChat {
+			client := tlsclient.New()
+			defer client.Release()
+			makeDeleteRequest(client.CycleTLS, cookie, projectId)
+		}
+	})
+}
+
+// shouldDeleteChat 是否删除本次对话,请求携带 store 时覆盖 AUTO_DEL_CHAT
+func shouldDeleteChat(c *gin.Context) bool {
+	if store, ok := c.Get(helper.StoreKey); ok {
+		return !store.(bool)
+	}
+	return config.AutoDelChat == 1
+}
+
+// sessionReusable 是否复用与绑定会话:会话(threads)运行自带历史,store:false 的对话不论 AUTO_MODEL_CHAT_MAP_TYPE 均在结束后删除
+func sessionReusable(c *gin.Context) bool {
+	if store, ok := c.Get(helper.StoreKey); ok && !store.(bool) {
+		return false
+	}
+	return !c.GetBool(helper.ThreadRunKey)
+}
+
+// respondCookiesUnavailable cookie 均不可用时响应,因限流导致时返回429并附带预计恢复时间与未限流的候选模型
+func respondCookiesUnavailable(c *gin.Context, modelName string, message string) {
+	retryAfter := config.GetRateLimitRetryAfter(getCookiePool(c))
+	if retryAfter <= 0 {
+		c.JSON(http.StatusInternalServerError, errorBody(c, message))
+		return
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	body := errorBody(c, message)
+	body["suggestions"] = getModelSuggestions(modelName)
+	c.JSON(http.StatusTooManyRequests, body)
+}
+
+// getModelSuggestions 获取同类型中当前未限流的替代模型
+func getModelSuggestions(modelName string) []string {
+	candidates := common.TextModelList
+	if lo.Contains(common.ImageModelList, modelName) {
+		candidates = common.ImageModelList
+	}
+	return lo.Filter(candidates, func(m string, _ int) bool {
+		return m != modelName && !config.IsRateLimitedModel(m)
+	})
+}
+
+// setUsageHeaders 设置上游模型与费用估算响应头
+func setUsageHeaders(c *gin.Context, upstreamModel string, modelName string, usage model.OpenAIUsage) {
+	c.Set(helper.UsageKey, usage)
+	c.Header("X-Upstream-Model", upstreamModel)
+	if cost, ok := common.EstimateCost(modelName, usage.PromptTokens, usage.CompletionTokens); ok {
+		c.Header("X-Usage-Cost-Estimate", strconv.FormatFloat(cost, 'f', 6, 64))
+	}
+}
+
+// getUpstreamModel 获取实际发往上游的模型(Mixture模式下为多个,agent 模型为 agent 类型)
+func getUpstreamModel(requestBody map[string]interface{}) string {
+	if upstreamType := requestType(requestBody); upstreamType != chatType {
+		return upstreamType
+	}
+	if extraData, ok := requestBody["extra_data"].(map[string]interface{}); ok {
+		if models, ok := extraData["models"].([]string); ok {
+			return strings.Join(models, ",")
+		}
+	}
+	return ""
+}
+
 // makeRequest 发送HTTP请求
 func makeRequest(client cycletls.CycleTLS, jsonData []byte, cookie string, isStream bool) (cycletls.Response, error) {
 	accept := "application/json"
@@ -711,9 +1117,9 @@ func makeRequest(client cycletls.CycleTLS, jsonData []byte, cookie string, isStr
 		accept = "text/event-stream"
 	}
 
-	return client.Do(apiEndpoint, cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+	response, err := client.Do(apiEndpoint, cycletls.Options{
+		Timeout: config.GetRuntimeConfig().Timeouts.Chat,
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Body:    string(jsonData),
 		Method:  "POST",
 		Headers: map[string]string{
@@ -725,6 +1131,7 @@ func makeRequest(client cycletls.CycleTLS, jsonData []byte, cookie string, isStr
 			"User-Agent":   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome",
 		},
 	}, "POST")
+	return response, classifyProxyError(err)
 }
 
 // makeRequest 发送HTTP请求
@@ -734,8 +1141,8 @@ func makeImageRequest(client cycletls.CycleTLS, jsonData []byte, cookie string)
 
 	return client.Do(apiEndpoint, cycletls.Options{
 		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome",
-		Timeout:   10 * 60 * 60,
-		Proxy:     config.ProxyUrl, // 在每个请求中设置代理
+		Timeout:   config.GetRuntimeConfig().Timeouts.Image,
+		Proxy:     egress.Proxy(), // 在每个请求中设置代理
 		Body:      string(jsonData),
 		Method:    "POST",
 		Headers: map[string]string{
@@ -758,6 +1165,13 @@ func makeDeleteRequest(client cycletls.CycleTLS, cookie, projectId string) (cycl
 			return cycletls.Response{}, nil
 		}
 	}
+	for _, tenant := range config.GetTenants() {
+		for _, v := range tenant.ModelChatMap {
+			if v == projectId {
+				return cycletls.Response{}, nil
+			}
+		}
+	}
 	for _, v := range config.GlobalSessionManager.GetChatIDsByCookie(cookie) {
 		if v == projectId {
 			return cycletls.Response{}, nil
@@ -772,8 +1186,8 @@ func makeDeleteRequest(client cycletls.CycleTLS, cookie, projectId string) (cycl
 	accept := "application/json"
 
 	return client.Do(fmt.Sprintf(deleteEndpoint, projectId), cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+		Timeout: config.GetRuntimeConfig().Timeouts.Delete,
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Method:  "GET",
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -791,8 +1205,8 @@ func makeGetUploadUrlRequest(client cycletls.CycleTLS, cookie string) (cycletls.
 	accept := "*/*"
 
 	return client.Do(fmt.Sprintf(uploadEndpoint), cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+		Timeout: config.GetRuntimeConfig().Timeouts.Upload,
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Method:  "GET",
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -823,8 +1237,8 @@ func makeGetUploadUrlRequest(client cycletls.CycleTLS, cookie string) (cycletls.
 
 func makeUploadRequest(client cycletls.CycleTLS, uploadUrl string, fileBytes []byte) (cycletls.Response, error) {
 	return client.Do(uploadUrl, cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+		Timeout: config.GetRuntimeConfig().Timeouts.Upload,
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Method:  "PUT",
 		Body:    string(fileBytes),
 		Headers: map[string]string{
@@ -866,42 +1280,108 @@ func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie string
 		errCloudflareBlock        = "CloudFlare: Sorry, you have been blocked"
 		errServerErrMsg           = "An error occurred with the current request, please try again."
 		errServiceUnavailable     = "Genspark Service Unavailable"
+		errStreamInterrupted      = "Upstream stream interrupted"
 	)
 
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
+	c.Header("X-Upstream-Model", getUpstreamModel(requestBody))
 
-	responseId := fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405"))
+	responseId := newResponseId()
 	ctx := c.Request.Context()
-	maxRetries := len(cookieManager.Cookies)
+	maxRetries := config.LimitRetries(len(cookieManager.Cookies), config.GetRuntimeConfig().Retries.Chat)
+
+	unlockChat := func() {}
+	defer func() { unlockChat() }()
+	// 每次尝试结束(换 cookie 重试、提前结束或返回)时关闭上游连接
+	cancelStream := func() {}
+	defer func() { cancelStream() }()
+	defer finishShadowParser(c)
+	var chunkSampler *logger.ChunkSampler
+	defer func() { chunkSampler.Close() }()
+	cfSolved := false
+
+	// fail 上游流式请求失败,尚未输出任何内容时改用非流式请求一次,否则返回错误
+	fallbackTried := false
+	fail := func(status int, message string) bool {
+		if config.StreamFallbackNonStream == 1 && !fallbackTried && !c.Writer.Written() {
+			fallbackTried = true
+			logger.Warnf(ctx, "Stream request failed before any content was sent: %s, falling back to non-stream request", message)
+			unlockChat()
+			unlockChat = func() {}
+			streamFromNonStream(c, client, cookie, cookieManager, requestBody, modelName, searchModel, responseId)
+			return false
+		}
+		c.JSON(status, errorBody(c, message))
+		return false
+	}
 
 	c.Stream(func(w io.Writer) bool {
 		for attempt := 0; attempt < maxRetries; attempt++ {
+			unlockChat()
+			unlockChat = lockChatSession(cookie, requestBody)
+			logCookieTags(ctx, cookie)
+			beginAttempt(c, cookie)
+			resetMixtureLayers(c)
+			resetAgent(c)
+			resetSearch(c)
+			resetSuggestions(c)
+			resetMarkmap(c)
+			resetGuardStream(c)
+			resetShadowParser(c, modelName)
+			startOutputLimit(c, modelName)
+			chunkSampler.Close()
+			chunkSampler = logger.NewChunkSampler(ctx)
 
 			requestBody, err := cheat(requestBody, c, cookie)
 			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
+				c.JSON(500, errorBody(c, err.Error()))
 				return false
 			}
 			jsonData, err := json.Marshal(requestBody)
 			if err != nil {
-				c.JSON(500, gin.H{"error": "Failed to marshal request body"})
+				c.JSON(500, errorBody(c, "Failed to marshal request body"))
 				return false
 			}
-			sseChan, err := makeStreamRequest(c, client, jsonData, cookie)
+			cancelStream()
+			sseChan, cancel, err := makeStreamRequest(c, jsonData, cookie)
 			if err != nil {
 				logger.Errorf(ctx, "makeStreamRequest err on attempt %d: %v", attempt+1, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return false
+				endAttempt(c, attemptRequestError)
+				return fail(http.StatusInternalServerError, err.Error())
+			}
+			sseChan, cancelStream, err = awaitFirstEvent(sseChan, cancel, modelName)
+			if err != nil {
+				// 首事件超时时换 cookie 并新建会话重试
+				logger.Warnf(ctx, "No upstream event within %ds, attempt %d/%d, COOKIE:%s", config.GetRuntimeConfig().StreamFirstEventTimeout, attempt+1, maxRetries, cookie)
+				endAttempt(c, attemptFirstEventTimeout)
+				if attempt+1 < maxRetries {
+					if cookie, err = cookieManager.GetNextCookie(); err == nil {
+						requestBody["current_query_string"] = fmt.Sprintf("type=%s", requestType(requestBody))
+						continue
+					}
+				}
+				return fail(http.StatusGatewayTimeout, errFirstEventTimeout.Error())
 			}
 
 			var projectId string
 			isRateLimit := false
+			cfRetry := false
 		SSELoop:
 			for response := range sseChan {
 				if response.Done {
 					logger.Debugf(ctx, response.Data)
+					if !c.Writer.Written() {
+						endAttempt(c, attemptInterrupted)
+						return fail(http.StatusInternalServerError, errStreamInterrupted)
+					}
+					endAttempt(c, attemptOk)
+					// 达到最大输出时长后上游请求超时断开
+					if outputLimitReached(c, "") {
+						finishOutputLimited(c, responseId, modelName, jsonData)
+						cleanupChat(c, cookie, modelName, projectId)
+					}
 					return false
 				}
 
@@ -910,32 +1390,41 @@ func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie string
 					continue
 				}
 
-				logger.Debug(ctx, strings.TrimSpace(data))
+				chunkSampler.Log(data)
+				feedShadowParser(c, data)
 
 				switch {
 				case common.IsCloudflareChallenge(data):
 					logger.Errorf(ctx, errCloudflareChallengeMsg)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": errCloudflareChallengeMsg})
-					return false
+					endAttempt(c, attemptCloudflareChallenge)
+					if cookie, cfRetry = retryWithCfSolver(ctx, cookie, &cfSolved); cfRetry {
+						break SSELoop
+					}
+					return fail(http.StatusInternalServerError, errCloudflareChallengeMsg)
 				case common.IsCloudflareBlock(data):
 					logger.Errorf(ctx, errCloudflareBlock)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": errCloudflareBlock})
-					return false
+					endAttempt(c, attemptCloudflareBlock)
+					return fail(http.StatusInternalServerError, errCloudflareBlock)
 				case common.IsServiceUnavailablePage(data):
 					logger.Errorf(ctx, errServiceUnavailable)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": errServiceUnavailable})
-					return false
+					endAttempt(c, attemptServiceUnavailable)
+					alert.RecordUpstreamError(errServiceUnavailable)
+					return fail(http.StatusInternalServerError, errServiceUnavailable)
 				case common.IsServerError(data):
 					logger.Errorf(ctx, errServerErrMsg)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": errServerErrMsg})
-					return false
+					endAttempt(c, attemptServerError)
+					alert.RecordUpstreamError(errServerErrMsg)
+					return fail(http.StatusInternalServerError, errServerErrMsg)
 				case common.IsRateLimit(data):
 					isRateLimit = true
+					endAttempt(c, attemptRateLimit)
 					logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 					config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
+					config.AddRateLimitModel(modelName, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
 					break SSELoop // 使用 label 跳出 SSE 循环
 				case common.IsFreeLimit(data):
 					isRateLimit = true
+					endAttempt(c, attemptFreeLimit)
 					logger.Warnf(ctx, "Cookie free rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 					config.AddRateLimitCookie(cookie, time.Now().Add(24*60*60*time.Second))
 					// 删除cookie
@@ -943,6 +1432,7 @@ func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie string
 					break SSELoop // 使用 label 跳出 SSE 循环
 				case common.IsNotLogin(data):
 					isRateLimit = true
+					endAttempt(c, attemptNotLogin)
 					logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 					// 删除cookie
 					config.RemoveCookie(cookie)
@@ -951,11 +1441,29 @@ func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie string
 
 				// 处理事件流数据
 				if shouldContinue := processStreamData(c, data, &projectId, cookie, responseId, modelName, jsonData, searchModel); !shouldContinue {
+					endAttempt(c, attemptOk)
+					if limiter, ok := getOutputLimiter(c); ok && limiter.reached {
+						// 达到输出上限后主动断开上游,会话按正常结束处理
+						cancelStream()
+						cleanupChat(c, cookie, modelName, projectId)
+					}
 					return false
 				}
 			}
 
+			if cfRetry {
+				// 过盾成功,使用更新后的 cookie 重试
+				attempt--
+				continue
+			}
+
 			if !isRateLimit {
+				if !c.Writer.Written() {
+					endAttempt(c, attemptInterrupted)
+					return fail(http.StatusInternalServerError, errStreamInterrupted)
+				}
+				endAttempt(c, attemptOk)
+				alert.RecordUpstreamSuccess()
 				return true
 			}
 
@@ -963,94 +1471,63 @@ func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie string
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
+				c.JSON(http.StatusInternalServerError, errorBody(c, errNoValidCookies))
 				return false
 			}
 
 			// requestBody重制chatId
-			currentQueryString := fmt.Sprintf("type=%s", chatType)
-			if chatId, ok := config.GlobalSessionManager.GetChatID(cookie, modelName); ok {
-				currentQueryString = fmt.Sprintf("id=%s&type=%s", chatId, chatType)
+			currentQueryString := fmt.Sprintf("type=%s", requestType(requestBody))
+			if chatId, ok := config.GlobalSessionManager.GetChatID(sessionNamespace(c), cookie, modelName); ok && sessionReusable(c) {
+				currentQueryString = fmt.Sprintf("id=%s&type=%s", chatId, requestType(requestBody))
 			}
 			requestBody["current_query_string"] = currentQueryString
 		}
 
 		logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "All cookies are temporarily unavailable."})
+		alertNoValidCookies(c, modelName, fmt.Sprintf("All cookies exhausted after %d attempts", maxRetries))
+		respondCookiesUnavailable(c, modelName, "All cookies are temporarily unavailable.")
 		return false
 	})
 }
 
-func cheat(requestBody map[string]interface{}, c *gin.Context, cookie string) (map[string]interface{}, error) {
-	if strings.TrimSpace(config.RecaptchaProxyUrl) == "" ||
-		(!strings.HasPrefix(config.RecaptchaProxyUrl, "http://") &&
-			!strings.HasPrefix(config.RecaptchaProxyUrl, "https://")) {
-		return requestBody, nil
-	} else {
-
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client := &http.Client{Transport: tr}
-
-		// 检查并补充 RecaptchaProxyUrl 的末尾斜杠
-		if !strings.HasSuffix(config.RecaptchaProxyUrl, "/") {
-			config.RecaptchaProxyUrl += "/"
-		}
-
-		// 创建请求
-		req, err := http.NewRequest("GET", fmt.Sprintf("%sgenspark", config.RecaptchaProxyUrl), nil)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("创建/genspark请求失败   %v\n", err))
-			return nil, err
-		}
-
-		// 设置请求头
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Cookie", cookie)
-
-		// 发送请求
-		resp, err := client.Do(req)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("发送/genspark请求失败   %v\n", err))
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		// 读取响应体
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark响应失败   %v\n", err))
-			return nil, err
-		}
-
-		type Response struct {
-			Code    int    `json:"code"`
-			Token   string `json:"token"`
-			Message string `json:"message"`
-		}
+// detectDegrade 降智检测,命中时记录事件并返回原因
+func detectDegrade(ctx context.Context, modelName string, content string, retry bool) string {
+	if !degrade.Enabled() {
+		return ""
+	}
+	reason := degrade.Detect(modelName, content)
+	if reason != "" {
+		logger.Warnf(ctx, "Response degrade detected, model: %s, reason: %s, retry: %v", modelName, reason, retry)
+		degrade.Record(modelName, reason, retry)
+	}
+	return reason
+}
 
-		if resp.StatusCode == 200 {
-			var response Response
-			if err := json.Unmarshal(body, &response); err != nil {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark JSON 失败   %v\n", err))
-				return nil, err
-			}
+// lockChatSession 复用会话(current_query_string 中带有 id)时按 (cookie, chatId) 加锁,未复用会话时不加锁
+func lockChatSession(cookie string, requestBody map[string]interface{}) func() {
+	queryString, _ := requestBody["current_query_string"].(string)
+	values, _ := url.ParseQuery(queryString)
+	chatId := values.Get("id")
+	if chatId == "" {
+		return func() {}
+	}
+	return config.LockChatSession(cookie, chatId)
+}
 
-			if response.Code == 200 {
-				logger.Debugf(c.Request.Context(), fmt.Sprintf("g_recaptcha_token: %v\n", response.Token))
-				requestBody["g_recaptcha_token"] = response.Token
-				logger.Infof(c.Request.Context(), fmt.Sprintf("cheat success!"))
-				return requestBody, nil
-			} else {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark token 失败,查看 playwright-proxy log"))
-				return nil, err
-			}
-		} else {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("请求/genspark失败,查看 playwright-proxy log"))
-			return nil, err
-		}
+// cheat 配置了 RECAPTCHA_PROXY_URL 时为请求体附加 g_recaptcha_token
+func cheat(requestBody map[string]interface{}, c *gin.Context, cookie string) (map[string]interface{}, error) {
+	if !recaptcha.Enabled() {
+		return requestBody, nil
+	}
+	token, err := recaptcha.GetToken(cookie)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "请求/genspark失败: %v", err)
+		return nil, err
 	}
+	logger.Debugf(c.Request.Context(), "g_recaptcha_token: %v", token)
+	requestBody["g_recaptcha_token"] = token
+	logger.Infof(c.Request.Context(), "cheat success!")
+	return requestBody, nil
 }
 
 // 处理流式数据的辅助函数，返回bool表示是否继续处理
@@ -1060,13 +1537,21 @@ func processStreamData(c *gin.Context, data string, projectId *string, cookie, r
 	//	return true
 	//}
 	data = strings.TrimPrefix(data, "data: ")
+	// agent 模型的步骤事件
+	if step, ok := collectAgentStep(c, model, data, cookie); ok {
+		if err := sendAgentStep(c, step, responseId, model, jsonData); err != nil {
+			logger.Warnf(c.Request.Context(), "sendSSEvent err: %v", err)
+			return false
+		}
+		return true
+	}
 	if !strings.HasPrefix(data, "{\"id\":") && !strings.HasPrefix(data, "{\"message_id\":") {
 		return true
 	}
 	var event map[string]interface{}
 	if err := json.Unmarshal([]byte(data), &event); err != nil {
 		logger.Errorf(c.Request.Context(), "Failed to unmarshal event: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, errorBody(c, err.Error()))
 		return false
 	}
 
@@ -1078,43 +1563,42 @@ func processStreamData(c *gin.Context, data string, projectId *string, cookie, r
 	switch eventType {
 	case "project_start":
 		*projectId, _ = event["id"].(string)
+		getShadowSession(c).RecordProjectId(*projectId)
 	case "message_field":
-		if err := handleMessageFieldDelta(c, event, responseId, model, jsonData); err != nil {
+		if err := handleMessageFieldDelta(c, event, responseId, model, jsonData, searchModel); err != nil {
+			if errors.Is(err, errContentFiltered) || errors.Is(err, errOutputLimited) {
+				return false
+			}
 			logger.Errorf(c.Request.Context(), "handleMessageFieldDelta err: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, errorBody(c, err.Error()))
 			return false
 		}
 	case "message_field_delta":
-		if err := handleMessageFieldDelta(c, event, responseId, model, jsonData); err != nil {
+		if err := handleMessageFieldDelta(c, event, responseId, model, jsonData, searchModel); err != nil {
+			if errors.Is(err, errContentFiltered) || errors.Is(err, errOutputLimited) {
+				return false
+			}
 			logger.Errorf(c.Request.Context(), "handleMessageFieldDelta err: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, errorBody(c, err.Error()))
 			return false
 		}
 	case "message_result":
-		go func() {
-			if config.AutoModelChatMapType == 1 {
-				// 保存映射
-				config.GlobalSessionManager.AddSession(cookie, model, *projectId)
-			} else {
-				if config.AutoDelChat == 1 {
-					client := cycletls.Init()
-					defer safeClose(client)
-					makeDeleteRequest(client, cookie, *projectId)
-				}
-			}
-		}()
+		getShadowSession(c).RecordResult("")
+		cleanupChat(c, cookie, model, *projectId)
 
+		recordFeedbackTarget(c, responseId, model, cookie)
 		return handleMessageResult(c, event, responseId, model, jsonData, searchModel)
 	}
 
 	return true
 }
 
-func makeStreamRequest(c *gin.Context, client cycletls.CycleTLS, jsonData []byte, cookie string) (<-chan cycletls.SSEResponse, error) {
+// makeStreamRequest 发起流式请求,提前结束读取时需调用返回的 cancel 关闭上游连接
+func makeStreamRequest(c *gin.Context, jsonData []byte, cookie string) (<-chan cycletls.SSEResponse, context.CancelFunc, error) {
 
 	options := cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+		Timeout: streamTimeout(c),
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Body:    string(jsonData),
 		Method:  "POST",
 		Headers: map[string]string{
@@ -1129,12 +1613,13 @@ func makeStreamRequest(c *gin.Context, client cycletls.CycleTLS, jsonData []byte
 
 	logger.Debug(c.Request.Context(), fmt.Sprintf("cookie: %v", cookie))
 
-	sseChan, err := client.DoSSE(apiEndpoint, options, "POST")
+	sseChan, cancel, err := tlsclient.DoSSE(c.Request.Context(), apiEndpoint, options, "POST")
 	if err != nil {
+		err = classifyProxyError(err)
 		logger.Errorf(c, "Failed to make stream request: %v", err)
-		return nil, fmt.Errorf("Failed to make stream request: %v", err)
+		return nil, nil, fmt.Errorf("Failed to make stream request: %v", err)
 	}
-	return sseChan, nil
+	return sseChan, cancel, nil
 }
 
 // handleNonStreamRequest 处理非流式请求
@@ -1231,23 +1716,50 @@ func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie str
 	)
 
 	ctx := c.Request.Context()
-	maxRetries := len(cookieManager.Cookies)
+	maxRetries := config.LimitRetries(len(cookieManager.Cookies), config.GetRuntimeConfig().Retries.Chat)
+	language := c.GetString(helper.LanguageKey)
+	languageRetried := false
+	degradeRetried := false
+	cfSolved := false
+
+	unlockChat := func() {}
+	defer func() { unlockChat() }()
+	// 每次尝试结束(换 cookie 重试、提前结束或返回)时关闭上游连接
+	cancelStream := func() {}
+	defer func() { cancelStream() }()
+	defer finishShadowParser(c)
+	var chunkSampler *logger.ChunkSampler
+	defer func() { chunkSampler.Close() }()
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		unlockChat()
+		unlockChat = lockChatSession(cookie, requestBody)
+		logCookieTags(ctx, cookie)
+		beginAttempt(c, cookie)
+		resetMixtureLayers(c)
+		resetAgent(c)
+		resetSearch(c)
+		resetSuggestions(c)
+		resetMarkmap(c)
+		resetShadowParser(c, modelName)
+		chunkSampler.Close()
+		chunkSampler = logger.NewChunkSampler(ctx)
+
 		requestBody, err := cheat(requestBody, c, cookie)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			c.JSON(500, errorBody(c, err.Error()))
 			return
 		}
 		jsonData, err := json.Marshal(requestBody)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to marshal request body"})
+			c.JSON(500, errorBody(c, "Failed to marshal request body"))
 			return
 		}
 		response, err := makeRequest(client, jsonData, cookie, false)
 		if err != nil {
 			logger.Errorf(ctx, "makeRequest err: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			endAttempt(c, attemptRequestError)
+			c.JSON(http.StatusInternalServerError, errorBody(c, err.Error()))
 			return
 		}
 
@@ -1257,7 +1769,9 @@ func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie str
 		var firstLine string
 		var projectId string
 		isRateLimit := false
+		cfRetry := false
 
+	ScanLoop:
 		for scanner.Scan() {
 			line := scanner.Text()
 			if firstLine == "" {
@@ -1266,24 +1780,33 @@ func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie str
 			if line == "" {
 				continue
 			}
-			logger.Debug(ctx, strings.TrimSpace(line))
+			chunkSampler.Log(line)
+			feedShadowParser(c, line)
 
 			switch {
 			case common.IsCloudflareChallenge(line):
 				logger.Errorf(ctx, errCloudflareChallengeMsg)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errCloudflareChallengeMsg})
+				endAttempt(c, attemptCloudflareChallenge)
+				if cookie, cfRetry = retryWithCfSolver(ctx, cookie, &cfSolved); cfRetry {
+					break ScanLoop
+				}
+				c.JSON(http.StatusInternalServerError, errorBody(c, errCloudflareChallengeMsg))
 				return
 			case common.IsCloudflareBlock(line):
 				logger.Errorf(ctx, errCloudflareBlock)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errCloudflareBlock})
+				endAttempt(c, attemptCloudflareBlock)
+				c.JSON(http.StatusInternalServerError, errorBody(c, errCloudflareBlock))
 				return
 			case common.IsRateLimit(line):
 				isRateLimit = true
+				endAttempt(c, attemptRateLimit)
 				logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 				config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
+				config.AddRateLimitModel(modelName, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
 				break
 			case common.IsFreeLimit(line):
 				isRateLimit = true
+				endAttempt(c, attemptFreeLimit)
 				logger.Warnf(ctx, "Cookie free rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 				config.AddRateLimitCookie(cookie, time.Now().Add(24*60*60*time.Second))
 				// 删除cookie
@@ -1291,136 +1814,190 @@ func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, cookie str
 				break
 			case common.IsNotLogin(line):
 				isRateLimit = true
+				endAttempt(c, attemptNotLogin)
 				logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 				// 删除cookie
 				config.RemoveCookie(cookie)
 				break
 			case common.IsServiceUnavailablePage(line):
 				logger.Errorf(ctx, errServiceUnavailable)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errServiceUnavailable})
+				endAttempt(c, attemptServiceUnavailable)
+				alert.RecordUpstreamError(errServiceUnavailable)
+				c.JSON(http.StatusInternalServerError, errorBody(c, errServiceUnavailable))
 				return
 			case common.IsServerError(line):
 				logger.Errorf(ctx, errServerErrMsg)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errServerErrMsg})
+				endAttempt(c, attemptServerError)
+				alert.RecordUpstreamError(errServerErrMsg)
+				c.JSON(http.StatusInternalServerError, errorBody(c, errServerErrMsg))
 				return
 			case strings.HasPrefix(line, "data: "):
 
 				data := strings.TrimPrefix(line, "data: ")
+				// agent 模型的步骤事件
+				if _, ok := collectAgentStep(c, modelName, data, cookie); ok {
+					continue
+				}
 				var parsedResponse struct {
-					Type      string `json:"type"`
-					FieldName string `json:"field_name"`
-					Content   string `json:"content"`
-					Id        string `json:"id"`
-					Delta     string `json:"delta"`
+					Type       string          `json:"type"`
+					FieldName  string          `json:"field_name"`
+					Content    string          `json:"content"`
+					Id         string          `json:"id"`
+					Delta      string          `json:"delta"`
+					FieldValue json.RawMessage `json:"field_value"`
 				}
 				if err := json.Unmarshal([]byte(data), &parsedResponse); err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					c.JSON(http.StatusInternalServerError, errorBody(c, err.Error()))
 					return
 				}
 				if parsedResponse.Type == "project_start" {
 					projectId = parsedResponse.Id
+					getShadowSession(c).RecordProjectId(projectId)
 				}
 				if parsedResponse.Type == "message_field" {
 					// 提取思考过程
-					if config.ReasoningHide != 1 {
-						if parsedResponse.FieldName == "session_state.answerthink_is_started" {
+					if reasoningEnabled(c) {
+						if config.ResolveField(parsedResponse.FieldName) == config.FieldThinkStart {
 							answerThink = "<think>\n"
 						}
-						if parsedResponse.FieldName == "session_state.answerthink_is_finished" {
+						if config.ResolveField(parsedResponse.FieldName) == config.FieldThinkEnd {
 							answerThink = answerThink + "\n</think>"
 						}
 					}
 				}
+				if (parsedResponse.Type == "message_field" || parsedResponse.Type == "message_field_delta") &&
+					config.ResolveField(parsedResponse.FieldName) == config.FieldLayer {
+					value := parsedResponse.Delta
+					if parsedResponse.Type == "message_field" {
+						value = fieldValueString(parsedResponse.FieldValue)
+					}
+					collectMixtureLayer(c, parsedResponse.Type, parsedResponse.FieldName, value)
+				}
+				if (parsedResponse.Type == "message_field" || parsedResponse.Type == "message_field_delta") &&
+					config.ResolveField(parsedResponse.FieldName) == config.FieldMarkmap {
+					value := parsedResponse.Delta
+					if parsedResponse.Type == "message_field" {
+						value = fieldValueString(parsedResponse.FieldValue)
+					}
+					collectMarkmap(c, parsedResponse.Type, value)
+				}
+				if parsedResponse.Type == "message_field" &&
+					config.ResolveField(parsedResponse.FieldName) == config.FieldSuggestions {
+					collectSuggestions(c, parsedResponse.FieldValue)
+				}
+				if parsedResponse.Type == "message_field" && searchModel &&
+					config.ResolveField(parsedResponse.FieldName) == config.FieldSources {
+					// 来源字段可能为数组或 JSON 字符串
+					value := fieldValueString(parsedResponse.FieldValue)
+					if value == "" {
+						value = string(parsedResponse.FieldValue)
+					}
+					collectSearchSources(c, value)
+				}
 				if parsedResponse.Type == "message_field_delta" {
+					getShadowSession(c).RecordField(config.ResolveField(parsedResponse.FieldName), parsedResponse.Delta)
 					// 提取思考过程
-					if config.ReasoningHide != 1 {
-						if parsedResponse.FieldName == "session_state.answerthink" {
+					if reasoningEnabled(c) {
+						if config.ResolveField(parsedResponse.FieldName) == config.FieldThink {
 							answerThink = answerThink + parsedResponse.Delta
 						}
 					}
 				}
 				if parsedResponse.Type == "message_result" {
 					// 删除临时会话
-					go func() {
-						if config.AutoModelChatMapType == 1 {
-							// 保存映射
-							config.GlobalSessionManager.AddSession(cookie, modelName, projectId)
-						} else {
-							if config.AutoDelChat == 1 {
-								client := cycletls.Init()
-								defer safeClose(client)
-								makeDeleteRequest(client, cookie, projectId)
-							}
-						}
-					}()
-					if modelName == "o1" && searchModel {
-						// 解析内层的 JSON
-						var content Content
-						if err := json.Unmarshal([]byte(parsedResponse.Content), &content); err != nil {
-							logger.Errorf(ctx, "Failed to unmarshal response content: %v err %s", parsedResponse.Content, err.Error())
-							c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmarshal response content"})
-							return
-						}
-						parsedResponse.Content = content.DetailAnswer
+					cleanupChat(c, cookie, modelName, projectId)
+					if searchModel {
+						// 联网搜索结果取详细答案并收集来源
+						parsedResponse.Content = parseSearchResult(c, parsedResponse.Content)
 					}
 					content = strings.TrimSpace(answerThink + parsedResponse.Content)
+					getShadowSession(c).RecordResult(parsedResponse.Content)
 					break
 				}
 			}
 		}
 
+		if cfRetry {
+			// 过盾成功,使用更新后的 cookie 重试
+			attempt--
+			continue
+		}
+
 		if !isRateLimit {
 			if content == "" {
 				logger.Warnf(ctx, firstLine)
+				endAttempt(c, attemptNoContent)
 				//c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidResponseContent})
+			} else if language != "" && config.ForceLanguageRetry == 1 && !languageRetried && !common.MatchLanguage(content, language) {
+				// 语言不符时使用当前cookie重试一次
+				languageRetried = true
+				logger.Warnf(ctx, "Response language mismatch, expected %s, retrying once", language)
+				endAttempt(c, attemptRetry)
+				attempt--
+				continue
+			} else if reason := detectDegrade(ctx, modelName, content, !degradeRetried); reason != "" && !degradeRetried {
+				// 疑似降智时换 cookie 并新建会话重试一次
+				degradeRetried = true
+				endAttempt(c, attemptRetry)
+				if nextCookie, err := cookieManager.GetNextCookie(); err == nil {
+					cookie = nextCookie
+				}
+				requestBody["current_query_string"] = fmt.Sprintf("type=%s", requestType(requestBody))
+				attempt--
+				continue
 			} else {
-				promptTokens := common.CountTokenText(string(jsonData), modelName)
-				completionTokens := common.CountTokenText(content, modelName)
+				endAttempt(c, attemptOk)
+				alert.RecordUpstreamSuccess()
 				finishReason := "stop"
-
-				c.JSON(http.StatusOK, model.OpenAIChatCompletionResponse{
-					ID:      fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
-					Object:  "chat.completion",
-					Created: time.Now().Unix(),
-					Model:   modelName,
-					Choices: []model.OpenAIChoice{{
-						Message: model.OpenAIMessage{
-							Role:    "assistant",
-							Content: content,
-						},
-						FinishReason: &finishReason,
-					}},
-					Usage: model.OpenAIUsage{
-						PromptTokens:     promptTokens,
-						CompletionTokens: completionTokens,
-						TotalTokens:      promptTokens + completionTokens,
-					},
-				})
+				if searchModel {
+					content += takeSearchSources(c, content)
+				}
+				content = linkrewrite.Rewrite(takeChatImage(c) + takeMixtureMarkdown(c) + content + takeMarkmapMermaid(c) + takeAgentArtifacts(c, content))
+				content = normalizeMarkdown(c, content)
+				if guarded, blocked := guardOutput(c, content, true); blocked {
+					content, finishReason = "", "content_filter"
+				} else {
+					content = guarded
+				}
+				usage := buildTextUsage(modelName, string(jsonData), content)
+				setUsageHeaders(c, getUpstreamModel(requestBody), modelName, usage)
+				responseId := newResponseId()
+				response := buildChatCompletion(responseId, modelName, content, finishReason, usage)
+				response.MixtureLayers = getMixtureLayers(c)
+				response.AgentSteps = getAgentCollector(c).steps
+				response.AgentArtifacts = getAgentArtifacts(c)
+				response.Attachments = getAttachments(c)
+				response.Suggestions = getSuggestions(c)
+				response.Markmap = getMarkmap(c)
+				storeResponse(c, response)
+				recordFeedbackTarget(c, responseId, modelName, cookie)
+				c.JSON(http.StatusOK, response)
 				return
 			}
 		}
 
 		cookie, err = cookieManager.GetNextCookie()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "No more valid cookies available"})
+			c.JSON(http.StatusInternalServerError, errorBody(c, "No more valid cookies available"))
 			return
 		}
 		// requestBody重制chatId
-		currentQueryString := fmt.Sprintf("type=%s", chatType)
-		if chatId, ok := config.GlobalSessionManager.GetChatID(cookie, modelName); ok {
-			currentQueryString = fmt.Sprintf("id=%s&type=%s", chatId, chatType)
+		currentQueryString := fmt.Sprintf("type=%s", requestType(requestBody))
+		if chatId, ok := config.GlobalSessionManager.GetChatID(sessionNamespace(c), cookie, modelName); ok && sessionReusable(c) {
+			currentQueryString = fmt.Sprintf("id=%s&type=%s", chatId, requestType(requestBody))
 		}
 		requestBody["current_query_string"] = currentQueryString
 	}
 
 	logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "All cookies are temporarily unavailable."})
+	alertNoValidCookies(c, modelName, fmt.Sprintf("All cookies exhausted after %d attempts", maxRetries))
+	respondCookiesUnavailable(c, modelName, "All cookies are temporarily unavailable.")
 }
 
 func OpenaiModels(c *gin.Context) {
 	var modelsResp []string
 
-	modelsResp = common.DefaultOpenaiModelList
+	modelsResp = append(listedModels(), config.AgentModelList()...)
 
 	var openaiModelListResponse model.OpenaiModelListResponse
 	var openaiModelResponse []model.OpenaiModelResponse
@@ -1428,8 +2005,10 @@ func OpenaiModels(c *gin.Context) {
 
 	for _, modelResp := range modelsResp {
 		openaiModelResponse = append(openaiModelResponse, model.OpenaiModelResponse{
-			ID:     modelResp,
-			Object: "model",
+			ID:      modelResp,
+			Object:  "model",
+			Created: common.StartTime,
+			OwnedBy: "genspark",
 		})
 	}
 	openaiModelListResponse.Data = openaiModelResponse
@@ -1437,14 +2016,72 @@ func OpenaiModels(c *gin.Context) {
 	return
 }
 
+// OpenaiModel 获取单个模型,模型不存在时返回 404
+func OpenaiModel(c *gin.Context) {
+	id := strings.TrimPrefix(c.Param("id"), "/")
+	if id == "metadata" {
+		OpenaiModelsMetadata(c)
+		return
+	}
+	if !lo.Contains(append(listedModels(), config.AgentModelList()...), id) {
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.ModelNotFound, id),
+				Type:    "invalid_request_error",
+				Param:   "model",
+				Code:    "model_not_found",
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, model.OpenaiModelResponse{
+		ID:      id,
+		Object:  "model",
+		Created: common.StartTime,
+		OwnedBy: "genspark",
+	})
+}
+
 func ImagesForOpenAI(c *gin.Context) {
+	if rejectOverloaded(c) {
+		return
+	}
 
-	client := cycletls.Init()
-	defer safeClose(client)
+	client := tlsclient.New()
+	defer client.Release()
 
 	var openAIReq model.OpenAIImagesGenerationRequest
 	if err := c.BindJSON(&openAIReq); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		c.JSON(400, errorBody(c, err.Error()))
+		return
+	}
+	c.Set(helper.ModelKey, openAIReq.Model)
+
+	// 模型名后缀参数,请求中显式指定的参数优先
+	var modelOptions common.ModelOptions
+	openAIReq.Model, modelOptions = common.ParseModelSuffix(openAIReq.Model)
+	if openAIReq.AspectRatio == "" {
+		openAIReq.AspectRatio = modelOptions.AspectRatio
+	}
+	if openAIReq.Style == "" {
+		openAIReq.Style = modelOptions.Style
+	}
+	openAIReq.HD = openAIReq.HD || modelOptions.HD
+	openAIReq.Model = resolveTierModel(c, openAIReq.Model)
+
+	if err := validateImageEditRequest(openAIReq); err != nil {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: err.Error(),
+				Type:    "invalid_request_error",
+				Param:   "image",
+				Code:    "400",
+			},
+		})
+		return
+	}
+
+	if !checkMediaPrompt(c, openAIReq.Model, openAIReq.Prompt) {
 		return
 	}
 	// 初始化cookie
@@ -1457,9 +2094,16 @@ func ImagesForOpenAI(c *gin.Context) {
 	//	return
 	//}
 
-	resp, err := ImageProcess(c, client, openAIReq)
+	resp, err := ImageProcess(c, client.CycleTLS, openAIReq)
 	if err != nil {
 		logger.Errorf(c.Request.Context(), fmt.Sprintf("ImageProcess err  %v\n", err))
+		if respondGenerationCancelled(c, err) {
+			return
+		}
+		alert.RecordImageResult(false, err.Error())
+		if respondImageQueueError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
 				Message: err.Error(),
@@ -1469,11 +2113,20 @@ func ImagesForOpenAI(c *gin.Context) {
 		})
 		return
 	} else {
+		alert.RecordImageResult(true, "")
 		c.JSON(200, resp)
 	}
 
 }
 
+// validateImageEditRequest 校验图像编辑类模型(upscale/背景去除等)必须携带原图
+func validateImageEditRequest(openAIReq model.OpenAIImagesGenerationRequest) error {
+	if lo.Contains(common.ImageEditModelList, openAIReq.Model) && strings.TrimSpace(openAIReq.Image) == "" {
+		return fmt.Errorf("model %s is an image editing model, the image parameter (url or base64) is required", openAIReq.Model)
+	}
+	return nil
+}
+
 func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIImagesGenerationRequest) (*model.OpenAIImagesGenerationResponse, error) {
 	const (
 		errNoValidCookies = "No valid cookies available"
@@ -1489,14 +2142,16 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 		chatId                  string
 	)
 
-	cookieManager := config.NewCookieManager()
+	defer startGenerationTask(c, generationImage)()
+
+	cookieManager := newCookieManager(c, openAIReq.Model)
 	sessionImageChatManager = config.NewSessionMapManager()
 	ctx := c.Request.Context()
 
 	// Initialize session manager and get initial cookie
 	if len(config.SessionImageChatMap) == 0 {
 		//logger.Warnf(ctx, "未配置环境变量 SESSION_IMAGE_CHAT_MAP, 可能会生图失败!")
-		maxRetries = len(cookieManager.Cookies)
+		maxRetries = config.LimitRetries(len(cookieManager.Cookies), config.GetRuntimeConfig().Retries.Image)
 
 		var err error
 		cookie, err = cookieManager.GetRandomCookie()
@@ -1504,12 +2159,32 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 			logger.Errorf(ctx, "Failed to get initial cookie: %v", err)
 			return nil, fmt.Errorf(errNoValidCookies)
 		}
+		cookie = selectImageSessionCookie(c, cookieManager, openAIReq.Model, cookie)
 	} else {
-		maxRetries = sessionImageChatManager.GetSize()
+		maxRetries = config.LimitRetries(sessionImageChatManager.GetSize(), config.GetRuntimeConfig().Retries.Image)
 		cookie, chatId, _ = sessionImageChatManager.GetRandomKeyValue()
 	}
 
+	// prompt 增强,失败时使用原始 prompt
+	if openAIReq.EnhancePrompt && strings.TrimSpace(openAIReq.Prompt) != "" && !lo.Contains(common.ImageEditModelList, openAIReq.Model) {
+		enhancedPrompt, err := enhanceImagePrompt(c, client, cookie, openAIReq.Prompt)
+		if err != nil {
+			logger.Warnf(ctx, "Failed to enhance prompt, using original prompt: %v", err)
+		} else {
+			openAIReq.Prompt = enhancedPrompt
+		}
+	}
+
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		if generationCancelled(c) {
+			return nil, errGenerationCancelled
+		}
+		logCookieTags(ctx, cookie)
+		beginAttempt(c, cookie)
+		if imageSessionEnabled(c) {
+			// 多轮编辑沿用当前 cookie 绑定的图像会话
+			chatId = imageSessionChatId(c, cookie, openAIReq.Model)
+		}
 		// Create request body
 		requestBody, err := createImageRequestBody(c, cookie, &openAIReq, chatId)
 		if err != nil {
@@ -1528,6 +2203,7 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 		response, err := makeImageRequest(client, jsonData, cookie)
 		if err != nil {
 			logger.Errorf(ctx, "Failed to make image request: %v", err)
+			endAttempt(c, attemptRequestError)
 			return nil, err
 		}
 
@@ -1536,6 +2212,7 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 		// Handle different response cases
 		switch {
 		case common.IsRateLimit(body):
+			endAttempt(c, attemptRateLimit)
 			logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 			//if sessionImageChatManager != nil {
 			//	cookie, chatId, err = sessionImageChatManager.GetNextKeyValue()
@@ -1547,15 +2224,17 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 			//} else {
 			//cookieManager := config.NewCookieManager()
 			config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
+			config.AddRateLimitModel(openAIReq.Model, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
+				c.JSON(http.StatusInternalServerError, errorBody(c, errNoValidCookies))
 				return nil, fmt.Errorf(errNoValidCookies)
 				//}
 			}
 			continue
 		case common.IsFreeLimit(body):
+			endAttempt(c, attemptFreeLimit)
 			logger.Warnf(ctx, "Cookie free rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 			//if sessionImageChatManager != nil {
 			//	cookie, chatId, err = sessionImageChatManager.GetNextKeyValue()
@@ -1572,12 +2251,13 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
+				c.JSON(http.StatusInternalServerError, errorBody(c, errNoValidCookies))
 				return nil, fmt.Errorf(errNoValidCookies)
 				//}
 			}
 			continue
 		case common.IsNotLogin(body):
+			endAttempt(c, attemptNotLogin)
 			logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 			//if sessionImageChatManager != nil {
 			//	//sessionImageChatManager.RemoveKey(cookie)
@@ -1596,18 +2276,22 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
+				c.JSON(http.StatusInternalServerError, errorBody(c, errNoValidCookies))
 				return nil, fmt.Errorf(errNoValidCookies)
 				//}
 
 			}
 			continue
 		case common.IsServerError(body):
+			endAttempt(c, attemptServerError)
 			logger.Errorf(ctx, errServerErrMsg)
+			alert.RecordUpstreamError(errServerErrMsg)
 			return nil, fmt.Errorf(errServerErrMsg)
 		case common.IsServerOverloaded(body):
+			endAttempt(c, attemptServerOverloaded)
 			//logger.Errorf(ctx, fmt.Sprintf("Server overloaded, please try again later.%s", "官方服务超载或环境变量 SESSION_IMAGE_CHAT_MAP 未配置"))
 			logger.Errorf(ctx, fmt.Sprintf("Server overloaded, please try again later.%s", "官方服务超载"))
+			alert.RecordUpstreamError("Server overloaded")
 			return nil, fmt.Errorf("Server overloaded, please try again later.")
 		}
 
@@ -1615,59 +2299,118 @@ func ImageProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Open
 		projectId, taskIDs := extractTaskIDs(response.Body)
 		if len(taskIDs) == 0 {
 			logger.Errorf(ctx, "Response body: %s", response.Body)
+			endAttempt(c, attemptNoContent)
 			return nil, fmt.Errorf(errNoValidTaskIDs)
 		}
 
 		// Poll for image URLs
-		imageURLs := pollTaskStatus(c, client, taskIDs, cookie)
-		if len(imageURLs) == 0 {
+		taskResults, err := pollTaskStatus(c, client, taskIDs, cookie)
+		if generationCancelled(c) {
+			return nil, abortGeneration(c, cookie, projectId)
+		}
+		if err != nil {
+			logger.Warnf(ctx, "Image task failed fast: %v", err)
+			endAttempt(c, attemptImageQueue)
+			return nil, err
+		}
+		if !lo.SomeBy(taskResults, func(r imageTaskResult) bool { return r.URL != "" }) {
 			logger.Warnf(ctx, "No image URLs received, retrying with next cookie")
+			endAttempt(c, attemptNoContent)
 			continue
 		}
 
 		// Create response object
 		result := &model.OpenAIImagesGenerationResponse{
 			Created: time.Now().Unix(),
-			Data:    make([]*model.OpenAIImagesGenerationDataResponse, 0, len(imageURLs)),
+			Data:    make([]*model.OpenAIImagesGenerationDataResponse, 0, len(taskResults)),
 		}
 
-		// Process image URLs
-		for _, url := range imageURLs {
+		// Process image URLs,按任务提交顺序输出,失败的任务以带 error 的占位项保留位置
+		for _, taskResult := range taskResults {
 			data := &model.OpenAIImagesGenerationDataResponse{
-				URL:           url,
+				URL:           taskResult.URL,
 				RevisedPrompt: openAIReq.Prompt,
 			}
+			if taskResult.URL == "" {
+				logger.Warnf(ctx, "image task failed: %s", taskResult.Err)
+				data.Error = imageTaskError(taskResult.Err)
+				result.Data = append(result.Data, data)
+				continue
+			}
 
 			if openAIReq.ResponseFormat == "b64_json" {
-				base64Str, err := getBase64ByUrl(data.URL)
+				imgData, err := getBytesByUrl(data.URL)
 				if err != nil {
-					logger.Errorf(ctx, "getBase64ByUrl error: %v", err)
+					logger.Errorf(ctx, "getBytesByUrl error: %v", err)
+					data.URL = ""
+					data.Error = imageTaskError(fmt.Sprintf("failed to fetch image: %v", err))
+					result.Data = append(result.Data, data)
 					continue
 				}
-				data.B64Json = "data:image/webp;base64," + base64Str
+				// 按配置叠加水印并注入 AI 生成元数据,失败时返回原图
+				imgData, contentType, err := imagemeta.Process(imgData, imagemeta.Metadata{
+					Model:   openAIReq.Model,
+					Created: time.Unix(result.Created, 0),
+					Prompt:  openAIReq.Prompt,
+				})
+				if err != nil {
+					logger.Warnf(ctx, "image process error: %v", err)
+				}
+				data.B64Json = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(imgData)
+			} else if storage.Enabled() {
+				// 归档到 S3 兼容存储并返回签名下载 URL,失败时返回上游 URL
+				imgData, err := getBytesByUrl(data.URL)
+				if err == nil {
+					var contentType string
+					imgData, contentType, err = imagemeta.Process(imgData, imagemeta.Metadata{
+						Model:   openAIReq.Model,
+						Created: time.Unix(result.Created, 0),
+						Prompt:  openAIReq.Prompt,
+					})
+					if err != nil {
+						logger.Warnf(ctx, "image process error: %v", err)
+					}
+					data.URL = archiveResult(ctx, data.URL, imgData, contentType)
+				} else {
+					logger.Warnf(ctx, "getBytesByUrl error: %v", err)
+				}
 			}
 
 			result.Data = append(result.Data, data)
 		}
 
 		// Handle successful case
-		if len(result.Data) > 0 {
-			// Delete temporary session if needed
-			if config.AutoDelChat == 1 {
-				go func() {
-					client := cycletls.Init()
-					defer safeClose(client)
-					makeDeleteRequest(client, cookie, projectId)
-				}()
+		if lo.SomeBy(result.Data, func(d *model.OpenAIImagesGenerationDataResponse) bool { return d.Error == nil }) {
+			endAttempt(c, attemptOk)
+			bindImageSession(c, cookie, openAIReq.Model, projectId)
+			// Delete temporary session if needed; 已绑定的图像会话需保留供下一轮编辑
+			if config.AutoDelChat == 1 && !imageSessionEnabled(c) {
+				task.Go("delete-chat", func() {
+					client := tlsclient.New()
+					defer client.Release()
+					makeDeleteRequest(client.CycleTLS, cookie, projectId)
+				})
 			}
 			return result, nil
 		}
+		endAttempt(c, attemptNoContent)
 	}
 
 	// All retries exhausted
 	logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
+	alertNoValidCookies(c, openAIReq.Model, fmt.Sprintf("All cookies exhausted after %d attempts", maxRetries))
 	return nil, fmt.Errorf("all cookies are temporarily unavailable")
 }
+
+// imageTaskError 失败任务占位项的错误信息
+func imageTaskError(message string) *model.OpenAIError {
+	return &model.OpenAIError{
+		Message: message,
+		Type:    "image_generation_error",
+		Code:    "image_task_failed",
+	}
+}
+
 func extractTaskIDs(responseBody string) (string, []string) {
 	var taskIDs []string
 	var projectId string
@@ -1727,8 +2470,22 @@ func extractTaskIDs(responseBody string) (string, []string) {
 	return projectId, taskIDs
 }
 
-func pollTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []string, cookie string) []string {
-	var imageURLs []string
+// imageTaskResult 单个生图任务的结果,URL 为空时 Err 为失败原因
+type imageTaskResult struct {
+	URL string
+	Err string
+}
+
+// pollTaskStatus 轮询生图任务状态,结果与 taskIDs 一一对应(按提交顺序),未完成的任务记为失败
+func pollTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []string, cookie string) (results []imageTaskResult, err error) {
+	results = make([]imageTaskResult, len(taskIDs))
+	defer func() {
+		for i := range results {
+			if results[i].URL == "" && results[i].Err == "" {
+				results[i].Err = "image task did not complete"
+			}
+		}
+	}()
 
 	requestData := map[string]interface{}{
 		"task_ids": taskIDs,
@@ -1736,13 +2493,14 @@ func pollTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []string,
 
 	jsonData, err := json.Marshal(requestData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal request data"})
-		return imageURLs
+		c.JSON(http.StatusInternalServerError, errorBody(c, "Failed to marshal request data"))
+		return results, nil
 	}
 
-	sseChan, err := client.DoSSE("https://www.genspark.ai/api/ig_tasks_status", cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+	// 任务结束或被取消时关闭轮询的上游连接
+	sseChan, cancel, err := tlsclient.DoSSE(generationContext(c), "https://www.genspark.ai/api/ig_tasks_status", cycletls.Options{
+		Timeout: config.GetRuntimeConfig().Timeouts.Image,
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Body:    string(jsonData),
 		Method:  "POST",
 		Headers: map[string]string{
@@ -1756,12 +2514,15 @@ func pollTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []string,
 	}, "POST")
 	if err != nil {
 		logger.Errorf(c, "Failed to make stream request: %v", err)
-		return imageURLs
+		return results, nil
 	}
+	defer cancel()
+	chunkSampler := logger.NewChunkSampler(c.Request.Context())
+	defer chunkSampler.Close()
 	for response := range sseChan {
 		if response.Done {
 			//logger.Warnf(c.Request.Context(), response.Data)
-			return imageURLs
+			return results, nil
 		}
 
 		data := response.Data
@@ -1769,59 +2530,75 @@ func pollTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []string,
 			continue
 		}
 
-		logger.Debug(c.Request.Context(), strings.TrimSpace(data))
+		chunkSampler.Log(data)
 
 		var responseData map[string]interface{}
 		if err := json.Unmarshal([]byte(data), &responseData); err != nil {
 			continue
 		}
 
+		// 排队中的任务返回队列位置与预计等待时间,超过阈值时快速失败
+		if queue, ok := parseImageQueue(responseData); ok {
+			if err = checkImageQueue(c, queue); err != nil {
+				return results, err
+			}
+		}
+
 		if responseData["type"] == "TASKS_STATUS_COMPLETE" {
 			if finalStatus, ok := responseData["final_status"].(map[string]interface{}); ok {
-				for _, taskID := range taskIDs {
-					if task, exists := finalStatus[taskID].(map[string]interface{}); exists {
-						if status, ok := task["status"].(string); ok && status == "SUCCESS" {
-							if urls, ok := task["image_urls"].([]interface{}); ok && len(urls) > 0 {
-								if imageURL, ok := urls[0].(string); ok {
-									imageURLs = append(imageURLs, imageURL)
-								}
-							}
+				for i, taskID := range taskIDs {
+					task, exists := finalStatus[taskID].(map[string]interface{})
+					if !exists {
+						continue
+					}
+					status, _ := task["status"].(string)
+					if status != "SUCCESS" {
+						results[i] = imageTaskResult{Err: fmt.Sprintf("image task %s", strings.ToLower(lo.Ternary(status == "", "failed", status)))}
+						continue
+					}
+					if urls, ok := task["image_urls"].([]interface{}); ok && len(urls) > 0 {
+						if imageURL, ok := urls[0].(string); ok && imageURL != "" {
+							results[i] = imageTaskResult{URL: imageURL}
+							continue
 						}
 					}
+					results[i] = imageTaskResult{Err: "image task returned no url"}
 				}
 			}
 		}
 	}
 
-	return imageURLs
+	return results, nil
 }
 
 func getBase64ByUrl(url string) (string, error) {
-	resp, err := http.Get(url)
+	body, err := openLimitedUrl(url, int64(config.FileMaxSize)*1024*1024)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch image: %w", err)
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
-	}
-
-	imgData, err := io.ReadAll(resp.Body)
-	if err != nil {
+	// 流式编码,不在内存中保留完整的原始数据
+	var builder strings.Builder
+	encoder := base64.NewEncoder(base64.StdEncoding, &builder)
+	if _, err := io.Copy(encoder, body); err != nil {
 		return "", fmt.Errorf("failed to read image data: %w", err)
 	}
-
-	// Encode the image data to Base64
-	base64Str := base64.StdEncoding.EncodeToString(imgData)
-	return base64Str, nil
+	encoder.Close()
+	return builder.String(), nil
 }
 
-func safeClose(client cycletls.CycleTLS) {
-	if client.ReqChan != nil {
-		close(client.ReqChan)
+// getBytesByUrl 下载生图/生视频结果,大小上限为 RESULT_MAX_SIZE
+func getBytesByUrl(url string) ([]byte, error) {
+	body, err := openLimitedUrl(url, int64(config.ResultMaxSize)*1024*1024)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
 	}
-	if client.RespChan != nil {
-		close(client.RespChan)
+	defer body.Close()
+
+	imgData, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image data: %w", err)
 	}
+	return imgData, nil
 }
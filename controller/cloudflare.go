@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"net/http"
+	"time"
+)
+
+type cfSolverResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Solution struct {
+		Cookies []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"cookies"`
+	} `json:"solution"`
+}
+
+// solveCloudflare 调用过盾服务获取 cf_clearance,写回 cookie 池并返回新的 cookie
+func solveCloudflare(ctx context.Context, cookie string) (string, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"cmd":        "request.get",
+		"url":        baseURL,
+		"maxTimeout": config.CfSolverTimeout * 1000,
+	})
+	client := &http.Client{Timeout: time.Duration(config.CfSolverTimeout+10) * time.Second}
+	resp, err := client.Post(config.CfSolverUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var solverResp cfSolverResponse
+	if err := json.NewDecoder(resp.Body).Decode(&solverResp); err != nil {
+		return "", err
+	}
+	if solverResp.Status != "ok" {
+		return "", fmt.Errorf("cf solver failed: %s", solverResp.Message)
+	}
+
+	for _, item := range solverResp.Solution.Cookies {
+		if item.Name == "cf_clearance" && item.Value != "" {
+			newCookie := config.SetCookieField(cookie, "cf_clearance", item.Value)
+			config.ReplaceCookie(cookie, newCookie)
+			logger.Infof(ctx, "Cloudflare challenge solved, cf_clearance updated")
+			return newCookie, nil
+		}
+	}
+	return "", fmt.Errorf("cf solver returned no cf_clearance")
+}
+
+// retryWithCfSolver 检测到 Cloudflare Challenge 时尝试过盾(每个请求仅一次),成功时返回新的 cookie
+func retryWithCfSolver(ctx context.Context, cookie string, solved *bool) (string, bool) {
+	if config.CfSolverUrl == "" || *solved {
+		return cookie, false
+	}
+	*solved = true
+	newCookie, err := solveCloudflare(ctx, cookie)
+	if err != nil {
+		logger.Errorf(ctx, "Failed to solve Cloudflare challenge: %v", err)
+		return cookie, false
+	}
+	return newCookie, true
+}
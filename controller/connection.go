@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/connstat"
+	"genspark2api/common/tlsclient"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetConnectionStats 获取下游连接数与上游 cycletls 客户端指标
+func GetConnectionStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"connections":     connstat.Snapshot(),
+			"max_connections": config.ServerMaxConnections,
+			"h2c":             config.ServerH2C == 1,
+			"tls_clients":     tlsclient.Snapshot(),
+		},
+	})
+}
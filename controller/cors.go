@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// GetCorsConfig 获取跨域配置
+func GetCorsConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    config.GetCorsConfig(),
+	})
+}
+
+// UpdateCorsConfig 更新跨域配置,未传的字段保持不变
+func UpdateCorsConfig(c *gin.Context) {
+	cfg := config.GetCorsConfig()
+	if err := c.BindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+		})
+		return
+	}
+	if len(cfg.AllowOrigins) == 0 || len(cfg.AllowMethods) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminCorsEmpty),
+		})
+		return
+	}
+
+	if cfg.CredentialsWithWildcard() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminCorsCredentials),
+		})
+		return
+	}
+
+	config.SetCorsConfig(cfg)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cfg,
+	})
+}
+
+// Options /v1/* 的 OPTIONS 请求,无需鉴权;带 Origin 的合法预检已由 CORS 中间件处理,
+// 此处兜底未携带 Origin 或 Access-Control-Request-Method 的预检与探测请求
+func Options(c *gin.Context) {
+	cfg := config.GetCorsConfig()
+	methods := strings.Join(cfg.AllowMethods, ", ")
+	header := c.Writer.Header()
+	header.Set("Allow", methods)
+	header.Set("Access-Control-Allow-Methods", methods)
+	if allowHeaders := cfg.AllowHeadersFor(c.GetHeader("Access-Control-Request-Headers")); allowHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// HeadOk 返回空体 200,供健康探测使用,无需鉴权
+func HeadOk(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
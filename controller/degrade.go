@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/degrade"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetDegradeStats 获取降智检测统计
+func GetDegradeStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled": config.DegradeDetect == 1,
+			"models":  degrade.Snapshot(),
+		},
+	})
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/egress"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const diagnoseTimeout = 10 * time.Second
+
+type diagnoseStep struct {
+	Name      string `json:"name"`
+	Target    string `json:"target"`
+	Success   bool   `json:"success"`
+	LatencyMs int64  `json:"latency_ms"`
+	Detail    string `json:"detail,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Diagnose 连接诊断:DNS解析、TCP/TLS握手、代理连通性
+func Diagnose(c *gin.Context) {
+	target, _ := url.Parse(baseURL)
+	host := target.Hostname()
+	address := net.JoinHostPort(host, "443")
+
+	var steps []diagnoseStep
+
+	// DNS 解析
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), diagnoseTimeout)
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	cancel()
+	dnsStep := diagnoseStep{Name: "dns", Target: host, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		dnsStep.Error = err.Error()
+	} else {
+		dnsStep.Success = true
+		dnsStep.Detail = fmt.Sprintf("%v", addrs)
+	}
+	steps = append(steps, dnsStep)
+
+	// TCP 握手(IPv4/IPv6 各取一个地址)
+	var ipv4, ipv6 net.IP
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = addr.IP
+			}
+		} else if ipv6 == nil {
+			ipv6 = addr.IP
+		}
+	}
+	for _, ip := range []net.IP{ipv4, ipv6} {
+		if ip == nil {
+			continue
+		}
+		ipAddress := net.JoinHostPort(ip.String(), "443")
+		start = time.Now()
+		conn, err := net.DialTimeout("tcp", ipAddress, diagnoseTimeout)
+		tcpStep := diagnoseStep{Name: "tcp", Target: ipAddress, LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			tcpStep.Error = err.Error()
+		} else {
+			tcpStep.Success = true
+			conn.Close()
+		}
+		steps = append(steps, tcpStep)
+	}
+
+	// TLS 握手
+	start = time.Now()
+	tlsConn, err := tls.DialWithDialer(&net.Dialer{Timeout: diagnoseTimeout}, "tcp", address, &tls.Config{ServerName: host})
+	tlsStep := diagnoseStep{Name: "tls", Target: address, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		tlsStep.Error = err.Error()
+	} else {
+		tlsStep.Success = true
+		tlsStep.Detail = fmt.Sprintf("remote %s, version %s", tlsConn.RemoteAddr(), tls.VersionName(tlsConn.ConnectionState().Version))
+		tlsConn.Close()
+	}
+	steps = append(steps, tlsStep)
+
+	// HTTP 请求(配置了代理时经代理)
+	steps = append(steps, diagnoseHttp(baseURL))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"dns_server": config.DnsServer,
+			"force_ipv4": config.ForceIPv4 == 1,
+			"proxy":      egress.Proxy() != "",
+			"steps":      steps,
+		},
+	})
+}
+
+func diagnoseHttp(targetUrl string) diagnoseStep {
+	step := diagnoseStep{Name: "http", Target: targetUrl}
+	transport := &http.Transport{}
+	if proxy := egress.Proxy(); proxy != "" {
+		step.Name = "proxy"
+		proxyUrl, err := url.Parse(proxy)
+		if err != nil {
+			step.Error = err.Error()
+			return step
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+	client := &http.Client{Transport: transport, Timeout: diagnoseTimeout}
+	defer transport.CloseIdleConnections()
+
+	start := time.Now()
+	resp, err := client.Get(targetUrl)
+	step.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		step.Error = classifyProxyError(err).Error()
+		return step
+	}
+	defer resp.Body.Close()
+	step.Success = resp.StatusCode < http.StatusInternalServerError
+	step.Detail = fmt.Sprintf("status %d", resp.StatusCode)
+	return step
+}
@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"genspark2api/common/egress"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetEgressNodes 获取各出口节点的测速结果与当前选中的出口
+func GetEgressNodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    egress.Snapshot(),
+	})
+}
+
+// ProbeEgressNodes 立即对所有出口节点测速并重新选择出口
+func ProbeEgressNodes(c *gin.Context) {
+	egress.Probe()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    egress.Snapshot(),
+	})
+}
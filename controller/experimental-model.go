@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"genspark2api/common"
+	"genspark2api/common/autoroute"
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/tlsclient"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"net/http"
+	"strings"
+)
+
+// experimentalProbePrompt 探测文本模型时发送的消息
+const experimentalProbePrompt = "Reply with OK."
+
+// isTextModel 内置或加入白名单的文本模型
+func isTextModel(modelName string) bool {
+	return lo.Contains(common.TextModelList, modelName) ||
+		config.GlobalExperimentalModelManager.Is(modelName, config.ExperimentalModelText)
+}
+
+// isImageModel 内置或加入白名单的生图模型
+func isImageModel(modelName string) bool {
+	return lo.Contains(common.ImageModelList, modelName) ||
+		config.GlobalExperimentalModelManager.Is(modelName, config.ExperimentalModelImage)
+}
+
+// isVideoModel 内置或加入白名单的生视频模型
+func isVideoModel(modelName string) bool {
+	return lo.Contains(common.VideoModelList, modelName) ||
+		config.GlobalExperimentalModelManager.Is(modelName, config.ExperimentalModelVideo)
+}
+
+// listedModels 模型列表:内置模型、智能路由模型与探测未失败的实验模型
+func listedModels() []string {
+	models := append([]string{}, common.DefaultOpenaiModelList...)
+	if autoroute.Enabled() {
+		models = append(models, autoroute.ModelName)
+	}
+	for _, modelType := range []string{config.ExperimentalModelText, config.ExperimentalModelImage, config.ExperimentalModelVideo} {
+		models = append(models, config.GlobalExperimentalModelManager.Listed(modelType)...)
+	}
+	return models
+}
+
+// GetExperimentalModels 获取实验模型白名单
+func GetExperimentalModels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    config.GlobalExperimentalModelManager.List(),
+	})
+}
+
+// SetExperimentalModel 将模型加入白名单,文本模型加入后立即探测一次
+func SetExperimentalModel(c *gin.Context) {
+	var req struct {
+		Type string `json:"type"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+			})
+			return
+		}
+	}
+
+	id := strings.TrimPrefix(c.Param("id"), "/")
+	if lo.Contains(common.DefaultOpenaiModelList, id) || id == autoroute.ModelName {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminModelBuiltin, id),
+		})
+		return
+	}
+
+	experimentalModel, err := config.GlobalExperimentalModelManager.Set(id, req.Type)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if experimentalModel.Type == config.ExperimentalModelText {
+		experimentalModel = probeExperimentalModel(c, experimentalModel.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    experimentalModel,
+	})
+}
+
+// ProbeExperimentalModel 重新探测实验模型是否可用,仅文本模型会实际请求上游
+func ProbeExperimentalModel(c *gin.Context) {
+	id := strings.TrimSuffix(strings.TrimPrefix(c.Param("id"), "/"), "/probe")
+	experimentalModel, ok := config.GlobalExperimentalModelManager.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminModelNotFound),
+		})
+		return
+	}
+	if experimentalModel.Type == config.ExperimentalModelText {
+		experimentalModel = probeExperimentalModel(c, id)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    experimentalModel,
+	})
+}
+
+// DeleteExperimentalModel 将模型移出白名单
+func DeleteExperimentalModel(c *gin.Context) {
+	removed, err := config.GlobalExperimentalModelManager.Remove(strings.TrimPrefix(c.Param("id"), "/"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminModelNotFound),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// probeExperimentalModel 用一条简单消息请求上游,记录模型是否可用
+func probeExperimentalModel(c *gin.Context, id string) config.ExperimentalModel {
+	ctx := c.Request.Context()
+	probeErr := ""
+	cookie, err := newCookieManager(c, id).GetRandomCookie()
+	if err != nil {
+		probeErr = err.Error()
+	} else {
+		client := tlsclient.New()
+		content, err := completeText(c, client.CycleTLS, cookie, id, []model.OpenAIChatMessage{
+			{Role: "user", Content: experimentalProbePrompt},
+		})
+		client.Release()
+		if err != nil {
+			probeErr = err.Error()
+		} else if strings.TrimSpace(content) == "" {
+			probeErr = "empty response"
+		}
+	}
+
+	if probeErr != "" {
+		logger.Warnf(ctx, "experimental model %s probe failed: %s", id, probeErr)
+	} else {
+		logger.Infof(ctx, "experimental model %s probe succeeded", id)
+	}
+	experimentalModel, err := config.GlobalExperimentalModelManager.SetProbeResult(id, probeErr)
+	if err != nil {
+		logger.Errorf(ctx, "failed to save experimental model %s: %v", id, err)
+	}
+	return experimentalModel
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/metrics"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// feedbackTarget 可被反馈的响应所用的模型与 cookie
+type feedbackTarget struct {
+	tenantId string
+	model    string
+	cookieId string
+}
+
+// feedbackRecord FEEDBACK_PATH 中的一条反馈记录
+type feedbackRecord struct {
+	Time       time.Time `json:"time"`
+	ResponseId string    `json:"response_id"`
+	TenantId   string    `json:"tenant_id,omitempty"`
+	Model      string    `json:"model"`
+	Cookie     string    `json:"cookie"` // cookie 标识,非原始 cookie
+	Score      int       `json:"score,omitempty"`
+	Degraded   bool      `json:"degraded,omitempty"`
+	Negative   bool      `json:"negative"`
+	Comment    string    `json:"comment,omitempty"`
+}
+
+// feedbackCommentMaxLength 反馈备注的最大字符数
+const feedbackCommentMaxLength = 1000
+
+var (
+	feedbackTargets   sync.Map
+	feedbackFileMutex sync.Mutex
+)
+
+// recordFeedbackTarget 对话成功后按响应 ID 记录所用的模型与 cookie,FEEDBACK_EXPIRE_DURATION 内可反馈
+func recordFeedbackTarget(c *gin.Context, responseId string, modelName string, cookie string) {
+	if config.FeedbackExpireDuration <= 0 {
+		return
+	}
+	target := &feedbackTarget{model: modelName, cookieId: cookieIdentifier(cookie)}
+	if tenant, ok := getTenant(c); ok {
+		target.tenantId = tenant.ID
+	}
+	feedbackTargets.Store(responseId, target)
+	time.AfterFunc(time.Duration(config.FeedbackExpireDuration)*time.Second, func() {
+		feedbackTargets.CompareAndDelete(responseId, target)
+	})
+}
+
+// cookieIdentifier cookie 的标识,用于在反馈汇总中区分 cookie 而不暴露原始值
+func cookieIdentifier(cookie string) string {
+	sum := sha256.Sum256([]byte(cookie))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Feedback 对一次响应评分或标记降智,每个响应只能反馈一次,计入 /admin/metrics 的负反馈率
+func Feedback(c *gin.Context) {
+	var req model.FeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ResponseId == "" {
+		feedbackError(c, http.StatusBadRequest, i18n.InvalidRequest)
+		return
+	}
+	if req.Score < 0 || req.Score > 5 || (req.Score == 0 && !req.Degraded) {
+		feedbackError(c, http.StatusBadRequest, i18n.FeedbackInvalid)
+		return
+	}
+	if utf8.RuneCountInString(req.Comment) > feedbackCommentMaxLength {
+		feedbackError(c, http.StatusBadRequest, i18n.CommentTooLong)
+		return
+	}
+
+	value, ok := feedbackTargets.Load(req.ResponseId)
+	target, _ := value.(*feedbackTarget)
+	if tenant, hasTenant := getTenant(c); ok && hasTenant && tenant.ID != target.tenantId {
+		ok = false
+	}
+	if ok {
+		ok = feedbackTargets.CompareAndDelete(req.ResponseId, target)
+	}
+	if !ok {
+		feedbackError(c, http.StatusNotFound, i18n.FeedbackNotFound)
+		return
+	}
+
+	record := feedbackRecord{
+		Time:       time.Now(),
+		ResponseId: req.ResponseId,
+		TenantId:   target.tenantId,
+		Model:      target.model,
+		Cookie:     target.cookieId,
+		Score:      req.Score,
+		Degraded:   req.Degraded,
+		Negative:   req.Degraded || (req.Score > 0 && req.Score <= 2),
+		Comment:    req.Comment,
+	}
+	metrics.RecordFeedback(record.Model, record.Cookie, record.Negative)
+	if err := saveFeedback(record); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save feedback: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"object":      "feedback",
+		"response_id": record.ResponseId,
+		"model":       record.Model,
+		"negative":    record.Negative,
+	})
+}
+
+// feedbackError 按 i18n 消息 key 返回反馈接口的错误响应
+func feedbackError(c *gin.Context, status int, key string) {
+	c.JSON(status, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: i18n.Message(c, key),
+			Type:    "invalid_request_error",
+			Code:    fmt.Sprint(status),
+		},
+	})
+}
+
+// saveFeedback 配置了 FEEDBACK_PATH 时追加写入反馈记录
+func saveFeedback(record feedbackRecord) error {
+	if config.FeedbackPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	feedbackFileMutex.Lock()
+	defer feedbackFileMutex.Unlock()
+	file, err := os.OpenFile(config.FeedbackPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
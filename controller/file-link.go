@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/egress"
+	"genspark2api/common/i18n"
+	"genspark2api/common/tlsclient"
+	"genspark2api/model"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 产出文件事件中的链接、文件名、类型与大小字段
+var (
+	fileUrlKeys  = []string{"download_url", "file_url", "url"}
+	fileNameKeys = []string{"file_name", "filename", "name", "title"}
+	fileTypeKeys = []string{"mime_type", "content_type", "file_type"}
+	fileSizeKeys = []string{"file_size", "size"}
+)
+
+// fileLink 临时下载链接对应的上游文件
+type fileLink struct {
+	url      string
+	cookie   string
+	name     string
+	mimeType string
+}
+
+var (
+	fileLinks      = make(map[string]*fileLink)
+	fileLinksMutex sync.RWMutex
+)
+
+// collectAgentFiles 从 agent 步骤事件中提取扩展名在 FILE_LINK_EXTENSIONS 中的产出文件
+func collectAgentFiles(collector *agentCollector, event map[string]interface{}, cookie string) {
+	var walk func(value interface{}, depth int)
+	walk = func(value interface{}, depth int) {
+		if depth > 4 {
+			return
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				walk(item, depth+1)
+			}
+		case map[string]interface{}:
+			if attachment, upstreamUrl, ok := parseAttachment(v); ok && !lo.Contains(collector.fileUrls, upstreamUrl) {
+				collector.fileUrls = append(collector.fileUrls, upstreamUrl)
+				collector.files = append(collector.files, newFileLink(attachment, upstreamUrl, cookie))
+			}
+			for _, child := range v {
+				walk(child, depth+1)
+			}
+		}
+	}
+	walk(event, 0)
+}
+
+// parseAttachment 对象中包含文件链接且扩展名为产出文件时返回附件信息与上游链接
+func parseAttachment(object map[string]interface{}) (model.Attachment, string, bool) {
+	var upstreamUrl string
+	for _, key := range fileUrlKeys {
+		if value, ok := object[key].(string); ok && (strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")) {
+			upstreamUrl = value
+			break
+		}
+	}
+	if upstreamUrl == "" {
+		return model.Attachment{}, "", false
+	}
+
+	name := ""
+	for _, key := range fileNameKeys {
+		if value, ok := object[key].(string); ok && isFileExtension(path.Ext(value)) {
+			name = value
+			break
+		}
+	}
+	if name == "" {
+		parsed, err := url.Parse(upstreamUrl)
+		if err != nil || !isFileExtension(path.Ext(parsed.Path)) {
+			return model.Attachment{}, "", false
+		}
+		name, _ = url.PathUnescape(path.Base(parsed.Path))
+	}
+
+	attachment := model.Attachment{Name: name}
+	for _, key := range fileTypeKeys {
+		if value, ok := object[key].(string); ok && strings.Contains(value, "/") {
+			attachment.MimeType = value
+			break
+		}
+	}
+	if attachment.MimeType == "" {
+		attachment.MimeType = mime.TypeByExtension(path.Ext(name))
+	}
+	if attachment.MimeType == "" {
+		attachment.MimeType = "application/octet-stream"
+	}
+	for _, key := range fileSizeKeys {
+		if value, ok := object[key].(float64); ok && value > 0 {
+			attachment.Size = int64(value)
+			break
+		}
+	}
+	return attachment, upstreamUrl, true
+}
+
+func isFileExtension(ext string) bool {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "" {
+		return false
+	}
+	for _, item := range strings.Split(config.FileLinkExtensions, ",") {
+		if strings.ToLower(strings.TrimSpace(item)) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// newFileLink 生成经 /files 代理的临时下载链接,FILE_LINK_EXPIRE_DURATION 为 0 时直接返回上游链接
+func newFileLink(attachment model.Attachment, upstreamUrl string, cookie string) model.Attachment {
+	if config.FileLinkExpireDuration <= 0 {
+		attachment.Url = upstreamUrl
+		return attachment
+	}
+
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	id := hex.EncodeToString(token)
+	link := &fileLink{url: upstreamUrl, cookie: cookie, name: attachment.Name, mimeType: attachment.MimeType}
+	expire := time.Duration(config.FileLinkExpireDuration) * time.Second
+
+	fileLinksMutex.Lock()
+	fileLinks[id] = link
+	fileLinksMutex.Unlock()
+	time.AfterFunc(expire, func() {
+		fileLinksMutex.Lock()
+		delete(fileLinks, id)
+		fileLinksMutex.Unlock()
+	})
+
+	attachment.Url = fmt.Sprintf("%s/files/%s", fileLinkBaseUrl(), id)
+	attachment.ExpiresAt = time.Now().Add(expire).Unix()
+	return attachment
+}
+
+// fileLinkBaseUrl 下载链接的外部访问地址,未配置 FILE_LINK_BASE_URL 时只返回路由前缀(相对链接),
+// 不使用客户端可伪造的 Host 与 X-Forwarded-Proto 请求头
+func fileLinkBaseUrl() string {
+	if config.FileLinkBaseUrl != "" {
+		return strings.TrimSuffix(config.FileLinkBaseUrl, "/")
+	}
+	prefix := strings.Trim(config.RoutePrefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// attachmentList 产出文件的下载链接列表
+func attachmentList(files []model.Attachment) string {
+	var builder strings.Builder
+	for _, file := range files {
+		builder.WriteString(fmt.Sprintf("- [%s](%s)\n", file.Name, file.Url))
+	}
+	return builder.String()
+}
+
+// getAttachments 返回产出文件,作为响应的 attachments 字段
+func getAttachments(c *gin.Context) []model.Attachment {
+	return getAgentCollector(c).files
+}
+
+// DownloadFile 代理下载 agent 产出的文件,链接本身即凭证,无需鉴权
+func DownloadFile(c *gin.Context) {
+	fileLinksMutex.RLock()
+	link, ok := fileLinks[c.Param("id")]
+	fileLinksMutex.RUnlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.FileNotFound),
+				Type:    "invalid_request_error",
+				Code:    "404",
+			},
+		})
+		return
+	}
+
+	headers := map[string]string{
+		"User-Agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome",
+	}
+	// 仅向 genspark 站内链接携带 cookie
+	if parsed, err := url.Parse(link.url); err == nil {
+		if host := parsed.Hostname(); host == "genspark.ai" || strings.HasSuffix(host, ".genspark.ai") {
+			headers["Cookie"] = link.cookie
+		}
+	}
+	// 与其他上游请求一致,使用 cycletls 指纹并经出口代理,响应体直接转发
+	resp, err := tlsclient.DoStream(c.Request.Context(), link.url, cycletls.Options{
+		Timeout: config.GetRuntimeConfig().Timeouts.Upload,
+		Proxy:   egress.Proxy(),
+		Headers: headers,
+	}, http.MethodGet)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, errorBody(c, classifyProxyError(err).Error()))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.JSON(http.StatusBadGateway, errorBody(c, fmt.Sprintf("upstream file status code: %d", resp.StatusCode)))
+		return
+	}
+
+	extraHeaders := map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(link.name)),
+	}
+	c.DataFromReader(http.StatusOK, resp.ContentLength, link.mimeType, resp.Body, extraHeaders)
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"genspark2api/common/fingerprint"
+	"genspark2api/common/i18n"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetFingerprints 获取当前生效的错误页指纹规则及样本库的校验结果
+func GetFingerprints(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"rules":   fingerprint.Rules(),
+			"samples": fingerprint.VerifySamples(),
+		},
+	})
+}
+
+// ClassifyFingerprint 用当前规则识别一段上游响应所属的错误类别,未命中时为空
+func ClassifyFingerprint(c *gin.Context) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"category": fingerprint.Classify(req.Text),
+		},
+	})
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/task"
+	"genspark2api/common/tlsclient"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+)
+
+// 生成任务类型
+const (
+	generationImage = "image"
+	generationVideo = "video"
+)
+
+// errGenerationCancelled 生成任务已通过取消接口取消
+var errGenerationCancelled = errors.New("generation task cancelled")
+
+// statusClientClosedRequest 任务被取消时原请求的状态码(nginx 的 499 Client Closed Request)
+const statusClientClosedRequest = 499
+
+// generationTask 进行中的生图/生视频任务,以请求 ID 标识,可通过 DELETE /v1/{images,videos}/tasks/:id 取消。
+// 请求 ID 即响应头 X-Request-Id,非流式请求的响应头在任务结束后才返回,需由调用方在请求头中自行指定才能随时取消
+type generationTask struct {
+	kind      string
+	tenantId  string
+	ctx       context.Context // 任务结束或被取消时结束,轮询请求随之关闭上游连接
+	stop      context.CancelFunc
+	mu        sync.Mutex
+	cancelled bool
+}
+
+var generationTasks sync.Map
+
+// startGenerationTask 登记生成任务,返回结束函数
+func startGenerationTask(c *gin.Context, kind string) func() {
+	requestId := c.GetString(helper.RequestIdKey)
+	if requestId == "" {
+		return func() {}
+	}
+	// 客户端断开后生成仍会继续,不随请求的 context 结束
+	ctx, stop := context.WithCancel(context.Background())
+	generation := &generationTask{kind: kind, ctx: ctx, stop: stop}
+	if tenant, ok := getTenant(c); ok {
+		generation.tenantId = tenant.ID
+	}
+	generationTasks.Store(requestId, generation)
+	c.Set(helper.GenerationTaskKey, generation)
+	return func() {
+		generation.stop()
+		generationTasks.CompareAndDelete(requestId, generation)
+	}
+}
+
+func getGenerationTask(c *gin.Context) (*generationTask, bool) {
+	if generation, ok := c.Get(helper.GenerationTaskKey); ok {
+		return generation.(*generationTask), true
+	}
+	return nil, false
+}
+
+// cancel 取消任务,进行中的轮询随即结束
+func (t *generationTask) cancel() {
+	t.mu.Lock()
+	t.cancelled = true
+	t.mu.Unlock()
+	t.stop()
+}
+
+// generationCancelled 当前请求的生成任务是否已被取消
+func generationCancelled(c *gin.Context) bool {
+	generation, ok := getGenerationTask(c)
+	if !ok {
+		return false
+	}
+	generation.mu.Lock()
+	defer generation.mu.Unlock()
+	return generation.cancelled
+}
+
+// abortGeneration 任务被取消后尽力删除上游会话,释放 cookie 的生成占用
+func abortGeneration(c *gin.Context, cookie string, projectId string) error {
+	endAttempt(c, attemptInterrupted)
+	logger.Infof(c.Request.Context(), "Generation task cancelled, deleting chat %s", projectId)
+	task.Go("delete-chat", func() {
+		client := tlsclient.New()
+		defer client.Release()
+		makeDeleteRequest(client.CycleTLS, cookie, projectId)
+	})
+	return errGenerationCancelled
+}
+
+// generationContext 轮询任务状态使用的 context,生成任务结束或被取消时结束;未登记任务时不会主动结束
+func generationContext(c *gin.Context) context.Context {
+	if generation, ok := getGenerationTask(c); ok {
+		return generation.ctx
+	}
+	return context.Background()
+}
+
+// respondGenerationCancelled 任务已通过取消接口取消时以 499 结束原请求
+func respondGenerationCancelled(c *gin.Context, err error) bool {
+	if !errors.Is(err, errGenerationCancelled) {
+		return false
+	}
+	c.JSON(statusClientClosedRequest, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: i18n.Message(c, i18n.TaskCancelled),
+			Type:    "invalid_request_error",
+			Code:    "cancelled",
+		},
+	})
+	return true
+}
+
+// CancelImageTask 取消进行中的生图任务
+func CancelImageTask(c *gin.Context) {
+	cancelGenerationTask(c, generationImage)
+}
+
+// CancelVideoTask 取消进行中的生视频任务
+func CancelVideoTask(c *gin.Context) {
+	cancelGenerationTask(c, generationVideo)
+}
+
+// cancelGenerationTask 按请求 ID 取消生成任务,多租户模式下仅能取消本租户的任务
+func cancelGenerationTask(c *gin.Context, kind string) {
+	id := c.Param("id")
+	value, ok := generationTasks.Load(id)
+	generation, _ := value.(*generationTask)
+	if ok && generation.kind != kind {
+		ok = false
+	}
+	if tenant, hasTenant := getTenant(c); ok && hasTenant && tenant.ID != generation.tenantId {
+		ok = false
+	}
+	if ok {
+		ok = generationTasks.CompareAndDelete(id, generation)
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.TaskNotFound),
+				Type:    "invalid_request_error",
+				Code:    "404",
+			},
+		})
+		return
+	}
+
+	generation.cancel()
+	c.JSON(http.StatusOK, gin.H{
+		"id":     id,
+		"object": kind + ".task",
+		"status": "cancelled",
+	})
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"errors"
+	"genspark2api/common/guard"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+var errContentFiltered = errors.New("content filtered")
+
+// recordGuardHit 记录内容守卫命中,写入日志与审计
+func recordGuardHit(c *gin.Context, direction string, result guard.Result) {
+	logger.Warnf(c.Request.Context(), "content guard hit, direction: %s, blocked: %v, reason: %s", direction, result.Blocked, result.Reason)
+	c.Set(helper.ContentGuardKey, gin.H{
+		"direction": direction,
+		"blocked":   result.Blocked,
+		"reason":    result.Reason,
+	})
+}
+
+// guardMessages 检查入站用户消息,命中阻断时返回 content_filter 错误,命中脱敏时替换消息内容
+func guardMessages(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) bool {
+	if !guard.Enabled() {
+		return true
+	}
+
+	check := func(text string) (string, bool) {
+		result := guard.Check(guard.DirectionInput, text, true)
+		if !result.Hit {
+			return text, true
+		}
+		recordGuardHit(c, guard.DirectionInput, result)
+		if result.Blocked {
+			c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+				OpenAIError: model.OpenAIError{
+					Message: i18n.Message(c, i18n.ContentFilter),
+					Type:    "invalid_request_error",
+					Code:    "content_filter",
+				},
+			})
+			return "", false
+		}
+		return result.Text, true
+	}
+
+	for i, message := range openAIReq.Messages {
+		if message.Role != "user" {
+			continue
+		}
+		switch content := message.Content.(type) {
+		case string:
+			text, ok := check(content)
+			if !ok {
+				return false
+			}
+			openAIReq.Messages[i].Content = text
+		case []interface{}:
+			for _, item := range content {
+				contentMap, ok := item.(map[string]interface{})
+				if !ok || contentMap["type"] != "text" {
+					continue
+				}
+				if text, ok := contentMap["text"].(string); ok {
+					if contentMap["text"], ok = check(text); !ok {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+// guardOutput 检查出站回复,返回处理后的文本与是否被阻断
+func guardOutput(c *gin.Context, text string, useWebhook bool) (string, bool) {
+	if !guard.Enabled() {
+		return text, false
+	}
+	result := guard.Check(guard.DirectionOutput, text, useWebhook)
+	if result.Hit {
+		recordGuardHit(c, guard.DirectionOutput, result)
+	}
+	return result.Text, result.Blocked
+}
+
+// guardStreamDelta 在滑动缓冲上检查流式增量,返回可输出的文本与是否被阻断,flush 为 true 时一并输出暂存的文本
+func guardStreamDelta(c *gin.Context, delta string, flush bool) (string, bool) {
+	if !guard.Enabled() {
+		return delta, false
+	}
+	stream := getGuardStream(c)
+	text, result := stream.Write(delta)
+	if result.Hit {
+		recordGuardHit(c, guard.DirectionOutput, result)
+	}
+	if result.Blocked {
+		return "", true
+	}
+	if flush {
+		text += stream.Flush()
+	}
+	return text, false
+}
+
+// finishContentFiltered 出站内容被阻断时以 finish_reason=content_filter 结束流式响应
+func finishContentFiltered(c *gin.Context, responseId, modelName string, jsonData []byte) error {
+	finishReason := "content_filter"
+	if err := sendSSEvent(c, createStreamResponse(responseId, modelName, jsonData, model.OpenAIDelta{Role: "assistant"}, &finishReason)); err != nil {
+		return err
+	}
+	c.SSEvent("", " [DONE]")
+	return nil
+}
+
+// resetGuardStream 每次请求上游前清空暂存的文本
+func resetGuardStream(c *gin.Context) {
+	c.Set(helper.GuardStreamKey, &guard.Stream{})
+}
+
+func getGuardStream(c *gin.Context) *guard.Stream {
+	if stream, ok := c.Get(helper.GuardStreamKey); ok {
+		return stream.(*guard.Stream)
+	}
+	stream := &guard.Stream{}
+	c.Set(helper.GuardStreamKey, stream)
+	return stream
+}
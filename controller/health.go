@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"genspark2api/common"
+	"genspark2api/common/overload"
+	"genspark2api/common/task"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Health 健康检查(无需鉴权),只返回服务状态与版本;降级模式下仍返回 200(聊天可用),通过 status 标记为 degraded
+func Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"status":  healthStatus(),
+			"version": common.Version,
+		},
+	})
+}
+
+// HealthDetail 管理接口的健康检查,额外返回负载采样、后台任务与守护任务
+func HealthDetail(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"status":   healthStatus(),
+			"version":  common.Version,
+			"overload": overload.GetStatus(),
+			"tasks":    task.Running(),
+			"daemons":  task.Daemons(),
+		},
+	})
+}
+
+func healthStatus() string {
+	if overload.Degraded() {
+		return "degraded"
+	}
+	return "ok"
+}
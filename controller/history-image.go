@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"encoding/json"
+	"genspark2api/common/bodystat"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/uploadcache"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// processHistoryImage 将历史消息中的图片上传为文件,同一 cookie 下相同的图片(链接或 base64 数据)复用已上传的 private_storage_url
+func processHistoryImage(c *gin.Context, client cycletls.CycleTLS, cookie string, url string) (map[string]interface{}, error) {
+	replacedBytes := 0
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		replacedBytes = len(url)
+	}
+	privateFile, reused, err := uploadImage(c, client, cookie, url)
+	if err != nil {
+		return nil, err
+	}
+	bodystat.RecordHistoryImage(reused, replacedBytes)
+	return privateFile, nil
+}
+
+// uploadImage 将图片(链接或 base64 数据)上传为 private_file,同一 cookie 下相同的图片直接复用,reused 表示是否复用
+func uploadImage(c *gin.Context, client cycletls.CycleTLS, cookie string, url string) (privateFile map[string]interface{}, reused bool, err error) {
+	key := uploadcache.SourceKey(cookie, url)
+	if privateFile, ok := uploadcache.Get(key); ok {
+		return privateFile, true, nil
+	}
+
+	maxSize := int64(config.FileMaxSize) * 1024 * 1024
+	var reader io.Reader
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		body, err := openLimitedUrl(url, maxSize)
+		if err != nil {
+			return nil, false, err
+		}
+		defer body.Close()
+		reader = body
+	} else {
+		reader = openLimitedBase64(url, maxSize)
+	}
+
+	contentType, reader, err := sniffContentType(reader)
+	if err != nil {
+		return nil, false, err
+	}
+	ext := "bin"
+	if parts := strings.SplitN(strings.Split(contentType, ";")[0], "/", 2); len(parts) == 2 {
+		ext = parts[1]
+	}
+	privateFile, err = uploadPrivateFile(c, client, cookie, reader, "image."+ext, contentType, ext)
+	if err != nil {
+		return nil, false, err
+	}
+
+	uploadcache.Put(key, privateFile)
+	return privateFile, false, nil
+}
+
+// recordRequestSize 记录客户端请求体与发往上游的请求体大小
+func recordRequestSize(c *gin.Context, requestBody map[string]interface{}, trimmed int) {
+	data, err := json.Marshal(requestBody)
+	if err != nil {
+		return
+	}
+	bodystat.RecordRequest(c.Request.ContentLength, int64(len(data)), trimmed)
+	logger.Debugf(c.Request.Context(), "request body size: inbound=%d upstream=%d trimmed_messages=%d", c.Request.ContentLength, len(data), trimmed)
+}
+
+// GetRequestSizeStats 获取对话请求体积与历史图片复用统计
+func GetRequestSizeStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"stats":        bodystat.Snapshot(),
+			"upload_cache": uploadcache.Snapshot(),
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// 上游任务状态事件中的队列位置与预计等待时间(秒)字段,位于事件顶层
+const (
+	imageQueuePositionKey = "queue_position"
+	imageQueueWaitKey     = "estimated_wait_time"
+)
+
+// imageQueueError 排队超过 IMAGE_QUEUE_MAX_POSITION/IMAGE_QUEUE_MAX_WAIT 时快速失败
+type imageQueueError struct {
+	queue model.ImageQueue
+}
+
+func (e *imageQueueError) Error() string {
+	return fmt.Sprintf("image queue too long: position %d, estimated wait %ds", e.queue.Position, e.queue.EstimatedWait)
+}
+
+// imageQueueReporter 收到新的排队状态时回调,流式请求用于下发进度
+type imageQueueReporter func(queue model.ImageQueue)
+
+// parseImageQueue 从任务状态事件顶层的 queue_position 与 estimated_wait_time 字段提取排队状态,
+// 事件中没有排队信息时返回 false;不在其他字段或嵌套对象中猜测,避免误把无关数值当作排队状态
+func parseImageQueue(event map[string]interface{}) (model.ImageQueue, bool) {
+	var queue model.ImageQueue
+	position, hasPosition := queueNumber(event[imageQueuePositionKey])
+	wait, hasWait := queueNumber(event[imageQueueWaitKey])
+	if hasPosition {
+		queue.Position = position
+	}
+	if hasWait {
+		queue.EstimatedWait = wait
+	}
+	return queue, hasPosition || hasWait
+}
+
+func queueNumber(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), v >= 0
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil && n >= 0
+	}
+	return 0, false
+}
+
+// checkImageQueue 排队状态变化时回调 imageQueueReporter,超过阈值时返回错误
+func checkImageQueue(c *gin.Context, queue model.ImageQueue) error {
+	if last, ok := c.Get(helper.ImageQueueKey); !ok || last.(model.ImageQueue) != queue {
+		c.Set(helper.ImageQueueKey, queue)
+		if reporter, ok := c.Get(helper.ImageQueueReporterKey); ok {
+			reporter.(imageQueueReporter)(queue)
+		}
+	}
+	if (config.ImageQueueMaxPosition > 0 && queue.Position > config.ImageQueueMaxPosition) ||
+		(config.ImageQueueMaxWait > 0 && queue.EstimatedWait > config.ImageQueueMaxWait) {
+		return &imageQueueError{queue: queue}
+	}
+	return nil
+}
+
+// imageErrorMessage 生图失败的错误信息,排队过长时按请求语言返回
+func imageErrorMessage(c *gin.Context, err error) string {
+	var queueErr *imageQueueError
+	if errors.As(err, &queueErr) {
+		return i18n.Message(c, i18n.ImageQueueTooLong, queueErr.queue.Position, queueErr.queue.EstimatedWait)
+	}
+	return err.Error()
+}
+
+// respondImageQueueError 排队过长时返回 503 及排队状态,有预计等待时间时设置 Retry-After;其他错误返回 false
+func respondImageQueueError(c *gin.Context, err error) bool {
+	var queueErr *imageQueueError
+	if !errors.As(err, &queueErr) {
+		return false
+	}
+	if queueErr.queue.EstimatedWait > 0 {
+		c.Header("Retry-After", strconv.Itoa(queueErr.queue.EstimatedWait))
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": model.OpenAIError{
+			Message: imageErrorMessage(c, err),
+			Type:    "server_error",
+			Code:    "image_queue_too_long",
+		},
+		"image_queue": queueErr.queue,
+	})
+	return true
+}
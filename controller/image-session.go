@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+)
+
+// markImageSession 经 chat 接口调用图像模型时绑定上游图像会话,消息中已有助手回复(多轮编辑)时复用已绑定的会话,
+// 否则新建会话并重新绑定
+func markImageSession(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) {
+	if config.AutoModelChatMapType != 1 || len(config.SessionImageChatMap) != 0 {
+		return
+	}
+	reuse := false
+	for _, message := range openAIReq.Messages {
+		if message.Role == "assistant" {
+			reuse = true
+			break
+		}
+	}
+	c.Set(helper.ImageSessionKey, reuse)
+}
+
+// imageSessionEnabled 本次生图是否绑定上游图像会话
+func imageSessionEnabled(c *gin.Context) bool {
+	_, ok := c.Get(helper.ImageSessionKey)
+	return ok
+}
+
+// imageSessionReused 本次生图是否复用已绑定的上游图像会话
+func imageSessionReused(c *gin.Context) bool {
+	return c.GetBool(helper.ImageSessionKey)
+}
+
+// selectImageSessionCookie 优先使用已绑定图像会话的 cookie,使连续的编辑指令作用于同一图像会话
+func selectImageSessionCookie(c *gin.Context, cookieManager *config.CookieManager, modelName string, cookie string) string {
+	if !imageSessionReused(c) {
+		return cookie
+	}
+	namespace := sessionNamespace(c)
+	if _, ok := config.GlobalSessionManager.GetChatID(namespace, cookie, modelName); ok {
+		return cookie
+	}
+	for _, candidate := range cookieManager.Cookies {
+		if _, ok := config.GlobalSessionManager.GetChatID(namespace, candidate, modelName); ok && cookieManager.SelectCookie(candidate) {
+			return candidate
+		}
+	}
+	return cookie
+}
+
+// imageSessionChatId cookie 绑定的图像会话 ID,未绑定时返回空字符串(新建会话)
+func imageSessionChatId(c *gin.Context, cookie string, modelName string) string {
+	if !imageSessionReused(c) {
+		return ""
+	}
+	chatId, _ := config.GlobalSessionManager.GetChatID(sessionNamespace(c), cookie, modelName)
+	return chatId
+}
+
+// bindImageSession 生图成功后绑定 cookie 的图像会话并解除其他 cookie 上的绑定,使下一轮编辑作用于最新的图像,
+// 绑定的会话不会被自动删除
+func bindImageSession(c *gin.Context, cookie string, modelName string, chatId string) {
+	if !imageSessionEnabled(c) || chatId == "" {
+		return
+	}
+	namespace := sessionNamespace(c)
+	for _, other := range getCookiePool(c) {
+		if other != cookie {
+			config.GlobalSessionManager.DeleteSession(namespace, other, modelName)
+		}
+	}
+	config.GlobalSessionManager.AddSession(namespace, cookie, modelName, chatId)
+}
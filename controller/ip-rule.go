@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type ipRuleRequest struct {
+	Type     string `json:"type"`
+	Cidr     string `json:"cidr"`
+	Reason   string `json:"reason"`
+	Duration int64  `json:"duration"` // 封禁时长(秒),0 表示永久
+}
+
+// GetIpRules 获取IP黑白名单规则
+func GetIpRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    config.GlobalIpRuleManager.List(),
+	})
+}
+
+// AddIpRule 添加IP黑白名单规则
+func AddIpRule(c *gin.Context) {
+	var req ipRuleRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+		})
+		return
+	}
+
+	rule, err := config.GlobalIpRuleManager.Add(req.Type, req.Cidr, req.Reason, time.Duration(req.Duration)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rule,
+	})
+}
+
+// DeleteIpRule 删除IP黑白名单规则
+func DeleteIpRule(c *gin.Context) {
+	removed, err := config.GlobalIpRuleManager.Remove(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminRuleNotFound),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"genspark2api/common/helper"
+	"genspark2api/common/linkrewrite"
+	"github.com/gin-gonic/gin"
+)
+
+// rewriteStreamDelta 重写流式增量中的内链,未完成的链接暂存到下一次增量
+func rewriteStreamDelta(c *gin.Context, delta string) string {
+	if !linkrewrite.Enabled() {
+		return delta
+	}
+	return getStreamRewriter(c).Write(delta)
+}
+
+// flushStreamRewriter 输出流式重写中暂存的文本
+func flushStreamRewriter(c *gin.Context) string {
+	if !linkrewrite.Enabled() {
+		return ""
+	}
+	return getStreamRewriter(c).Flush()
+}
+
+func getStreamRewriter(c *gin.Context) *linkrewrite.StreamRewriter {
+	if rewriter, ok := c.Get(helper.LinkRewriterKey); ok {
+		return rewriter.(*linkrewrite.StreamRewriter)
+	}
+	rewriter := &linkrewrite.StreamRewriter{}
+	c.Set(helper.LinkRewriterKey, rewriter)
+	return rewriter
+}
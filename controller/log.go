@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+const maxLogLines = 2000
+
+// GetLogs 在线查看当前日志文件的最后若干行
+func GetLogs(c *gin.Context) {
+	logType := c.DefaultQuery("type", logger.LogTypeAccess)
+	if logType != logger.LogTypeAccess && logType != logger.LogTypeError {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminLogTypeInvalid),
+		})
+		return
+	}
+
+	lines, err := strconv.Atoi(c.DefaultQuery("lines", "200"))
+	if err != nil || lines <= 0 {
+		lines = 200
+	}
+	if lines > maxLogLines {
+		lines = maxLogLines
+	}
+
+	logs, err := logger.TailLog(logType, lines)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+	})
+}
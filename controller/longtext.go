@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"strings"
+	"unicode/utf8"
+)
+
+const longTextNotice = "The full content of this message is in the attached file %s, please read it and respond accordingly."
+
+// convertLongText 将超过阈值的文本转为 txt 文件上传,并在消息中以附件形式引用
+func convertLongText(c *gin.Context, client cycletls.CycleTLS, cookie string, content interface{}) (interface{}, error) {
+	if config.LongTextFileThreshold <= 0 {
+		return content, nil
+	}
+
+	switch v := content.(type) {
+	case string:
+		if utf8.RuneCountInString(v) <= config.LongTextFileThreshold {
+			return content, nil
+		}
+		return uploadLongText(c, client, cookie, v, 1)
+	case []interface{}:
+		var result []interface{}
+		index := 0
+		for _, item := range v {
+			contentMap, ok := item.(map[string]interface{})
+			if !ok || contentMap["type"] != "text" {
+				result = append(result, item)
+				continue
+			}
+			text, _ := contentMap["text"].(string)
+			if utf8.RuneCountInString(text) <= config.LongTextFileThreshold {
+				result = append(result, item)
+				continue
+			}
+			index++
+			parts, err := uploadLongText(c, client, cookie, text, index)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, parts...)
+		}
+		return result, nil
+	}
+	return content, nil
+}
+
+// uploadLongText 上传文本文件,返回说明文本与 private_file 附件
+func uploadLongText(c *gin.Context, client cycletls.CycleTLS, cookie string, text string, index int) ([]interface{}, error) {
+	name := fmt.Sprintf("message-%d.txt", index)
+	privateFile, err := uploadPrivateFile(c, client, cookie, strings.NewReader(text), name, "text/plain", "txt")
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		map[string]interface{}{"type": "text", "text": fmt.Sprintf(longTextNotice, name)},
+		privateFile,
+	}, nil
+}
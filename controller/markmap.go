@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"regexp"
+	"strings"
+)
+
+const (
+	markmapOutputText    = "text"
+	markmapOutputMermaid = "mermaid"
+	markmapOutputJson    = "json"
+	markmapOutputHide    = "hide"
+)
+
+var (
+	markmapHeadingRegex = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	markmapItemRegex    = regexp.MustCompile(`^([ \t]*)(?:[-*+]|\d+[.)])\s+(.*)$`)
+	markmapLinkRegex    = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	// mermaid mindmap 中括号类字符会被解析为节点形状,替换为全角字符
+	mermaidTextReplacer = strings.NewReplacer("(", "（", ")", "）", "[", "【", "]", "】", "{", "｛", "}", "｝", `"`, "'", "`", "'")
+)
+
+// markmapCollector 收集一次请求中的思维导图(markdown 大纲)
+type markmapCollector struct {
+	text string
+	sent bool
+}
+
+func getMarkmapCollector(c *gin.Context) *markmapCollector {
+	if collector, ok := c.Get(helper.MarkmapKey); ok {
+		return collector.(*markmapCollector)
+	}
+	collector := &markmapCollector{}
+	c.Set(helper.MarkmapKey, collector)
+	return collector
+}
+
+// resetMarkmap 换 cookie 重试前清空已收集的思维导图
+func resetMarkmap(c *gin.Context) {
+	c.Set(helper.MarkmapKey, &markmapCollector{})
+}
+
+// markmapCollected 思维导图字段是否由收集器处理(不作为普通文本下发)
+func markmapCollected() bool {
+	return config.MarkmapOutput != markmapOutputText
+}
+
+// collectMarkmap 记录思维导图字段事件,message_field 事件为完整值,message_field_delta 事件为增量
+func collectMarkmap(c *gin.Context, eventType string, value string) {
+	if config.MarkmapOutput != markmapOutputMermaid && config.MarkmapOutput != markmapOutputJson {
+		return
+	}
+	collector := getMarkmapCollector(c)
+	if eventType == "message_field" {
+		collector.text = value
+	} else {
+		collector.text += value
+	}
+}
+
+// takeMarkmapMermaid mermaid 模式下返回追加在答案末尾的 mindmap 代码块,每次请求只返回一次
+func takeMarkmapMermaid(c *gin.Context) string {
+	if config.MarkmapOutput != markmapOutputMermaid {
+		return ""
+	}
+	collector := getMarkmapCollector(c)
+	if collector.sent {
+		return ""
+	}
+	collector.sent = true
+	root := parseMarkmap(collector.text)
+	if root == nil {
+		return ""
+	}
+	return "\n\n" + markmapToMermaid(root)
+}
+
+// getMarkmap json 模式下返回思维导图的节点树,作为响应的 markmap 字段
+func getMarkmap(c *gin.Context) *model.MarkmapNode {
+	if config.MarkmapOutput != markmapOutputJson {
+		return nil
+	}
+	return parseMarkmap(getMarkmapCollector(c).text)
+}
+
+// parseMarkmap 将 markmap 的 markdown 大纲(标题与列表)解析为节点树,多个顶层节点时以 Mind Map 为根
+func parseMarkmap(text string) *model.MarkmapNode {
+	type entry struct {
+		level int
+		node  *model.MarkmapNode
+	}
+	virtual := &model.MarkmapNode{Text: "Mind Map"}
+	stack := []entry{{level: 0, node: virtual}}
+	headingLevel := 0
+	inFence, inFrontMatter := false, false
+
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if i == 0 && trimmed == "---" {
+			inFrontMatter = true
+			continue
+		}
+		if inFrontMatter {
+			inFrontMatter = trimmed != "---"
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || trimmed == "" {
+			continue
+		}
+
+		var level int
+		var nodeText string
+		if groups := markmapHeadingRegex.FindStringSubmatch(trimmed); groups != nil {
+			level, nodeText = len(groups[1]), groups[2]
+			headingLevel = level
+		} else if groups := markmapItemRegex.FindStringSubmatch(line); groups != nil {
+			indent := len(strings.ReplaceAll(groups[1], "\t", "  "))
+			level, nodeText = headingLevel+1+indent/2, groups[2]
+		} else {
+			level, nodeText = headingLevel+1, trimmed
+		}
+		nodeText = cleanMarkmapText(nodeText)
+		if nodeText == "" {
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].level >= level {
+			stack = stack[:len(stack)-1]
+		}
+		node := &model.MarkmapNode{Text: nodeText}
+		parent := stack[len(stack)-1].node
+		parent.Children = append(parent.Children, node)
+		stack = append(stack, entry{level: level, node: node})
+	}
+
+	switch len(virtual.Children) {
+	case 0:
+		return nil
+	case 1:
+		return virtual.Children[0]
+	}
+	return virtual
+}
+
+// cleanMarkmapText 去掉节点文本中的 markdown 链接与强调标记
+func cleanMarkmapText(text string) string {
+	text = markmapLinkRegex.ReplaceAllString(text, "$1")
+	text = strings.NewReplacer("**", "", "__", "", "~~", "").Replace(text)
+	return strings.TrimSpace(text)
+}
+
+// markmapToMermaid 生成 mermaid mindmap 代码块
+func markmapToMermaid(root *model.MarkmapNode) string {
+	var builder strings.Builder
+	builder.WriteString("```mermaid\nmindmap\n")
+	builder.WriteString("  root((" + mermaidTextReplacer.Replace(root.Text) + "))\n")
+	var write func(nodes []*model.MarkmapNode, depth int)
+	write = func(nodes []*model.MarkmapNode, depth int) {
+		for _, node := range nodes {
+			builder.WriteString(strings.Repeat("  ", depth) + mermaidTextReplacer.Replace(node.Text) + "\n")
+			write(node.Children, depth+1)
+		}
+	}
+	write(root.Children, 2)
+	builder.WriteString("```")
+	return builder.String()
+}
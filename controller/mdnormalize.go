@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/mdnormalize"
+	"github.com/gin-gonic/gin"
+)
+
+// markdownNormalizeEnabled 是否规范化输出的 markdown,请求字段 normalize_markdown 优先于特性开关
+func markdownNormalizeEnabled(c *gin.Context) bool {
+	if enabled, ok := c.Get(helper.MarkdownNormalizeKey); ok {
+		return enabled.(bool)
+	}
+	return flagEnabled(c, config.FlagMarkdownNormalize)
+}
+
+// normalizeMarkdown 规范化非流式输出的完整文本
+func normalizeMarkdown(c *gin.Context, content string) string {
+	if !markdownNormalizeEnabled(c) {
+		return content
+	}
+	return mdnormalize.Normalize(content)
+}
+
+// normalizeStreamDelta 规范化流式增量,未完成的行暂存到下一次增量
+func normalizeStreamDelta(c *gin.Context, delta string) string {
+	if !markdownNormalizeEnabled(c) {
+		return delta
+	}
+	return getStreamNormalizer(c).Write(delta)
+}
+
+// flushStreamNormalizer 输出流式规范化中暂存的文本,并闭合未闭合的代码块
+func flushStreamNormalizer(c *gin.Context) string {
+	if !markdownNormalizeEnabled(c) {
+		return ""
+	}
+	return getStreamNormalizer(c).Flush()
+}
+
+func getStreamNormalizer(c *gin.Context) *mdnormalize.Normalizer {
+	if normalizer, ok := c.Get(helper.MarkdownNormalizerKey); ok {
+		return normalizer.(*mdnormalize.Normalizer)
+	}
+	normalizer := &mdnormalize.Normalizer{}
+	c.Set(helper.MarkdownNormalizerKey, normalizer)
+	return normalizer
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/egress"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// processMediaUrl 下载(或解析 base64)视频/音频附件并上传,返回 private_file 格式的内容
+func processMediaUrl(c *gin.Context, client cycletls.CycleTLS, cookie string, mediaUrl string, mediaType string) (map[string]interface{}, error) {
+	maxSize := int64(config.MediaMaxSize) * 1024 * 1024
+
+	var reader io.Reader
+	name := mediaType
+	if strings.HasPrefix(mediaUrl, "http://") || strings.HasPrefix(mediaUrl, "https://") {
+		body, err := openLimitedUrl(mediaUrl, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		reader = body
+		if base := path.Base(strings.Split(mediaUrl, "?")[0]); base != "" && base != "/" && base != "." {
+			name = base
+		}
+	} else {
+		reader = openLimitedBase64(mediaUrl, maxSize)
+	}
+
+	// 优先使用文件名后缀判断类型,无法判断时按内容检测
+	contentType, reader, err := sniffContentType(reader)
+	if err != nil {
+		return nil, err
+	}
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	if ext != "" {
+		if byExt := mime.TypeByExtension("." + ext); byExt != "" {
+			contentType = byExt
+		}
+	} else {
+		ext = strings.Split(strings.Split(contentType, ";")[0], "/")[1]
+	}
+
+	return uploadPrivateFile(c, client, cookie, reader, name, contentType, ext)
+}
+
+// sizeLimitReader 读取超过 limit 字节时返回错误,避免大文件被完整读入内存
+type sizeLimitReader struct {
+	reader io.Reader
+	read   int64
+	limit  int64
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		return n, fmt.Errorf("file size exceeds limit of %d MB", r.limit/1024/1024)
+	}
+	return n, err
+}
+
+// limitReader 限制读取大小,limit 不大于 0 时不限制
+func limitReader(reader io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return reader
+	}
+	return &sizeLimitReader{reader: reader, limit: limit}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// openLimitedUrl 打开远程文件用于流式读取,超过大小限制时返回错误(limit 不大于 0 时不限制)
+func openLimitedUrl(fileUrl string, limit int64) (io.ReadCloser, error) {
+	body, _, err := openLimitedUrlWithSize(fileUrl, limit)
+	return body, err
+}
+
+// openLimitedUrlWithSize 同 openLimitedUrl,并返回响应声明的长度(未知时为 -1)
+func openLimitedUrlWithSize(fileUrl string, limit int64) (io.ReadCloser, int64, error) {
+	resp, err := http.Get(fileUrl)
+	if err != nil {
+		return nil, 0, fmt.Errorf("http.Get err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("http.Get status code: %d", resp.StatusCode)
+	}
+	if limit > 0 && resp.ContentLength > limit {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("file size exceeds limit of %d MB", limit/1024/1024)
+	}
+	return readCloser{Reader: limitReader(resp.Body, limit), Closer: resp.Body}, resp.ContentLength, nil
+}
+
+// openLimitedBase64 流式解码 base64(兼容 data URI 前缀),超过大小限制时读取返回错误
+func openLimitedBase64(data string, limit int64) io.Reader {
+	if index := strings.Index(data, ";base64,"); index >= 0 {
+		data = data[index+len(";base64,"):]
+	}
+	return limitReader(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)), limit)
+}
+
+// sniffContentType 读取开头的字节检测内容类型,返回的 reader 仍包含这些字节
+func sniffContentType(reader io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), reader), nil
+}
+
+// encodeBase64 流式编码为 base64 data URI,不在内存中同时保留原始数据与编码结果
+func encodeBase64(reader io.Reader, contentType string) (string, error) {
+	var builder strings.Builder
+	builder.WriteString("data:" + contentType + ";base64,")
+	encoder := base64.NewEncoder(base64.StdEncoding, &builder)
+	if _, err := io.Copy(encoder, reader); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// makeChunkedUploadRequest 按块上传(Put Block)后提交块列表(Put Block List),chunk 为已读取的首块,后续块复用其缓冲区,返回文件大小
+func makeChunkedUploadRequest(client cycletls.CycleTLS, uploadUrl string, reader io.Reader, chunk []byte) (int64, error) {
+	separator := "?"
+	if strings.Contains(uploadUrl, "?") {
+		separator = "&"
+	}
+
+	var size int64
+	var blockIds []string
+	for index := 0; len(chunk) > 0; index++ {
+		blockId := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", index)))
+
+		resp, err := client.Do(uploadUrl+separator+"comp=block&blockid="+url.QueryEscape(blockId), cycletls.Options{
+			Timeout: config.GetRuntimeConfig().Timeouts.Upload,
+			Proxy:   egress.Proxy(),
+			Method:  "PUT",
+			Body:    string(chunk),
+			Headers: map[string]string{
+				"Accept":         "*/*",
+				"Content-Type":   "application/octet-stream",
+				"Content-Length": fmt.Sprintf("%d", len(chunk)),
+				"Origin":         baseURL,
+			},
+		}, "PUT")
+		if err != nil {
+			return 0, err
+		}
+		if resp.Status >= 300 {
+			return 0, fmt.Errorf("upload block %d failed, status code: %d", index, resp.Status)
+		}
+		blockIds = append(blockIds, blockId)
+		size += int64(len(chunk))
+
+		n, err := io.ReadFull(reader, chunk[:cap(chunk)])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		chunk = chunk[:n]
+	}
+
+	var blockList strings.Builder
+	blockList.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, blockId := range blockIds {
+		blockList.WriteString("<Latest>" + blockId + "</Latest>")
+	}
+	blockList.WriteString("</BlockList>")
+
+	resp, err := client.Do(uploadUrl+separator+"comp=blocklist", cycletls.Options{
+		Timeout: config.GetRuntimeConfig().Timeouts.Upload,
+		Proxy:   egress.Proxy(),
+		Method:  "PUT",
+		Body:    blockList.String(),
+		Headers: map[string]string{
+			"Accept":       "*/*",
+			"Content-Type": "application/xml",
+			"Origin":       baseURL,
+		},
+	}, "PUT")
+	if err != nil {
+		return 0, err
+	}
+	if resp.Status >= 300 {
+		return 0, fmt.Errorf("commit block list failed, status code: %d", resp.Status)
+	}
+	return size, nil
+}
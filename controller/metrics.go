@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"genspark2api/common/metrics"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetMetrics 获取请求数、成功率与模型用量,since_start 为本次启动以来,persistent 含落盘恢复的累计值
+func GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    metrics.GetSnapshot(),
+	})
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	mixtureLayerOutputHide     = "hide"
+	mixtureLayerOutputMarkdown = "markdown"
+	mixtureLayerOutputJson     = "json"
+)
+
+// 层字段名,如 session_state.layer_0.gpt-5.1-low
+var layerFieldRegex = regexp.MustCompile(`layer_(\d+)(?:[._](.+))?$`)
+
+// mixtureLayerCollector 收集一次请求中各层各模型的中间答案
+type mixtureLayerCollector struct {
+	layers []model.MixtureLayer
+	sent   bool
+}
+
+func getMixtureLayerCollector(c *gin.Context) *mixtureLayerCollector {
+	if collector, ok := c.Get(helper.MixtureLayerKey); ok {
+		return collector.(*mixtureLayerCollector)
+	}
+	collector := &mixtureLayerCollector{}
+	c.Set(helper.MixtureLayerKey, collector)
+	return collector
+}
+
+// resetMixtureLayers 换 cookie 重试前清空已收集的中间答案
+func resetMixtureLayers(c *gin.Context) {
+	c.Set(helper.MixtureLayerKey, &mixtureLayerCollector{})
+}
+
+// collectMixtureLayer 记录层字段事件,message_field 事件为完整值,message_field_delta 事件为增量
+func collectMixtureLayer(c *gin.Context, eventType string, fieldName string, value string) {
+	if config.MixtureLayerOutput != mixtureLayerOutputMarkdown && config.MixtureLayerOutput != mixtureLayerOutputJson {
+		return
+	}
+	groups := layerFieldRegex.FindStringSubmatch(fieldName)
+	if groups == nil {
+		return
+	}
+	layer, _ := strconv.Atoi(groups[1])
+	modelName := groups[2]
+	if modelName == "" {
+		modelName = "unknown"
+	}
+
+	collector := getMixtureLayerCollector(c)
+	for i := range collector.layers {
+		if collector.layers[i].Layer == layer+1 && collector.layers[i].Model == modelName {
+			if eventType == "message_field" {
+				collector.layers[i].Content = value
+			} else {
+				collector.layers[i].Content += value
+			}
+			return
+		}
+	}
+	collector.layers = append(collector.layers, model.MixtureLayer{Layer: layer + 1, Model: modelName, Content: value})
+}
+
+// takeMixtureMarkdown markdown 模式下返回带标题的中间答案段落,每次请求只返回一次
+func takeMixtureMarkdown(c *gin.Context) string {
+	if config.MixtureLayerOutput != mixtureLayerOutputMarkdown {
+		return ""
+	}
+	collector := getMixtureLayerCollector(c)
+	if collector.sent || len(collector.layers) == 0 {
+		return ""
+	}
+	collector.sent = true
+
+	var builder strings.Builder
+	for _, layer := range collector.layers {
+		if strings.TrimSpace(layer.Content) == "" {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("### Layer %d · %s\n\n%s\n\n", layer.Layer, layer.Model, strings.TrimSpace(layer.Content)))
+	}
+	if builder.Len() == 0 {
+		return ""
+	}
+	builder.WriteString("---\n\n")
+	return builder.String()
+}
+
+// getMixtureLayers json 模式下返回中间答案,作为响应的 mixture_layers 字段
+func getMixtureLayers(c *gin.Context) []model.MixtureLayer {
+	if config.MixtureLayerOutput != mixtureLayerOutputJson {
+		return nil
+	}
+	return getMixtureLayerCollector(c).layers
+}
+
+// fieldValueString 获取 message_field 事件中字符串类型的 field_value
+func fieldValueString(value json.RawMessage) string {
+	var result string
+	if err := json.Unmarshal(value, &result); err != nil {
+		return ""
+	}
+	return result
+}
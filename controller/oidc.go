@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/oidc"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// oidcStateTTL 登录 state 的有效期
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	oidcStates     = make(map[string]time.Time)
+	oidcStateMutex sync.Mutex
+)
+
+func newOidcState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+
+	oidcStateMutex.Lock()
+	defer oidcStateMutex.Unlock()
+	now := time.Now()
+	for s, expiresAt := range oidcStates {
+		if now.After(expiresAt) {
+			delete(oidcStates, s)
+		}
+	}
+	oidcStates[state] = now.Add(oidcStateTTL)
+	return state, nil
+}
+
+// consumeOidcState 校验并作废 state,每个 state 仅可使用一次
+func consumeOidcState(state string) bool {
+	oidcStateMutex.Lock()
+	defer oidcStateMutex.Unlock()
+	expiresAt, ok := oidcStates[state]
+	delete(oidcStates, state)
+	return ok && time.Now().Before(expiresAt)
+}
+
+// OidcLogin 跳转到 IdP 登录页
+func OidcLogin(c *gin.Context) {
+	if !config.OidcEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcDisabled),
+		})
+		return
+	}
+
+	state, err := newOidcState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	authUrl, err := oidc.AuthCodeURL(c.Request.Context(), state)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "OIDC discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcDiscovery),
+		})
+		return
+	}
+	c.Redirect(http.StatusFound, authUrl)
+}
+
+// OidcCallback IdP 登录回调,校验通过后返回 id_token,之后以 Authorization: Bearer <id_token> 调用管理接口
+func OidcCallback(c *gin.Context) {
+	if !config.OidcEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcDisabled),
+		})
+		return
+	}
+	if errMsg := c.Query("error"); errMsg != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcLoginFailed, errMsg, c.Query("error_description")),
+		})
+		return
+	}
+	if !consumeOidcState(c.Query("state")) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcInvalidState),
+		})
+		return
+	}
+
+	idToken, err := oidc.Exchange(c.Request.Context(), c.Query("code"))
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "OIDC code exchange failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcExchange),
+		})
+		return
+	}
+	claims, err := oidc.Verify(c.Request.Context(), idToken)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "OIDC token verification failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcVerifyFailed),
+		})
+		return
+	}
+	role := config.MapOidcRole(claims.Roles())
+	if role == "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminOidcNoRole),
+		})
+		return
+	}
+
+	logger.SysLog("admin " + claims.Identity() + " logged in via OIDC as " + role)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"id_token":   idToken,
+			"expires_at": claims.ExpiresAt().Unix(),
+			"operator":   claims.Identity(),
+			"role":       role,
+		},
+	})
+}
+
+// GetAdminHistory 获取管理端变更记录(含操作人),可通过 limit 限制条数
+func GetAdminHistory(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    config.GetAdminHistory(limit),
+	})
+}
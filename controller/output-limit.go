@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"errors"
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	logger "genspark2api/common/loggger"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// errOutputLimited 超过模型的输出上限,已以 finish_reason=length 结束响应
+var errOutputLimited = errors.New("output limit reached")
+
+// outputLimiter 单次上游尝试的输出时长与 token 计数
+type outputLimiter struct {
+	limit    config.OutputLimit
+	model    string
+	deadline time.Time
+	tokens   int
+	reached  bool
+}
+
+// startOutputLimit 每次上游尝试开始时按 MODEL_OUTPUT_LIMIT_MAP 重置输出上限
+func startOutputLimit(c *gin.Context, modelName string) {
+	limiter := &outputLimiter{limit: config.GetModelOutputLimit(modelName), model: modelName}
+	if limiter.limit.MaxDuration > 0 {
+		limiter.deadline = time.Now().Add(time.Duration(limiter.limit.MaxDuration) * time.Second)
+	}
+	c.Set(helper.OutputLimitKey, limiter)
+}
+
+func getOutputLimiter(c *gin.Context) (*outputLimiter, bool) {
+	if limiter, ok := c.Get(helper.OutputLimitKey); ok {
+		return limiter.(*outputLimiter), true
+	}
+	return nil, false
+}
+
+// outputLimitReached 计入已输出的内容,超过最大输出 token 数或最大输出时长时返回 true
+func outputLimitReached(c *gin.Context, delta string) bool {
+	limiter, ok := getOutputLimiter(c)
+	if !ok {
+		return false
+	}
+	if limiter.limit.MaxTokens > 0 && delta != "" {
+		limiter.tokens += common.CountTokenText(delta, limiter.model)
+	}
+	if (limiter.limit.MaxTokens > 0 && limiter.tokens >= limiter.limit.MaxTokens) ||
+		(!limiter.deadline.IsZero() && !time.Now().Before(limiter.deadline)) {
+		limiter.reached = true
+	}
+	return limiter.reached
+}
+
+// streamTimeout 流式请求的上游超时(秒),配置了最大输出时长时以其为上限,到时由上游请求超时断开连接
+func streamTimeout(c *gin.Context) int {
+	timeout := config.GetRuntimeConfig().Timeouts.Chat
+	if limiter, ok := getOutputLimiter(c); ok && limiter.limit.MaxDuration > 0 {
+		timeout = min(timeout, limiter.limit.MaxDuration)
+	}
+	return timeout
+}
+
+// finishOutputLimited 输出改写与 Markdown 规范化中缓存的内容后,以 finish_reason=length 结束流式响应
+func finishOutputLimited(c *gin.Context, responseId, modelName string, jsonData []byte) error {
+	logger.Warnf(c.Request.Context(), "Output limit of model %s reached, finishing with length", modelName)
+	finishReason := "length"
+	delta := normalizeStreamDelta(c, flushStreamRewriter(c)) + flushStreamNormalizer(c)
+	delta, blocked := guardStreamDelta(c, delta, true)
+	if blocked {
+		return finishContentFiltered(c, responseId, modelName, jsonData)
+	}
+	err := sendSSEvent(c, createStreamResponse(responseId, modelName, jsonData, model.OpenAIDelta{Content: delta, Role: "assistant"}, &finishReason))
+	c.SSEvent("", " [DONE]")
+	return err
+}
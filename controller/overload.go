@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"genspark2api/common/i18n"
+	"genspark2api/common/overload"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// rejectOverloaded 降级模式下拒绝生图/生视频请求,在各入口(含对话路由与批任务)分发前调用,已拒绝时返回 true
+func rejectOverloaded(c *gin.Context) bool {
+	if !overload.Degraded() {
+		return false
+	}
+	c.Header("Retry-After", "30")
+	c.JSON(http.StatusServiceUnavailable, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: i18n.Message(c, i18n.ServiceOverloaded),
+			Type:    "server_error",
+			Code:    "service_overloaded",
+		},
+	})
+	return true
+}
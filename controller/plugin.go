@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// getModelMetadata 获取模型类型与能力声明,工具调用按调用方的 tool_use 特性开关声明
+func getModelMetadata(c *gin.Context, modelName string) model.ModelMetadataResponse {
+	metadata := model.ModelMetadataResponse{
+		ID:      modelName,
+		Object:  "model",
+		Created: common.StartTime,
+		OwnedBy: "genspark",
+	}
+	switch {
+	case isImageModel(modelName):
+		metadata.Type = "image"
+		metadata.Capabilities.ImageGeneration = true
+	case isVideoModel(modelName):
+		metadata.Type = "video"
+		metadata.Capabilities.VideoGeneration = true
+	default:
+		// 文本模型支持识别图片/文件,模型名后添加 -search 即可联网搜索
+		metadata.Type = "chat"
+		metadata.Capabilities.Vision = true
+		metadata.Capabilities.WebSearch = true
+		metadata.Capabilities.FileUpload = true
+		metadata.Capabilities.ToolUse = flagEnabled(c, config.FlagToolUse)
+	}
+	return metadata
+}
+
+// OpenaiModelsMetadata 获取模型能力声明列表
+func OpenaiModelsMetadata(c *gin.Context) {
+	var data []model.ModelMetadataResponse
+	for _, modelName := range listedModels() {
+		data = append(data, getModelMetadata(c, modelName))
+	}
+	c.JSON(http.StatusOK, model.ModelMetadataListResponse{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+// PluginManifest 插件清单,供 LobeChat/NextChat 等前端自动识别服务能力
+func PluginManifest(c *gin.Context) {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	prefix := strings.TrimSuffix(c.Request.URL.Path, "/.well-known/ai-plugin.json")
+	baseUrl := fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, prefix)
+
+	auth := gin.H{"type": "none"}
+	if config.ApiSecret != "" {
+		auth = gin.H{"type": "service_http", "authorization_type": "bearer"}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schema_version":        "v1",
+		"name_for_human":        "Genspark2API",
+		"name_for_model":        "genspark2api",
+		"description_for_human": "OpenAI compatible API for Genspark.",
+		"description_for_model": "OpenAI compatible chat, image and video generation API.",
+		"auth":                  auth,
+		"api": gin.H{
+			"type": "openai",
+			"url":  baseUrl + "/v1",
+		},
+		"models_metadata_url": baseUrl + "/v1/models/metadata",
+		"capabilities": model.ModelCapabilities{
+			Vision:          true,
+			ToolUse:         flagEnabled(c, config.FlagToolUse),
+			WebSearch:       true,
+			FileUpload:      true,
+			ImageGeneration: true,
+			VideoGeneration: true,
+		},
+		"version": common.Version,
+	})
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetPresets 获取 prompt 预设
+func GetPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    config.GlobalPresetManager.List(),
+	})
+}
+
+// SetPreset 新增或覆盖 prompt 预设
+func SetPreset(c *gin.Context) {
+	var preset config.Preset
+	if err := c.BindJSON(&preset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+		})
+		return
+	}
+	preset.Name = c.Param("name")
+
+	if err := config.GlobalPresetManager.Set(preset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	preset, _ = config.GlobalPresetManager.Get(preset.Name)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    preset,
+	})
+}
+
+// DeletePreset 删除 prompt 预设
+func DeletePreset(c *gin.Context) {
+	removed, err := config.GlobalPresetManager.Remove(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminPresetNotFound),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// resolvePreset 根据请求字段 preset 或模型别名选择预设,别名绑定了模型时替换请求模型
+func resolvePreset(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) bool {
+	if openAIReq.Preset != "" {
+		if _, ok := config.GlobalPresetManager.Get(openAIReq.Preset); !ok {
+			c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+				OpenAIError: model.OpenAIError{
+					Message: i18n.Message(c, i18n.PresetNotFound, openAIReq.Preset),
+					Type:    "invalid_request_error",
+					Param:   "preset",
+					Code:    "400",
+				},
+			})
+			return false
+		}
+		return true
+	}
+
+	if preset, ok := config.GlobalPresetManager.GetByAlias(openAIReq.Model); ok {
+		openAIReq.Preset = preset.Name
+		if preset.Model != "" {
+			openAIReq.Model = preset.Model
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/guard"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/task"
+	"genspark2api/common/tlsclient"
+	"genspark2api/model"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+const checkPromptInstruction = "You are a content safety classifier for an image and video generation service. " +
+	"Decide whether the following prompt asks for sexual content, any sexualized depiction of minors, graphic violence or gore, " +
+	"hateful or extremist content, self-harm, or realistic depictions of real people in harmful or deceptive situations. " +
+	"Reply with exactly SAFE, or UNSAFE: followed by a short reason, and nothing else.\n\nPrompt: "
+
+const enhancePromptInstruction = "You are a prompt engineer for text-to-image models. " +
+	"Rewrite the following image prompt into a single detailed English description covering subject, composition, style, lighting and color. " +
+	"Keep the original intent and output only the rewritten prompt without any explanation.\n\nPrompt: "
+
+// completeText 使用文本模型完成一次非流式对话(独立的临时会话,结束后删除)
+func completeText(c *gin.Context, client cycletls.CycleTLS, cookie string, modelName string, messages []model.OpenAIChatMessage) (string, error) {
+	requestBody := map[string]interface{}{
+		"type":                 chatType,
+		"current_query_string": fmt.Sprintf("type=%s", chatType),
+		"messages":             messages,
+		"action_params":        map[string]interface{}{},
+		"extra_data": map[string]interface{}{
+			"models":                 []string{modelName},
+			"run_with_another_model": false,
+			"writingContent":         nil,
+			"request_web_knowledge":  false,
+		},
+	}
+
+	requestBody, err := cheat(requestBody, c, cookie)
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", err
+	}
+	response, err := makeRequest(client, jsonData, cookie, false)
+	if err != nil {
+		return "", err
+	}
+
+	var content, projectId string
+	scanner := bufio.NewScanner(strings.NewReader(response.Body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event struct {
+			Type    string `json:"type"`
+			Id      string `json:"id"`
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "project_start":
+			projectId = event.Id
+		case "message_result":
+			content = strings.TrimSpace(event.Content)
+		}
+	}
+
+	if projectId != "" {
+		task.Go("delete-chat", func() {
+			client := tlsclient.New()
+			defer client.Release()
+			makeDeleteRequest(client.CycleTLS, cookie, projectId)
+		})
+	}
+
+	if content == "" {
+		return "", fmt.Errorf("no valid response content")
+	}
+	return content, nil
+}
+
+// enhanceImagePrompt 使用文本模型将用户 prompt 扩写为详细的英文描述
+func enhanceImagePrompt(c *gin.Context, client cycletls.CycleTLS, cookie string, prompt string) (string, error) {
+	content, err := completeText(c, client, cookie, config.PromptEnhanceModel, []model.OpenAIChatMessage{
+		{Role: "user", Content: enhancePromptInstruction + prompt},
+	})
+	if err != nil {
+		return "", err
+	}
+	logger.Debugf(c.Request.Context(), "enhanced prompt: %s", content)
+	return content, nil
+}
+
+// checkMediaPrompt 生图/生视频前预检 prompt,命中本地敏感词或被文本模型判定为违规时返回 400 content_policy_violation
+// 文本模型分类失败时放行
+func checkMediaPrompt(c *gin.Context, modelName string, prompt string) bool {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" || (len(config.PromptCheckWords) == 0 && config.PromptCheckModel == "") {
+		return true
+	}
+
+	reason := ""
+	lowerPrompt := strings.ToLower(prompt)
+	for _, word := range config.PromptCheckWords {
+		if strings.Contains(lowerPrompt, strings.ToLower(word)) {
+			reason = "word: " + word
+			break
+		}
+	}
+	if reason == "" && config.PromptCheckModel != "" {
+		reason = classifyPrompt(c, prompt)
+	}
+	if reason == "" {
+		return true
+	}
+
+	recordGuardHit(c, guard.DirectionInput, guard.Result{Hit: true, Blocked: true, Reason: "prompt check(" + modelName + ") " + reason})
+	c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: i18n.Message(c, i18n.ContentPolicy),
+			Type:    "invalid_request_error",
+			Param:   "prompt",
+			Code:    "content_policy_violation",
+		},
+	})
+	return false
+}
+
+// classifyPrompt 使用 PROMPT_CHECK_MODEL 判定 prompt 是否违规,返回违规原因
+func classifyPrompt(c *gin.Context, prompt string) string {
+	ctx := c.Request.Context()
+	cookie, err := newCookieManager(c, config.PromptCheckModel).GetRandomCookie()
+	if err != nil {
+		logger.Warnf(ctx, "prompt check skipped: %v", err)
+		return ""
+	}
+
+	client := tlsclient.New()
+	defer client.Release()
+	content, err := completeText(c, client.CycleTLS, cookie, config.PromptCheckModel, []model.OpenAIChatMessage{
+		{Role: "user", Content: checkPromptInstruction + prompt},
+	})
+	if err != nil {
+		logger.Warnf(ctx, "prompt check failed, request allowed: %v", err)
+		return ""
+	}
+	logger.Debugf(ctx, "prompt check result: %s", content)
+
+	if !strings.HasPrefix(strings.ToUpper(content), "UNSAFE") {
+		return ""
+	}
+	reason := strings.TrimSpace(strings.TrimLeft(content[len("UNSAFE"):], ":： "))
+	if reason == "" {
+		reason = "unsafe"
+	}
+	return "model: " + reason
+}
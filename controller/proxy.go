@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"fmt"
+	"genspark2api/common/egress"
+	"strings"
+)
+
+// classifyProxyError 对配置了代理时的请求错误进行分类,便于排查
+func classifyProxyError(err error) error {
+	if err == nil || egress.Proxy() == "" {
+		return err
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "407") || strings.Contains(msg, "proxy authentication required") ||
+		(strings.Contains(msg, "socks") && strings.Contains(msg, "auth")):
+		return fmt.Errorf("proxy authentication failed, check the username and password in PROXY_URL: %v", err)
+	case strings.Contains(msg, "connection refused"):
+		return fmt.Errorf("proxy connection refused, check the host and port in PROXY_URL: %v", err)
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline exceeded"):
+		return fmt.Errorf("proxy connection timed out: %v", err)
+	case strings.Contains(msg, "no such host"):
+		return fmt.Errorf("proxy host could not be resolved: %v", err)
+	case strings.Contains(msg, "proxyconnect") || strings.Contains(msg, "socks"):
+		return fmt.Errorf("proxy connection failed: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"genspark2api/common/recaptcha"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetRecaptchaStats 获取 recaptcha proxy 状态与预取池中的 token 数
+func GetRecaptchaStats(c *gin.Context) {
+	proxies, pooled := recaptcha.Snapshot()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"proxies": proxies,
+			"pooled":  pooled,
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/helper"
+	"genspark2api/model"
+	"time"
+)
+
+// newResponseId 生成响应ID,时间后附随机数以区分同一秒内的响应
+func newResponseId() string {
+	return fmt.Sprintf(responseIDFormat, helper.GenRequestID())
+}
+
+// buildUsage 组装用量信息
+func buildUsage(promptTokens int, completionTokens int) model.OpenAIUsage {
+	return model.OpenAIUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+	}
+}
+
+// buildTextUsage 按文本计算并组装用量信息
+func buildTextUsage(modelName string, prompt string, completion string) model.OpenAIUsage {
+	return buildUsage(common.CountTokenText(prompt, modelName), common.CountTokenText(completion, modelName))
+}
+
+// buildChatCompletion 组装非流式响应
+func buildChatCompletion(responseId string, modelName string, content string, finishReason string, usage model.OpenAIUsage) model.OpenAIChatCompletionResponse {
+	return model.OpenAIChatCompletionResponse{
+		ID:      responseId,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelName,
+		Choices: []model.OpenAIChoice{
+			{
+				Index: 0,
+				Message: &model.OpenAIMessage{
+					Role:    "assistant",
+					Content: content,
+				},
+				FinishReason: &finishReason,
+			},
+		},
+		Usage: usage,
+	}
+}
+
+// buildChatCompletionChunk 组装流式响应块
+func buildChatCompletionChunk(responseId string, modelName string, delta model.OpenAIDelta, finishReason *string, usage model.OpenAIUsage) model.OpenAIChatCompletionResponse {
+	return model.OpenAIChatCompletionResponse{
+		ID:      responseId,
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   modelName,
+		Choices: []model.OpenAIChoice{
+			{
+				Index:        0,
+				Delta:        &delta,
+				FinishReason: finishReason,
+			},
+		},
+		Usage: usage,
+	}
+}
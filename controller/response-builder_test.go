@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"encoding/json"
+	"genspark2api/model"
+	"testing"
+)
+
+// TestResponseSchema 校验对话响应与 OpenAI 官方 schema 的字段完整性,可为 null 的字段也必须存在
+func TestResponseSchema(t *testing.T) {
+	stop := "stop"
+	usage := buildUsage(3, 5)
+
+	tests := []struct {
+		name       string
+		response   model.OpenAIChatCompletionResponse
+		object     string
+		choiceKeys []string // choices[0] 必须存在的字段
+		absentKeys []string // choices[0] 不应出现的字段
+		nullKeys   []string // 必须为 null 的字段(choices[0] 中)
+	}{
+		{
+			name:       "chat completion",
+			response:   buildChatCompletion("chatcmpl-1", "gpt-4o", "hello", "stop", usage),
+			object:     "chat.completion",
+			choiceKeys: []string{"index", "message", "logprobs", "finish_reason"},
+			absentKeys: []string{"delta"},
+			nullKeys:   []string{"logprobs"},
+		},
+		{
+			name:       "chat completion chunk",
+			response:   buildChatCompletionChunk("chatcmpl-1", "gpt-4o", model.OpenAIDelta{Content: "he", Role: "assistant"}, nil, usage),
+			object:     "chat.completion.chunk",
+			choiceKeys: []string{"index", "delta", "logprobs", "finish_reason"},
+			absentKeys: []string{"message"},
+			nullKeys:   []string{"logprobs", "finish_reason"},
+		},
+		{
+			name:       "final chat completion chunk",
+			response:   buildChatCompletionChunk("chatcmpl-1", "gpt-4o", model.OpenAIDelta{}, &stop, usage),
+			object:     "chat.completion.chunk",
+			choiceKeys: []string{"index", "delta", "logprobs", "finish_reason"},
+			absentKeys: []string{"message"},
+			nullKeys:   []string{"logprobs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.response)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			for _, key := range []string{"id", "object", "created", "model", "choices", "usage", "system_fingerprint"} {
+				if _, ok := body[key]; !ok {
+					t.Errorf("missing top-level field %q in %s", key, data)
+				}
+			}
+			if body["object"] != tt.object {
+				t.Errorf("object = %v, want %s", body["object"], tt.object)
+			}
+			if body["system_fingerprint"] != nil {
+				t.Errorf("system_fingerprint = %v, want null", body["system_fingerprint"])
+			}
+			if _, ok := body["suggestions"]; ok {
+				t.Errorf("suggestions should be omitted when empty")
+			}
+
+			choices, ok := body["choices"].([]interface{})
+			if !ok || len(choices) != 1 {
+				t.Fatalf("choices = %v, want one choice", body["choices"])
+			}
+			choice := choices[0].(map[string]interface{})
+			for _, key := range tt.choiceKeys {
+				if _, ok := choice[key]; !ok {
+					t.Errorf("missing choice field %q in %s", key, data)
+				}
+			}
+			for _, key := range tt.absentKeys {
+				if _, ok := choice[key]; ok {
+					t.Errorf("unexpected choice field %q in %s", key, data)
+				}
+			}
+			for _, key := range tt.nullKeys {
+				if choice[key] != nil {
+					t.Errorf("choice field %q = %v, want null", key, choice[key])
+				}
+			}
+			if choice["index"] != float64(0) {
+				t.Errorf("index = %v, want 0", choice["index"])
+			}
+
+			usageBody, ok := body["usage"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("usage = %v, want object", body["usage"])
+			}
+			for _, key := range []string{"prompt_tokens", "completion_tokens", "total_tokens"} {
+				if _, ok := usageBody[key]; !ok {
+					t.Errorf("missing usage field %q", key)
+				}
+			}
+		})
+	}
+}
+
+// TestResponseMessageSchema 非流式响应的 message 需包含 role/content/refusal
+func TestResponseMessageSchema(t *testing.T) {
+	data, err := json.Marshal(buildChatCompletion("chatcmpl-1", "gpt-4o", "hello", "stop", buildUsage(1, 1)))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var body struct {
+		Choices []struct {
+			Message map[string]interface{} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	message := body.Choices[0].Message
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"role", "assistant"},
+		{"content", "hello"},
+		{"refusal", nil},
+	}
+	for _, tt := range tests {
+		value, ok := message[tt.key]
+		if !ok {
+			t.Errorf("missing message field %q in %s", tt.key, data)
+			continue
+		}
+		if value != tt.want {
+			t.Errorf("message.%s = %v, want %v", tt.key, value, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// storedResponse 暂存的非流式响应
+type storedResponse struct {
+	tenantId     string
+	created      int64
+	model        string
+	content      []rune
+	finishReason *string
+	usage        model.OpenAIUsage
+}
+
+var storedResponses sync.Map
+
+// 暂存响应的 ID 响应头,ID 由服务端随机生成,不使用客户端可指定的请求 ID,避免被猜测读取或覆盖
+const responsePageIdHeader = "X-Response-Id"
+
+// storeResponse 暂存非流式响应并通过 X-Response-Id 响应头返回其 ID,客户端超时断开后仍可分页获取。
+// 同一请求多次暂存(如工具调用改写回答)时沿用同一 ID
+func storeResponse(c *gin.Context, response model.OpenAIChatCompletionResponse) {
+	if config.ResponsePageExpireDuration <= 0 || len(response.Choices) == 0 || response.Choices[0].Message == nil {
+		return
+	}
+	responseId := c.GetString(helper.ResponsePageIdKey)
+	if responseId == "" {
+		responseId = "resp_" + common.GetUUID()
+		c.Set(helper.ResponsePageIdKey, responseId)
+		c.Header(responsePageIdHeader, responseId)
+	}
+	stored := &storedResponse{
+		created:      response.Created,
+		model:        response.Model,
+		content:      []rune(response.Choices[0].Message.Content),
+		finishReason: response.Choices[0].FinishReason,
+		usage:        response.Usage,
+	}
+	if tenant, ok := getTenant(c); ok {
+		stored.tenantId = tenant.ID
+	}
+	storedResponses.Store(responseId, stored)
+	time.AfterFunc(time.Duration(config.ResponsePageExpireDuration)*time.Second, func() {
+		storedResponses.CompareAndDelete(responseId, stored)
+	})
+}
+
+// GetResponsePage 按暂存响应的 ID 分页获取暂存的响应内容,offset/limit 以字符计
+func GetResponsePage(c *gin.Context) {
+	value, ok := storedResponses.Load(c.Param("id"))
+	stored, _ := value.(*storedResponse)
+	if tenant, hasTenant := getTenant(c); ok && hasTenant && tenant.ID != stored.tenantId {
+		ok = false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.ResponseNotFound),
+				Type:    "invalid_request_error",
+				Code:    "404",
+			},
+		})
+		return
+	}
+
+	total := len(stored.content)
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	offset = max(0, min(offset, total))
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 || limit > config.ResponsePageSize {
+		limit = config.ResponsePageSize
+	}
+	end := min(offset+limit, total)
+
+	page := model.ChatCompletionPage{
+		ID:      c.Param("id"),
+		Object:  "chat.completion.page",
+		Created: stored.created,
+		Model:   stored.model,
+		Offset:  offset,
+		Total:   total,
+		HasMore: end < total,
+		Content: string(stored.content[offset:end]),
+	}
+	if page.HasMore {
+		page.NextOffset = &end
+	} else {
+		page.FinishReason = stored.finishReason
+		page.Usage = &stored.usage
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetRuntimeConfig 获取各接口上游请求的超时与重试配置
+func GetRuntimeConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    config.GetRuntimeConfig(),
+	})
+}
+
+// UpdateRuntimeConfig 更新超时与重试配置,未传的字段保持不变,对之后的上游请求立即生效
+func UpdateRuntimeConfig(c *gin.Context) {
+	cfg := config.GetRuntimeConfig()
+	if err := c.BindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+		})
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	config.SetRuntimeConfig(cfg)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cfg,
+	})
+}
+
+// flagEnabled 按请求的染色分组查询特性开关
+func flagEnabled(c *gin.Context, key string) bool {
+	return config.FlagEnabledFor(c.GetString(helper.CohortKey), key)
+}
+
+// reasoningEnabled 是否输出思考过程,请求携带 reasoning.exclude 时既不下发也不计入用量
+func reasoningEnabled(c *gin.Context) bool {
+	return !c.GetBool(helper.ReasoningExcludeKey) && flagEnabled(c, config.FlagReasoning)
+}
+
+// featureFlag 特性开关当前状态
+type featureFlag struct {
+	Key        string `json:"key"`
+	Enabled    bool   `json:"enabled"`
+	Default    bool   `json:"default"`
+	Overridden bool   `json:"overridden"`
+}
+
+// GetFeatureFlags 获取所有特性开关的当前值与默认值
+func GetFeatureFlags(c *gin.Context) {
+	overrides := config.GetRuntimeConfig().Flags
+	flags := make([]featureFlag, 0)
+	for _, key := range config.FlagKeys() {
+		defaultValue, _ := config.FlagDefault(key)
+		_, overridden := overrides[key]
+		flags = append(flags, featureFlag{
+			Key:        key,
+			Enabled:    config.FlagEnabled(key),
+			Default:    defaultValue,
+			Overridden: overridden,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    flags,
+	})
+}
+
+// UpdateFeatureFlag 覆盖特性开关,请求体 {"enabled": true},立即生效
+func UpdateFeatureFlag(c *gin.Context) {
+	key := c.Param("key")
+	if _, ok := config.FlagDefault(key); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminFlagNotFound),
+		})
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.BindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+		})
+		return
+	}
+
+	config.SetFlag(key, *req.Enabled)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// ResetFeatureFlag 清除特性开关的覆盖值,恢复默认值
+func ResetFeatureFlag(c *gin.Context) {
+	key := c.Param("key")
+	if _, ok := config.FlagDefault(key); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminFlagNotFound),
+		})
+		return
+	}
+
+	config.ResetFlag(key)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
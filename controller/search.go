@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// 搜索结果中可能承载来源列表的字段
+var searchSourceKeys = []string{"sources", "search_results", "references", "citations"}
+
+type searchSource struct {
+	Title string
+	Url   string
+}
+
+// searchCollector 收集一次联网搜索请求的来源列表,并记录已流式输出的答案字段
+type searchCollector struct {
+	sources       []searchSource
+	streamedField string
+	sent          bool
+}
+
+func getSearchCollector(c *gin.Context) *searchCollector {
+	if collector, ok := c.Get(helper.SearchKey); ok {
+		return collector.(*searchCollector)
+	}
+	collector := &searchCollector{}
+	c.Set(helper.SearchKey, collector)
+	return collector
+}
+
+// resetSearch 换 cookie 重试前清空已收集的来源
+func resetSearch(c *gin.Context) {
+	c.Set(helper.SearchKey, &searchCollector{})
+}
+
+// collectSearchSources 从来源字段的值(JSON 字符串或已解析的数组)中收集来源
+func collectSearchSources(c *gin.Context, value interface{}) {
+	if text, ok := value.(string); ok {
+		if json.Unmarshal([]byte(text), &value) != nil {
+			return
+		}
+	}
+	collector := getSearchCollector(c)
+	for _, source := range extractSearchSources(value) {
+		duplicate := false
+		for _, existing := range collector.sources {
+			if existing.Url == source.Url {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			collector.sources = append(collector.sources, source)
+		}
+	}
+}
+
+// extractSearchSources 从 [{"title":..,"url":..}] 形式的数组中提取来源,兼容 link/href/name 等字段名
+func extractSearchSources(value interface{}) []searchSource {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var sources []searchSource
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var source searchSource
+		for _, key := range []string{"url", "link", "href"} {
+			if url, ok := itemMap[key].(string); ok && url != "" {
+				source.Url = url
+				break
+			}
+		}
+		for _, key := range []string{"title", "name", "site_name"} {
+			if title, ok := itemMap[key].(string); ok && title != "" {
+				source.Title = strings.TrimSpace(title)
+				break
+			}
+		}
+		if source.Url != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// parseSearchResult 解析联网搜索的 message_result 内容,内容为 JSON 时取详细答案并收集来源,
+// 非 JSON 或不含答案字段时原样返回
+func parseSearchResult(c *gin.Context, content string) string {
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return content
+	}
+	for _, key := range searchSourceKeys {
+		if value, ok := result[key]; ok {
+			collectSearchSources(c, value)
+		}
+	}
+	for _, key := range []string{"detailAnswer", "detail_answer", "answer"} {
+		if answer, ok := result[key].(string); ok && answer != "" {
+			return answer
+		}
+	}
+	return content
+}
+
+// skipSearchField 联网搜索时简要答案与详细答案只输出先到达的一种,两者混在一起会导致引用与正文错乱;
+// 未返回详细答案的模型仍按简要答案输出
+func skipSearchField(c *gin.Context, field string) bool {
+	if field != config.FieldAnswer && field != config.FieldDetailAnswer {
+		return false
+	}
+	collector := getSearchCollector(c)
+	if collector.streamedField == "" {
+		collector.streamedField = field
+	}
+	return collector.streamedField != field
+}
+
+// searchAnswerStreamed 答案是否已以增量形式输出
+func searchAnswerStreamed(c *gin.Context) bool {
+	return getSearchCollector(c).streamedField != ""
+}
+
+// takeSearchSources 返回"来源"一节,已出现在答案中的链接不再列出,每次请求只返回一次
+func takeSearchSources(c *gin.Context, content string) string {
+	collector := getSearchCollector(c)
+	if config.SearchSourcesSection != 1 || collector.sent {
+		return ""
+	}
+	collector.sent = true
+
+	var builder strings.Builder
+	index := 0
+	for _, source := range collector.sources {
+		if strings.Contains(content, source.Url) {
+			continue
+		}
+		index++
+		title := source.Title
+		if title == "" {
+			title = source.Url
+		}
+		builder.WriteString(fmt.Sprintf("%d. [%s](%s)\n", index, title, source.Url))
+	}
+	if builder.Len() == 0 {
+		return ""
+	}
+	return "\n\n---\n\n**来源**\n\n" + builder.String()
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// sessionNamespace 自动绑定会话的命名空间,按 SESSION_NAMESPACE 以 API key(及请求的 user 字段)区分调用方,
+// API key 只保留摘要
+func sessionNamespace(c *gin.Context) string {
+	switch config.SessionNamespace {
+	case "api_key", "user":
+	default:
+		return ""
+	}
+
+	// 批任务等内部构造的请求不带鉴权头,使用提交时记录的调用方
+	namespace := c.GetString(helper.SessionCallerKey)
+	if namespace == "" {
+		namespace = sessionCaller(c)
+	}
+	if config.SessionNamespace == "user" {
+		if user := c.GetString(helper.SessionUserKey); user != "" {
+			namespace += ":" + user
+		}
+	}
+	return namespace
+}
+
+// sessionCaller 按请求的 API key 摘要标识调用方
+func sessionCaller(c *gin.Context) string {
+	secret := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if secret == "" {
+		secret = c.GetHeader("x-api-key")
+	}
+	if secret == "" && c.IsWebsocket() {
+		secret = c.Query("api_key")
+	}
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:8])
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"genspark2api/common/helper"
+	"genspark2api/common/shadow"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func getShadowSession(c *gin.Context) *shadow.Session {
+	if session, ok := c.Get(helper.ShadowParserKey); ok {
+		return session.(*shadow.Session)
+	}
+	return nil
+}
+
+// resetShadowParser 每次请求上游前开启新的影子解析,换 cookie 重试时放弃上一次尝试的对比
+func resetShadowParser(c *gin.Context, modelName string) {
+	getShadowSession(c).Discard()
+	c.Set(helper.ShadowParserKey, shadow.Start(c.GetString(helper.RequestIdKey), modelName))
+}
+
+// feedShadowParser 将上游事件交给新解析器,线上解析结果由处理流程通过 Record* 记录
+func feedShadowParser(c *gin.Context, data string) {
+	getShadowSession(c).Feed(data)
+}
+
+// finishShadowParser 请求结束,对比最后一次尝试的解析结果
+func finishShadowParser(c *gin.Context) {
+	getShadowSession(c).Finish()
+}
+
+// GetShadowParserStats 获取线上与新解析器的对比统计与最近的差异报告
+func GetShadowParserStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    shadow.Snapshot(),
+	})
+}
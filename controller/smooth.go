@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// maxSmoothDuration 单个增量的平滑下发总耗时上限,超过时提高速率,避免大段内容拖慢整体响应
+const maxSmoothDuration = 2 * time.Second
+
+// sendSmoothSSEvent 将超过 STREAM_SMOOTH_CHUNK_SIZE 个字符的内容增量切成小块,按 STREAM_SMOOTH_RATE 的速率依次下发;
+// 结束原因与用量仅随最后一块下发
+func sendSmoothSSEvent(c *gin.Context, response model.OpenAIChatCompletionResponse) error {
+	if len(response.Choices) != 1 || response.Choices[0].Delta == nil {
+		return writeSSEvent(c, response)
+	}
+	delta := *response.Choices[0].Delta
+	content := []rune(delta.Content)
+	chunkSize := config.StreamSmoothChunkSize
+	if chunkSize <= 0 || len(content) <= chunkSize {
+		return writeSSEvent(c, response)
+	}
+
+	interval := time.Second * time.Duration(chunkSize) / time.Duration(config.StreamSmoothRate)
+	chunks := (len(content) + chunkSize - 1) / chunkSize
+	if total := interval * time.Duration(chunks-1); total > maxSmoothDuration {
+		interval = maxSmoothDuration / time.Duration(chunks-1)
+	}
+
+	ctx := c.Request.Context()
+	for start := 0; start < len(content); start += chunkSize {
+		end := start + chunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		chunk := response
+		chunkDelta := delta
+		chunkDelta.Content = string(content[start:end])
+		chunk.Choices = []model.OpenAIChoice{response.Choices[0]}
+		chunk.Choices[0].Delta = &chunkDelta
+		if end < len(content) {
+			// 中间块不携带结束原因、用量与附加数据
+			chunkDelta.ToolCalls = nil
+			chunk.Choices[0].FinishReason = nil
+			chunk.Usage = model.OpenAIUsage{}
+			chunk.Suggestions = nil
+			chunk.MixtureLayers = nil
+			chunk.AgentSteps = nil
+			chunk.AgentArtifacts = nil
+			chunk.Markmap = nil
+		}
+		if err := writeSSEvent(c, chunk); err != nil {
+			return err
+		}
+		if end == len(content) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return nil
+}
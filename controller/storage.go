@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/storage"
+	"net/http"
+)
+
+// archiveResult 上传生成结果到 S3 兼容存储并返回签名下载 URL,失败时返回上游 URL
+func archiveResult(ctx context.Context, upstreamUrl string, data []byte, contentType string) string {
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	signedUrl, err := storage.Upload(bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		logger.Warnf(ctx, "archive result error: %v", err)
+		return upstreamUrl
+	}
+	return signedUrl
+}
+
+// archiveResultUrl 下载上游结果并流式上传归档(视频等较大的结果不在内存中完整保留),未启用存储或失败时返回上游 URL
+func archiveResultUrl(ctx context.Context, upstreamUrl string) string {
+	if !storage.Enabled() {
+		return upstreamUrl
+	}
+	body, size, err := openLimitedUrlWithSize(upstreamUrl, int64(config.ResultMaxSize)*1024*1024)
+	if err != nil {
+		logger.Warnf(ctx, "openLimitedUrl error: %v", err)
+		return upstreamUrl
+	}
+	defer body.Close()
+
+	contentType, reader, err := sniffContentType(body)
+	if err != nil {
+		logger.Warnf(ctx, "archive result error: %v", err)
+		return upstreamUrl
+	}
+	signedUrl, err := storage.Upload(reader, size, contentType)
+	if err != nil {
+		logger.Warnf(ctx, "archive result error: %v", err)
+		return upstreamUrl
+	}
+	return signedUrl
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"genspark2api/common/config"
+	"genspark2api/model"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// bufferedWriter 暂存响应而不输出,用于将非流式响应转为流式返回
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *bufferedWriter) Flush() {}
+
+// streamFromNonStream 改用非流式请求上游,成功时以流式形式一次性返回结果,失败时返回非流式请求的错误响应
+func streamFromNonStream(c *gin.Context, client cycletls.CycleTLS, cookie string, cookieManager *config.CookieManager, requestBody map[string]interface{}, modelName string, searchModel bool, responseId string) {
+	writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+	c.Writer = writer
+	handleNonStreamRequest(c, client, cookie, cookieManager, requestBody, modelName, searchModel)
+	c.Writer = writer.ResponseWriter
+
+	var response model.OpenAIChatCompletionResponse
+	if writer.status != http.StatusOK || json.Unmarshal(writer.body.Bytes(), &response) != nil || len(response.Choices) == 0 || response.Choices[0].Message == nil {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Data(writer.status, "application/json; charset=utf-8", writer.body.Bytes())
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	choice := response.Choices[0]
+	chunk := buildChatCompletionChunk(responseId, modelName, model.OpenAIDelta{Content: choice.Message.Content, Role: "assistant"}, choice.FinishReason, response.Usage)
+	chunk.MixtureLayers = response.MixtureLayers
+	chunk.AgentSteps = response.AgentSteps
+	chunk.AgentArtifacts = response.AgentArtifacts
+	chunk.Markmap = response.Markmap
+	chunk.Suggestions = response.Suggestions
+	if err := sendSSEvent(c, chunk); err != nil {
+		return
+	}
+	c.SSEvent("", " [DONE]")
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/json"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// 建议对象中可能承载问题文本的字段
+var suggestionTextKeys = []string{"question", "text", "title", "content"}
+
+// resetSuggestions 换 cookie 重试前清空已收集的建议
+func resetSuggestions(c *gin.Context) {
+	c.Set(helper.SuggestionsKey, []string(nil))
+}
+
+// collectSuggestions 从建议字段的值(JSON 字符串或已解析的数组)中收集后续问题建议,后到的完整值覆盖此前的值
+func collectSuggestions(c *gin.Context, value interface{}) {
+	if config.SuggestionsPassthrough != 1 {
+		return
+	}
+	if raw, ok := value.(json.RawMessage); ok {
+		if json.Unmarshal(raw, &value) != nil {
+			return
+		}
+	}
+	if text, ok := value.(string); ok {
+		if json.Unmarshal([]byte(text), &value) != nil {
+			return
+		}
+	}
+	if suggestions := extractSuggestions(value); len(suggestions) > 0 {
+		c.Set(helper.SuggestionsKey, suggestions)
+	}
+}
+
+// extractSuggestions 兼容字符串数组与 [{"question":..}] 形式的对象数组
+func extractSuggestions(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var suggestions []string
+	for _, item := range items {
+		var text string
+		switch v := item.(type) {
+		case string:
+			text = v
+		case map[string]interface{}:
+			for _, key := range suggestionTextKeys {
+				if s, ok := v[key].(string); ok && s != "" {
+					text = s
+					break
+				}
+			}
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			suggestions = append(suggestions, text)
+		}
+	}
+	return suggestions
+}
+
+// getSuggestions 获取本次请求收集到的建议
+func getSuggestions(c *gin.Context) []string {
+	if value, ok := c.Get(helper.SuggestionsKey); ok {
+		return value.([]string)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+)
+
+// limitSystemMessages 按 SYSTEM_MESSAGE_* 合并系统消息并控制总长度,DEBUG 模式下记录处理前后的差异
+func limitSystemMessages(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) {
+	if config.SystemMessageMaxCount <= 0 && config.SystemMessageMaxLength <= 0 {
+		return
+	}
+	before, after := openAIReq.LimitSystemMessages(config.SystemMessageMaxCount, config.SystemMessageMaxLength, config.SystemMessageOverflow)
+	if before.Count == after.Count && before.Total() == after.Total() {
+		return
+	}
+	logger.Debugf(c.Request.Context(), "System messages limited (%s): count %d -> %d, length %d -> %d, lengths %v -> %v",
+		config.SystemMessageOverflow, before.Count, after.Count, before.Total(), after.Total(), before.Lengths, after.Lengths)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"genspark2api/common/alert"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// getTenant 获取当前请求所属租户
+func getTenant(c *gin.Context) (*config.Tenant, bool) {
+	value, ok := c.Get(config.TenantKey)
+	if !ok {
+		return nil, false
+	}
+	tenant, ok := value.(*config.Tenant)
+	return tenant, ok
+}
+
+// getCookiePool 获取当前请求的 cookie 池,租户请求仅使用租户自己的 cookie 池
+func getCookiePool(c *gin.Context) []string {
+	if tenant, ok := getTenant(c); ok {
+		return tenant.GetCookies()
+	}
+	return config.GetGSCookies()
+}
+
+// newCookieManager 创建当前请求可用的 CookieManager,仅包含满足模型标签要求的 cookie
+func newCookieManager(c *gin.Context, modelName string) *config.CookieManager {
+	cookies := config.FilterCookiesByModel(getCookiePool(c), modelName)
+	if len(cookies) == 0 {
+		if tags := config.GetModelCookieTags(modelName); len(tags) > 0 {
+			logger.Warnf(c.Request.Context(), "no cookie matches tags %s required by model %s", config.FormatCookieTags(tags), modelName)
+		}
+	}
+	return config.NewCookieManagerWithCookies(cookies)
+}
+
+// resolveTierModel 没有 cookie 满足模型的标签要求(如只有免费账号可用)时,按 MODEL_TIER_FALLBACK 降配到
+// 有 cookie 可用的模型,并以 X-Actual-Model 响应头注明实际使用的模型
+func resolveTierModel(c *gin.Context, modelName string) string {
+	pool := getCookiePool(c)
+	if len(config.FilterCookiesByModel(pool, modelName)) > 0 {
+		return modelName
+	}
+	fallback := config.GetModelTierFallback(modelName)
+	if fallback == "" || fallback == modelName || len(config.FilterCookiesByModel(pool, fallback)) == 0 {
+		return modelName
+	}
+	logger.Warnf(c.Request.Context(), "no cookie matches tags required by model %s, falling back to %s", modelName, fallback)
+	c.Header("X-Actual-Model", fallback)
+	return fallback
+}
+
+// alertNoValidCookies 无可用 cookie 时告警,租户请求或模型有标签要求时注明范围,仅全局 cookie 池均不可用时按全部失效告警
+func alertNoValidCookies(c *gin.Context, modelName string, sample string) {
+	var scopes []string
+	if tenant, ok := getTenant(c); ok {
+		scopes = append(scopes, fmt.Sprintf("租户 %s", tenant.ID))
+	}
+	if tags := config.GetModelCookieTags(modelName); len(tags) > 0 {
+		scopes = append(scopes, fmt.Sprintf("模型 %s(标签 %s)", modelName, config.FormatCookieTags(tags)))
+	}
+	alert.NoValidCookies(strings.Join(scopes, " "), sample)
+}
+
+// logCookieTags 输出本次请求所选 cookie 的标签
+func logCookieTags(ctx context.Context, cookie string) {
+	if tags := config.GetCookieTags(cookie); len(tags) > 0 {
+		logger.Infof(ctx, "selected cookie tags: %s", config.FormatCookieTags(tags))
+	}
+}
+
+// getModelChatMap 获取当前请求的 Model 绑定 Chat 映射
+func getModelChatMap(c *gin.Context) map[string]string {
+	if tenant, ok := getTenant(c); ok {
+		return tenant.ModelChatMap
+	}
+	return config.ModelChatMap
+}
@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"genspark2api/common"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// threadRunWriter 在输出响应的同时记录响应体,用于提取助手回复
+type threadRunWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *threadRunWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *threadRunWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// CreateThread 新建会话,可携带初始消息
+func CreateThread(c *gin.Context) {
+	var req model.ThreadCreateRequest
+	// 请求体可为空
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		threadError(c, http.StatusBadRequest, "Invalid request parameters")
+		return
+	}
+
+	thread := config.Thread{
+		ID:        "thread_" + common.GetUUID(),
+		Object:    "thread",
+		CreatedAt: time.Now().Unix(),
+		Metadata:  req.Metadata,
+		Owner:     getCallerOwner(c),
+	}
+	for _, message := range req.Messages {
+		if err := validateThreadMessage(message); err != nil {
+			threadError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		thread.Messages = append(thread.Messages, newThreadMessage(thread.ID, message.Role, message.Content))
+	}
+
+	thread, err := config.GlobalThreadManager.Create(thread)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save thread: %v", err)
+		threadError(c, http.StatusInternalServerError, "Failed to save thread")
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// GetThread 查询会话
+func GetThread(c *gin.Context) {
+	thread, ok := getThread(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// DeleteThread 删除会话
+func DeleteThread(c *gin.Context) {
+	removed, err := config.GlobalThreadManager.Remove(c.Param("id"), getCallerOwner(c))
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save thread: %v", err)
+		threadError(c, http.StatusInternalServerError, "Failed to save thread")
+		return
+	}
+	if !removed {
+		threadError(c, http.StatusNotFound, "thread not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      c.Param("id"),
+		"object":  "thread.deleted",
+		"deleted": true,
+	})
+}
+
+// GetThreadMessages 按时间顺序列出会话消息
+func GetThreadMessages(c *gin.Context) {
+	thread, ok := getThread(c)
+	if !ok {
+		return
+	}
+	messages := thread.Messages
+	if messages == nil {
+		messages = []config.ThreadMessage{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   messages,
+	})
+}
+
+// CreateThreadMessage 向会话追加消息
+func CreateThreadMessage(c *gin.Context) {
+	var req model.ThreadMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		threadError(c, http.StatusBadRequest, "Invalid request parameters")
+		return
+	}
+	if err := validateThreadMessage(req); err != nil {
+		threadError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	message := newThreadMessage(c.Param("id"), req.Role, req.Content)
+	if !addThreadMessage(c, message) {
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+// CreateThreadRun 拼接会话历史调用对话接口,成功后将助手回复追加到会话
+// 请求参数同对话接口(messages 除外),instructions 作为系统消息置于历史之前
+func CreateThreadRun(c *gin.Context) {
+	thread, ok := getThread(c)
+	if !ok {
+		return
+	}
+
+	var body map[string]interface{}
+	if err := c.BindJSON(&body); err != nil {
+		threadError(c, http.StatusBadRequest, "Invalid request parameters")
+		return
+	}
+
+	var messages []model.OpenAIChatMessage
+	if instructions, ok := body["instructions"].(string); ok && instructions != "" {
+		messages = append(messages, model.OpenAIChatMessage{Role: "system", Content: instructions})
+	}
+	for _, message := range thread.Messages {
+		messages = append(messages, model.OpenAIChatMessage{Role: message.Role, Content: message.Content})
+	}
+	if len(messages) == 0 {
+		threadError(c, http.StatusBadRequest, "thread has no messages")
+		return
+	}
+	delete(body, "instructions")
+	body["messages"] = messages
+	// 历史由会话提供,上游每次新建对话,不经共享会话绑定与 FilterUserMessage 裁剪
+	c.Set(helper.ThreadRunKey, true)
+
+	jsonData, _ := json.Marshal(body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(jsonData))
+	writer := &threadRunWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	ChatForOpenAI(c)
+
+	if writer.Status() != http.StatusOK {
+		return
+	}
+	content := extractRunContent(writer.body.Bytes(), strings.HasPrefix(writer.Header().Get("Content-Type"), "text/event-stream"))
+	if content == "" {
+		return
+	}
+	message := newThreadMessage(thread.ID, "assistant", content)
+	if _, err := config.GlobalThreadManager.AddMessage(thread.ID, thread.Owner, message); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save thread: %v", err)
+	}
+}
+
+// extractRunContent 从对话接口的响应(流式或非流式)中提取助手回复
+func extractRunContent(body []byte, stream bool) string {
+	if !stream {
+		var response model.OpenAIChatCompletionResponse
+		if err := json.Unmarshal(body, &response); err != nil || len(response.Choices) == 0 || response.Choices[0].Message == nil {
+			return ""
+		}
+		return response.Choices[0].Message.Content
+	}
+
+	var builder strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk model.OpenAIChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || len(chunk.Choices) == 0 || chunk.Choices[0].Delta == nil {
+			continue
+		}
+		builder.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	return builder.String()
+}
+
+// getCallerOwner 调用方标识,按请求密钥区分(会话、批任务等仅对创建者可见),Anthropic 风格客户端使用 x-api-key
+func getCallerOwner(c *gin.Context) string {
+	secret := c.GetHeader("Authorization")
+	if secret == "" {
+		secret = c.GetHeader("x-api-key")
+	}
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func getThread(c *gin.Context) (config.Thread, bool) {
+	thread, ok := config.GlobalThreadManager.Get(c.Param("id"), getCallerOwner(c))
+	if !ok {
+		threadError(c, http.StatusNotFound, "thread not found")
+	}
+	return thread, ok
+}
+
+func addThreadMessage(c *gin.Context, message config.ThreadMessage) bool {
+	added, err := config.GlobalThreadManager.AddMessage(message.ThreadId, getCallerOwner(c), message)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to save thread: %v", err)
+		threadError(c, http.StatusInternalServerError, "Failed to save thread")
+		return false
+	}
+	if !added {
+		threadError(c, http.StatusNotFound, "thread not found")
+		return false
+	}
+	return true
+}
+
+func newThreadMessage(threadId string, role string, content interface{}) config.ThreadMessage {
+	return config.ThreadMessage{
+		ID:        "msg_" + common.GetUUID(),
+		Object:    "thread.message",
+		CreatedAt: time.Now().Unix(),
+		ThreadId:  threadId,
+		Role:      role,
+		Content:   content,
+	}
+}
+
+func validateThreadMessage(message model.ThreadMessageRequest) error {
+	if message.Role != "user" && message.Role != "assistant" {
+		return fmt.Errorf("invalid message role %q, must be user or assistant", message.Role)
+	}
+	if message.Content == nil {
+		return fmt.Errorf("message content is empty")
+	}
+	return nil
+}
+
+func threadError(c *gin.Context, status int, message string) {
+	c.JSON(status, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: i18n.Translate(c, message),
+			Type:    "invalid_request_error",
+			Code:    fmt.Sprint(status),
+		},
+	})
+}
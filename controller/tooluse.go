@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/tooluse"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// prepareToolRequest 将带工具定义的请求转为上游可处理的纯文本请求:
+// 历史中的工具调用与结果转为文本,工具说明拼接到最后一条 user 消息。
+// 历史含工具调用时为工具循环的后续轮次,未绑定会话时也携带完整历史,不再只保留最后一条 user 消息
+func prepareToolRequest(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) (model.OpenAIChatCompletionRequest, []tooluse.Tool) {
+	tools := tooluse.FromOpenAITools(openAIReq.Tools)
+	choice := tooluse.FromOpenAIChoice(openAIReq.ToolChoice)
+	if hasToolMessages(openAIReq.Messages) {
+		c.Set(helper.ToolHistoryKey, true)
+	}
+
+	openAIReq.Messages = tooluse.ConvertOpenAIMessages(openAIReq.Messages)
+	openAIReq.Tools = nil
+	openAIReq.ToolChoice = nil
+	// 关闭工具调用特性时忽略工具定义,历史消息仍转为文本以免上游无法理解
+	if choice.Mode == tooluse.ChoiceNone || len(tools) == 0 || !flagEnabled(c, config.FlagToolUse) {
+		return openAIReq, nil
+	}
+
+	prompt := tooluse.BuildPrompt(tools, choice)
+	for i := len(openAIReq.Messages) - 1; i >= 0; i-- {
+		if openAIReq.Messages[i].Role != "user" {
+			continue
+		}
+		switch content := openAIReq.Messages[i].Content.(type) {
+		case string:
+			openAIReq.Messages[i].Content = prompt + "\n\n" + content
+		case []interface{}:
+			openAIReq.Messages[i].Content = append([]interface{}{map[string]interface{}{"type": "text", "text": prompt}}, content...)
+		}
+		break
+	}
+	return openAIReq, tools
+}
+
+// completeChat 以非流式请求执行一次对话,失败时返回 nil 及暂存的错误响应
+func completeChat(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) (*model.OpenAIChatCompletionResponse, *bufferedWriter) {
+	openAIReq.Stream = false
+	setRequestBody(c, openAIReq)
+
+	writer := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+	c.Writer = writer
+	ChatForOpenAI(c)
+	c.Writer = writer.ResponseWriter
+
+	var response model.OpenAIChatCompletionResponse
+	if writer.status != http.StatusOK || json.Unmarshal(writer.body.Bytes(), &response) != nil || len(response.Choices) == 0 || response.Choices[0].Message == nil {
+		return nil, writer
+	}
+	return &response, writer
+}
+
+// streamChat 以流式请求执行一次对话,回答增量经 StreamFilter 分离思考段、拦截调用块后实时交给 onDelta 输出。
+// 返回汇总的回答及仍暂存在 filter 中的文本;尚未输出任何增量就失败时返回 nil 及暂存的错误响应
+func streamChat(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest, onDelta func(chunk model.OpenAIChatCompletionResponse, reasoning, text string)) (*model.OpenAIChatCompletionResponse, *tooluse.StreamFilter, *bufferedWriter) {
+	openAIReq.Stream = true
+	setRequestBody(c, openAIReq)
+
+	filter := &tooluse.StreamFilter{}
+	response := &model.OpenAIChatCompletionResponse{Object: "chat.completion"}
+	var finishReason *string
+	done, delivered := false, false
+	writer := &sseWriter{bufferedWriter: bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}}
+	writer.onEvent = func(data string) {
+		if data == "[DONE]" {
+			done = true
+			return
+		}
+		var chunk model.OpenAIChatCompletionResponse
+		if json.Unmarshal([]byte(data), &chunk) != nil || len(chunk.Choices) == 0 {
+			return
+		}
+		if response.ID == "" {
+			response.ID, response.Created, response.Model = chunk.ID, chunk.Created, chunk.Model
+		}
+		response.Usage = chunk.Usage
+		if chunk.Choices[0].FinishReason != nil {
+			finishReason = chunk.Choices[0].FinishReason
+		}
+		if delta := chunk.Choices[0].Delta; delta != nil && delta.Content != "" {
+			if reasoning, text := filter.Write(delta.Content); reasoning != "" || text != "" {
+				delivered = true
+				onDelta(chunk, reasoning, text)
+			}
+		}
+	}
+	c.Writer = writer
+	ChatForOpenAI(c)
+	c.Writer = writer.ResponseWriter
+
+	if !done && finishReason == nil {
+		if !delivered {
+			return nil, filter, &writer.bufferedWriter
+		}
+		logger.Warnf(c.Request.Context(), "tool stream interrupted: status %d", writer.status)
+	}
+	// 流式响应的分片只带各自增量的用量,完整用量取对话结束时记录的值
+	if usage, ok := c.Get(helper.UsageKey); ok {
+		response.Usage = usage.(model.OpenAIUsage)
+	}
+	response.Choices = []model.OpenAIChoice{{
+		Message:      &model.OpenAIMessage{Role: "assistant", Content: filter.Content()},
+		FinishReason: finishReason,
+	}}
+	return response, filter, &writer.bufferedWriter
+}
+
+// sseWriter 拦截对话的 SSE 输出,逐个事件将 data 交给 onEvent;非 SSE 的输出(如错误响应)暂存在 body 中
+type sseWriter struct {
+	bufferedWriter
+	onEvent func(data string)
+}
+
+func (w *sseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	for w.status == http.StatusOK {
+		index := bytes.Index(w.body.Bytes(), []byte("\n\n"))
+		if index < 0 {
+			break
+		}
+		event := string(w.body.Next(index + 2))
+		for _, line := range strings.Split(event, "\n") {
+			if data, ok := strings.CutPrefix(line, "data:"); ok {
+				w.onEvent(strings.TrimSpace(data))
+			}
+		}
+	}
+	return len(b), nil
+}
+
+func (w *sseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// setRequestBody 以 openAIReq 替换请求体,供复用 ChatForOpenAI 的对话流程
+func setRequestBody(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) {
+	jsonData, _ := json.Marshal(openAIReq)
+	c.Request.Body = io.NopCloser(bytes.NewReader(jsonData))
+}
+
+// parseToolCalls 解析回答中的工具调用,丢弃未定义或参数不符合 JSON Schema 的调用,并返回其校验错误
+func parseToolCalls(c *gin.Context, tools []tooluse.Tool, content string) (string, []tooluse.Call, []error) {
+	if len(tools) == 0 {
+		return content, nil, nil
+	}
+	text, calls := tooluse.Parse(content)
+	var validCalls []tooluse.Call
+	var errs []error
+	for _, call := range calls {
+		if err := tooluse.ValidateToolCall(tools, call); err != nil {
+			logger.Warnf(c.Request.Context(), "drop invalid tool call: %v", err)
+			errs = append(errs, err)
+			continue
+		}
+		validCalls = append(validCalls, call)
+	}
+	if len(validCalls) == 0 {
+		return content, nil, errs
+	}
+	return text, validCalls, errs
+}
+
+// resolveToolCalls 剥离回答开头的思考段后解析工具调用,存在不合法的调用时将校验错误回注给模型修正一次,
+// 修正后仍无合法调用时沿用原回答;修正请求的用量累加到 response 中。返回思考段、去掉调用块的文本与合法调用
+func resolveToolCalls(c *gin.Context, upstreamReq model.OpenAIChatCompletionRequest, tools []tooluse.Tool, response *model.OpenAIChatCompletionResponse) (string, string, []tooluse.Call) {
+	reasoning, answer := tooluse.SplitReasoning(response.Choices[0].Message.Content)
+	text, calls, errs := parseToolCalls(c, tools, answer)
+	if len(errs) == 0 || config.ToolCallRepair != 1 {
+		return reasoning, text, calls
+	}
+
+	// 未绑定会话时只发送最后一条 user 消息,因此修正指令追加到该消息中
+	repairReq := upstreamReq
+	repairReq.Messages = append([]model.OpenAIChatMessage(nil), upstreamReq.Messages...)
+	appendToLastUserMessage(repairReq.Messages, tooluse.BuildRepairPrompt(answer, errs))
+	repaired, writer := completeChat(c, repairReq)
+	if repaired == nil {
+		logger.Warnf(c.Request.Context(), "tool call repair failed: status %d", writer.status)
+		return reasoning, text, calls
+	}
+	response.Usage.PromptTokens += repaired.Usage.PromptTokens
+	response.Usage.CompletionTokens += repaired.Usage.CompletionTokens
+	response.Usage.TotalTokens += repaired.Usage.TotalTokens
+
+	repairedReasoning, repairedAnswer := tooluse.SplitReasoning(repaired.Choices[0].Message.Content)
+	repairedText, repairedCalls, repairedErrs := parseToolCalls(c, tools, repairedAnswer)
+	if len(repairedCalls) == 0 {
+		logger.Warnf(c.Request.Context(), "tool call repair produced no valid call")
+		return reasoning, text, calls
+	}
+	logger.Infof(c.Request.Context(), "tool call repaired, %d invalid before, %d invalid after", len(errs), len(repairedErrs))
+	return repairedReasoning, repairedText, repairedCalls
+}
+
+// appendToLastUserMessage 在最后一条 user 消息末尾追加文本
+func appendToLastUserMessage(messages []model.OpenAIChatMessage, text string) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		switch content := messages[i].Content.(type) {
+		case string:
+			messages[i].Content = content + "\n\n" + text
+		case []interface{}:
+			messages[i].Content = append(append([]interface{}(nil), content...), map[string]interface{}{"type": "text", "text": text})
+		}
+		return
+	}
+}
+
+// chatWithTools 处理带工具定义的 OpenAI 请求,上游回答中的调用块转为 tool_calls 返回
+func chatWithTools(c *gin.Context, openAIReq model.OpenAIChatCompletionRequest) {
+	upstreamReq, tools := prepareToolRequest(c, openAIReq)
+	if openAIReq.Stream {
+		streamChatWithTools(c, upstreamReq, tools)
+		return
+	}
+	response, writer := completeChat(c, upstreamReq)
+	if response == nil {
+		c.Data(writer.status, "application/json; charset=utf-8", writer.body.Bytes())
+		return
+	}
+
+	reasoning, text, calls := resolveToolCalls(c, upstreamReq, tools, response)
+	// OpenAI 格式的思考过程与普通回答一致,以 <think> 段放在文本开头
+	response.Choices[0].Message.Content = tooluse.JoinReasoning(reasoning, text)
+	response.Choices[0].Message.ToolCalls = tooluse.ToOpenAIToolCalls(calls, false)
+	response.Choices[0].FinishReason = toolFinishReason(response.Choices[0].FinishReason, calls)
+	// 覆盖 completeChat 暂存的原始回答
+	storeResponse(c, *response)
+	c.JSON(http.StatusOK, response)
+}
+
+// streamChatWithTools 流式请求上游并实时下发调用块之前的回答增量,回答结束后下发剩余文本与 tool_calls
+func streamChatWithTools(c *gin.Context, upstreamReq model.OpenAIChatCompletionRequest, tools []tooluse.Tool) {
+	thinking, thought, sent := false, false, false
+	// 思考段以 <think> 段放在文本开头,格式与 JoinReasoning 一致
+	send := func(responseId, modelName, reasoning, text string) error {
+		var delta string
+		if reasoning != "" {
+			if !thinking {
+				thinking = true
+				delta = "<think>\n"
+			}
+			delta += reasoning
+		}
+		if thinking && !thought && text != "" {
+			thought = true
+			delta += "\n</think>\n"
+		}
+		delta += text
+		sent = true
+		chunk := buildChatCompletionChunk(responseId, modelName, model.OpenAIDelta{Content: delta, Role: "assistant"}, nil, model.OpenAIUsage{})
+		return sendSSEvent(c, chunk)
+	}
+
+	response, filter, writer := streamChat(c, upstreamReq, func(chunk model.OpenAIChatCompletionResponse, reasoning, text string) {
+		send(chunk.ID, chunk.Model, reasoning, text)
+	})
+	if response == nil {
+		c.Data(writer.status, "application/json; charset=utf-8", writer.body.Bytes())
+		return
+	}
+
+	_, _, calls := resolveToolCalls(c, upstreamReq, tools, response)
+	restReasoning, restText := filter.Close(len(calls) > 0)
+	if thinking && !thought && restText == "" {
+		// 思考段未闭合时补上结束标记
+		restText = "\n</think>"
+		thought = true
+	}
+	c.Header("Content-Type", "text/event-stream")
+	if restReasoning != "" || restText != "" || !sent && len(calls) == 0 {
+		if err := send(response.ID, response.Model, restReasoning, restText); err != nil {
+			return
+		}
+	}
+	finishReason := toolFinishReason(response.Choices[0].FinishReason, calls)
+	chunk := buildChatCompletionChunk(response.ID, response.Model, model.OpenAIDelta{Role: "assistant", ToolCalls: tooluse.ToOpenAIToolCalls(calls, true)}, finishReason, response.Usage)
+	if err := sendSSEvent(c, chunk); err != nil {
+		return
+	}
+	c.SSEvent("", " [DONE]")
+}
+
+// toolFinishReason 存在工具调用时结束原因为 tool_calls,否则沿用上游的结束原因
+func toolFinishReason(finishReason *string, calls []tooluse.Call) *string {
+	reason := "stop"
+	if finishReason != nil {
+		reason = *finishReason
+	}
+	if len(calls) > 0 {
+		reason = "tool_calls"
+	}
+	return &reason
+}
+
+// hasToolMessages 历史中是否包含工具调用或工具结果,此类消息需转为文本后才能发往上游
+func hasToolMessages(messages []model.OpenAIChatMessage) bool {
+	for _, message := range messages {
+		if message.Role == "tool" || len(message.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
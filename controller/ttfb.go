@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"genspark2api/common/config"
+	"genspark2api/common/ttfb"
+	"github.com/deanxv/CycleTLS/cycletls"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errFirstEventTimeout = errors.New("upstream first event timeout")
+
+// awaitFirstEvent 等待上游首个事件并记录耗时,超过首事件超时时间时取消上游请求并返回超时错误
+// 返回的通道依次包含首事件与后续事件,返回的 cancel 取消上游请求并结束转发协程,调用方不再读取时需调用
+func awaitFirstEvent(sseChan <-chan cycletls.SSEResponse, cancel context.CancelFunc, modelName string) (<-chan cycletls.SSEResponse, context.CancelFunc, error) {
+	start := time.Now()
+	var timeout <-chan time.Time
+	if firstEventTimeout := config.GetRuntimeConfig().StreamFirstEventTimeout; firstEventTimeout > 0 {
+		timer := time.NewTimer(time.Duration(firstEventTimeout) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case first, ok := <-sseChan:
+		ttfb.Record(modelName, time.Since(start))
+		out := make(chan cycletls.SSEResponse, 1)
+		if !ok {
+			close(out)
+			return out, cancel, nil
+		}
+		out <- first
+		done := make(chan struct{})
+		var once sync.Once
+		stop := func() {
+			once.Do(func() { close(done) })
+			cancel()
+		}
+		go func() {
+			defer close(out)
+			for response := range sseChan {
+				select {
+				case out <- response:
+				case <-done:
+					return
+				}
+			}
+		}()
+		return out, stop, nil
+	case <-timeout:
+		ttfb.RecordTimeout(modelName)
+		cancel()
+		return nil, cancel, errFirstEventTimeout
+	}
+}
+
+// GetTTFBStats 获取流式首事件耗时统计
+func GetTTFBStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"timeout": config.GetRuntimeConfig().StreamFirstEventTimeout,
+			"models":  ttfb.Snapshot(),
+		},
+	})
+}
@@ -1,42 +1,73 @@
 package controller
 
 import (
-	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"genspark2api/common"
+	"genspark2api/common/alert"
 	"genspark2api/common/config"
+	"genspark2api/common/egress"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
 	logger "genspark2api/common/loggger"
+	"genspark2api/common/task"
+	"genspark2api/common/tlsclient"
 	"genspark2api/model"
 	"github.com/deanxv/CycleTLS/cycletls"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
-	"io"
 	"net/http"
 	"strings"
 	"time"
 )
 
 func VideosForOpenAI(c *gin.Context) {
+	if rejectOverloaded(c) {
+		return
+	}
 
-	client := cycletls.Init()
-	defer safeClose(client)
+	client := tlsclient.New()
+	defer client.Release()
 
 	var openAIReq model.VideosGenerationRequest
 	if err := c.BindJSON(&openAIReq); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+		c.JSON(400, errorBody(c, err.Error()))
+		return
+	}
+	c.Set(helper.ModelKey, openAIReq.Model)
+
+	// 模型名后缀参数,请求中显式指定的参数优先
+	var modelOptions common.ModelOptions
+	openAIReq.Model, modelOptions = common.ParseModelSuffix(openAIReq.Model)
+	if openAIReq.AspectRatio == "" {
+		openAIReq.AspectRatio = modelOptions.AspectRatio
+	}
+	if openAIReq.Duration == 0 {
+		openAIReq.Duration = modelOptions.Duration
+	}
+	openAIReq.Model = resolveTierModel(c, openAIReq.Model)
+
+	if !isVideoModel(openAIReq.Model) {
+		c.JSON(400, errorBody(c, "Invalid model"))
+		return
+	}
+
+	if limit := videoImageLimit(openAIReq.Model); len(openAIReq.GetImages()) > limit {
+		c.JSON(http.StatusBadRequest, errorBody(c, i18n.Message(c, i18n.VideoImagesExceeded, openAIReq.Model, limit)))
 		return
 	}
 
-	if lo.Contains(common.VideoModelList, openAIReq.Model) == false {
-		c.JSON(400, gin.H{"error": "Invalid model"})
+	if !checkMediaPrompt(c, openAIReq.Model, openAIReq.Prompt) {
 		return
 	}
 
-	resp, err := VideoProcess(c, client, openAIReq)
+	resp, err := VideoProcess(c, client.CycleTLS, openAIReq)
 	if err != nil {
 		logger.Errorf(c.Request.Context(), fmt.Sprintf("VideoProcess err  %v\n", err))
+		if respondGenerationCancelled(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
 				Message: err.Error(),
@@ -64,13 +95,15 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 		chatId     string
 	)
 
-	cookieManager := config.NewCookieManager()
+	defer startGenerationTask(c, generationVideo)()
+
+	cookieManager := newCookieManager(c, openAIReq.Model)
 	ctx := c.Request.Context()
 
 	// Initialize session manager and get initial cookie
 	if len(config.SessionImageChatMap) == 0 {
 		//logger.Warnf(ctx, "未配置环境变量 SESSION_IMAGE_CHAT_MAP, 可能会生图失败!")
-		maxRetries = len(cookieManager.Cookies)
+		maxRetries = config.LimitRetries(len(cookieManager.Cookies), config.GetRuntimeConfig().Retries.Video)
 
 		var err error
 		cookie, err = cookieManager.GetRandomCookie()
@@ -81,8 +114,13 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 	}
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		if generationCancelled(c) {
+			return nil, errGenerationCancelled
+		}
+		logCookieTags(ctx, cookie)
+		beginAttempt(c, cookie)
 		// Create request body
-		requestBody, err := createVideoRequestBody(c, cookie, &openAIReq, chatId)
+		requestBody, err := createVideoRequestBody(c, client, cookie, &openAIReq, chatId)
 		if err != nil {
 			logger.Errorf(ctx, "Failed to create request body: %v", err)
 			return nil, err
@@ -99,6 +137,7 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 		response, err := makeVideoRequest(client, jsonData, cookie)
 		if err != nil {
 			logger.Errorf(ctx, "Failed to make video request: %v", err)
+			endAttempt(c, attemptRequestError)
 			return nil, err
 		}
 
@@ -106,52 +145,61 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 
 		switch {
 		case common.IsRateLimit(body):
+			endAttempt(c, attemptRateLimit)
 			logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 			config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
 				return nil, fmt.Errorf(errNoValidCookies)
 			}
 			continue
 		case common.IsFreeLimit(body):
+			endAttempt(c, attemptFreeLimit)
 			logger.Warnf(ctx, "Cookie free rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 			config.AddRateLimitCookie(cookie, time.Now().Add(24*60*60*time.Second))
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
 				return nil, fmt.Errorf(errNoValidCookies)
 			}
 			continue
 		case common.IsNotLogin(body):
+			endAttempt(c, attemptNotLogin)
 			logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
 			cookie, err = cookieManager.GetNextCookie()
 			if err != nil {
 				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": errNoValidCookies})
 				return nil, fmt.Errorf(errNoValidCookies)
 			}
 			continue
 		case common.IsServerError(body):
+			endAttempt(c, attemptServerError)
 			logger.Errorf(ctx, errServerErrMsg)
+			alert.RecordUpstreamError(errServerErrMsg)
 			return nil, fmt.Errorf(errServerErrMsg)
 		case common.IsServerOverloaded(body):
+			endAttempt(c, attemptServerOverloaded)
 			logger.Errorf(ctx, fmt.Sprintf("Server overloaded, please try again later.%s", "官方服务超载"))
+			alert.RecordUpstreamError("Server overloaded")
 			return nil, fmt.Errorf("Server overloaded, please try again later.")
 		}
 
 		projectId, taskIDs := extractVideoTaskIDs(response.Body)
 		if len(taskIDs) == 0 {
 			logger.Errorf(ctx, "Response body: %s", response.Body)
+			endAttempt(c, attemptNoContent)
 			return nil, fmt.Errorf(errNoValidTaskIDs)
 		}
 
 		// Poll for image URLs
 		imageURLs := pollVideoTaskStatus(c, client, taskIDs, cookie)
+		if generationCancelled(c) {
+			return nil, abortGeneration(c, cookie, projectId)
+		}
 		if len(imageURLs) == 0 {
 			logger.Warnf(ctx, "No image URLs received, retrying with next cookie")
+			endAttempt(c, attemptNoContent)
 			continue
 		}
 
@@ -164,7 +212,7 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 		// Process image URLs
 		for _, url := range imageURLs {
 			data := &model.VideosGenerationDataResponse{
-				URL:           url,
+				URL:           archiveResultUrl(ctx, url),
 				RevisedPrompt: openAIReq.Prompt,
 			}
 
@@ -182,13 +230,14 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 
 		// Handle successful case
 		if len(result.Data) > 0 {
+			endAttempt(c, attemptOk)
 			// Delete temporary session if needed
 			if config.AutoDelChat == 1 {
-				go func() {
-					client := cycletls.Init()
-					defer safeClose(client)
-					makeDeleteRequest(client, cookie, projectId)
-				}()
+				task.Go("delete-chat", func() {
+					client := tlsclient.New()
+					defer client.Release()
+					makeDeleteRequest(client.CycleTLS, cookie, projectId)
+				})
 			}
 			return result, nil
 		}
@@ -196,10 +245,11 @@ func VideoProcess(c *gin.Context, client cycletls.CycleTLS, openAIReq model.Vide
 
 	// All retries exhausted
 	logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
+	alertNoValidCookies(c, openAIReq.Model, fmt.Sprintf("All cookies exhausted after %d attempts", maxRetries))
 	return nil, fmt.Errorf("all cookies are temporarily unavailable")
 }
 
-func createVideoRequestBody(c *gin.Context, cookie string, openAIReq *model.VideosGenerationRequest, chatId string) (map[string]interface{}, error) {
+func createVideoRequestBody(c *gin.Context, client cycletls.CycleTLS, cookie string, openAIReq *model.VideosGenerationRequest, chatId string) (map[string]interface{}, error) {
 
 	// 创建模型配置
 	modelConfigs := []map[string]interface{}{
@@ -214,28 +264,46 @@ func createVideoRequestBody(c *gin.Context, cookie string, openAIReq *model.Vide
 	// 创建消息数组
 	var messages []map[string]interface{}
 
-	if openAIReq.Image != "" {
-		var base64Data string
-
-		if strings.HasPrefix(openAIReq.Image, "http://") || strings.HasPrefix(openAIReq.Image, "https://") {
-			// 下载文件
-			bytes, err := fetchImageBytes(openAIReq.Image)
+	images := openAIReq.GetImages()
+	if _, ok := common.VideoMultiImageModels[openAIReq.Model]; ok && len(images) > 0 {
+		// 多张参考图/首尾帧逐张上传为文件,按传入顺序放在文本之前
+		content := make([]interface{}, 0, len(images)+1)
+		for i, image := range images {
+			privateFile, _, err := uploadImage(c, client, cookie, image)
 			if err != nil {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("fetchImageBytes err  %v\n", err))
-				return nil, fmt.Errorf("fetchImageBytes err  %v\n", err)
+				logger.Errorf(c.Request.Context(), "upload video image %d err: %v", i+1, err)
+				return nil, fmt.Errorf("upload image %d err: %v", i+1, err)
 			}
+			content = append(content, privateFile)
+		}
+		content = append(content, map[string]interface{}{
+			"type": "text",
+			"text": openAIReq.Prompt,
+		})
+		messages = []map[string]interface{}{
+			{
+				"role":    "user",
+				"content": content,
+			},
+		}
+	} else if len(images) > 0 {
+		image := images[0]
+		var base64Data string
 
-			contentType := http.DetectContentType(bytes)
-			if strings.HasPrefix(contentType, "image/") {
-				// 是图片类型，转换为base64
-				base64Data = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(bytes)
+		if strings.HasPrefix(image, "http://") || strings.HasPrefix(image, "https://") {
+			// 下载文件,是图片类型时转换为base64
+			var err error
+			base64Data, err = fetchImageBase64(image)
+			if err != nil {
+				logger.Errorf(c.Request.Context(), fmt.Sprintf("fetchImageBase64 err  %v\n", err))
+				return nil, fmt.Errorf("fetchImageBase64 err  %v\n", err)
 			}
-		} else if common.IsImageBase64(openAIReq.Image) {
+		} else if common.IsImageBase64(image) {
 			// 如果已经是 base64 格式
-			if !strings.HasPrefix(openAIReq.Image, "data:image") {
-				base64Data = "data:image/jpeg;base64," + openAIReq.Image
+			if !strings.HasPrefix(image, "data:image") {
+				base64Data = "data:image/jpeg;base64," + image
 			} else {
-				base64Data = openAIReq.Image
+				base64Data = image
 			}
 		}
 
@@ -293,75 +361,141 @@ func createVideoRequestBody(c *gin.Context, cookie string, openAIReq *model.Vide
 
 	logger.Debug(c.Request.Context(), fmt.Sprintf("RequestBody: %v", requestBody))
 
-	if strings.TrimSpace(config.RecaptchaProxyUrl) == "" ||
-		(!strings.HasPrefix(config.RecaptchaProxyUrl, "http://") &&
-			!strings.HasPrefix(config.RecaptchaProxyUrl, "https://")) {
-		return requestBody, nil
+	return cheat(requestBody, c, cookie)
+}
+
+// videoChatForOpenAI 通过对话接口调用视频模型,结果以 markdown 视频链接或 HTML video 标签返回
+// 流式请求在生成期间定时发送进度文本
+func videoChatForOpenAI(c *gin.Context, client *tlsclient.Client, openAIReq model.OpenAIChatCompletionRequest, modelOptions common.ModelOptions) {
+	videoReq := model.VideosGenerationRequest{
+		Model:       openAIReq.Model,
+		AspectRatio: config.VideoChatAspectRatio,
+		Duration:    config.VideoChatDuration,
+		Prompt:      openAIReq.GetUserText(),
+		AutoPrompt:  true,
+	}
+	if limit := videoImageLimit(videoReq.Model); limit > 1 {
+		videoReq.Images = lo.Slice(openAIReq.GetUserImageUrls(), 0, limit)
 	} else {
+		videoReq.Image = openAIReq.GetUserImageUrl()
+	}
+	if modelOptions.AspectRatio != "" {
+		videoReq.AspectRatio = modelOptions.AspectRatio
+	}
+	if modelOptions.Duration > 0 {
+		videoReq.Duration = modelOptions.Duration
+	}
+	if videoReq.Prompt == "" && len(videoReq.GetImages()) == 0 {
+		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.PromptRequired),
+				Type:    "invalid_request_error",
+				Param:   "messages",
+				Code:    "400",
+			},
+		})
+		return
+	}
 
-		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		client := &http.Client{Transport: tr}
+	if !checkMediaPrompt(c, videoReq.Model, videoReq.Prompt) {
+		return
+	}
 
-		// 检查并补充 RecaptchaProxyUrl 的末尾斜杠
-		if !strings.HasSuffix(config.RecaptchaProxyUrl, "/") {
-			config.RecaptchaProxyUrl += "/"
-		}
+	responseId := newResponseId()
+	promptJson, _ := json.Marshal(videoReq.Prompt)
 
-		// 创建请求
-		req, err := http.NewRequest("GET", fmt.Sprintf("%sgenspark", config.RecaptchaProxyUrl), nil)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("创建/genspark请求失败   %v\n", err))
-			return nil, err
+	type videoResult struct {
+		resp *model.VideosGenerationResponse
+		err  error
+	}
+	resultChan := make(chan videoResult, 1)
+	// 客户端断开后生成仍会继续,使用 Context 副本并持有 client 引用,避免使用已回收的资源
+	videoCtx := c.Copy()
+	client.Retain()
+	task.Go("video-generation", func() {
+		defer client.Release()
+		resp, err := VideoProcess(videoCtx, client.CycleTLS, videoReq)
+		resultChan <- videoResult{resp: resp, err: err}
+	})
+
+	var result videoResult
+	if openAIReq.Stream {
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Upstream-Model", openAIReq.Model)
+
+		sendProgress := func(content string) error {
+			return sendSSEvent(c, createStreamResponse(responseId, openAIReq.Model, promptJson, model.OpenAIDelta{Content: content, Role: "assistant"}, nil))
 		}
-
-		// 设置请求头
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Cookie", cookie)
-
-		// 发送请求
-		resp, err := client.Do(req)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("发送/genspark请求失败   %v\n", err))
-			return nil, err
+		if err := sendProgress("视频生成中"); err != nil {
+			return
 		}
-		defer resp.Body.Close()
-
-		// 读取响应体
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark响应失败   %v\n", err))
-			return nil, err
+		interval := config.VideoChatProgressInterval
+		if interval <= 0 {
+			interval = 10
 		}
-
-		type Response struct {
-			Code    int    `json:"code"`
-			Token   string `json:"token"`
-			Message string `json:"message"`
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+	WaitLoop:
+		for {
+			select {
+			case result = <-resultChan:
+				break WaitLoop
+			case <-ticker.C:
+				if err := sendProgress("."); err != nil {
+					return
+				}
+			case <-c.Request.Context().Done():
+				return
+			}
 		}
+	} else {
+		result = <-resultChan
+	}
 
-		if resp.StatusCode == 200 {
-			var response Response
-			if err := json.Unmarshal(body, &response); err != nil {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark JSON 失败   %v\n", err))
-				return nil, err
-			}
+	if result.err != nil {
+		logger.Errorf(c.Request.Context(), "VideoProcess err: %v", result.err)
+		if !errors.Is(result.err, errGenerationCancelled) {
+			alert.RecordUpstreamError(result.err.Error())
+		}
+		if openAIReq.Stream {
+			finishReason := "stop"
+			sendSSEvent(c, createStreamResponse(responseId, openAIReq.Model, promptJson, model.OpenAIDelta{Content: "\n\n视频生成失败: " + result.err.Error(), Role: "assistant"}, &finishReason))
+			c.SSEvent("", " [DONE]")
+			return
+		}
+		if respondGenerationCancelled(c, result.err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: result.err.Error(),
+				Type:    "request_error",
+				Code:    "500",
+			},
+		})
+		return
+	}
 
-			if response.Code == 200 {
-				logger.Debugf(c.Request.Context(), fmt.Sprintf("g_recaptcha_token: %v\n", response.Token))
-				requestBody["g_recaptcha_token"] = response.Token
-				logger.Infof(c.Request.Context(), fmt.Sprintf("cheat success!"))
-				return requestBody, nil
-			} else {
-				logger.Errorf(c.Request.Context(), fmt.Sprintf("读取/genspark token 失败   %v\n", err))
-				return nil, err
-			}
+	var content []string
+	for _, item := range result.resp.Data {
+		if config.VideoChatFormat == "html" {
+			content = append(content, fmt.Sprintf(`<video src="%s" controls></video>`, item.URL))
 		} else {
-			logger.Errorf(c.Request.Context(), fmt.Sprintf("请求/genspark失败   %v\n", err))
-			return nil, err
+			content = append(content, fmt.Sprintf("[Video](%s)", item.URL))
 		}
 	}
+
+	if openAIReq.Stream {
+		finishReason := "stop"
+		sendSSEvent(c, createStreamResponse(responseId, openAIReq.Model, promptJson, model.OpenAIDelta{Content: "\n\n" + strings.Join(content, "\n"), Role: "assistant"}, &finishReason))
+		c.SSEvent("", " [DONE]")
+		return
+	}
+	usage := buildTextUsage(openAIReq.Model, string(promptJson), strings.Join(content, "\n"))
+	setUsageHeaders(c, openAIReq.Model, openAIReq.Model, usage)
+	c.JSON(http.StatusOK, buildChatCompletion(responseId, openAIReq.Model, strings.Join(content, "\n"), "stop", usage))
 }
 
 func makeVideoRequest(client cycletls.CycleTLS, jsonData []byte, cookie string) (cycletls.Response, error) {
@@ -370,8 +504,8 @@ func makeVideoRequest(client cycletls.CycleTLS, jsonData []byte, cookie string)
 
 	return client.Do(apiEndpoint, cycletls.Options{
 		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome",
-		Timeout:   10 * 60 * 60,
-		Proxy:     config.ProxyUrl, // 在每个请求中设置代理
+		Timeout:   config.GetRuntimeConfig().Timeouts.Video,
+		Proxy:     egress.Proxy(), // 在每个请求中设置代理
 		Body:      string(jsonData),
 		Method:    "POST",
 		Headers: map[string]string{
@@ -453,13 +587,14 @@ func pollVideoTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []str
 
 	jsonData, err := json.Marshal(requestData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal request data"})
+		logger.Errorf(c.Request.Context(), "Failed to marshal request data: %v", err)
 		return imageURLs
 	}
 
-	sseChan, err := client.DoSSE("https://www.genspark.ai/api/vg_tasks_status", cycletls.Options{
-		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+	// 任务结束或被取消时关闭轮询的上游连接
+	sseChan, cancel, err := tlsclient.DoSSE(generationContext(c), "https://www.genspark.ai/api/vg_tasks_status", cycletls.Options{
+		Timeout: config.GetRuntimeConfig().Timeouts.Video,
+		Proxy:   egress.Proxy(), // 在每个请求中设置代理
 		Body:    string(jsonData),
 		Method:  "POST",
 		Headers: map[string]string{
@@ -475,6 +610,9 @@ func pollVideoTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []str
 		logger.Errorf(c, "Failed to make stream request: %v", err)
 		return imageURLs
 	}
+	defer cancel()
+	chunkSampler := logger.NewChunkSampler(c.Request.Context())
+	defer chunkSampler.Close()
 	for response := range sseChan {
 		if response.Done {
 			//logger.Warnf(c.Request.Context(), response.Data)
@@ -486,7 +624,7 @@ func pollVideoTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []str
 			continue
 		}
 
-		logger.Debug(c.Request.Context(), strings.TrimSpace(data))
+		chunkSampler.Log(data)
 
 		var responseData map[string]interface{}
 		if err := json.Unmarshal([]byte(data), &responseData); err != nil {
@@ -512,3 +650,11 @@ func pollVideoTaskStatus(c *gin.Context, client cycletls.CycleTLS, taskIDs []str
 
 	return imageURLs
 }
+
+// videoImageLimit 视频模型最多可传入的图片数
+func videoImageLimit(modelName string) int {
+	if limit, ok := common.VideoMultiImageModels[modelName]; ok {
+		return limit
+	}
+	return 1
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"genspark2api/common/charset"
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || config.GetCorsConfig().AllowOrigin(origin)
+	},
+}
+
+// wsResponseWriter 将对话接口的 SSE 输出逐个事件转为 WebSocket 消息,非 SSE 响应(如错误)整体作为一条消息发送
+type wsResponseWriter struct {
+	conn      *websocket.Conn
+	closed    chan bool
+	header    http.Header
+	status    int
+	size      int
+	written   bool
+	buffer    bytes.Buffer
+	sendError error
+}
+
+func newWsResponseWriter(conn *websocket.Conn, closed chan bool) *wsResponseWriter {
+	return &wsResponseWriter{
+		conn:   conn,
+		closed: closed,
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (w *wsResponseWriter) isEventStream() bool {
+	return strings.HasPrefix(w.header.Get("Content-Type"), "text/event-stream")
+}
+
+func (w *wsResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *wsResponseWriter) WriteHeader(code int) {
+	if !w.written {
+		w.status = code
+	}
+}
+
+func (w *wsResponseWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *wsResponseWriter) Write(b []byte) (int, error) {
+	if w.sendError != nil {
+		return 0, w.sendError
+	}
+	w.WriteHeaderNow()
+	w.buffer.Write(b)
+	w.size += len(b)
+	if w.isEventStream() {
+		w.sendEvents()
+	}
+	return len(b), w.sendError
+}
+
+func (w *wsResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *wsResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *wsResponseWriter) Size() int {
+	return w.size
+}
+
+func (w *wsResponseWriter) Written() bool {
+	return w.written
+}
+
+func (w *wsResponseWriter) Flush() {
+	if w.isEventStream() {
+		w.sendEvents()
+	}
+}
+
+func (w *wsResponseWriter) CloseNotify() <-chan bool {
+	return w.closed
+}
+
+func (w *wsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported on websocket response")
+}
+
+func (w *wsResponseWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// sendEvents 发送缓冲区中完整的 SSE 事件,每个事件的 data 作为一条消息
+func (w *wsResponseWriter) sendEvents() {
+	for w.sendError == nil {
+		data := w.buffer.Bytes()
+		end := bytes.Index(data, []byte("\n\n"))
+		if end < 0 {
+			return
+		}
+		var lines []string
+		for _, line := range strings.Split(string(data[:end]), "\n") {
+			if strings.HasPrefix(line, "data:") {
+				lines = append(lines, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			}
+		}
+		w.buffer.Next(end + 2)
+		if len(lines) > 0 {
+			w.sendError = w.conn.WriteMessage(websocket.TextMessage, []byte(strings.Join(lines, "\n")))
+		}
+	}
+}
+
+// finish 请求处理结束,发送剩余的非 SSE 响应体
+func (w *wsResponseWriter) finish() error {
+	if w.sendError == nil && !w.isEventStream() && w.buffer.Len() > 0 {
+		w.sendError = w.conn.WriteMessage(websocket.TextMessage, w.buffer.Bytes())
+	}
+	return w.sendError
+}
+
+// ChatForOpenAIWebSocket 通过 WebSocket 处理对话请求
+// 客户端每发送一条 OpenAI 请求 JSON,服务端以流式方式处理并将每个 chunk 作为一条消息下发,最后下发 [DONE]
+func ChatForOpenAIWebSocket(c *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "websocket upgrade err: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// 独立读取客户端消息,连接断开时通知正在处理的流式请求
+	messages := make(chan []byte)
+	closed := make(chan bool)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(closed)
+		defer close(messages)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for message := range messages {
+		message, _, _ = charset.ToUTF8(message, "")
+		var request map[string]interface{}
+		if err := json.Unmarshal(message, &request); err != nil {
+			if err := conn.WriteJSON(gin.H{"error": i18n.Message(c, i18n.InvalidRequest)}); err != nil {
+				return
+			}
+			continue
+		}
+		request["stream"] = true
+		body, _ := json.Marshal(request)
+
+		ctx := c.Copy()
+		ctx.Request = c.Request.Clone(c.Request.Context())
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		writer := newWsResponseWriter(conn, closed)
+		ctx.Writer = writer
+
+		ChatForOpenAI(ctx)
+		if err := writer.finish(); err != nil {
+			logger.Warnf(c.Request.Context(), "websocket write err: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"time"
+)
+
+// FieldMapReloadTask 定时检查字段映射文件,变更后热更新
+func FieldMapReloadTask() {
+	for {
+		time.Sleep(time.Duration(config.FieldMapReloadInterval) * time.Second)
+
+		reloaded, err := config.LoadFieldMap()
+		if err != nil {
+			logger.SysError("genspark2api FieldMapReloadTask reload failed: " + err.Error())
+			continue
+		}
+		if reloaded {
+			logger.SysLog("genspark2api FieldMapReloadTask field map reloaded!")
+		}
+	}
+}
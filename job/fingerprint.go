@@ -0,0 +1,24 @@
+package job
+
+import (
+	"genspark2api/common/config"
+	"genspark2api/common/fingerprint"
+	logger "genspark2api/common/loggger"
+	"time"
+)
+
+// FingerprintReloadTask 定时检查指纹规则文件,变更且样本校验通过后热更新
+func FingerprintReloadTask() {
+	for {
+		time.Sleep(time.Duration(config.FingerprintRulesReloadInterval) * time.Second)
+
+		reloaded, err := fingerprint.Load()
+		if err != nil {
+			logger.SysError("genspark2api FingerprintReloadTask reload failed: " + err.Error())
+			continue
+		}
+		if reloaded {
+			logger.SysLog("genspark2api FingerprintReloadTask fingerprint rules reloaded!")
+		}
+	}
+}
@@ -1,47 +1,112 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"genspark2api/check"
 	"genspark2api/common"
 	"genspark2api/common/config"
+	"genspark2api/common/connstat"
+	"genspark2api/common/egress"
 	logger "genspark2api/common/loggger"
+	"genspark2api/common/metrics"
+	"genspark2api/common/overload"
+	"genspark2api/common/recaptcha"
+	"genspark2api/common/resolver"
+	"genspark2api/common/storage"
+	"genspark2api/common/task"
+	"genspark2api/job"
 	"genspark2api/middleware"
 	"genspark2api/router"
 	"genspark2api/yescaptcha"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/net/netutil"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 func main() {
+	logger.LogDir = *common.LogDir
 	logger.SetupLogger()
 	logger.SysLog(fmt.Sprintf("genspark2api %s starting...", common.Version))
 
 	check.CheckEnvVariable()
 
-	if os.Getenv("GIN_MODE") != "debug" {
+	if config.GinMode != "debug" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	var err error
 
+	resolver.Init()
 	common.InitTokenEncoders()
 	config.InitGSCookies()
 	config.YescaptchaClient = yescaptcha.NewClient(config.YesCaptchaClientKey, nil)
 
 	config.GlobalSessionManager = config.NewSessionManager()
 
+	config.GlobalIpRuleManager, err = config.NewIpRuleManager()
+	if err != nil {
+		logger.FatalLog("failed to load ip rules: " + err.Error())
+	}
+
+	config.GlobalPresetManager, err = config.NewPresetManager()
+	if err != nil {
+		logger.FatalLog("failed to load presets: " + err.Error())
+	}
+
+	config.GlobalExperimentalModelManager, err = config.NewExperimentalModelManager()
+	if err != nil {
+		logger.FatalLog("failed to load experimental models: " + err.Error())
+	}
+
+	config.GlobalThreadManager, err = config.NewThreadManager()
+	if err != nil {
+		logger.FatalLog("failed to load threads: " + err.Error())
+	}
+
 	// 定时任务 每天9点整重载GS_COOKIES
 	//go job.LoadCookieTask()
 
+	if config.FieldMapPath != "" && config.FieldMapReloadInterval > 0 {
+		task.Daemon("field-map-reload", job.FieldMapReloadTask)
+	}
+	if config.FingerprintRulesPath != "" && config.FingerprintRulesReloadInterval > 0 {
+		task.Daemon("fingerprint-reload", job.FingerprintReloadTask)
+	}
+
+	task.Daemon("recaptcha-health-check", recaptcha.HealthCheckTask)
+
+	task.Daemon("egress-probe", egress.ProbeTask)
+
+	task.Daemon("metrics-flush", metrics.FlushTask)
+
+	task.Daemon("overload-watch", overload.WatchTask)
+
+	task.Go("storage-lifecycle", func() {
+		if err := storage.ApplyLifecycle(); err != nil {
+			logger.SysError("failed to apply storage lifecycle: " + err.Error())
+		}
+	})
+
 	server := gin.New()
+	// 仅信任 TRUSTED_PROXIES 中反向代理传入的 X-Forwarded-For,否则客户端可伪造 IP 绕过封禁与挑战
+	if err := server.SetTrustedProxies(config.TrustedProxyList()); err != nil {
+		logger.FatalLog("环境变量 TRUSTED_PROXIES 有误: " + err.Error())
+	}
 	server.Use(gin.Recovery())
 	server.Use(middleware.RequestId())
+	server.Use(middleware.Charset())
 	middleware.SetUpLogger(server)
 
 	router.SetRouter(server)
-	var port = os.Getenv("PORT")
+	var port = config.Port
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
 	}
@@ -52,10 +117,47 @@ func main() {
 
 	logger.SysLog("genspark2api start success. enjoy it! ^_^\n")
 
-	err = server.Run(":" + port)
+	server.UseH2C = config.ServerH2C == 1
+	httpServer := &http.Server{
+		Handler:      server.Handler(),
+		ReadTimeout:  time.Duration(config.ServerReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(config.ServerWriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(config.ServerIdleTimeout) * time.Second,
+		ConnState:    connstat.ConnState,
+	}
 
+	listener, err := net.Listen("tcp", ":"+port)
 	if err != nil {
-		logger.FatalLog("failed to start HTTP server: " + err.Error())
+		logger.FatalLog("failed to listen: " + err.Error())
+	}
+	if config.ServerMaxConnections > 0 {
+		listener = netutil.LimitListener(listener, config.ServerMaxConnections)
 	}
 
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.FatalLog("failed to start HTTP server: " + err.Error())
+		}
+	}()
+
+	// 收到 SIGTERM/SIGINT 后停止接收新请求,等待在途请求与后台任务结束(共用 SHUTDOWN_TIMEOUT)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-quit
+	logger.SysLog(fmt.Sprintf("received %s, shutting down...", sig))
+
+	timeout := time.Duration(config.ShutdownTimeout) * time.Second
+	deadline := time.Now().Add(timeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.SysError("failed to shutdown HTTP server: " + err.Error())
+	}
+	task.Shutdown(time.Until(deadline))
+	if config.MetricsPath != "" {
+		if err := metrics.Save(); err != nil {
+			logger.SysError("failed to save metrics: " + err.Error())
+		}
+	}
+	logger.SysLog("genspark2api stopped")
 }
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"genspark2api/common/abuse"
+	"genspark2api/common/config"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// ChallengeSolutionHeader 携带挑战答案(token:solution)的请求头
+const ChallengeSolutionHeader = "X-Challenge-Solution"
+
+// AbuseGuard 可疑来源先完成工作量证明挑战,窗口内 401/404 等响应过多的 IP 自动临时封禁
+func AbuseGuard() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		if !abuse.Enabled() || abuse.Whitelisted(clientIP) {
+			c.Next()
+			return
+		}
+
+		if abuse.Suspicious(clientIP, c.Request.UserAgent()) {
+			answer := c.GetHeader(ChallengeSolutionHeader)
+			if answer == "" || !abuse.Verify(clientIP, answer) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": gin.H{
+						"message": i18n.Message(c, i18n.ChallengeRequired),
+						"type":    "invalid_request_error",
+						"code":    "challenge_required",
+					},
+					"challenge": abuse.NewChallenge(clientIP),
+				})
+				return
+			}
+			logger.Infof(c.Request.Context(), "IP %s passed proof-of-work challenge", clientIP)
+		}
+
+		c.Next()
+
+		if config.AbuseBanThreshold <= 0 || !abuse.Tracked(c.Writer.Status()) {
+			return
+		}
+		if abuse.RecordFailure(clientIP) < config.AbuseBanThreshold {
+			return
+		}
+		abuse.Reset(clientIP)
+		if _, err := config.GlobalIpRuleManager.Add(config.IpRuleTypeBlack, clientIP, "auto ban: too many suspicious responses", time.Duration(config.AbuseBanDuration)*time.Second); err != nil {
+			logger.Errorf(c.Request.Context(), "failed to ban IP %s: %v", clientIP, err)
+			return
+		}
+		logger.Warnf(c.Request.Context(), "IP %s auto banned for %ds: too many %d responses", clientIP, config.AbuseBanDuration, c.Writer.Status())
+	}
+}
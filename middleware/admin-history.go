@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 变更记录中请求体的最大长度
+const adminHistoryBodyLimit = 4096
+
+// AdminHistory 记录管理接口的变更操作(非 GET 请求)及操作人,需挂在 Auth 之后
+func AdminHistory() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": i18n.AdminMessage(c, i18n.AdminInvalidParams),
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		c.Next()
+
+		operator, _ := c.Value(helper.OperatorKey).(model.AdminOperator)
+		body = redactAdminBody(body)
+		if len(body) > adminHistoryBodyLimit {
+			body = append(body[:adminHistoryBodyLimit:adminHistoryBodyLimit], "...(truncated)"...)
+		}
+		if err := config.RecordAdminOperation(config.AdminOperation{
+			Time:       time.Now(),
+			Operator:   operator.Name,
+			Role:       operator.Role,
+			AuthMethod: operator.AuthMethod,
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Body:       string(body),
+			Status:     c.Writer.Status(),
+		}); err != nil {
+			logger.Errorf(c.Request.Context(), "failed to record admin operation: %v", err)
+		}
+	}
+}
+
+// 变更记录中需脱敏的字段名(包含即脱敏,不区分大小写)
+var adminSensitiveFields = []string{"secret", "token", "password", "cookie", "api_key", "apikey"}
+
+// redactAdminBody 脱敏请求体中的密钥、cookie 等字段,非 JSON 请求体不记录内容
+func redactAdminBody(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []byte("(non-JSON body omitted)")
+	}
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return []byte("(non-JSON body omitted)")
+	}
+	return data
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			lower := strings.ToLower(key)
+			if lo.SomeBy(adminSensitiveFields, func(field string) bool { return strings.Contains(lower, field) }) {
+				v[key] = "***"
+				continue
+			}
+			v[key] = redactValue(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child)
+		}
+	}
+	return value
+}
@@ -1,7 +1,12 @@
 package middleware
 
 import (
+	"genspark2api/common/abuse"
 	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"genspark2api/common/oidc"
 	"genspark2api/model"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
@@ -9,20 +14,70 @@ import (
 	"strings"
 )
 
-func isValidSecret(secret string) bool {
+// isInvalidSecret 配置了 API_SECRET 且 secret 不在其中时返回 true,未配置 API_SECRET 时对话接口不鉴权
+func isInvalidSecret(secret string) bool {
 	return config.ApiSecret != "" && !lo.Contains(config.ApiSecrets, secret)
 }
 
+// recordAuthFailure 记录鉴权失败,连续失败达到阈值时自动封禁该IP
+func recordAuthFailure(c *gin.Context) {
+	if abuse.Whitelisted(c.ClientIP()) {
+		return
+	}
+	if config.GlobalIpRuleManager.RecordAuthFailure(c.ClientIP()) {
+		logger.Warnf(c.Request.Context(), "IP %s auto banned for %ds: too many auth failures", c.ClientIP(), config.IpAutoBanDuration)
+	}
+}
+
+// resolveTenant 通过 API key(租户 api_keys 或 key_prefix)识别租户,租户只由 key 决定,
+// 避免持有全局 API_SECRET 的调用方通过请求头访问任意租户
+func resolveTenant(secret string) (*config.Tenant, bool) {
+	return config.GetTenantByApiKey(secret)
+}
+
 func authHelper(c *gin.Context) {
+	// 管理接口仅接受已配置的 API_SECRET,未配置时只能通过 OIDC 访问
 	secret := c.Request.Header.Get("proxy-secret")
-	if isValidSecret(secret) {
+	if config.ApiSecret != "" && !isInvalidSecret(secret) {
+		c.Set(helper.OperatorKey, model.AdminOperator{Name: "proxy-secret", Role: config.AdminRoleAdmin, AuthMethod: "proxy-secret"})
+		config.GlobalIpRuleManager.ResetAuthFailure(c.ClientIP())
+		c.Next()
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !config.OidcEnabled() || token == "" {
+		recordAuthFailure(c)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidSecret),
+		})
+		c.Abort()
+		return
+	}
+
+	claims, err := oidc.Verify(c.Request.Context(), token)
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "OIDC token verification failed: %v", err)
+		recordAuthFailure(c)
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
-			"message": "无权进行此操作,未提供正确的 api-secret",
+			"message": i18n.AdminMessage(c, i18n.AdminInvalidToken),
 		})
 		c.Abort()
 		return
 	}
+	operator := model.AdminOperator{Name: claims.Identity(), Role: config.MapOidcRole(claims.Roles()), AuthMethod: "oidc"}
+	if operator.Role == "" || (operator.Role == config.AdminRoleViewer && c.Request.Method != http.MethodGet) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": i18n.AdminMessage(c, i18n.AdminRoleForbidden),
+		})
+		c.Abort()
+		return
+	}
+	c.Set(helper.OperatorKey, operator)
+	config.GlobalIpRuleManager.ResetAuthFailure(c.ClientIP())
 	c.Next()
 	return
 }
@@ -30,21 +85,50 @@ func authHelper(c *gin.Context) {
 func authHelperForOpenai(c *gin.Context) {
 	secret := c.Request.Header.Get("Authorization")
 	secret = strings.Replace(secret, "Bearer ", "", 1)
-	if isValidSecret(secret) {
+	if secret == "" {
+		// Anthropic 风格客户端通过 x-api-key 传递
+		secret = c.GetHeader("x-api-key")
+	}
+	if secret == "" && c.IsWebsocket() {
+		// 浏览器中的 WebSocket 无法设置请求头,允许通过查询参数传递
+		secret = c.Query("api_key")
+	}
+	tenant, hasTenant := resolveTenant(secret)
+	if isInvalidSecret(secret) && !(hasTenant && tenant.HasApiKey(secret)) {
+		recordAuthFailure(c)
 		c.JSON(http.StatusUnauthorized, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
-				Message: "authorization(api-secret)校验失败",
+				Message: i18n.Message(c, i18n.InvalidAuthorization),
 				Type:    "invalid_request_error",
 				Code:    "invalid_authorization",
 			},
 		})
 		c.Abort()
+		publishRejected(c)
+		return
+	}
+
+	// X-Tenant-Id 仅用于校验,须与 key 所属租户一致
+	if tenantId := c.GetHeader("X-Tenant-Id"); tenantId != "" && (!hasTenant || tenant.ID != tenantId) {
+		c.JSON(http.StatusForbidden, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: i18n.Message(c, i18n.TenantMismatch),
+				Type:    "invalid_request_error",
+				Code:    "invalid_tenant",
+			},
+		})
+		c.Abort()
+		publishRejected(c)
 		return
 	}
+	if hasTenant {
+		c.Set(config.TenantKey, tenant)
+	}
 
 	if config.ApiSecret == "" {
 		c.Request.Header.Set("Authorization", "")
 	}
+	config.GlobalIpRuleManager.ResetAuthFailure(c.ClientIP())
 
 	c.Next()
 	return
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"context"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"github.com/gin-gonic/gin"
+)
+
+// Canary 为请求染色:按请求头或比例分入金丝雀/稳定分组,分组写入响应头、日志与用量汇总,
+// 金丝雀分组的请求使用 Canary.Flags 中的特性开关值
+func Canary() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		cohort := config.PickCohort(c.GetHeader(config.CanaryHeader))
+		if cohort == "" {
+			c.Next()
+			return
+		}
+		c.Set(helper.CohortKey, cohort)
+		ctx := context.WithValue(c.Request.Context(), helper.CohortKey, cohort)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(config.CanaryHeader, cohort)
+		c.Next()
+	}
+}
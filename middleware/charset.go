@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"bytes"
+	"genspark2api/common/charset"
+	"genspark2api/common/i18n"
+	logger "genspark2api/common/loggger"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Charset 在 JSON 解析前将请求体统一转换为 UTF-8,兼容部分 Windows 客户端发送的带 BOM 或 GBK/UTF-16 编码的请求体
+func Charset() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.ContentLength == 0 {
+			c.Next()
+			return
+		}
+		mediaType, params, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if mediaType != "" && mediaType != "application/json" && mediaType != "text/plain" && !strings.HasSuffix(mediaType, "+json") {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Message(c, i18n.ReadBodyFailed)})
+			c.Abort()
+			return
+		}
+		converted, encoding, err := charset.ToUTF8(body, params["charset"])
+		if err != nil {
+			logger.Warnf(c.Request.Context(), "failed to convert request body to utf-8: %v", err)
+		}
+		if encoding != "" {
+			logger.Debugf(c.Request.Context(), "request body converted from %s to utf-8", encoding)
+			if _, ok := params["charset"]; ok {
+				params["charset"] = "utf-8"
+				c.Request.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+			}
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(converted))
+		c.Request.ContentLength = int64(len(converted))
+		c.Next()
+	}
+}
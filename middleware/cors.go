@@ -1,15 +1,65 @@
 package middleware
 
 import (
-	"github.com/gin-contrib/cors"
+	"genspark2api/common/config"
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"net/http"
+	"strconv"
+	"strings"
 )
 
 func CORS() gin.HandlerFunc {
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowCredentials = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"*"}
-	return cors.New(config)
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		cfg := config.GetCorsConfig()
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !cfg.AllowOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// 来源列表包含 * 时不回显来源也不允许携带凭证,携带凭证需配置明确的来源列表
+		header := c.Writer.Header()
+		if lo.Contains(cfg.AllowOrigins, "*") {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+			if cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if preflight {
+			header.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowMethods, ", "))
+			allowHeaders := cfg.AllowHeadersFor(c.GetHeader("Access-Control-Request-Headers"))
+			if lo.Contains(cfg.AllowHeaders, "*") {
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if allowHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if cfg.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		// SSE 等响应的自定义响应头需显式暴露给浏览器
+		if len(cfg.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposeHeaders, ", "))
+		}
+		c.Next()
+	}
 }
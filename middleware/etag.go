@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// etagWriter 暂存 GET 响应体以计算 ETag,调用 Flush(流式输出)后改为直接写出
+type etagWriter struct {
+	gin.ResponseWriter
+	body        bytes.Buffer
+	passthrough bool
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.body.WriteString(s)
+}
+
+func (w *etagWriter) Written() bool {
+	return w.body.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *etagWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		if w.body.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.body.Bytes())
+			w.body.Reset()
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// ETag 为成功的 GET 响应生成 ETag,请求的 If-None-Match 命中时返回 304 且不传输响应体;POST 等其他方法不处理
+func ETag() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet || c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		writer := &etagWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		if writer.passthrough {
+			return
+		}
+
+		body := writer.body.Bytes()
+		if writer.Status() != http.StatusOK {
+			_, _ = c.Writer.Write(body)
+			return
+		}
+		if notModified(c, body) {
+			return
+		}
+		_, _ = c.Writer.Write(body)
+	}
+}
+
+// notModified 设置 ETag 响应头,If-None-Match 命中时写出 304 并返回 true
+func notModified(c *gin.Context, body []byte) bool {
+	etag := computeETag(body)
+	c.Header("ETag", etag)
+	if !etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeader(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+	return true
+}
+
+func computeETag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// etagMatches 按弱比较判断 If-None-Match 是否包含 etag
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"genspark2api/common/events"
+	"genspark2api/common/helper"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// Events 向事件总线发布请求开始与完成(或错误)事件,未配置订阅者时直接跳过
+func Events() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !events.Enabled() {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		event := events.Event{
+			RequestId: c.GetString(helper.RequestIdKey),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+		}
+		if tenant, ok := getTenant(c); ok {
+			event.TenantId = tenant.ID
+		}
+		started := event
+		started.Type = events.TypeRequestStart
+		events.Publish(started)
+
+		c.Next()
+
+		event.Type = events.TypeRequestComplete
+		if c.Writer.Status() >= http.StatusBadRequest {
+			event.Type = events.TypeRequestError
+		}
+		event.Model = c.GetString(helper.ModelKey)
+		event.Status = c.Writer.Status()
+		event.DurationMs = time.Since(start).Milliseconds()
+		if value, ok := c.Get(helper.UsageKey); ok {
+			usage := value.(model.OpenAIUsage)
+			event.PromptTokens, event.CompletionTokens = usage.PromptTokens, usage.CompletionTokens
+		}
+		events.Publish(event)
+	}
+}
+
+// publishRejected 鉴权失败的请求不会到达 Events,由鉴权中间件在拒绝后发布 request.error 事件
+func publishRejected(c *gin.Context) {
+	if !events.Enabled() {
+		return
+	}
+	events.Publish(events.Event{
+		Type:      events.TypeRequestError,
+		RequestId: c.GetString(helper.RequestIdKey),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Status:    c.Writer.Status(),
+	})
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"genspark2api/common/idempotency"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyWriter 记录首次请求的响应体,以及响应头写出后才出现的错误状态(如流式响应中途上游出错)
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body   bytes.Buffer
+	failed bool
+}
+
+func (w *idempotencyWriter) WriteHeader(code int) {
+	if w.Written() && (code < http.StatusOK || code >= http.StatusMultipleChoices) {
+		w.failed = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// completed 响应是否正常结束:非 2xx、中途出错或流式响应未以结束事件收尾时均视为失败
+func (w *idempotencyWriter) completed() bool {
+	if w.failed || w.Status() < http.StatusOK || w.Status() >= http.StatusMultipleChoices {
+		return false
+	}
+	return streamCompleted(w.Header(), w.body.String())
+}
+
+// streamCompleted 非流式响应直接视为结束;流式响应的最后一个事件须为 OpenAI 风格的 [DONE] 或 Anthropic 风格的 message_stop
+func streamCompleted(header http.Header, body string) bool {
+	if !strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		return true
+	}
+	events := strings.Split(strings.TrimSpace(body), "\n\n")
+	last := events[len(events)-1]
+	return strings.Contains(last, "data: [DONE]") || strings.HasPrefix(last, "event:message_stop")
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency 携带 Idempotency-Key 的请求在有效期内重复提交时直接回放首次成功的响应,不再请求上游
+func Idempotency() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" || config.IdempotencyExpireDuration <= 0 || !config.FlagEnabledFor(c.GetString(helper.CohortKey), config.FlagCache) || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Message(c, i18n.ReadBodyFailed)})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		bodyHash := sha256.Sum256(body)
+
+		// 幂等键按调用方密钥与接口隔离
+		scope := sha256.Sum256([]byte(c.GetHeader("Authorization") + "\n" + c.FullPath() + "\n" + key))
+		storeKey := hex.EncodeToString(scope[:])
+
+		for {
+			first, done, mismatch := idempotency.Begin(storeKey, hex.EncodeToString(bodyHash[:]), time.Duration(config.IdempotencyExpireDuration)*time.Second)
+			if mismatch {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": i18n.Message(c, i18n.IdempotencyConflict)})
+				c.Abort()
+				return
+			}
+			if first {
+				break
+			}
+
+			// 等待首次请求完成后回放其结果,首次请求失败时重新作为首次请求处理
+			select {
+			case <-done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+			if result, ok := idempotency.Get(storeKey); ok {
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(result.Status, result.ContentType, result.Body)
+				c.Abort()
+				return
+			}
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() {
+			// 仅缓存正常结束的响应,失败时允许客户端使用同一幂等键重试
+			if writer.completed() {
+				idempotency.Finish(storeKey, &idempotency.Result{
+					Status:      writer.Status(),
+					ContentType: writer.Header().Get("Content-Type"),
+					Body:        writer.body.Bytes(),
+				})
+			} else {
+				idempotency.Finish(storeKey, nil)
+			}
+		}()
+		c.Next()
+	}
+}
@@ -2,9 +2,9 @@ package middleware
 
 import (
 	"genspark2api/common/config"
+	"genspark2api/common/i18n"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strings"
 )
 
 // IPBlacklistMiddleware 检查请求的IP是否在黑名单中
@@ -13,13 +13,11 @@ func IPBlacklistMiddleware() gin.HandlerFunc {
 		// 获取请求的IP地址
 		clientIP := c.ClientIP()
 
-		// 检查IP是否在黑名单中
-		for _, blockedIP := range config.IpBlackList {
-			if strings.TrimSpace(blockedIP) == clientIP {
-				// 如果在黑名单中，返回403 Forbidden
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-				return
-			}
+		// 检查IP是否被黑白名单规则拦截(支持CIDR段及临时封禁)
+		if !config.GlobalIpRuleManager.IsAllowed(clientIP) {
+			// 如果被拦截，返回403 Forbidden
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": i18n.Message(c, i18n.Forbidden)})
+			return
 		}
 
 		// 如果不在黑名单中，继续处理请求
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"genspark2api/common/helper"
 	"github.com/gin-gonic/gin"
+	"net/url"
+	"strings"
 )
 
 func SetUpLogger(server *gin.Engine) {
@@ -11,6 +13,9 @@ func SetUpLogger(server *gin.Engine) {
 		var requestID string
 		if param.Keys != nil {
 			requestID = param.Keys[helper.RequestIdKey].(string)
+			if cohort, ok := param.Keys[helper.CohortKey].(string); ok {
+				requestID += "(" + cohort + ")"
+			}
 		}
 		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
 			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
@@ -19,7 +24,24 @@ func SetUpLogger(server *gin.Engine) {
 			param.Latency,
 			param.ClientIP,
 			param.Method,
-			param.Path,
+			redactPath(param.Path),
 		)
 	}))
 }
+
+// redactPath 隐藏查询参数中的密钥(WebSocket 通过 api_key 传递),避免写入访问日志
+func redactPath(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return base
+	}
+	if _, ok := query["api_key"]; !ok {
+		return path
+	}
+	query.Set("api_key", "redacted")
+	return base + "?" + query.Encode()
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"genspark2api/common/helper"
+	"genspark2api/common/metrics"
+	"genspark2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// metricsTailSize 为判断流式响应是否正常结束而保留的响应末尾字节数
+const metricsTailSize = 256
+
+// metricsWriter 记录响应头写出后才出现的错误状态与响应末尾,用于按最终状态判断流式请求是否成功
+type metricsWriter struct {
+	gin.ResponseWriter
+	tail   []byte
+	failed bool
+}
+
+func (w *metricsWriter) WriteHeader(code int) {
+	if w.Written() && code >= http.StatusBadRequest {
+		w.failed = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	w.keep(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *metricsWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *metricsWriter) keep(b []byte) {
+	w.tail = append(w.tail, b...)
+	if len(w.tail) > metricsTailSize {
+		w.tail = w.tail[len(w.tail)-metricsTailSize:]
+	}
+}
+
+// succeeded 状态码小于 400、未中途出错,且流式响应以结束事件收尾
+func (w *metricsWriter) succeeded() bool {
+	if w.failed || w.Status() >= http.StatusBadRequest {
+		return false
+	}
+	return streamCompleted(w.Header(), string(w.tail))
+}
+
+// Metrics 记录对话/生图/生视频请求的结果与用量,按 model 汇总;流式请求按最终状态判断成功与否
+func Metrics() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		writer := &metricsWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if c.Request.Method != http.MethodPost {
+			return
+		}
+		modelName := c.GetString(helper.ModelKey)
+		if modelName == "" {
+			return
+		}
+		var promptTokens, completionTokens int
+		if value, ok := c.Get(helper.UsageKey); ok {
+			usage := value.(model.OpenAIUsage)
+			promptTokens, completionTokens = usage.PromptTokens, usage.CompletionTokens
+		}
+		metrics.Record(modelName, c.GetString(helper.CohortKey), writer.succeeded(), promptTokens, completionTokens)
+	}
+}
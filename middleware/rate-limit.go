@@ -3,6 +3,7 @@ package middleware
 import (
 	"genspark2api/common"
 	"genspark2api/common/config"
+	"genspark2api/common/i18n"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -16,7 +17,7 @@ func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark s
 	if !inMemoryRateLimiter.Request(key, maxRequestNum, duration) {
 		c.JSON(http.StatusTooManyRequests, gin.H{
 			"success": false,
-			"message": "请求过于频繁,请稍后再试",
+			"message": i18n.AdminMessage(c, i18n.AdminTooManyRequests),
 		})
 		c.Abort()
 		return
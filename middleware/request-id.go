@@ -2,17 +2,70 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"genspark2api/common/helper"
 	"github.com/gin-gonic/gin"
+	"regexp"
+	"strings"
 )
 
+// 客户端传入的 X-Request-ID 仅接受安全字符
+var requestIdRegex = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
 func RequestId() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		id := helper.GenRequestID()
+		id := c.GetHeader(helper.RequestIdKey)
+		if !requestIdRegex.MatchString(id) {
+			id = helper.GenRequestID()
+		}
 		c.Set(helper.RequestIdKey, id)
 		ctx := context.WithValue(c.Request.Context(), helper.RequestIdKey, id)
 		c.Request = c.Request.WithContext(ctx)
 		c.Header(helper.RequestIdKey, id)
+
+		writer := &errorBodyWriter{ResponseWriter: c.Writer, requestId: id}
+		c.Writer = writer
 		c.Next()
+		writer.flush()
+	}
+}
+
+// errorBodyWriter 缓存 JSON 错误响应体,结束时追加 request_id 字段
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	requestId string
+	body      []byte
+}
+
+func (w *errorBodyWriter) isJsonError() bool {
+	return w.Status() >= 400 && strings.Contains(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *errorBodyWriter) Write(b []byte) (int, error) {
+	if w.isJsonError() {
+		w.body = append(w.body, b...)
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorBodyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *errorBodyWriter) flush() {
+	if len(w.body) == 0 {
+		return
+	}
+	body := w.body
+	w.body = nil
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(body, &resp); err == nil {
+		resp["request_id"] = w.requestId
+		if data, err := json.Marshal(resp); err == nil {
+			body = data
+		}
 	}
+	_, _ = w.ResponseWriter.Write(body)
 }
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"genspark2api/common/config"
+	"genspark2api/common/helper"
+	"genspark2api/common/i18n"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var auditMutex sync.Mutex
+
+func getTenant(c *gin.Context) (*config.Tenant, bool) {
+	value, ok := c.Get(config.TenantKey)
+	if !ok {
+		return nil, false
+	}
+	tenant, ok := value.(*config.Tenant)
+	return tenant, ok
+}
+
+// TenantRateLimit 按租户配置的速率限制
+func TenantRateLimit() func(c *gin.Context) {
+	inMemoryRateLimiter.Init(config.RateLimitKeyExpirationDuration)
+	return func(c *gin.Context) {
+		tenant, ok := getTenant(c)
+		if !ok || tenant.RateLimit <= 0 {
+			c.Next()
+			return
+		}
+		if !inMemoryRateLimiter.Request("TENANT_RATE_LIMIT"+tenant.ID, tenant.RateLimit, config.RequestRateLimitDuration) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success": false,
+				"message": i18n.AdminMessage(c, i18n.AdminTooManyRequests),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// TenantAudit 按租户记录审计日志
+func TenantAudit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		tenant, ok := getTenant(c)
+		if !ok {
+			return
+		}
+
+		entry := gin.H{
+			"time":       start.Format("2006-01-02 15:04:05"),
+			"request_id": c.GetString(helper.RequestIdKey),
+			"tenant":     tenant.ID,
+			"ip":         c.ClientIP(),
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"latency_ms": time.Since(start).Milliseconds(),
+		}
+		if metadata, ok := c.Get(helper.MetadataKey); ok {
+			entry["metadata"] = metadata
+		}
+		if store, ok := c.Get(helper.StoreKey); ok {
+			entry["store"] = store
+		}
+		if contentGuard, ok := c.Get(helper.ContentGuardKey); ok {
+			entry["content_guard"] = contentGuard
+		}
+		record, _ := json.Marshal(entry)
+
+		auditMutex.Lock()
+		defer auditMutex.Unlock()
+		if err := os.MkdirAll(config.TenantAuditDir, 0755); err != nil {
+			return
+		}
+		fd, err := os.OpenFile(filepath.Join(config.TenantAuditDir, fmt.Sprintf("%s.log", tenant.ID)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return
+		}
+		defer fd.Close()
+		_, _ = fd.Write(append(record, '\n'))
+	}
+}
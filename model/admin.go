@@ -0,0 +1,8 @@
+package model
+
+// AdminOperator 管理接口的操作人,由鉴权中间件写入上下文
+type AdminOperator struct {
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	AuthMethod string `json:"auth_method"` // proxy-secret 或 oidc
+}
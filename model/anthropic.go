@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// AnthropicMessagesRequest Anthropic /v1/messages 请求
+type AnthropicMessagesRequest struct {
+	Model      string                 `json:"model"`
+	MaxTokens  int                    `json:"max_tokens"`
+	System     interface{}            `json:"system,omitempty"` // 字符串或 text content block 数组
+	Messages   []AnthropicMessage     `json:"messages"`
+	Tools      []AnthropicTool        `json:"tools,omitempty"`
+	ToolChoice *AnthropicToolChoice   `json:"tool_choice,omitempty"`
+	Stream     bool                   `json:"stream"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Thinking   *AnthropicThinking     `json:"thinking,omitempty"`
+}
+
+// AnthropicThinking 扩展思考参数,Type 为 enabled 时才返回 thinking 内容块
+type AnthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// ThinkingEnabled 请求是否开启扩展思考
+func (r AnthropicMessagesRequest) ThinkingEnabled() bool {
+	return r.Thinking != nil && r.Thinking.Type == "enabled"
+}
+
+// AnthropicMessage 消息,Content 为字符串或 content block 数组
+type AnthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// AnthropicContentBlock content block,按 Type 使用不同字段(text/image/tool_use/tool_result)
+type AnthropicContentBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`  // thinking block 的思考过程
+	Signature string                `json:"signature,omitempty"` // thinking block 的签名
+	Source    *AnthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseId string                `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage       `json:"content,omitempty"` // tool_result 的结果,字符串或 content block 数组
+	IsError   bool                  `json:"is_error,omitempty"`
+}
+
+type AnthropicImageSource struct {
+	Type      string `json:"type"` // base64 或 url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// AnthropicTool 工具定义
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// AnthropicToolChoice 工具选择,Type 为 auto/any/tool/none
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type AnthropicMessagesResponse struct {
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role"`
+	Model        string                  `json:"model"`
+	Content      []AnthropicContentBlock `json:"content"`
+	StopReason   *string                 `json:"stop_reason"`
+	StopSequence *string                 `json:"stop_sequence"`
+	Usage        AnthropicUsage          `json:"usage"`
+}
+
+type AnthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type AnthropicErrorResponse struct {
+	Type  string         `json:"type"`
+	Error AnthropicError `json:"error"`
+}
+
+type AnthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ParseAnthropicContent 解析字符串或 content block 数组形式的内容,字符串视为单个 text block
+func ParseAnthropicContent(content json.RawMessage) ([]AnthropicContentBlock, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return []AnthropicContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []AnthropicContentBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// GetSystemText 获取 system 文本(兼容字符串与 text block 数组)
+func (r *AnthropicMessagesRequest) GetSystemText() string {
+	switch system := r.System.(type) {
+	case string:
+		return system
+	case []interface{}:
+		var texts []string
+		for _, block := range system {
+			if blockMap, ok := block.(map[string]interface{}); ok && blockMap["type"] == "text" {
+				if text, ok := blockMap["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
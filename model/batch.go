@@ -0,0 +1,41 @@
+package model
+
+import "encoding/json"
+
+type BatchRequest struct {
+	Requests []BatchRequestItem `json:"requests"`
+}
+
+type BatchRequestItem struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type BatchResponse struct {
+	ID            string             `json:"id"`
+	Object        string             `json:"object"`
+	Status        string             `json:"status"`
+	CreatedAt     int64              `json:"created_at"`
+	CompletedAt   *int64             `json:"completed_at"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+}
+
+type BatchResultItem struct {
+	ID       string               `json:"id"`
+	CustomId string               `json:"custom_id"`
+	Response *BatchResultResponse `json:"response"`
+	Error    *OpenAIError         `json:"error"`
+}
+
+type BatchResultResponse struct {
+	StatusCode int             `json:"status_code"`
+	Body       json.RawMessage `json:"body"`
+}
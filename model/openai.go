@@ -1,14 +1,46 @@
 package model
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
 
 type OpenAIChatCompletionRequest struct {
-	Model    string              `json:"model"`
-	Stream   bool                `json:"stream"`
-	Messages []OpenAIChatMessage `json:"messages"`
+	Model      string              `json:"model"`
+	Stream     bool                `json:"stream"`
+	Messages   []OpenAIChatMessage `json:"messages"`
+	Store      *bool               `json:"store,omitempty"`
+	Metadata   map[string]string   `json:"metadata,omitempty"`
+	Language   string              `json:"language,omitempty"`
+	Preset     string              `json:"preset,omitempty"`
+	Tools      []OpenAITool        `json:"tools,omitempty"`
+	ToolChoice interface{}         `json:"tool_choice,omitempty"`
+	// 文本对话中检测到画图意图时自动调用生图模型,传 {} 即使用默认生图模型
+	ImageGeneration *ChatImageGeneration `json:"image_generation,omitempty"`
+	Reasoning       *ChatReasoning       `json:"reasoning,omitempty"`
+	// 已拼好的 ChatML 等原始文本,不做消息结构转换,作为单条 user 消息发送(忽略 messages 与 tools)
+	RawPrompt string `json:"raw_prompt,omitempty"`
+	// 规范化输出的 markdown,未设置时使用特性开关 markdown_normalize
+	NormalizeMarkdown *bool `json:"normalize_markdown,omitempty"`
+	// 调用方的终端用户标识,SESSION_NAMESPACE=user 时用于隔离自动绑定的会话
+	User string `json:"user,omitempty"`
 	OpenAIChatCompletionExtraRequest
 }
 
+// ChatReasoning 思考过程的输出控制,Exclude 为 true 时不下发思考过程
+type ChatReasoning struct {
+	Exclude bool `json:"exclude,omitempty"`
+}
+
+// ChatImageGeneration 对话中自动生图的参数
+type ChatImageGeneration struct {
+	Model       string `json:"model,omitempty"` // 为空时使用 CHAT_IMAGE_MODEL
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+}
+
 type OpenAIChatCompletionExtraRequest struct {
 	ChannelId *string `json:"channelId"`
 }
@@ -20,10 +52,38 @@ type SessionState struct {
 	AnswerIsFinished bool     `json:"answer_is_finished"`
 }
 type OpenAIChatMessage struct {
-	Role         string        `json:"role"`
-	Content      interface{}   `json:"content"`
-	IsPrompt     bool          `json:"is_prompt"`
-	SessionState *SessionState `json:"session_state"`
+	Role         string           `json:"role"`
+	Content      interface{}      `json:"content"`
+	IsPrompt     bool             `json:"is_prompt"`
+	SessionState *SessionState    `json:"session_state"`
+	ToolCalls    []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallId   string           `json:"tool_call_id,omitempty"`
+	Name         string           `json:"name,omitempty"`
+}
+
+// OpenAITool 工具定义,目前仅支持 function 类型
+type OpenAITool struct {
+	Type     string             `json:"type"`
+	Function OpenAIToolFunction `json:"function"`
+}
+
+type OpenAIToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// OpenAIToolCall 助手消息中的工具调用,Index 仅在流式增量中使用
+type OpenAIToolCall struct {
+	Index    *int                   `json:"index,omitempty"`
+	ID       string                 `json:"id"`
+	Type     string                 `json:"type"`
+	Function OpenAIToolCallFunction `json:"function"`
+}
+
+type OpenAIToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
 
 func (r *OpenAIChatCompletionRequest) AddMessage(message OpenAIChatMessage) {
@@ -71,7 +131,157 @@ func (r *OpenAIChatCompletionRequest) SystemMessagesProcess(model string) {
 	}
 }
 
-func (r *OpenAIChatCompletionRequest) FilterUserMessage() {
+// 系统消息超出长度预算时的处理方式
+const (
+	SystemOverflowTruncate = "truncate"  // 保留开头
+	SystemOverflowHeadTail = "head_tail" // 保留首尾,省略中间部分
+)
+
+// SystemMessageStats 系统消息的条数与各条长度(字符)
+type SystemMessageStats struct {
+	Count   int   `json:"count"`
+	Lengths []int `json:"lengths"`
+}
+
+// Total 系统消息总长度
+func (s SystemMessageStats) Total() int {
+	total := 0
+	for _, length := range s.Lengths {
+		total += length
+	}
+	return total
+}
+
+// LimitSystemMessages 条数超过 maxCount 时将纯文本系统消息合并为一条(位于第一条系统消息处),
+// 总长度超过 maxLength 时分配预算并按 overflow 截断,0 为不限制;返回处理前后的统计
+func (r *OpenAIChatCompletionRequest) LimitSystemMessages(maxCount int, maxLength int, overflow string) (SystemMessageStats, SystemMessageStats) {
+	before := r.systemMessageStats()
+	if maxCount > 0 && before.Count > maxCount {
+		r.mergeSystemMessages()
+	}
+
+	if stats := r.systemMessageStats(); maxLength > 0 && stats.Total() > maxLength {
+		budgets := allocateBudgets(stats.Lengths, maxLength)
+		index := 0
+		for i, message := range r.Messages {
+			if text, ok := systemText(message); ok {
+				r.Messages[i].Content = shortenText(text, budgets[index], overflow)
+				index++
+			}
+		}
+	}
+	return before, r.systemMessageStats()
+}
+
+// allocateBudgets 在各条之间平分 maxLength,短于平均预算的消息保留全文,余下预算再分给较长的消息;
+// 每条至少保留 1 个字符,不会因预算不足删除消息
+func allocateBudgets(lengths []int, maxLength int) []int {
+	order := make([]int, len(lengths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lengths[order[i]] < lengths[order[j]]
+	})
+
+	budgets := make([]int, len(lengths))
+	remaining := maxLength
+	for n, i := range order {
+		share := max(remaining/(len(order)-n), 1)
+		budgets[i] = min(lengths[i], share)
+		remaining = max(remaining-budgets[i], 0)
+	}
+	return budgets
+}
+
+// mergeSystemMessages 将纯文本系统消息按顺序合并为一条
+func (r *OpenAIChatCompletionRequest) mergeSystemMessages() {
+	var texts []string
+	first := -1
+	messages := make([]OpenAIChatMessage, 0, len(r.Messages))
+	for _, message := range r.Messages {
+		text, ok := systemText(message)
+		if !ok {
+			messages = append(messages, message)
+			continue
+		}
+		if first < 0 {
+			first = len(messages)
+			messages = append(messages, OpenAIChatMessage{Role: "system"})
+		}
+		texts = append(texts, text)
+	}
+	if first < 0 {
+		return
+	}
+	messages[first].Content = strings.Join(texts, "\n\n")
+	r.Messages = messages
+}
+
+func (r *OpenAIChatCompletionRequest) systemMessageStats() SystemMessageStats {
+	var stats SystemMessageStats
+	for _, message := range r.Messages {
+		if text, ok := systemText(message); ok {
+			stats.Count++
+			stats.Lengths = append(stats.Lengths, utf8.RuneCountInString(text))
+		}
+	}
+	return stats
+}
+
+// systemText 纯文本系统消息的内容(兼容字符串与数组格式),包含图片等非文本内容时返回 false
+func systemText(message OpenAIChatMessage) (string, bool) {
+	if message.Role != "system" {
+		return "", false
+	}
+	switch content := message.Content.(type) {
+	case string:
+		return content, true
+	case []interface{}:
+		var texts []string
+		for _, item := range content {
+			contentMap, ok := item.(map[string]interface{})
+			if !ok || contentMap["type"] != "text" {
+				return "", false
+			}
+			text, _ := contentMap["text"].(string)
+			texts = append(texts, text)
+		}
+		return strings.Join(texts, "\n"), true
+	}
+	return "", false
+}
+
+// shortenText 将文本缩短到 budget 个字符以内,head_tail 保留首尾并标注省略的字符数
+func shortenText(text string, budget int, overflow string) string {
+	runes := []rune(text)
+	if len(runes) <= budget {
+		return text
+	}
+	if overflow == SystemOverflowHeadTail {
+		const marker = "\n...[%d characters omitted]...\n"
+		if keep := budget - utf8.RuneCountInString(fmt.Sprintf(marker, len(runes))); keep > 0 {
+			head := keep * 2 / 3
+			return string(runes[:head]) + fmt.Sprintf(marker, len(runes)-keep) + string(runes[len(runes)-(keep-head):])
+		}
+	}
+	return string(runes[:max(budget, 0)])
+}
+
+// AddLanguageConstraint 在最后一条user消息前插入语言约束的系统消息
+func (r *OpenAIChatCompletionRequest) AddLanguageConstraint(constraint string) {
+	message := OpenAIChatMessage{Role: "system", Content: constraint}
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			r.Messages = append(r.Messages[:i], append([]OpenAIChatMessage{message}, r.Messages[i:]...)...)
+			return
+		}
+	}
+	r.Messages = append(r.Messages, message)
+}
+
+// FilterUserMessage 仅保留最后一条 user 消息及之后的消息,keepSystem 为 true 时同时保留其之前的系统消息
+func (r *OpenAIChatCompletionRequest) FilterUserMessage(keepSystem bool) {
 	if r.Messages == nil {
 		return
 	}
@@ -79,7 +289,17 @@ func (r *OpenAIChatCompletionRequest) FilterUserMessage() {
 	// 返回最后一个role为user的元素
 	for i := len(r.Messages) - 1; i >= 0; i-- {
 		if r.Messages[i].Role == "user" {
-			r.Messages = r.Messages[i:]
+			if !keepSystem {
+				r.Messages = r.Messages[i:]
+				break
+			}
+			messages := make([]OpenAIChatMessage, 0, len(r.Messages))
+			for _, message := range r.Messages[:i] {
+				if message.Role == "system" {
+					messages = append(messages, message)
+				}
+			}
+			r.Messages = append(messages, r.Messages[i:]...)
 			break
 		}
 	}
@@ -96,6 +316,28 @@ type OpenAIError struct {
 	Code    string `json:"code"`
 }
 
+// MarshalJSON 与 OpenAI 一致,未设置的 param/code 输出为 null
+func (e OpenAIError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Param   *string `json:"param"`
+		Code    *string `json:"code"`
+	}{
+		Message: e.Message,
+		Type:    e.Type,
+		Param:   nullableString(e.Param),
+		Code:    nullableString(e.Code),
+	})
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 type OpenAIChatCompletionResponse struct {
 	ID                string         `json:"id"`
 	Object            string         `json:"object"`
@@ -104,31 +346,103 @@ type OpenAIChatCompletionResponse struct {
 	Choices           []OpenAIChoice `json:"choices"`
 	Usage             OpenAIUsage    `json:"usage"`
 	SystemFingerprint *string        `json:"system_fingerprint"`
-	Suggestions       []string       `json:"suggestions"`
+	Suggestions       []string       `json:"suggestions,omitempty"`
+	MixtureLayers     []MixtureLayer `json:"mixture_layers,omitempty"`
+	AgentSteps        []AgentStep    `json:"agent_steps,omitempty"`
+	AgentArtifacts    []string       `json:"agent_artifacts,omitempty"`
+	Attachments       []Attachment   `json:"attachments,omitempty"`
+	Markmap           *MarkmapNode   `json:"markmap,omitempty"`
+	ImageQueue        *ImageQueue    `json:"image_queue,omitempty"`
+}
+
+// ImageQueue 生图任务的排队状态
+type ImageQueue struct {
+	Position      int `json:"position,omitempty"`       // 队列位置
+	EstimatedWait int `json:"estimated_wait,omitempty"` // 预计等待时间(秒)
+}
+
+// MarkmapNode 思维导图节点
+type MarkmapNode struct {
+	Text     string         `json:"text"`
+	Children []*MarkmapNode `json:"children,omitempty"`
+}
+
+// FeedbackRequest 对一次响应的质量反馈,score 与 degraded 至少提供一项
+type FeedbackRequest struct {
+	ResponseId string `json:"response_id"`        // 响应 ID(响应体中的 id,如 chatcmpl-xxx)
+	Score      int    `json:"score,omitempty"`    // 评分 1-5
+	Degraded   bool   `json:"degraded,omitempty"` // 标记为降智
+	Comment    string `json:"comment,omitempty"`
+}
+
+// ChatCompletionPage 暂存的非流式响应按字符分页的一页,结束原因与用量仅在最后一页返回
+type ChatCompletionPage struct {
+	ID           string       `json:"id"` // 请求 ID
+	Object       string       `json:"object"`
+	Created      int64        `json:"created"`
+	Model        string       `json:"model"`
+	Offset       int          `json:"offset"`
+	Total        int          `json:"total"` // 内容总字符数
+	HasMore      bool         `json:"has_more"`
+	NextOffset   *int         `json:"next_offset,omitempty"`
+	Content      string       `json:"content"`
+	FinishReason *string      `json:"finish_reason,omitempty"`
+	Usage        *OpenAIUsage `json:"usage,omitempty"`
+}
+
+// AgentStep agent 工作流中的一个步骤事件(如网页浏览、工具调用)
+type AgentStep struct {
+	Type    string `json:"type"`
+	Content string `json:"content,omitempty"`
+}
+
+// Attachment agent 产出的文件,Url 为经 /files 代理的临时下载链接
+type Attachment struct {
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	MimeType  string `json:"mime_type"`
+	Size      int64  `json:"size,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
 }
 
+// MixtureLayer 多模型混合某一层中某个模型的中间答案
+type MixtureLayer struct {
+	Layer   int    `json:"layer"`
+	Model   string `json:"model"`
+	Content string `json:"content"`
+}
+
+// OpenAIChoice 非流式响应(chat.completion)仅包含 message,流式响应块(chat.completion.chunk)仅包含 delta
 type OpenAIChoice struct {
-	Index        int           `json:"index"`
-	Message      OpenAIMessage `json:"message"`
-	LogProbs     *string       `json:"logprobs"`
-	FinishReason *string       `json:"finish_reason"`
-	Delta        OpenAIDelta   `json:"delta"`
+	Index        int            `json:"index"`
+	Message      *OpenAIMessage `json:"message,omitempty"`
+	LogProbs     *string        `json:"logprobs"`
+	FinishReason *string        `json:"finish_reason"`
+	Delta        *OpenAIDelta   `json:"delta,omitempty"`
 }
 
 type OpenAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Refusal   *string          `json:"refusal"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
 }
 
 type OpenAIUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int                       `json:"prompt_tokens"`
+	CompletionTokens    int                       `json:"completion_tokens"`
+	TotalTokens         int                       `json:"total_tokens"`
+	PromptTokensDetails OpenAIPromptTokensDetails `json:"prompt_tokens_details"`
+}
+
+type OpenAIPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
 }
 
 type OpenAIDelta struct {
-	Content string `json:"content"`
-	Role    string `json:"role"`
+	Content   string           `json:"content"`
+	Role      string           `json:"role,omitempty"`
+	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
 }
 
 type OpenAIImagesGenerationRequest struct {
@@ -137,16 +451,32 @@ type OpenAIImagesGenerationRequest struct {
 	Prompt         string `json:"prompt"`
 	ResponseFormat string `json:"response_format"`
 	Image          string `json:"image"`
+	EnhancePrompt  bool   `json:"enhance_prompt"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	HD             bool   `json:"hd,omitempty"`
+	Style          string `json:"style,omitempty"`
 }
 
 type VideosGenerationRequest struct {
-	ResponseFormat string `json:"response_format"`
-	Model          string `json:"model"`
-	AspectRatio    string `json:"aspect_ratio"`
-	Duration       int    `json:"duration"`
-	Prompt         string `json:"prompt"`
-	AutoPrompt     bool   `json:"auto_prompt"`
-	Image          string `json:"image"`
+	ResponseFormat string   `json:"response_format"`
+	Model          string   `json:"model"`
+	AspectRatio    string   `json:"aspect_ratio"`
+	Duration       int      `json:"duration"`
+	Prompt         string   `json:"prompt"`
+	AutoPrompt     bool     `json:"auto_prompt"`
+	Image          string   `json:"image"`
+	Images         []string `json:"images"` // 多张参考图/首尾帧,URL 与 base64 可混用,与 image 同时传入时 image 排在最前
+}
+
+// GetImages 获取请求中的全部图片
+func (r *VideosGenerationRequest) GetImages() []string {
+	var images []string
+	for _, image := range append([]string{r.Image}, r.Images...) {
+		if image = strings.TrimSpace(image); image != "" {
+			images = append(images, image)
+		}
+	}
+	return images
 }
 
 type VideosGenerationResponse struct {
@@ -171,6 +501,8 @@ type OpenAIImagesGenerationDataResponse struct {
 	URL           string `json:"url"`
 	RevisedPrompt string `json:"revised_prompt"`
 	B64Json       string `json:"b64_json"`
+	// 任务失败时的占位项,URL 与 B64Json 为空
+	Error *OpenAIError `json:"error,omitempty"`
 }
 
 type OpenAIGPT4VImagesReq struct {
@@ -200,10 +532,10 @@ type OpenAIModerationResponse struct {
 }
 
 type OpenaiModelResponse struct {
-	ID     string `json:"id"`
-	Object string `json:"object"`
-	//Created time.Time `json:"created"`
-	//OwnedBy string    `json:"owned_by"`
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
 }
 
 // ModelList represents a list of models.
@@ -227,3 +559,91 @@ func (r *OpenAIChatCompletionRequest) GetUserContent() []string {
 
 	return userContent
 }
+
+type ModelCapabilities struct {
+	Vision          bool `json:"vision"`
+	ToolUse         bool `json:"tool_use"`
+	WebSearch       bool `json:"web_search"`
+	FileUpload      bool `json:"file_upload"`
+	ImageGeneration bool `json:"image_generation"`
+	VideoGeneration bool `json:"video_generation"`
+}
+
+type ModelMetadataResponse struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	Created      int64             `json:"created"`
+	OwnedBy      string            `json:"owned_by"`
+	Type         string            `json:"type"`
+	Capabilities ModelCapabilities `json:"capabilities"`
+}
+
+type ModelMetadataListResponse struct {
+	Object string                  `json:"object"`
+	Data   []ModelMetadataResponse `json:"data"`
+}
+
+// GetUserImageUrl 获取最后一条 user 消息中的第一张图片
+func (r *OpenAIChatCompletionRequest) GetUserImageUrl() string {
+	if urls := r.GetUserImageUrls(); len(urls) > 0 {
+		return urls[0]
+	}
+	return ""
+}
+
+// GetUserImageUrls 获取最后一条 user 消息中的全部图片链接
+func (r *OpenAIChatCompletionRequest) GetUserImageUrls() []string {
+	var urls []string
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role != "user" {
+			continue
+		}
+		if contentArray, ok := r.Messages[i].Content.([]interface{}); ok {
+			for _, content := range contentArray {
+				contentMap, ok := content.(map[string]interface{})
+				if !ok || contentMap["type"] != "image_url" {
+					continue
+				}
+				if imageMap, ok := contentMap["image_url"].(map[string]interface{}); ok {
+					if url, ok := imageMap["url"].(string); ok && url != "" {
+						urls = append(urls, url)
+					}
+				}
+			}
+		}
+		break
+	}
+	return urls
+}
+
+// GetUserText 获取最后一条 user 消息中的文本(兼容字符串与数组格式)
+func (r *OpenAIChatCompletionRequest) GetUserText() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role != "user" {
+			continue
+		}
+		switch contentObj := r.Messages[i].Content.(type) {
+		case string:
+			return contentObj
+		case []interface{}:
+			var texts []string
+			for _, content := range contentObj {
+				if contentMap, ok := content.(map[string]interface{}); ok && contentMap["type"] == "text" {
+					if text, ok := contentMap["text"].(string); ok {
+						texts = append(texts, text)
+					}
+				}
+			}
+			return strings.Join(texts, "\n")
+		}
+		break
+	}
+	return ""
+}
+
+// UpstreamAttempt 一次上游请求尝试,Cookie 为 cookie 在池中的序号(从 1 开始)
+type UpstreamAttempt struct {
+	Cookie     int    `json:"cookie"`
+	Category   string `json:"category"`
+	DurationMs int64  `json:"duration_ms"`
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestSchemaConsistency 校验错误与模型列表响应与 OpenAI 官方 schema 的字段一致
+func TestSchemaConsistency(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]interface{}
+	}{
+		{
+			name:  "error without param and code",
+			value: OpenAIErrorResponse{OpenAIError: OpenAIError{Message: "bad request", Type: "invalid_request_error"}},
+			want: map[string]interface{}{
+				"error": map[string]interface{}{
+					"message": "bad request",
+					"type":    "invalid_request_error",
+					"param":   nil,
+					"code":    nil,
+				},
+			},
+		},
+		{
+			name:  "error with param and code",
+			value: OpenAIErrorResponse{OpenAIError: OpenAIError{Message: "no such model", Type: "invalid_request_error", Param: "model", Code: "model_not_found"}},
+			want: map[string]interface{}{
+				"error": map[string]interface{}{
+					"message": "no such model",
+					"type":    "invalid_request_error",
+					"param":   "model",
+					"code":    "model_not_found",
+				},
+			},
+		},
+		{
+			name: "model list",
+			value: OpenaiModelListResponse{
+				Object: "list",
+				Data:   []OpenaiModelResponse{{ID: "gpt-4o", Object: "model", Created: 1700000000, OwnedBy: "genspark"}},
+			},
+			want: map[string]interface{}{
+				"object": "list",
+				"data": []interface{}{
+					map[string]interface{}{
+						"id":       "gpt-4o",
+						"object":   "model",
+						"created":  float64(1700000000),
+						"owned_by": "genspark",
+					},
+				},
+			},
+		},
+		{
+			name:  "delta without role",
+			value: OpenAIDelta{Content: "hi"},
+			want:  map[string]interface{}{"content": "hi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %v", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package model
+
+type ThreadCreateRequest struct {
+	Messages []ThreadMessageRequest `json:"messages"`
+	Metadata map[string]string      `json:"metadata"`
+}
+
+type ThreadMessageRequest struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
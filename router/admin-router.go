@@ -0,0 +1,59 @@
+package router
+
+import (
+	"fmt"
+	"genspark2api/common/config"
+	logger "genspark2api/common/loggger"
+	"genspark2api/controller"
+	"genspark2api/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func SetAdminRouter(router *gin.Engine) {
+	// 未配置 API_SECRET 与 OIDC 时管理接口无法鉴权,不挂载
+	if config.ApiSecret == "" && !config.OidcEnabled() {
+		logger.SysLog("API_SECRET and OIDC are not configured, admin API is disabled")
+		return
+	}
+
+	// OIDC 登录入口无需鉴权
+	oidcRouter := router.Group(fmt.Sprintf("%s/admin/oidc", ProcessPath(config.RoutePrefix)))
+	oidcRouter.GET("/login", controller.OidcLogin)
+	oidcRouter.GET("/callback", controller.OidcCallback)
+
+	adminRouter := router.Group(fmt.Sprintf("%s/admin", ProcessPath(config.RoutePrefix)))
+	adminRouter.Use(middleware.Auth(), middleware.AdminHistory())
+	adminRouter.GET("/health", controller.HealthDetail)
+	adminRouter.GET("/history", controller.GetAdminHistory)
+	adminRouter.GET("/ip-rules", controller.GetIpRules)
+	adminRouter.POST("/ip-rules", controller.AddIpRule)
+	adminRouter.DELETE("/ip-rules/:id", controller.DeleteIpRule)
+	adminRouter.GET("/diagnose", controller.Diagnose)
+	adminRouter.GET("/connections", controller.GetConnectionStats)
+	adminRouter.GET("/metrics", controller.GetMetrics)
+	adminRouter.GET("/logs", controller.GetLogs)
+	adminRouter.GET("/degrade", controller.GetDegradeStats)
+	adminRouter.GET("/ttfb", controller.GetTTFBStats)
+	adminRouter.GET("/request-size", controller.GetRequestSizeStats)
+	adminRouter.GET("/shadow-parser", controller.GetShadowParserStats)
+	adminRouter.GET("/recaptcha", controller.GetRecaptchaStats)
+	adminRouter.GET("/egress", controller.GetEgressNodes)
+	adminRouter.POST("/egress/probe", controller.ProbeEgressNodes)
+	adminRouter.GET("/fingerprints", controller.GetFingerprints)
+	adminRouter.POST("/fingerprints/classify", controller.ClassifyFingerprint)
+	adminRouter.GET("/cors", controller.GetCorsConfig)
+	adminRouter.PUT("/cors", controller.UpdateCorsConfig)
+	adminRouter.GET("/config", controller.GetRuntimeConfig)
+	adminRouter.PUT("/config", controller.UpdateRuntimeConfig)
+	adminRouter.GET("/flags", controller.GetFeatureFlags)
+	adminRouter.PUT("/flags/:key", controller.UpdateFeatureFlag)
+	adminRouter.DELETE("/flags/:key", controller.ResetFeatureFlag)
+	adminRouter.GET("/presets", controller.GetPresets)
+	adminRouter.PUT("/presets/:name", controller.SetPreset)
+	adminRouter.DELETE("/presets/:name", controller.DeletePreset)
+	// 模型ID可能包含 /,探测接口为 POST /experimental-models/{id}/probe
+	adminRouter.GET("/experimental-models", controller.GetExperimentalModels)
+	adminRouter.PUT("/experimental-models/*id", controller.SetExperimentalModel)
+	adminRouter.POST("/experimental-models/*id", controller.ProbeExperimentalModel)
+	adminRouter.DELETE("/experimental-models/*id", controller.DeleteExperimentalModel)
+}
@@ -13,18 +13,51 @@ func SetApiRouter(router *gin.Engine) {
 	router.Use(middleware.CORS())
 	//router.Use(gzip.Gzip(gzip.DefaultCompression))
 	router.Use(middleware.IPBlacklistMiddleware())
+	router.Use(middleware.AbuseGuard())
 	router.Use(middleware.RequestRateLimit())
 
 	router.GET("/")
+	router.GET(fmt.Sprintf("%s/health", ProcessPath(config.RoutePrefix)), controller.Health)
+	router.GET(fmt.Sprintf("%s/.well-known/ai-plugin.json", ProcessPath(config.RoutePrefix)), controller.PluginManifest)
+	// agent 产出文件的临时下载链接本身即凭证,供浏览器直接打开
+	router.GET(fmt.Sprintf("%s/files/:id", ProcessPath(config.RoutePrefix)), controller.DownloadFile)
 
 	//router.GET("/api/init/model/chat/map", controller.InitModelChatMap)
 	//https://api.openai.com/v1/images/generations
+	// 浏览器直连的预检与健康探测无需鉴权,注册在 v1Router 之外
+	router.OPTIONS(fmt.Sprintf("%s/v1/*path", ProcessPath(config.RoutePrefix)), controller.Options)
+	router.HEAD(fmt.Sprintf("%s/v1/models", ProcessPath(config.RoutePrefix)), controller.HeadOk)
+
 	v1Router := router.Group(fmt.Sprintf("%s/v1", ProcessPath(config.RoutePrefix)))
 	v1Router.Use(middleware.OpenAIAuth())
+	v1Router.Use(middleware.TenantAudit())
+	v1Router.Use(middleware.TenantRateLimit())
+	v1Router.Use(middleware.Canary())
+	v1Router.Use(middleware.Idempotency())
+	v1Router.Use(middleware.Metrics())
+	v1Router.Use(middleware.Events())
+	v1Router.Use(middleware.ETag())
 	v1Router.POST("/chat/completions", controller.ChatForOpenAI)
+	v1Router.GET("/chat/ws", controller.ChatForOpenAIWebSocket)
+	v1Router.POST("/messages", controller.MessagesForAnthropic)
 	v1Router.POST("/images/generations", controller.ImagesForOpenAI)
 	v1Router.POST("/videos/generations", controller.VideosForOpenAI)
+	v1Router.DELETE("/images/tasks/:id", controller.CancelImageTask)
+	v1Router.DELETE("/videos/tasks/:id", controller.CancelVideoTask)
 	v1Router.GET("/models", controller.OpenaiModels)
+	// 模型ID可能包含 /,/models/metadata 由 OpenaiModel 分发
+	v1Router.GET("/models/*id", controller.OpenaiModel)
+	v1Router.POST("/batch", controller.BatchForOpenAI)
+	v1Router.GET("/batch/:id", controller.GetBatch)
+	v1Router.GET("/batch/:id/results", controller.GetBatchResults)
+	v1Router.GET("/responses/:id", controller.GetResponsePage)
+	v1Router.POST("/feedback", controller.Feedback)
+	v1Router.POST("/threads", controller.CreateThread)
+	v1Router.GET("/threads/:id", controller.GetThread)
+	v1Router.DELETE("/threads/:id", controller.DeleteThread)
+	v1Router.GET("/threads/:id/messages", controller.GetThreadMessages)
+	v1Router.POST("/threads/:id/messages", controller.CreateThreadMessage)
+	v1Router.POST("/threads/:id/runs", controller.CreateThreadRun)
 }
 
 func ProcessPath(path string) string {
@@ -6,4 +6,5 @@ import (
 
 func SetRouter(router *gin.Engine) {
 	SetApiRouter(router)
+	SetAdminRouter(router)
 }